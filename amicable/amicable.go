@@ -26,6 +26,9 @@ import (
 	"errors"
 	"fmt"
 	"math"
+	"reflect"
+	"unicode/utf8"
+
 	"github.com/cursork/gritt/codec"
 )
 
@@ -96,6 +99,16 @@ func Unmarshal(data []byte) (any, error) {
 	return r.readArray()
 }
 
+// UnmarshalInto deserializes a 220⌶ byte vector into the value pointed
+// to by v, using the same rules (and `apl` struct tags) as codec.Decode.
+func UnmarshalInto(data []byte, v any) error {
+	val, err := Unmarshal(data)
+	if err != nil {
+		return err
+	}
+	return codec.Decode(val, v)
+}
+
 // unmarshalNamespace parses a Raw namespace blob into *codec.Namespace.
 // Extracts member values directly from the blob as typed Go values.
 //
@@ -628,6 +641,8 @@ func validTypeCode(tc byte) bool {
 
 // Marshal serializes a Go value into 220⌶ format (64-bit little-endian).
 // Raw values are returned as-is (they already contain the full serialized form).
+// Other Go values are converted with codec.Encode; namespaces (and so
+// structs and maps) are not yet supported.
 func Marshal(v any) ([]byte, error) {
 	if raw, ok := v.(Raw); ok {
 		out := make([]byte, len(raw))
@@ -1058,8 +1073,20 @@ func (w *writer) writeArray(v any) error {
 	case *codec.Array:
 		return w.writeShapedArray(val)
 
-	default:
+	case *codec.Namespace, Raw, codec.Raw, codec.FnSource:
 		return fmt.Errorf("amicable: unsupported type %T", v)
+
+	default:
+		// Go structs, slices, maps and other numeric types go through
+		// the codec reflection layer first.
+		enc, err := codec.Encode(v)
+		if err != nil {
+			return fmt.Errorf("amicable: %w", err)
+		}
+		if reflect.TypeOf(enc) == reflect.TypeOf(v) {
+			return fmt.Errorf("amicable: unsupported type %T", v)
+		}
+		return w.writeArray(enc)
 	}
 }
 
@@ -1483,7 +1510,8 @@ func homogeneousType(vals []any) (byte, bool) {
 				return 0, false
 			}
 		case string:
-			if baseType != typeChar8 {
+			// Only character scalars; longer strings make a nested array.
+			if baseType != typeChar8 || utf8.RuneCountInString(vv) != 1 {
 				return 0, false
 			}
 			for _, r := range vv {
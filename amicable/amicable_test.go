@@ -1061,3 +1061,31 @@ func assertFloat(t *testing.T, got any, want float64) {
 		t.Fatalf("got %v, want %v", f, want)
 	}
 }
+
+func TestMarshalGoValues(t *testing.T) {
+	grid := [][]int16{{1, 2, 3}, {4, 5, 6}}
+	data, err := Marshal(grid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got [][]int
+	if err := UnmarshalInto(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got[1][2] != 6 {
+		t.Errorf("round trip = %v", got)
+	}
+
+	var words []string
+	data, err = Marshal([]string{"ab", "c"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := UnmarshalInto(data, &words); err != nil || len(words) != 2 || words[0] != "ab" {
+		t.Errorf("strings = %q, %v", words, err)
+	}
+
+	if _, err := Marshal(struct{ X int }{1}); err == nil {
+		t.Error("expected error: namespaces are not supported")
+	}
+}
@@ -89,7 +89,6 @@ func (a *APLcart) Render(w, h int) string {
 
 	// Entries list
 	selectedStyle := lipgloss.NewStyle().Background(AccentColor).Foreground(lipgloss.Color("0"))
-	syntaxStyle := lipgloss.NewStyle().Foreground(AccentColor).Bold(true)
 	descStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("250"))
 
 	listH := h - 2
@@ -117,7 +116,7 @@ func (a *APLcart) Render(w, h int) string {
 		if i == a.selected {
 			sb.WriteString(selectedStyle.Render(syntax) + " " + descStyle.Render(desc))
 		} else {
-			sb.WriteString(syntaxStyle.Render(syntax) + " " + descStyle.Render(desc))
+			sb.WriteString(highlight(syntax) + " " + descStyle.Render(desc))
 		}
 
 		if i < len(a.filtered)-1 && i < a.scroll+listH-1 {
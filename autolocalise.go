@@ -6,6 +6,8 @@ import (
 	"strings"
 	"unicode"
 	"unicode/utf8"
+
+	"github.com/cursork/gritt/syntax"
 )
 
 // findAssignedVars scans function body lines for assignment targets.
@@ -44,16 +46,8 @@ func findAssignedVars(lines []string) []string {
 // stripComment removes the comment portion of an APL line (from ⍝ onward),
 // respecting string literals delimited by single quotes.
 func stripComment(line string) string {
-	inString := false
-	runes := []rune(line)
-	for i, r := range runes {
-		if r == '\'' {
-			inString = !inString
-		} else if r == '⍝' && !inString {
-			return string(runes[:i])
-		}
-	}
-	return line
+	code, _ := syntax.SplitComment(line)
+	return code
 }
 
 // findAssignments finds name← patterns in a line of code and adds names to the set.
@@ -156,16 +150,10 @@ func extractForVars(code string) []string {
 	return nil
 }
 
-// isIdentRune returns true if the rune can be part of an APL identifier.
+// isIdentRune returns true if the rune can be part of an APL identifier,
+// including system names (⎕name) and ⍺/⍵.
 func isIdentRune(r rune) bool {
-	if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' {
-		return true
-	}
-	// APL special characters that can start identifiers
-	if r == '⎕' || r == '⍺' || r == '⍵' || r == '∆' || r == '⍙' {
-		return true
-	}
-	return false
+	return syntax.IsNameRune(r) || r == '⎕' || r == '⍺' || r == '⍵'
 }
 
 // isValidVarName returns true if the string is a valid APL variable name
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss/v2"
+)
+
+// breakpointFields are the BreakpointPane's inputs, in order
+var breakpointFields = []string{"condition", "hit count", "log"}
+
+// BreakpointPane edits the condition, hit count and log message of a stop
+// line. Leaving them all empty makes it a plain stop.
+//
+// Like the workspace pane it talks to the model through Pending fields:
+// ⏎ sets PendingSave for the model to apply.
+type BreakpointPane struct {
+	Fn     string // Function the line is in
+	Line   int
+	Token  int    // Window the pane was opened from
+	PaneID string // That window's pane, to refocus
+
+	values [3][]rune
+	field  int
+	cursor int
+	status string
+
+	PendingSave bool
+
+	// Styles
+	labelStyle  lipgloss.Style
+	statusStyle lipgloss.Style
+}
+
+// NewBreakpointPane creates a pane editing bp (nil for a plain stop) on
+// fn's line.
+func NewBreakpointPane(fn string, line int, bp *Breakpoint) *BreakpointPane {
+	p := &BreakpointPane{
+		Fn:          fn,
+		Line:        line,
+		labelStyle:  lipgloss.NewStyle().Foreground(lipgloss.Color("243")),
+		statusStyle: lipgloss.NewStyle().Foreground(lipgloss.Color("245")),
+	}
+	if bp != nil {
+		p.values[0] = []rune(bp.Cond)
+		if bp.Hits > 0 {
+			p.values[1] = []rune(strconv.Itoa(bp.Hits))
+		}
+		p.values[2] = []rune(bp.Log)
+	}
+	p.cursor = len(p.values[0])
+	return p
+}
+
+// Breakpoint returns the breakpoint as entered
+func (p *BreakpointPane) Breakpoint() *Breakpoint {
+	hits, _ := strconv.Atoi(string(p.values[1]))
+	return &Breakpoint{
+		Cond: strings.TrimSpace(string(p.values[0])),
+		Hits: hits,
+		Log:  strings.TrimSpace(string(p.values[2])),
+	}
+}
+
+func (p *BreakpointPane) Title() string {
+	return fmt.Sprintf("breakpoint %s[%d]", p.Fn, p.Line)
+}
+
+func (p *BreakpointPane) Render(w, h int) string {
+	var lines []string
+	for i, name := range breakpointFields {
+		text := string(p.values[i])
+		if i == p.field {
+			text = string(p.values[i][:p.cursor]) + "█" + string(p.values[i][p.cursor:])
+		}
+		text, _ = fitLine(text, "", w-10)
+		lines = append(lines, p.labelStyle.Render(fmt.Sprintf("%-10s", name))+text)
+	}
+	for len(lines) < h-1 {
+		lines = append(lines, "")
+	}
+	footer := p.status
+	if footer == "" {
+		footer = "↑↓ field  ⏎ set  {expr} in log  esc cancel"
+	}
+	footer, _ = fitLine(footer, "", w)
+	lines = append(lines[:max(h-1, 0)], p.statusStyle.Render(footer))
+	return strings.Join(lines, "\n")
+}
+
+func (p *BreakpointPane) HandleKey(msg tea.KeyMsg) bool {
+	p.status = ""
+	buf := p.values[p.field]
+	switch msg.Type {
+	case tea.KeyEnter:
+		p.PendingSave = true
+	case tea.KeyUp, tea.KeyShiftTab:
+		p.field = (p.field + len(breakpointFields) - 1) % len(breakpointFields)
+		p.cursor = len(p.values[p.field])
+	case tea.KeyDown, tea.KeyTab:
+		p.field = (p.field + 1) % len(breakpointFields)
+		p.cursor = len(p.values[p.field])
+	case tea.KeyBackspace:
+		if p.cursor > 0 {
+			p.values[p.field] = append(buf[:p.cursor-1], buf[p.cursor:]...)
+			p.cursor--
+		}
+	case tea.KeyLeft:
+		if p.cursor > 0 {
+			p.cursor--
+		}
+	case tea.KeyRight:
+		if p.cursor < len(buf) {
+			p.cursor++
+		}
+	case tea.KeyHome:
+		p.cursor = 0
+	case tea.KeyEnd:
+		p.cursor = len(buf)
+	case tea.KeySpace:
+		p.insert([]rune{' '})
+	case tea.KeyRunes:
+		p.insert(msg.Runes)
+	}
+	return true
+}
+
+func (p *BreakpointPane) insert(runes []rune) {
+	if p.field == 1 {
+		for _, r := range runes {
+			if r < '0' || r > '9' {
+				p.status = "hit count is a number"
+				return
+			}
+		}
+	}
+	buf := p.values[p.field]
+	p.values[p.field] = append(buf[:p.cursor], append(runes, buf[p.cursor:]...)...)
+	p.cursor += len(runes)
+}
+
+func (p *BreakpointPane) HandleMouse(x, y int, msg tea.MouseMsg) bool {
+	if msg.Button == tea.MouseButtonLeft && msg.Action == tea.MouseActionPress {
+		if y >= 0 && y < len(breakpointFields) {
+			p.field = y
+			p.cursor = len(p.values[y])
+		}
+		return true
+	}
+	return false
+}
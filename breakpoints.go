@@ -0,0 +1,193 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Breakpoint is what gritt adds to a stop line: the interpreter stops
+// there as usual, and gritt then decides whether the stop stands or runs
+// on.
+type Breakpoint struct {
+	Cond string // APL expression; the stop stands only when it gives 1
+	Hits int    // The stop stands from this hit on; 0 for every hit
+	Log  string // Written to the session instead of stopping; {expr} is replaced by expr's value
+
+	count int // Hits so far
+}
+
+// plain is true for a breakpoint with nothing added
+func (b *Breakpoint) plain() bool {
+	return b.Cond == "" && b.Hits <= 0 && b.Log == ""
+}
+
+// exprs returns the expressions to evaluate at a stop: the condition,
+// then those in the log message.
+func (b *Breakpoint) exprs() []string {
+	var exprs []string
+	if b.Cond != "" {
+		exprs = append(exprs, b.Cond)
+	}
+	return append(exprs, b.logExprs()...)
+}
+
+// decide works out what a stop in window win comes to, given the values
+// of exprs. A condition that fails or doesn't give a boolean stops, with
+// a note.
+func (b *Breakpoint) decide(win int, values map[string]string) *breakpointVerdict {
+	v := &breakpointVerdict{win: win}
+	if b.Cond != "" {
+		switch c := strings.TrimSpace(values[b.Cond]); c {
+		case "1":
+		case "0":
+			return v
+		default:
+			v.stop = true
+			v.lines = []string{fmt.Sprintf("⍝ breakpoint condition %s gave %s", b.Cond, strings.Join(strings.Fields(c), " "))}
+			return v
+		}
+	}
+	b.count++
+	if b.count < b.Hits {
+		return v
+	}
+	if b.Log != "" {
+		v.lines = []string{b.logLine(values)}
+		return v
+	}
+	v.stop = true
+	return v
+}
+
+// logExprs returns the expressions to interpolate into the log message
+func (b *Breakpoint) logExprs() []string {
+	var exprs []string
+	rest := b.Log
+	for {
+		open := strings.Index(rest, "{")
+		if open == -1 {
+			return exprs
+		}
+		end := strings.Index(rest[open:], "}")
+		if end == -1 {
+			return exprs
+		}
+		if expr := strings.TrimSpace(rest[open+1 : open+end]); expr != "" {
+			exprs = append(exprs, expr)
+		}
+		rest = rest[open+end+1:]
+	}
+}
+
+// logLine formats the log message with the values of its expressions. A
+// multi-line value is joined onto one line.
+func (b *Breakpoint) logLine(values map[string]string) string {
+	var sb strings.Builder
+	rest := b.Log
+	for {
+		open := strings.Index(rest, "{")
+		end := -1
+		if open != -1 {
+			end = strings.Index(rest[open:], "}")
+		}
+		if end == -1 {
+			sb.WriteString(rest)
+			return sb.String()
+		}
+		sb.WriteString(rest[:open])
+		expr := strings.TrimSpace(rest[open+1 : open+end])
+		if v, ok := values[expr]; ok {
+			sb.WriteString(strings.Join(strings.Fields(v), " "))
+		}
+		rest = rest[open+end+1:]
+	}
+}
+
+// String describes the breakpoint for its pane and the log
+func (b *Breakpoint) String() string {
+	var parts []string
+	if b.Cond != "" {
+		parts = append(parts, "if "+b.Cond)
+	}
+	if b.Hits > 0 {
+		parts = append(parts, fmt.Sprintf("from hit %d", b.Hits))
+	}
+	if b.Log != "" {
+		parts = append(parts, "log "+b.Log)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// Breakpoints holds the conditions, hit counts and log messages set on
+// stop lines, by function name and line, for the whole session: tracer
+// windows come and go but the function's stops stay.
+//
+// It is shared by pointer, so the tracer's key callbacks, which close over
+// an old copy of the model, can still mark a step.
+type Breakpoints struct {
+	byFn map[string]map[int]*Breakpoint
+
+	stepping bool // A step is under way, so where it stops isn't a hit
+	arrived  int  // Tracer window that has moved since the last prompt
+
+	verdict *breakpointVerdict // Waiting to be acted on
+}
+
+// breakpointVerdict is what a stop at a breakpoint came to
+type breakpointVerdict struct {
+	win   int
+	stop  bool
+	lines []string // For the session
+}
+
+// NewBreakpoints creates an empty set of breakpoints
+func NewBreakpoints() *Breakpoints {
+	return &Breakpoints{byFn: make(map[string]map[int]*Breakpoint)}
+}
+
+// Get returns the breakpoint on fn's line, or nil for none or a plain stop
+func (b *Breakpoints) Get(fn string, line int) *Breakpoint {
+	if b == nil {
+		return nil
+	}
+	return b.byFn[fn][line]
+}
+
+// Set puts bp on fn's line, or clears the line for nil or a plain bp.
+// Setting starts the hit count over.
+func (b *Breakpoints) Set(fn string, line int, bp *Breakpoint) {
+	if bp == nil || bp.plain() {
+		delete(b.byFn[fn], line)
+		return
+	}
+	if b.byFn[fn] == nil {
+		b.byFn[fn] = make(map[int]*Breakpoint)
+	}
+	bp.count = 0
+	b.byFn[fn][line] = bp
+}
+
+// Mark returns the editor's gutter mark for fn's stop line
+func (b *Breakpoints) Mark(fn string, line int) string {
+	switch bp := b.Get(fn, line); {
+	case bp == nil:
+		return "●"
+	case bp.Log != "":
+		return "◇"
+	}
+	return "◆"
+}
+
+// SetStepping notes whether a step is under way
+func (b *Breakpoints) SetStepping(on bool) {
+	if b != nil {
+		b.stepping = on
+	}
+}
+
+// Arrive notes that tracer window win has moved, unless a step moved it
+func (b *Breakpoints) Arrive(win int) {
+	if b != nil && !b.stepping {
+		b.arrived = win
+	}
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/cursork/gritt/ride"
+	"github.com/cursork/gritt/ride/ridetest"
+)
+
+func TestBreakpointDecide(t *testing.T) {
+	bp := &Breakpoint{Cond: "i>2", Hits: 2, Log: "i={i} sum={+/v}{"}
+	if got, want := bp.exprs(), []string{"i>2", "i", "+/v"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("exprs = %q, want %q", got, want)
+	}
+	tests := []struct {
+		cond  string
+		stop  bool
+		lines []string
+	}{
+		{"0", false, nil},
+		{"1", false, nil}, // first hit: below the count
+		{"1", false, []string{"i=3 sum=1 2{"}},
+		{"(error)", true, []string{"⍝ breakpoint condition i>2 gave (error)"}},
+	}
+	for i, tt := range tests {
+		v := bp.decide(7, map[string]string{"i>2": tt.cond, "i": "3", "+/v": "1\n2\n"})
+		if v.win != 7 || v.stop != tt.stop || !reflect.DeepEqual(v.lines, tt.lines) {
+			t.Errorf("%d: cond %s: %+v", i, tt.cond, v)
+		}
+	}
+
+	b := NewBreakpoints()
+	b.Set("f", 3, &Breakpoint{Log: "here"})
+	b.Set("f", 4, &Breakpoint{Cond: "x"})
+	b.Set("f", 5, &Breakpoint{})
+	for line, want := range map[int]string{3: "◇", 4: "◆", 5: "●"} {
+		if got := b.Mark("f", line); got != want {
+			t.Errorf("Mark(f, %d) = %s, want %s", line, got, want)
+		}
+	}
+	if (*Breakpoints)(nil).Mark("f", 3) != "●" {
+		t.Error("nil Breakpoints should give plain marks")
+	}
+}
+
+func TestBreakpointPane(t *testing.T) {
+	p := NewBreakpointPane("f", 2, &Breakpoint{Cond: "x"})
+	p.HandleKey(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune(">0")})
+	p.HandleKey(tea.KeyMsg{Type: tea.KeyDown})
+	p.HandleKey(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("x")})
+	if !strings.Contains(p.status, "number") {
+		t.Errorf("status %q", p.status)
+	}
+	p.HandleKey(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("10")})
+	p.HandleKey(tea.KeyMsg{Type: tea.KeyTab})
+	p.HandleKey(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("x is")})
+	p.HandleKey(tea.KeyMsg{Type: tea.KeySpace})
+	p.HandleKey(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("{x}")})
+	p.HandleKey(tea.KeyMsg{Type: tea.KeyEnter})
+	if !p.PendingSave {
+		t.Error("Enter should set PendingSave")
+	}
+	got := p.Breakpoint()
+	if got.Cond != "x>0" || got.Hits != 10 || got.Log != "x is {x}" {
+		t.Errorf("Breakpoint() = %+v", got)
+	}
+	out := stripANSI(p.Render(40, 6))
+	for _, want := range []string{"condition x>0", "hit count 10", "log       x is {x}█"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("render lacks %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestBreakpointModel(t *testing.T) {
+	client, srv := fakeInterpreter(t, func(*ride.Message) []*ride.Message { return nil })
+	m := newTestModel(t, client)
+	highlight := &ride.Message{Command: "SetHighlightLine", Args: map[string]any{"win": 1, "line": 1}}
+	answer := func(values string) {
+		t.Helper()
+		m.recv(ridetest.Prompt(0))
+		m.recv(ridetest.Output(2, values))
+		m.recv(ridetest.Prompt(1))
+	}
+	lastLine := func() string { return m.lines[len(m.lines)-1].Text }
+
+	// The condition is evaluated before the stop is shown, and a false one
+	// runs on
+	m.breakpoints.Set("f", 1, &Breakpoint{Cond: "y>2"})
+	m.recv(ridetest.Prompt(0))
+	m.recv(&ride.Message{Command: "OpenWindow", Args: map[string]any{
+		"token": 1, "name": "f", "debugger": 1, "text": []string{"r←f y", "r←1+y"}, "currentRow": 1, "stop": []int{1},
+	}})
+	m.recv(ridetest.Prompt(1))
+	if !strings.Contains(m.internalQuery, "⎕EA'y>2'") || len(m.lines) != 0 {
+		t.Fatalf("query %q, lines %v", m.internalQuery, m.lines)
+	}
+	answer("⍝GRITT 0\n0\n")
+	if m.ready || len(m.lines) != 0 {
+		t.Errorf("false condition: ready %v, lines %v", m.ready, m.lines)
+	}
+
+	// A true one stops as usual
+	m.recv(highlight)
+	m.recv(ridetest.Prompt(1))
+	answer("⍝GRITT 0\n1\n")
+	if !m.ready || lastLine() != aplIndent {
+		t.Errorf("true condition: ready %v, lines %v", m.ready, m.lines)
+	}
+
+	// A logpoint writes its message to the session and runs on
+	m.breakpoints.Set("f", 1, &Breakpoint{Log: "y is {y}"})
+	m.recv(ridetest.Prompt(0))
+	m.recv(highlight)
+	m.recv(ridetest.Prompt(1))
+	answer("⍝GRITT 0\n3\n")
+	if m.ready || lastLine() != "y is 3" {
+		t.Errorf("logpoint: ready %v, lines %v", m.ready, m.lines)
+	}
+
+	// Stepping onto the line isn't a hit
+	m.tracerStepOver()
+	m.recv(highlight)
+	m.recv(ridetest.Prompt(1))
+	if m.internalQuery != "" || lastLine() != aplIndent {
+		t.Errorf("step: query %q, lines %v", m.internalQuery, m.lines)
+	}
+
+	var continues int
+	for _, msg := range waitReceived(srv, 6) {
+		if msg.Command == "Continue" {
+			continues++
+		}
+	}
+	if continues != 2 {
+		t.Errorf("sent %d Continues, want 2", continues)
+	}
+}
+
+func TestBreakpointEdit(t *testing.T) {
+	client, srv := fakeInterpreter(t, func(*ride.Message) []*ride.Message { return nil })
+	m := newTestModel(t, client)
+	m.recv(&ride.Message{Command: "OpenWindow", Args: map[string]any{
+		"token": 1, "name": "f", "debugger": 1, "text": []string{"r←f y", "r←1+y"}, "currentRow": 1,
+	}})
+	m.editors[1].CursorRow = 1
+
+	m.editBreakpoint()
+	for _, msg := range []tea.KeyMsg{
+		{Type: tea.KeyRunes, Runes: []rune("y>2")},
+		{Type: tea.KeyEnter},
+	} {
+		m.update(msg)
+	}
+	if m.panes.Get("breakpoint") != nil || m.panes.FocusedPane() != m.panes.Get("tracer") {
+		t.Error("breakpoint pane should close back to the tracer")
+	}
+	if bp := m.breakpoints.Get("f", 1); bp == nil || bp.Cond != "y>2" || !m.editors[1].HasStop(1) {
+		t.Errorf("breakpoint %+v, stops %v", bp, m.editors[1].Stop)
+	}
+	msgs := waitReceived(srv, 1)
+	if len(msgs) != 1 || msgs[0].Command != "SetLineAttributes" {
+		t.Errorf("sent %v", msgs)
+	}
+
+	// Removing the stop drops its condition
+	m.toggleBreakpoint()
+	if m.breakpoints.Get("f", 1) != nil {
+		t.Error("condition outlived its stop")
+	}
+}
@@ -0,0 +1,663 @@
+package codec
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Marshal returns the APLAN encoding of a Go value, on one line.
+//
+// Go types map as follows:
+//   - bool → 0 or 1
+//   - integers, floats, complex numbers → numbers
+//   - string → character vector
+//   - slices and arrays → vectors; a slice of equal-length numeric slices
+//     becomes a matrix
+//   - maps with string keys → namespaces, keys sorted
+//   - structs → namespaces, fields in declaration order
+//   - pointers and interfaces → the value they hold; nil → ⍬
+//   - codec values (*Array, *Namespace, Raw, ...) pass through
+//
+// Struct fields are named by an `apl:"name"` tag, or the field name if
+// there is none. As with encoding/json, "-" skips the field, the
+// "omitempty" option drops zero values, and embedded structs without a
+// tag have their fields promoted. A value that contains itself is an
+// error.
+func Marshal(v any) (string, error) {
+	val, err := Encode(v)
+	if err != nil {
+		return "", err
+	}
+	return Serialize(val, SerializeOptions{UseDiamond: true}), nil
+}
+
+// Unmarshal parses APLAN text and stores the result in the value pointed
+// to by v. See Decode for the conversion rules.
+func Unmarshal(text string, v any) error {
+	val, err := APLAN(text)
+	if err != nil {
+		return err
+	}
+	return Decode(val, v)
+}
+
+// Encode converts a Go value to the codec representation Serialize
+// accepts, by the rules described at Marshal. Shaped arrays hold their
+// elements in flat row-major order.
+func Encode(v any) (any, error) {
+	var e encoder
+	return e.encode(reflect.ValueOf(v), "")
+}
+
+// Decode stores a codec value (as returned by APLAN or
+// amicable.Unmarshal) in the value pointed to by v.
+//
+// Numbers convert to any numeric Go type that holds them exactly, and
+// 0/1 to bool. Vectors decode into slices and arrays, matrices and
+// higher-rank arrays into nested slices by major cell, and a scalar into
+// a one-element slice. Namespaces decode into maps with string keys or
+// structs, matching keys to `apl` tags, then field names, then field
+// names ignoring case. Unknown keys are ignored. An interface{} target
+// receives the codec value unchanged.
+func Decode(val any, v any) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() {
+		return fmt.Errorf("codec: Decode needs a non-nil pointer, got %T", v)
+	}
+	return decodeValue(val, rv.Elem(), "")
+}
+
+// --- Encoding ---
+
+var codecTypes = map[reflect.Type]bool{
+	reflect.TypeOf(&Array{}):     true,
+	reflect.TypeOf(&Namespace{}): true,
+	reflect.TypeOf(Zilde):        true,
+	reflect.TypeOf(Raw("")):      true,
+	reflect.TypeOf(FnSource("")): true,
+}
+
+// encoder holds the pointers, maps and slices being encoded, to catch a
+// value that contains itself.
+type encoder struct {
+	seen map[ref]bool
+}
+
+type ref struct {
+	ptr uintptr
+	len int
+	typ reflect.Type
+}
+
+// enter marks rv as being encoded, failing if it already is. leave undoes
+// it, so a value shared but not cyclic encodes each time it appears.
+func (e *encoder) enter(rv reflect.Value, path string) (ref, error) {
+	r := ref{ptr: rv.Pointer(), typ: rv.Type()}
+	if rv.Kind() == reflect.Slice {
+		r.len = rv.Len()
+	}
+	if e.seen[r] {
+		return r, fmt.Errorf("codec: %s: cyclic value of type %s", pathName(path), rv.Type())
+	}
+	if e.seen == nil {
+		e.seen = make(map[ref]bool)
+	}
+	e.seen[r] = true
+	return r, nil
+}
+
+func (e *encoder) leave(r ref) { delete(e.seen, r) }
+
+func (e *encoder) encode(rv reflect.Value, path string) (any, error) {
+	if !rv.IsValid() {
+		return nil, nil
+	}
+	if codecTypes[rv.Type()] {
+		return rv.Interface(), nil
+	}
+
+	switch rv.Kind() {
+	case reflect.Bool:
+		if rv.Bool() {
+			return 1, nil
+		}
+		return 0, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return int(rv.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		n := rv.Uint()
+		if n > math.MaxInt {
+			return nil, fmt.Errorf("codec: %s: %d overflows int", pathName(path), n)
+		}
+		return int(n), nil
+	case reflect.Float32, reflect.Float64:
+		return rv.Float(), nil
+	case reflect.Complex64, reflect.Complex128:
+		return rv.Complex(), nil
+	case reflect.String:
+		return rv.String(), nil
+	case reflect.Pointer, reflect.Interface:
+		if rv.IsNil() {
+			return nil, nil
+		}
+		if rv.Kind() == reflect.Pointer {
+			r, err := e.enter(rv, path)
+			if err != nil {
+				return nil, err
+			}
+			defer e.leave(r)
+		}
+		return e.encode(rv.Elem(), path)
+	case reflect.Slice, reflect.Array:
+		if rv.Kind() == reflect.Slice {
+			if rv.IsNil() {
+				return Zilde, nil
+			}
+			r, err := e.enter(rv, path)
+			if err != nil {
+				return nil, err
+			}
+			defer e.leave(r)
+		}
+		if m, ok, err := e.matrix(rv, path); ok || err != nil {
+			return m, err
+		}
+		items := make([]any, rv.Len())
+		for i := range items {
+			item, err := e.encode(rv.Index(i), fmt.Sprintf("%s[%d]", path, i))
+			if err != nil {
+				return nil, err
+			}
+			items[i] = item
+		}
+		if len(items) == 0 {
+			return Zilde, nil
+		}
+		return items, nil
+	case reflect.Map:
+		if rv.Type().Key().Kind() != reflect.String {
+			return nil, fmt.Errorf("codec: %s: map key type %s is not a string", pathName(path), rv.Type().Key())
+		}
+		if !rv.IsNil() {
+			r, err := e.enter(rv, path)
+			if err != nil {
+				return nil, err
+			}
+			defer e.leave(r)
+		}
+		ns := &Namespace{Values: make(map[string]any, rv.Len())}
+		for _, k := range rv.MapKeys() {
+			ns.Keys = append(ns.Keys, k.String())
+		}
+		sort.Strings(ns.Keys)
+		for _, k := range ns.Keys {
+			item, err := e.encode(rv.MapIndex(reflect.ValueOf(k).Convert(rv.Type().Key())), joinPath(path, k))
+			if err != nil {
+				return nil, err
+			}
+			ns.Values[k] = item
+		}
+		return ns, nil
+	case reflect.Struct:
+		ns := &Namespace{Values: make(map[string]any)}
+		for _, f := range structFields(rv.Type()) {
+			fv, ok := fieldByIndex(rv, f.index)
+			if !ok || (f.omitEmpty && fv.IsZero()) {
+				continue
+			}
+			item, err := e.encode(fv, joinPath(path, f.name))
+			if err != nil {
+				return nil, err
+			}
+			ns.Keys = append(ns.Keys, f.name)
+			ns.Values[f.name] = item
+		}
+		return ns, nil
+	}
+	return nil, fmt.Errorf("codec: %s: cannot encode %s", pathName(path), rv.Type())
+}
+
+// matrix encodes a non-empty slice of equal-length numeric slices
+// as a rank-2 *Array. ok is false if rv doesn't have that form.
+func (e *encoder) matrix(rv reflect.Value, path string) (m *Array, ok bool, err error) {
+	inner := rv.Type().Elem()
+	if (inner.Kind() != reflect.Slice && inner.Kind() != reflect.Array) || !isNumericKind(inner.Elem().Kind()) || rv.Len() == 0 {
+		return nil, false, nil
+	}
+	cols := rv.Index(0).Len()
+	for i := 1; i < rv.Len(); i++ {
+		if rv.Index(i).Len() != cols {
+			return nil, false, nil // ragged: a vector of vectors
+		}
+	}
+	data := make([]any, 0, rv.Len()*cols)
+	for i := 0; i < rv.Len(); i++ {
+		row := rv.Index(i)
+		for j := 0; j < cols; j++ {
+			item, err := e.encode(row.Index(j), fmt.Sprintf("%s[%d][%d]", path, i, j))
+			if err != nil {
+				return nil, false, err
+			}
+			data = append(data, item)
+		}
+	}
+	return &Array{Data: data, Shape: []int{rv.Len(), cols}}, true, nil
+}
+
+func isNumericKind(k reflect.Kind) bool {
+	switch k {
+	case reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64, reflect.Complex64, reflect.Complex128:
+		return true
+	}
+	return false
+}
+
+// --- Decoding ---
+
+func decodeValue(val any, rv reflect.Value, path string) error {
+	if rv.Kind() == reflect.Interface && rv.NumMethod() == 0 {
+		if val == nil {
+			rv.Set(reflect.Zero(rv.Type()))
+		} else {
+			rv.Set(reflect.ValueOf(val))
+		}
+		return nil
+	}
+	if rv.Kind() == reflect.Pointer {
+		if val == nil {
+			rv.Set(reflect.Zero(rv.Type()))
+			return nil
+		}
+		if rv.IsNil() {
+			rv.Set(reflect.New(rv.Type().Elem()))
+		}
+		return decodeValue(val, rv.Elem(), path)
+	}
+	if val == nil || isZilde(val) {
+		// ⍬ (or no value) leaves an empty collection or zero value.
+		switch rv.Kind() {
+		case reflect.Slice:
+			rv.Set(reflect.MakeSlice(rv.Type(), 0, 0))
+		default:
+			rv.Set(reflect.Zero(rv.Type()))
+		}
+		return nil
+	}
+
+	switch rv.Kind() {
+	case reflect.Bool:
+		n, ok := val.(int)
+		if !ok || (n != 0 && n != 1) {
+			return decodeError(val, rv, path)
+		}
+		rv.SetBool(n == 1)
+		return nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, ok := wholeNumber(val)
+		if !ok || rv.OverflowInt(n) {
+			return decodeError(val, rv, path)
+		}
+		rv.SetInt(n)
+		return nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		n, ok := wholeNumber(val)
+		if !ok || n < 0 || rv.OverflowUint(uint64(n)) {
+			return decodeError(val, rv, path)
+		}
+		rv.SetUint(uint64(n))
+		return nil
+	case reflect.Float32, reflect.Float64:
+		switch n := val.(type) {
+		case int:
+			rv.SetFloat(float64(n))
+		case float64:
+			rv.SetFloat(n)
+		default:
+			return decodeError(val, rv, path)
+		}
+		return nil
+	case reflect.Complex64, reflect.Complex128:
+		switch n := val.(type) {
+		case int:
+			rv.SetComplex(complex(float64(n), 0))
+		case float64:
+			rv.SetComplex(complex(n, 0))
+		case complex128:
+			rv.SetComplex(n)
+		default:
+			return decodeError(val, rv, path)
+		}
+		return nil
+	case reflect.String:
+		s, ok := charVector(val)
+		if !ok {
+			return decodeError(val, rv, path)
+		}
+		rv.SetString(s)
+		return nil
+	case reflect.Slice, reflect.Array:
+		cells, ok := majorCells(val)
+		if !ok {
+			return decodeError(val, rv, path)
+		}
+		if rv.Kind() == reflect.Slice {
+			rv.Set(reflect.MakeSlice(rv.Type(), len(cells), len(cells)))
+		} else if len(cells) > rv.Len() {
+			return fmt.Errorf("codec: %s: %d elements do not fit in %s", pathName(path), len(cells), rv.Type())
+		}
+		for i, cell := range cells {
+			if err := decodeValue(cell, rv.Index(i), fmt.Sprintf("%s[%d]", path, i)); err != nil {
+				return err
+			}
+		}
+		return nil
+	case reflect.Map:
+		ns, ok := val.(*Namespace)
+		if !ok || rv.Type().Key().Kind() != reflect.String {
+			return decodeError(val, rv, path)
+		}
+		if rv.IsNil() {
+			rv.Set(reflect.MakeMapWithSize(rv.Type(), len(ns.Keys)))
+		}
+		for _, k := range ns.Keys {
+			item := reflect.New(rv.Type().Elem()).Elem()
+			if err := decodeValue(ns.Values[k], item, joinPath(path, k)); err != nil {
+				return err
+			}
+			rv.SetMapIndex(reflect.ValueOf(k).Convert(rv.Type().Key()), item)
+		}
+		return nil
+	case reflect.Struct:
+		ns, ok := val.(*Namespace)
+		if !ok {
+			return decodeError(val, rv, path)
+		}
+		fields := structFields(rv.Type())
+		for _, k := range ns.Keys {
+			f := matchField(fields, k)
+			if f == nil {
+				continue
+			}
+			fv := fieldByIndexAlloc(rv, f.index)
+			if err := decodeValue(ns.Values[k], fv, joinPath(path, k)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return decodeError(val, rv, path)
+}
+
+// wholeNumber returns val as an int64 if it is an integer, or a float
+// with no fractional part.
+func wholeNumber(val any) (int64, bool) {
+	switch n := val.(type) {
+	case int:
+		return int64(n), true
+	case float64:
+		if n == math.Trunc(n) && n >= math.MinInt64 && n < math.MaxInt64 {
+			return int64(n), true
+		}
+	}
+	return 0, false
+}
+
+// charVector returns val as a string: a character vector or scalar, or
+// a vector of characters as amicable gives for rows of a char matrix.
+func charVector(val any) (string, bool) {
+	switch v := val.(type) {
+	case string:
+		return v, true
+	case []any:
+		var sb strings.Builder
+		for _, el := range v {
+			s, ok := el.(string)
+			if !ok || len([]rune(s)) != 1 {
+				return "", false
+			}
+			sb.WriteString(s)
+		}
+		return sb.String(), true
+	}
+	return "", false
+}
+
+// majorCells splits val into the items of a Go slice: the elements of a
+// vector, the major cells of a higher-rank array, or a scalar on its own.
+func majorCells(val any) ([]any, bool) {
+	switch v := val.(type) {
+	case []any:
+		return v, true
+	case *Array:
+		if len(v.Shape) < 2 {
+			return v.Data, true
+		}
+		// codec.APLAN nests by major cell; amicable is flat row-major.
+		if len(v.Data) == v.Shape[0] && nestedCells(v.Data, v.Shape[1]) {
+			return v.Data, true
+		}
+		size := 1
+		for _, n := range v.Shape {
+			size *= n
+		}
+		if len(v.Data) != size {
+			return nil, false
+		}
+		if size == 0 {
+			return make([]any, v.Shape[0]), true
+		}
+		return rebuildNested(v.Data, v.Shape).([]any), true
+	case *Namespace:
+		return nil, false
+	}
+	return []any{val}, true
+}
+
+func nestedCells(data []any, n int) bool {
+	for _, d := range data {
+		switch c := d.(type) {
+		case []any:
+			if len(c) != n {
+				return false
+			}
+		case string:
+			if len([]rune(c)) != n {
+				return false
+			}
+		case *Array:
+			if len(c.Shape) == 0 || c.Shape[0] != n {
+				return false
+			}
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func decodeError(val any, rv reflect.Value, path string) error {
+	return fmt.Errorf("codec: %s: cannot decode %s into %s", pathName(path), describe(val), rv.Type())
+}
+
+// describe names an APL value for error messages.
+func describe(val any) string {
+	switch v := val.(type) {
+	case int, float64:
+		return fmt.Sprintf("number %v", v)
+	case complex128:
+		return "complex number"
+	case string:
+		return "character vector"
+	case []any:
+		return "vector"
+	case *Array:
+		return fmt.Sprintf("rank-%d array", len(v.Shape))
+	case *Namespace:
+		return "namespace"
+	}
+	return fmt.Sprintf("%T", val)
+}
+
+func joinPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+func pathName(path string) string {
+	if path == "" {
+		return "value"
+	}
+	return path
+}
+
+// --- Struct fields ---
+
+type field struct {
+	name      string
+	index     []int
+	omitEmpty bool
+	tagged    bool
+}
+
+// structFields lists t's encoded fields in declaration order, promoting the
+// fields of untagged embedded structs as encoding/json does: a field hides
+// deeper ones with the same name, and of several at the same depth only a
+// lone tagged one is kept. A struct embedded in itself, through a pointer,
+// is not expanded again.
+func structFields(t reflect.Type) []field {
+	var all []field
+	walking := map[reflect.Type]bool{}
+	var walk func(t reflect.Type, index []int)
+	walk = func(t reflect.Type, index []int) {
+		walking[t] = true
+		defer delete(walking, t)
+		for i := 0; i < t.NumField(); i++ {
+			sf := t.Field(i)
+			tag := sf.Tag.Get("apl")
+			if tag == "-" {
+				continue
+			}
+			name, opts, _ := strings.Cut(tag, ",")
+			idx := append(append([]int(nil), index...), i)
+
+			if sf.Anonymous && name == "" {
+				ft := sf.Type
+				if ft.Kind() == reflect.Pointer {
+					if !sf.IsExported() {
+						continue // can't allocate through it
+					}
+					ft = ft.Elem()
+				}
+				if ft.Kind() == reflect.Struct {
+					if !walking[ft] {
+						walk(ft, idx)
+					}
+					continue
+				}
+			}
+			if !sf.IsExported() {
+				continue
+			}
+			f := field{name: name, index: idx, omitEmpty: opts == "omitempty", tagged: name != ""}
+			if name == "" {
+				f.name = sf.Name
+			}
+			all = append(all, f)
+		}
+	}
+	walk(t, nil)
+
+	byName := map[string][]int{}
+	for i, f := range all {
+		byName[f.name] = append(byName[f.name], i)
+	}
+	var fields []field
+	for i, f := range all {
+		if dominantField(all, byName[f.name]) == i {
+			fields = append(fields, f)
+		}
+	}
+	return fields
+}
+
+// dominantField picks, from the positions in all of the fields sharing a
+// name, the one that is encoded: the shallowest, or of several equally
+// shallow the only tagged one. It returns -1 if none wins.
+func dominantField(all []field, at []int) int {
+	var top []int
+	for _, i := range at {
+		switch {
+		case len(top) == 0 || len(all[i].index) < len(all[top[0]].index):
+			top = []int{i}
+		case len(all[i].index) == len(all[top[0]].index):
+			top = append(top, i)
+		}
+	}
+	if len(top) == 1 {
+		return top[0]
+	}
+	win := -1
+	for _, i := range top {
+		if all[i].tagged {
+			if win >= 0 {
+				return -1
+			}
+			win = i
+		}
+	}
+	return win
+}
+
+// matchField finds the field for a namespace key: exact name first, then
+// ignoring case.
+func matchField(fields []field, key string) *field {
+	for i := range fields {
+		if fields[i].name == key {
+			return &fields[i]
+		}
+	}
+	for i := range fields {
+		if strings.EqualFold(fields[i].name, key) {
+			return &fields[i]
+		}
+	}
+	return nil
+}
+
+// fieldByIndex is reflect.Value.FieldByIndex without panicking on nil
+// embedded pointers.
+func fieldByIndex(rv reflect.Value, index []int) (reflect.Value, bool) {
+	for i, x := range index {
+		if i > 0 && rv.Kind() == reflect.Pointer {
+			if rv.IsNil() {
+				return reflect.Value{}, false
+			}
+			rv = rv.Elem()
+		}
+		rv = rv.Field(x)
+	}
+	return rv, true
+}
+
+// fieldByIndexAlloc is like fieldByIndex but allocates nil embedded
+// pointers on the way.
+func fieldByIndexAlloc(rv reflect.Value, index []int) reflect.Value {
+	for i, x := range index {
+		if i > 0 && rv.Kind() == reflect.Pointer {
+			if rv.IsNil() {
+				rv.Set(reflect.New(rv.Type().Elem()))
+			}
+			rv = rv.Elem()
+		}
+		rv = rv.Field(x)
+	}
+	return rv
+}
@@ -0,0 +1,198 @@
+package codec
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type point struct {
+	X int `apl:"x"`
+	Y int `apl:"y"`
+}
+
+type shape struct {
+	Name   string   `apl:"name"`
+	Points []point  `apl:"points"`
+	Grid   [][]int  `apl:"grid"`
+	Scale  float64  `apl:"scale,omitempty"`
+	Closed bool     `apl:"closed"`
+	Tags   []string `apl:"tags"`
+	Note   *string  `apl:"note"`
+	Skip   string   `apl:"-"`
+	Extra  map[string]int
+	hidden int
+}
+
+type corner struct {
+	X int `apl:"x"`
+	W int `apl:"w"`
+}
+
+// Chain embeds itself: its fields must not be expanded forever.
+type Chain struct {
+	*Chain
+	V int `apl:"v"`
+}
+
+type link struct {
+	Next *link `apl:"next"`
+	V    int   `apl:"v"`
+}
+
+func TestMarshal(t *testing.T) {
+	tests := []struct {
+		in   any
+		want string
+	}{
+		{42, "42"},
+		{-3, "¯3"},
+		{true, "1"},
+		{"it's", "'it''s'"},
+		{[]int{1, 2, 3}, "1 2 3"},
+		{[]int{}, "⍬"},
+		{[]string{"ab", "cd"}, "('ab' ⋄ 'cd')"},
+		{[][]int{{1, 2}, {3, 4}}, "[1 2 ⋄ 3 4]"},
+		{[][]int{{1}, {2, 3}}, "((⋄ 1) ⋄ 2 3)"},
+		{map[string]int{"b": 2, "a": 1}, "(a: 1 ⋄ b: 2)"},
+		{point{1, 2}, "(x: 1 ⋄ y: 2)"},
+		{&point{3, 4}, "(x: 3 ⋄ y: 4)"},
+		{struct {
+			point
+			Z int `apl:"z"`
+		}{point{1, 2}, 3}, "(x: 1 ⋄ y: 2 ⋄ z: 3)"},
+		{struct {
+			A int `apl:"x"`
+			point
+			B int `apl:"b"`
+		}{9, point{1, 2}, 3}, "(x: 9 ⋄ y: 2 ⋄ b: 3)"},
+		{struct {
+			point
+			corner
+		}{point{1, 2}, corner{3, 4}}, "(y: 2 ⋄ w: 4)"},
+		{Chain{&Chain{V: 1}, 2}, "(v: 2)"},
+		{func() *link { l := &link{V: 1}; return &link{Next: l, V: 2} }(), "(next: (next: ⍬ ⋄ v: 1) ⋄ v: 2)"},
+	}
+	for _, tt := range tests {
+		got, err := Marshal(tt.in)
+		if err != nil {
+			t.Errorf("Marshal(%#v): %v", tt.in, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("Marshal(%#v) = %s, want %s", tt.in, got, tt.want)
+		}
+	}
+
+	if _, err := Marshal(map[int]int{1: 2}); err == nil {
+		t.Error("expected error for non-string map key")
+	}
+	if _, err := Marshal(struct{ F func() }{}); err == nil || !strings.Contains(err.Error(), "F") {
+		t.Errorf("expected error naming the field, got %v", err)
+	}
+
+	l := &link{V: 1}
+	l.Next = &link{Next: l, V: 2}
+	if _, err := Marshal(l); err == nil || !strings.Contains(err.Error(), "cyclic") {
+		t.Errorf("expected cyclic value error, got %v", err)
+	}
+	m := map[string]any{}
+	m["self"] = m
+	if _, err := Marshal(m); err == nil || !strings.Contains(err.Error(), "cyclic") {
+		t.Errorf("expected cyclic value error for map, got %v", err)
+	}
+}
+
+func TestStructRoundTrip(t *testing.T) {
+	note := "n"
+	in := shape{
+		Name:   "tri",
+		Points: []point{{0, 0}, {1, 0}, {0, 1}},
+		Grid:   [][]int{{1, 2, 3}, {4, 5, 6}},
+		Closed: true,
+		Tags:   []string{"a"},
+		Note:   &note,
+		Skip:   "dropped",
+		Extra:  map[string]int{"k": 7},
+		hidden: 9,
+	}
+	text, err := Marshal(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(text, "scale") || strings.Contains(text, "dropped") {
+		t.Errorf("omitempty/skipped fields encoded: %s", text)
+	}
+
+	var out shape
+	if err := Unmarshal(text, &out); err != nil {
+		t.Fatalf("Unmarshal(%s): %v", text, err)
+	}
+	in.Skip, in.hidden = "", 0
+	if !reflect.DeepEqual(in, out) {
+		t.Errorf("round trip:\n got %+v\nwant %+v", out, in)
+	}
+}
+
+func TestUnmarshal(t *testing.T) {
+	var n int
+	if err := Unmarshal("3.0", &n); err != nil || n != 3 {
+		t.Errorf("int from 3.0 = %d, %v", n, err)
+	}
+	if err := Unmarshal("3.5", &n); err == nil {
+		t.Error("expected error decoding 3.5 into int")
+	}
+	var u uint8
+	if err := Unmarshal("300", &u); err == nil {
+		t.Error("expected overflow error")
+	}
+
+	var f []float64
+	if err := Unmarshal("5", &f); err != nil || !reflect.DeepEqual(f, []float64{5}) {
+		t.Errorf("scalar into slice = %v, %v", f, err)
+	}
+	if err := Unmarshal("⍬", &f); err != nil || f == nil || len(f) != 0 {
+		t.Errorf("⍬ into slice = %#v, %v", f, err)
+	}
+
+	var rows []string
+	if err := Unmarshal("['ab' ⋄ 'cd']", &rows); err != nil || !reflect.DeepEqual(rows, []string{"ab", "cd"}) {
+		t.Errorf("char matrix into []string = %q, %v", rows, err)
+	}
+
+	var cube [][][]int
+	if err := Unmarshal("[[1 2 ⋄ 3 4] ⋄ [5 6 ⋄ 7 8]]", &cube); err != nil || cube[1][0][1] != 6 {
+		t.Errorf("rank 3 = %v, %v", cube, err)
+	}
+	// Flat row-major data, as amicable produces.
+	var m [][]int
+	flat := &Array{Data: []any{1, 2, 3, 4, 5, 6}, Shape: []int{2, 3}}
+	if err := Decode(flat, &m); err != nil || !reflect.DeepEqual(m, [][]int{{1, 2, 3}, {4, 5, 6}}) {
+		t.Errorf("flat matrix = %v, %v", m, err)
+	}
+
+	var p point
+	if err := Unmarshal("(X: 1 ⋄ y: 2 ⋄ z: 3)", &p); err != nil || p != (point{1, 2}) {
+		t.Errorf("case-insensitive keys = %+v, %v", p, err)
+	}
+
+	var s struct {
+		Inner point `apl:"inner"`
+	}
+	err := Unmarshal("(inner: (x: 'a'))", &s)
+	if err == nil || !strings.Contains(err.Error(), "inner.x") {
+		t.Errorf("error should name the path, got %v", err)
+	}
+
+	var v any
+	if err := Unmarshal("(a: 1)", &v); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := v.(*Namespace); !ok {
+		t.Errorf("interface target = %T, want *Namespace", v)
+	}
+
+	if err := Unmarshal("1", p); err == nil {
+		t.Error("expected error for non-pointer target")
+	}
+}
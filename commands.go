@@ -271,10 +271,30 @@ func buildCommands(cfg *Config) *CommandRegistry {
 		m.toggleVariablesPane()
 		return *m, nil
 	})
+	reg.add("workspace", "Toggle workspace explorer", true, "", func(m *Model) (tea.Model, tea.Cmd) {
+		m.toggleWorkspacePane()
+		return *m, nil
+	})
+	reg.add("threads", "Toggle threads pane", true, "", func(m *Model) (tea.Model, tea.Cmd) {
+		m.toggleThreadsPane()
+		return *m, nil
+	})
+	reg.add("watch", "Toggle watch expressions pane", true, "", func(m *Model) (tea.Model, tea.Cmd) {
+		m.toggleWatchPane()
+		return *m, nil
+	})
+	reg.add("explore", "Explore the last compound result in the data browser (-prepl)", true, "", func(m *Model) (tea.Model, tea.Cmd) {
+		m.explore()
+		return *m, nil
+	})
 	reg.add("breakpoint", "Toggle breakpoint on current line", true, "", func(m *Model) (tea.Model, tea.Cmd) {
 		m.toggleBreakpoint()
 		return *m, nil
 	})
+	reg.add("breakpoint-edit", "Set condition, hit count or log message on breakpoint", true, "", func(m *Model) (tea.Model, tea.Cmd) {
+		m.editBreakpoint()
+		return *m, nil
+	})
 	reg.add("reconnect", "Reconnect to Dyalog", true, "", func(m *Model) (tea.Model, tea.Cmd) {
 		return m.reconnect()
 	})
@@ -459,6 +479,10 @@ func buildCommands(cfg *Config) *CommandRegistry {
 		return *m, nil
 	})
 	reg.add("edit-mode", "Tracer: enter edit mode", false, "tracer", nil) // handled in EditorPane
+	reg.add("inline-trace", "Tracer: step through the applications within the line", false, "tracer", func(m *Model) (tea.Model, tea.Cmd) {
+		m.inlineTrace()
+		return *m, nil
+	})
 
 	// --- Data browser commands --- (all handled in DataBrowserPane)
 	reg.add("append-row", "Data browser: append a row", false, "data-browser", nil)
@@ -473,7 +497,12 @@ func buildCommands(cfg *Config) *CommandRegistry {
 	reg.alias("debug", "log", "logging")
 	reg.alias("stack", "callstack", "frames", "backtrace")
 	reg.alias("variables", "locals")
+	reg.alias("workspace", "explorer", "tree", "names", "namespaces")
+	reg.alias("threads", "tasks", "tnums")
+	reg.alias("watch", "watches", "expressions")
+	reg.alias("explore", "inspect", "result")
 	reg.alias("breakpoint", "bp", "pause")
+	reg.alias("breakpoint-edit", "condition", "conditional", "logpoint", "hit-count")
 	reg.alias("reconnect", "connect")
 	reg.alias("command-palette", "palette", "menu")
 	reg.alias("pane-move", "resize", "layout", "move-pane")
@@ -510,6 +539,7 @@ func buildCommands(cfg *Config) *CommandRegistry {
 	reg.alias("trace-back", "backwards")
 	reg.alias("trace-forward", "skip")
 	reg.alias("edit-mode", "modify")
+	reg.alias("inline-trace", "it", "intermediate", "subexpression")
 	reg.alias("append-row", "add-row")
 	reg.alias("append-column", "add-column")
 	reg.alias("delete-row", "remove-row")
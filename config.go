@@ -50,6 +50,7 @@ type Config struct {
 	Navigation   NavConfig              `json:"navigation"`
 	Autolocalise bool                   `json:"autolocalise"`
 	KillTimeout  int                    `json:"kill_timeout"`
+	Theme        map[string]string      `json:"theme,omitempty"` // syntax colours by token kind
 
 	// Legacy fields for migration
 	Keys       *legacyKeyMapConfig     `json:"keys,omitempty"`
@@ -0,0 +1,884 @@
+// Package dap implements a Debug Adapter Protocol server for Dyalog APL.
+//
+// It drives the interpreter's tracer over RIDE with the same messages as
+// gritt's TUI: StepInto, RunCurrentLine, ContinueTrace and Continue for
+// stepping, SetLineAttributes for breakpoints, and tracer OpenWindow /
+// SetHighlightLine / CloseWindow to follow the stack.
+//
+// DAP lines are 1-based and count the function header as line 1, so DAP
+// line n is APL line [n-1] — which is also the file line in a Link-managed
+// .aplf. Only one APL thread is modelled.
+package dap
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cursork/gritt/internal/framing"
+	"github.com/cursork/gritt/ride"
+	"github.com/cursork/gritt/session"
+)
+
+// threadID is the single thread reported to the client.
+const threadID = 1
+
+// Server implements the Debug Adapter Protocol.
+type Server struct {
+	sess   *session.Session
+	client *ride.Client
+	owns   bool // true if we launched the interpreter
+
+	wmu sync.Mutex // serialises writes and seq
+	w   io.Writer
+	seq int
+
+	mu          sync.Mutex
+	windows     map[int]*window
+	stack       []int            // tracer window tokens, innermost last
+	breakpoints map[string][]int // function name → stop lines (0-based)
+	sources     map[string]string
+	linkDirs    []string
+	expression  string // launch expression, run on configurationDone
+	stopOnEntry bool
+	running     bool // launch expression in flight
+	resumed     bool // resumed since the last stop, waiting for the next
+	stepping    bool // the resume was a step
+	sawError    bool // error output since the last resume
+	pending     *pendingExec
+	editWait    chan *window
+}
+
+// window is the adapter's view of a RIDE editor or tracer window.
+type window struct {
+	token    int
+	name     string
+	text     []string
+	line     int
+	debugger bool
+}
+
+// pendingExec collects output for an Execute issued by the adapter itself
+// (variables, evaluate), mirroring the TUI's executeInternal.
+type pendingExec struct {
+	outputs []string
+	errors  []string
+	done    chan struct{}
+}
+
+// NewServer creates a DAP server. The interpreter is launched or attached
+// when the client sends "launch" or "attach".
+func NewServer() *Server {
+	return &Server{
+		windows:     make(map[int]*window),
+		breakpoints: make(map[string][]int),
+		sources:     make(map[string]string),
+	}
+}
+
+// DAP wire types.
+
+type request struct {
+	Seq       int             `json:"seq"`
+	Type      string          `json:"type"`
+	Command   string          `json:"command"`
+	Arguments json.RawMessage `json:"arguments,omitempty"`
+}
+
+type response struct {
+	Seq        int    `json:"seq"`
+	Type       string `json:"type"`
+	RequestSeq int    `json:"request_seq"`
+	Success    bool   `json:"success"`
+	Command    string `json:"command"`
+	Message    string `json:"message,omitempty"`
+	Body       any    `json:"body,omitempty"`
+}
+
+type event struct {
+	Seq   int    `json:"seq"`
+	Type  string `json:"type"`
+	Event string `json:"event"`
+	Body  any    `json:"body,omitempty"`
+}
+
+type source struct {
+	Name string `json:"name"`
+	Path string `json:"path,omitempty"`
+}
+
+type stackFrame struct {
+	ID     int     `json:"id"`
+	Name   string  `json:"name"`
+	Source *source `json:"source,omitempty"`
+	Line   int     `json:"line"`
+	Column int     `json:"column"`
+}
+
+type variable struct {
+	Name               string `json:"name"`
+	Value              string `json:"value"`
+	VariablesReference int    `json:"variablesReference"`
+}
+
+// Variable references encode the frame token and the scope kind.
+const (
+	scopeLocals = 1
+	scopeAll    = 2
+)
+
+// Serve reads DAP requests from r and writes responses and events to w.
+func (s *Server) Serve(ctx context.Context, r io.Reader, w io.Writer) error {
+	s.w = w
+	br := bufio.NewReader(r)
+	defer s.shutdown()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+
+		body, err := framing.Read(br)
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+
+		var req request
+		if err := json.Unmarshal(body, &req); err != nil || req.Type != "request" {
+			continue
+		}
+
+		result, err := s.handle(ctx, req)
+		resp := response{Type: "response", RequestSeq: req.Seq, Command: req.Command, Success: err == nil, Body: result}
+		if err != nil {
+			resp.Message = err.Error()
+		}
+		s.write(&resp, &resp.Seq)
+
+		switch req.Command {
+		case "launch", "attach":
+			if err == nil {
+				s.event("initialized", nil)
+			}
+		case "disconnect", "terminate":
+			return nil
+		}
+	}
+}
+
+func (s *Server) handle(ctx context.Context, req request) (any, error) {
+	switch req.Command {
+	case "initialize":
+		return map[string]any{
+			"supportsConfigurationDoneRequest": true,
+			"supportsEvaluateForHovers":        true,
+			"supportsTerminateRequest":         true,
+		}, nil
+	case "launch":
+		return nil, s.launch(ctx, req.Arguments)
+	case "attach":
+		return nil, s.attach(ctx, req.Arguments)
+	case "setBreakpoints":
+		return s.setBreakpoints(req.Arguments)
+	case "setExceptionBreakpoints":
+		return map[string]any{"breakpoints": []any{}}, nil
+	case "configurationDone":
+		return nil, s.configurationDone()
+	case "threads":
+		return map[string]any{"threads": []map[string]any{{"id": threadID, "name": "APL"}}}, nil
+	case "stackTrace":
+		return s.stackTrace(), nil
+	case "scopes":
+		var args struct {
+			FrameID int `json:"frameId"`
+		}
+		json.Unmarshal(req.Arguments, &args)
+		return map[string]any{"scopes": []map[string]any{
+			{"name": "Locals", "variablesReference": args.FrameID*4 + scopeLocals, "expensive": false},
+			{"name": "Variables", "variablesReference": args.FrameID*4 + scopeAll, "expensive": true},
+		}}, nil
+	case "variables":
+		var args struct {
+			VariablesReference int `json:"variablesReference"`
+		}
+		json.Unmarshal(req.Arguments, &args)
+		return s.variables(args.VariablesReference)
+	case "evaluate":
+		var args struct {
+			Expression string `json:"expression"`
+		}
+		json.Unmarshal(req.Arguments, &args)
+		return s.evaluate(args.Expression)
+	case "next":
+		return nil, s.step("RunCurrentLine")
+	case "stepIn":
+		return nil, s.step("StepInto")
+	case "stepOut":
+		return nil, s.step("ContinueTrace")
+	case "continue":
+		return map[string]any{"allThreadsContinued": true}, s.resume()
+	case "pause":
+		return nil, s.send("WeakInterrupt", ride.WeakInterrupt{})
+	case "disconnect", "terminate":
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("unsupported request: %s", req.Command)
+	}
+}
+
+// --- Launch / attach ---
+
+type launchArgs struct {
+	Version     string   `json:"version"`     // Dyalog version or binary path
+	Program     string   `json:"program"`     // optional source file to ⎕FIX first
+	Link        []string `json:"link"`        // directories to Link into #
+	Expression  string   `json:"expression"`  // APL expression to run
+	StopOnEntry bool     `json:"stopOnEntry"` // trace the expression from its first line
+}
+
+func (s *Server) launch(ctx context.Context, raw json.RawMessage) error {
+	var args launchArgs
+	if len(raw) > 0 {
+		if err := json.Unmarshal(raw, &args); err != nil {
+			return fmt.Errorf("invalid launch arguments: %w", err)
+		}
+	}
+	sess, err := session.Launch(ctx, session.LaunchOptions{Version: args.Version})
+	if err != nil {
+		return fmt.Errorf("launch failed: %w", err)
+	}
+	s.owns = true
+	return s.start(ctx, sess, args)
+}
+
+func (s *Server) attach(ctx context.Context, raw json.RawMessage) error {
+	var args struct {
+		launchArgs
+		Addr string `json:"addr"`
+	}
+	if len(raw) > 0 {
+		if err := json.Unmarshal(raw, &args); err != nil {
+			return fmt.Errorf("invalid attach arguments: %w", err)
+		}
+	}
+	sess, err := session.Connect(ctx, session.ConnectOptions{Addr: args.Addr})
+	if err != nil {
+		return fmt.Errorf("attach failed: %w", err)
+	}
+	return s.start(ctx, sess, args.launchArgs)
+}
+
+// start prepares the workspace with Session calls, then hands the RIDE
+// connection to the adapter's reader goroutine.
+func (s *Server) start(ctx context.Context, sess *session.Session, args launchArgs) error {
+	for _, dir := range args.Link {
+		abs, err := filepath.Abs(dir)
+		if err != nil {
+			sess.Close()
+			return err
+		}
+		if err := sess.Link(ctx, abs); err != nil {
+			sess.Close()
+			return fmt.Errorf("link %s: %w", dir, err)
+		}
+		s.linkDirs = append(s.linkDirs, abs)
+	}
+	if args.Program != "" {
+		abs, err := filepath.Abs(args.Program)
+		if err != nil {
+			sess.Close()
+			return err
+		}
+		if err := sess.Fix(ctx, abs); err != nil {
+			sess.Close()
+			return fmt.Errorf("fix %s: %w", args.Program, err)
+		}
+		s.sources[nameFromPath(abs)] = abs
+	}
+
+	s.mu.Lock()
+	s.sess = sess
+	s.client = sess.Client()
+	s.expression = args.Expression
+	s.stopOnEntry = args.StopOnEntry
+	s.mu.Unlock()
+
+	s.watch(s.client)
+	return nil
+}
+
+func (s *Server) configurationDone() error {
+	s.mu.Lock()
+	expr := s.expression
+	trace := 0
+	if s.stopOnEntry {
+		trace = 1
+	}
+	if expr != "" {
+		s.running = true
+	}
+	s.mu.Unlock()
+
+	if expr == "" {
+		return nil
+	}
+	return s.send("Execute", ride.Execute{Text: expr + "\n", Trace: trace})
+}
+
+func (s *Server) shutdown() {
+	s.mu.Lock()
+	sess := s.sess
+	s.sess = nil
+	s.mu.Unlock()
+	if sess == nil {
+		return
+	}
+	if !s.owns {
+		// Leave an attached interpreter running and untraced.
+		s.send("RestartThreads", ride.TraceCommand{})
+	}
+	sess.Close()
+}
+
+// --- Breakpoints ---
+
+func (s *Server) setBreakpoints(raw json.RawMessage) (any, error) {
+	var args struct {
+		Source      source `json:"source"`
+		Breakpoints []struct {
+			Line int `json:"line"`
+		} `json:"breakpoints"`
+	}
+	if err := json.Unmarshal(raw, &args); err != nil {
+		return nil, fmt.Errorf("invalid arguments: %w", err)
+	}
+
+	name := nameFromPath(args.Source.Path)
+	if name == "" {
+		name = args.Source.Name
+	}
+	stops := make([]int, 0, len(args.Breakpoints))
+	for _, bp := range args.Breakpoints {
+		stops = append(stops, bp.Line-1)
+	}
+
+	s.mu.Lock()
+	s.breakpoints[name] = stops
+	if args.Source.Path != "" {
+		s.sources[name] = args.Source.Path
+	}
+	connected := s.client != nil
+	s.mu.Unlock()
+
+	verified, message := false, "interpreter not connected"
+	if connected {
+		if err := s.applyStops(name, stops); err != nil {
+			message = err.Error()
+		} else {
+			verified, message = true, ""
+		}
+	}
+
+	result := make([]map[string]any, len(args.Breakpoints))
+	for i, bp := range args.Breakpoints {
+		result[i] = map[string]any{"verified": verified, "line": bp.Line}
+		if message != "" {
+			result[i]["message"] = message
+		}
+	}
+	return map[string]any{"breakpoints": result}, nil
+}
+
+// applyStops opens name in an editor window, sends SetLineAttributes as the
+// TUI's sendSetLineAttributes does, and closes the window again.
+func (s *Server) applyStops(name string, stops []int) error {
+	wait := make(chan *window, 1)
+	s.mu.Lock()
+	s.editWait = wait
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		s.editWait = nil
+		s.mu.Unlock()
+	}()
+
+	if err := s.send("Edit", ride.Edit{Text: name}); err != nil {
+		return err
+	}
+
+	var w *window
+	select {
+	case w = <-wait:
+	case <-time.After(5 * time.Second):
+		return fmt.Errorf("no editor opened for %s", name)
+	}
+	defer s.send("CloseWindow", ride.CloseWindow{Win: w.token})
+
+	if len(w.text) <= 1 && strings.TrimSpace(strings.Join(w.text, "")) == "" {
+		return fmt.Errorf("%s is not defined", name)
+	}
+
+	stop := make([]int, 0, len(stops))
+	for _, l := range stops {
+		if l >= 0 && l < len(w.text) {
+			stop = append(stop, l)
+		}
+	}
+	return s.send("SetLineAttributes", ride.SetLineAttributes{Win: w.token, Stop: stop})
+}
+
+// --- Execution control ---
+
+func (s *Server) top() int {
+	if len(s.stack) == 0 {
+		return 0
+	}
+	return s.stack[len(s.stack)-1]
+}
+
+func (s *Server) step(command string) error {
+	return s.resumeWith(command, true)
+}
+
+func (s *Server) resume() error {
+	return s.resumeWith("Continue", false)
+}
+
+// resumeWith sends a tracer command for the innermost frame. The stop
+// that follows is reported from the next SetHighlightLine or ready prompt
+// while frames remain: a breakpoint hit again in a frame that is already
+// open only moves its window's highlight.
+func (s *Server) resumeWith(command string, stepping bool) error {
+	s.mu.Lock()
+	win := s.top()
+	if win == 0 {
+		s.mu.Unlock()
+		return fmt.Errorf("not suspended")
+	}
+	s.resumed = true
+	s.stepping = stepping
+	s.sawError = false
+	s.mu.Unlock()
+	return s.send(command, ride.TraceCommand{Win: win})
+}
+
+func (s *Server) stackTrace() any {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	frames := make([]stackFrame, 0, len(s.stack))
+	for i := len(s.stack) - 1; i >= 0; i-- {
+		w, ok := s.windows[s.stack[i]]
+		if !ok {
+			continue
+		}
+		f := stackFrame{ID: w.token, Name: w.name, Line: w.line + 1, Column: 1}
+		if path := s.sourceFor(w.name); path != "" {
+			f.Source = &source{Name: filepath.Base(path), Path: path}
+		}
+		frames = append(frames, f)
+	}
+	return map[string]any{"stackFrames": frames, "totalFrames": len(frames)}
+}
+
+// sourceFor maps a function name to a file: breakpoint sources first, then
+// a search of the Link directories. Caller must hold mu.
+func (s *Server) sourceFor(name string) string {
+	if path, ok := s.sources[name]; ok {
+		return path
+	}
+	for _, dir := range s.linkDirs {
+		var found string
+		filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return nil
+			}
+			if !d.IsDir() && nameFromPath(path) == name {
+				found = path
+				return fs.SkipAll
+			}
+			return nil
+		})
+		if found != "" {
+			s.sources[name] = found
+			return found
+		}
+	}
+	return ""
+}
+
+// --- Variables and evaluation ---
+
+func (s *Server) variables(ref int) (any, error) {
+	token, scope := ref/4, ref%4
+
+	s.mu.Lock()
+	w, ok := s.windows[token]
+	var names []string
+	if ok && scope == scopeLocals && len(w.text) > 0 {
+		names = headerLocals(w.text[0])
+	}
+	s.mu.Unlock()
+
+	var expr string
+	switch {
+	case scope == scopeLocals && len(names) == 0:
+		return map[string]any{"variables": []variable{}}, nil
+	case scope == scopeLocals:
+		expr = showVarsFn + "¨" + quoteNames(names)
+	default:
+		expr = "{0=≢⍵:⍬ ⋄ " + showVarsFn + "¨⍵}' '~⍨¨↓⎕NL 2"
+	}
+
+	outputs, _, err := s.exec(expr)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]any{"variables": parseVars(outputs)}, nil
+}
+
+// showVarsFn prints name=value with multi-row values joined by " ⋄ ",
+// so each variable stays on one output line.
+const showVarsFn = "{⎕PW←32767 ⋄ 0::⎕←⍵,'=' ⋄ ⎕←⍵,'=',3↓∊' ⋄ '∘,¨↓⍕⍎⍵}"
+
+func (s *Server) evaluate(expr string) (any, error) {
+	outputs, errs, err := s.exec(expr)
+	if err != nil {
+		return nil, err
+	}
+	if len(errs) > 0 {
+		return nil, errors.New(strings.Join(errs, "\n"))
+	}
+	return map[string]any{"result": strings.Join(outputs, "\n"), "variablesReference": 0}, nil
+}
+
+// exec runs code in the interpreter and collects its output without
+// forwarding it to the client as output events.
+func (s *Server) exec(code string) ([]string, []string, error) {
+	s.mu.Lock()
+	if s.client == nil {
+		s.mu.Unlock()
+		return nil, nil, fmt.Errorf("interpreter not connected")
+	}
+	if s.running && len(s.stack) == 0 {
+		s.mu.Unlock()
+		return nil, nil, fmt.Errorf("interpreter is busy")
+	}
+	if s.pending != nil {
+		s.mu.Unlock()
+		return nil, nil, fmt.Errorf("another evaluation is in progress")
+	}
+	p := &pendingExec{done: make(chan struct{})}
+	s.pending = p
+	s.mu.Unlock()
+
+	if err := s.send("Execute", ride.Execute{Text: code + "\n"}); err != nil {
+		s.mu.Lock()
+		s.pending = nil
+		s.mu.Unlock()
+		return nil, nil, err
+	}
+
+	select {
+	case <-p.done:
+		return p.outputs, p.errors, nil
+	case <-time.After(30 * time.Second):
+		s.mu.Lock()
+		s.pending = nil
+		s.mu.Unlock()
+		return nil, nil, fmt.Errorf("evaluation timed out")
+	}
+}
+
+// --- RIDE reader ---
+
+// watch subscribes to the session's RIDE client and reports termination
+// when the connection drops.
+func (s *Server) watch(c *ride.Client) {
+	c.Subscribe(s.dispatch)
+	go func() {
+		<-c.Done()
+		s.event("terminated", nil)
+	}()
+}
+
+// dispatch runs on the client's dispatch goroutine, so it must not block.
+func (s *Server) dispatch(msg *ride.Message) {
+	ev, err := msg.Typed()
+	if err != nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch ev := ev.(type) {
+	case *ride.AppendSessionOutput:
+		if ev.Type == 14 || ev.Type == 11 {
+			return // input echo
+		}
+		if p := s.pending; p != nil {
+			result := strings.TrimRight(ev.Result, "\n")
+			if ev.Type == 5 {
+				p.errors = append(p.errors, result)
+			} else if result != "" {
+				p.outputs = append(p.outputs, result)
+			}
+			return
+		}
+		category := "stdout"
+		if ev.Type == 5 {
+			category = "stderr"
+			s.sawError = true
+		}
+		s.event("output", map[string]any{"category": category, "output": ev.Result})
+
+	case *ride.SetPromptType:
+		if !ev.Ready() {
+			return
+		}
+		if p := s.pending; p != nil {
+			s.pending = nil
+			close(p.done)
+			return
+		}
+		if s.resumed && len(s.stack) > 0 {
+			s.stopped()
+			return
+		}
+		if s.running && len(s.stack) == 0 {
+			s.running = false
+			code := 0
+			if s.sawError {
+				code = 1
+			}
+			s.event("exited", map[string]any{"exitCode": code})
+			s.event("terminated", nil)
+		}
+
+	case *ride.OpenWindow:
+		w := &window{token: ev.Token}
+		w.update(ev)
+		s.windows[w.token] = w
+		if !w.debugger {
+			if s.editWait != nil {
+				s.editWait <- w
+				s.editWait = nil
+			}
+			return
+		}
+		if !s.inStack(w.token) {
+			s.stack = append(s.stack, w.token)
+		}
+		s.stopped()
+
+	case *ride.UpdateWindow:
+		w, ok := s.windows[ev.Token]
+		if !ok {
+			return
+		}
+		prev := w.name
+		w.update((*ride.OpenWindow)(ev))
+		// Dyalog may reuse a tracer token for a different frame.
+		if s.inStack(ev.Token) && w.name != prev {
+			s.stopped()
+		}
+
+	case *ride.SetHighlightLine:
+		if w, ok := s.windows[ev.Win]; ok {
+			w.line = ev.Line
+		}
+		if s.resumed && s.inStack(ev.Win) {
+			s.stopped()
+		}
+
+	case *ride.CloseWindow:
+		delete(s.windows, ev.Win)
+		for i, t := range s.stack {
+			if t == ev.Win {
+				s.stack = append(s.stack[:i], s.stack[i+1:]...)
+				break
+			}
+		}
+
+	case *ride.WindowTypeChanged:
+		if w, ok := s.windows[ev.Win]; ok {
+			w.debugger = bool(ev.Tracer)
+		}
+
+	case *ride.OptionsDialog:
+		// Same default as the TUI: "No" (replace only the name being edited).
+		go s.send("ReplyOptionsDialog", ride.ReplyOptionsDialog{Token: ev.Token, Index: 1})
+	}
+}
+
+// stopped emits a stopped event for the top of the tracer stack. Caller must hold mu.
+func (s *Server) stopped() {
+	reason := "pause"
+	if w, ok := s.windows[s.top()]; ok {
+		for _, l := range s.breakpoints[w.name] {
+			if l == w.line {
+				reason = "breakpoint"
+			}
+		}
+	}
+	switch {
+	case reason == "breakpoint":
+	case s.stepping:
+		reason = "step"
+	case s.sawError:
+		reason = "exception"
+	case s.stopOnEntry:
+		reason = "entry"
+	}
+	s.resumed = false
+	s.stepping = false
+	s.stopOnEntry = false
+	s.event("stopped", map[string]any{
+		"reason":            reason,
+		"threadId":          threadID,
+		"allThreadsStopped": true,
+	})
+}
+
+func (s *Server) inStack(token int) bool {
+	for _, t := range s.stack {
+		if t == token {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Server) send(cmd string, args any) error {
+	s.mu.Lock()
+	c := s.client
+	s.mu.Unlock()
+	if c == nil {
+		return fmt.Errorf("interpreter not connected")
+	}
+	return c.Send(cmd, args)
+}
+
+// --- Helpers ---
+
+func (w *window) update(ow *ride.OpenWindow) {
+	w.name = ow.Name
+	w.text = ow.Text
+	w.line = ow.CurrentRow
+	w.debugger = bool(ow.Debugger)
+}
+
+// nameFromPath turns a Link-style file path into the APL name it defines.
+func nameFromPath(path string) string {
+	base := filepath.Base(path)
+	if path == "" || base == "." {
+		return ""
+	}
+	return strings.TrimSuffix(base, filepath.Ext(base))
+}
+
+func isNameChar(r rune) bool {
+	return r == '_' || r == '∆' || r == '⍙' || r == '⎕' ||
+		(r >= 'A' && r <= 'Z') || (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9')
+}
+
+// headerLocals extracts result, argument and localised names from a tradfn
+// header such as "r←{a} Fn b;x;y". The function name itself is dropped.
+// Dfn frames ("{...}") have no header names.
+func headerLocals(header string) []string {
+	if i := strings.Index(header, "⍝"); i >= 0 {
+		header = header[:i]
+	}
+	parts := strings.Split(header, ";")
+	sig := parts[0]
+
+	var names []string
+	var result []string
+	if i := strings.Index(sig, "←"); i >= 0 {
+		result = fields(sig[:i])
+		sig = sig[i+len("←"):]
+	}
+	words := fields(sig)
+	switch len(words) {
+	case 2: // Fn b
+		words = words[1:]
+	case 3: // a Fn b
+		words = []string{words[0], words[2]}
+	default: // niladic, or operator headers we don't unpick
+		words = nil
+	}
+	names = append(names, result...)
+	names = append(names, words...)
+	for _, p := range parts[1:] {
+		for _, n := range fields(p) {
+			if !strings.HasPrefix(n, "⎕") {
+				names = append(names, n)
+			}
+		}
+	}
+	return names
+}
+
+// fields splits s into APL names, ignoring braces, parentheses and spaces.
+func fields(s string) []string {
+	return strings.FieldsFunc(s, func(r rune) bool { return !isNameChar(r) })
+}
+
+// quoteNames renders names as an APL vector of character vectors.
+func quoteNames(names []string) string {
+	q := make([]string, len(names))
+	for i, n := range names {
+		q[i] = "'" + n + "'"
+	}
+	if len(q) == 1 {
+		return "(,⊂," + q[0] + ")"
+	}
+	return "(" + strings.Join(q, " ") + ")"
+}
+
+// parseVars reads name=value lines printed by showVarsFn.
+func parseVars(outputs []string) []variable {
+	vars := []variable{}
+	for _, out := range outputs {
+		for _, line := range strings.Split(out, "\n") {
+			line = strings.TrimSpace(line)
+			if idx := strings.Index(line, "="); idx > 0 {
+				vars = append(vars, variable{
+					Name:  strings.TrimSpace(line[:idx]),
+					Value: strings.TrimSpace(line[idx+1:]),
+				})
+			}
+		}
+	}
+	return vars
+}
+
+// --- Framing ---
+
+// write assigns the next sequence number via seq and writes v.
+func (s *Server) write(v any, seq *int) {
+	s.wmu.Lock()
+	defer s.wmu.Unlock()
+	s.seq++
+	*seq = s.seq
+	framing.Write(s.w, v)
+}
+
+func (s *Server) event(name string, body any) {
+	e := event{Type: "event", Event: name, Body: body}
+	s.write(&e, &e.Seq)
+}
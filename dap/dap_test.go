@@ -0,0 +1,183 @@
+package dap
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/cursork/gritt/internal/framing"
+	"github.com/cursork/gritt/ride"
+)
+
+func frame(t *testing.T, msgs ...any) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	for _, m := range msgs {
+		if err := framing.Write(&buf, m); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return &buf
+}
+
+func TestServeWithoutInterpreter(t *testing.T) {
+	in := frame(t,
+		map[string]any{"seq": 1, "type": "request", "command": "initialize", "arguments": map[string]any{}},
+		map[string]any{"seq": 2, "type": "request", "command": "threads"},
+		map[string]any{"seq": 3, "type": "request", "command": "setBreakpoints", "arguments": map[string]any{
+			"source":      map[string]any{"path": "/src/Foo.aplf"},
+			"breakpoints": []any{map[string]any{"line": 3}},
+		}},
+		map[string]any{"seq": 4, "type": "request", "command": "next", "arguments": map[string]any{"threadId": 1}},
+		map[string]any{"seq": 5, "type": "request", "command": "disconnect"},
+	)
+	var out bytes.Buffer
+	s := NewServer()
+	if err := s.Serve(context.Background(), in, &out); err != nil {
+		t.Fatal(err)
+	}
+
+	br := bufio.NewReader(&out)
+	var msgs []response
+	for {
+		body, err := framing.Read(br)
+		if err != nil {
+			break
+		}
+		var r response
+		json.Unmarshal(body, &r)
+		msgs = append(msgs, r)
+	}
+	if len(msgs) != 5 {
+		t.Fatalf("got %d responses, want 5", len(msgs))
+	}
+	for i, r := range msgs {
+		if r.Seq != i+1 || r.RequestSeq != i+1 {
+			t.Errorf("response %d: seq=%d request_seq=%d", i, r.Seq, r.RequestSeq)
+		}
+	}
+	if !msgs[0].Success || !msgs[1].Success {
+		t.Errorf("initialize/threads should succeed: %+v", msgs[:2])
+	}
+	if msgs[3].Success {
+		t.Error("next without a suspended function should fail")
+	}
+	if got := s.breakpoints["Foo"]; !reflect.DeepEqual(got, []int{2}) {
+		t.Errorf("breakpoints[Foo] = %v, want [2]", got)
+	}
+}
+
+func TestHeaderLocals(t *testing.T) {
+	tests := []struct {
+		header string
+		want   []string
+	}{
+		{"r←Fn x", []string{"r", "x"}},
+		{"r←{a}Fn b;x;y", []string{"r", "a", "b", "x", "y"}},
+		{"Fn;⎕IO;tmp ⍝ comment", []string{"tmp"}},
+		{"{r}←a Fn b", []string{"r", "a", "b"}},
+		{"Niladic", nil},
+	}
+	for _, tt := range tests {
+		if got := headerLocals(tt.header); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("headerLocals(%q) = %v, want %v", tt.header, got, tt.want)
+		}
+	}
+}
+
+func TestQuoteNames(t *testing.T) {
+	if got := quoteNames([]string{"abc"}); got != "(,⊂,'abc')" {
+		t.Errorf("single = %s", got)
+	}
+	if got := quoteNames([]string{"a", "bc"}); got != "('a' 'bc')" {
+		t.Errorf("multiple = %s", got)
+	}
+}
+
+func TestParseVars(t *testing.T) {
+	got := parseVars([]string{"x=1 2 3", "m=1 2 ⋄ 3 4", "junk", "u="})
+	want := []variable{{Name: "x", Value: "1 2 3"}, {Name: "m", Value: "1 2 ⋄ 3 4"}, {Name: "u", Value: ""}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseVars = %+v, want %+v", got, want)
+	}
+}
+
+func TestDispatchTracerStack(t *testing.T) {
+	s := NewServer()
+	var out bytes.Buffer
+	s.w = &out
+	s.breakpoints["Foo"] = []int{2}
+
+	s.dispatch(&ride.Message{Command: "OpenWindow", Args: map[string]any{"token": 1.0, "name": "Foo", "debugger": 1.0, "currentRow": 2.0, "text": []any{"Foo", "a←1", "b←2"}}})
+	s.dispatch(&ride.Message{Command: "OpenWindow", Args: map[string]any{"token": 2.0, "name": "Bar", "debugger": 1.0, "currentRow": 0.0}})
+	if !reflect.DeepEqual(s.stack, []int{1, 2}) {
+		t.Fatalf("stack = %v", s.stack)
+	}
+
+	frames := s.stackTrace().(map[string]any)["stackFrames"].([]stackFrame)
+	if len(frames) != 2 || frames[0].Name != "Bar" || frames[1].Name != "Foo" || frames[1].Line != 3 {
+		t.Errorf("frames = %+v", frames)
+	}
+
+	s.dispatch(&ride.Message{Command: "CloseWindow", Args: map[string]any{"win": 2.0}})
+	if !reflect.DeepEqual(s.stack, []int{1}) {
+		t.Errorf("stack after close = %v", s.stack)
+	}
+
+	if got := events(&out); !reflect.DeepEqual(got, []string{"stopped:breakpoint", "stopped:pause"}) {
+		t.Errorf("events = %v", got)
+	}
+}
+
+func TestDispatchContinueStops(t *testing.T) {
+	s := NewServer()
+	var out bytes.Buffer
+	s.w = &out
+	s.breakpoints["Loop"] = []int{2}
+
+	s.dispatch(&ride.Message{Command: "OpenWindow", Args: map[string]any{"token": 1.0, "name": "Loop", "debugger": 1.0, "currentRow": 2.0}})
+	out.Reset()
+
+	// A loop hits the breakpoint again: the open frame's window only moves
+	// its highlight. (Without an interpreter nothing is sent, but the
+	// adapter counts itself resumed.)
+	s.resume()
+	s.dispatch(&ride.Message{Command: "SetHighlightLine", Args: map[string]any{"win": 1.0, "line": 2.0}})
+	s.dispatch(&ride.Message{Command: "SetPromptType", Args: map[string]any{"type": 1.0}})
+	if got := events(&out); !reflect.DeepEqual(got, []string{"stopped:breakpoint"}) {
+		t.Errorf("events after Continue = %v", got)
+	}
+
+	// With the breakpoint gone, an error stops it in the same frame, with
+	// no highlight to report
+	s.breakpoints["Loop"] = nil
+	s.resume()
+	s.dispatch(&ride.Message{Command: "AppendSessionOutput", Args: map[string]any{"result": "DOMAIN ERROR\n", "type": 5.0}})
+	s.dispatch(&ride.Message{Command: "SetPromptType", Args: map[string]any{"type": 1.0}})
+	if got := events(&out); !reflect.DeepEqual(got, []string{"output:", "stopped:exception"}) {
+		t.Errorf("events after an error = %v", got)
+	}
+}
+
+// events reads the events written to out as "event:reason".
+func events(out *bytes.Buffer) []string {
+	var got []string
+	br := bufio.NewReader(out)
+	for {
+		body, err := framing.Read(br)
+		if err != nil {
+			return got
+		}
+		var e struct {
+			Event string `json:"event"`
+			Body  struct {
+				Reason string `json:"reason"`
+			} `json:"body"`
+		}
+		json.Unmarshal(body, &e)
+		got = append(got, e.Event+":"+e.Body.Reason)
+	}
+}
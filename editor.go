@@ -1,5 +1,7 @@
 package main
 
+import "github.com/cursork/gritt/ride"
+
 // EditorWindow holds state for an open editor/tracer window from Dyalog
 type EditorWindow struct {
 	Token      int      // Unique window identifier from Dyalog
@@ -12,6 +14,8 @@ type EditorWindow struct {
 	CurrentRow int      // Initial cursor position
 	ReadOnly   bool     // Whether editor is read-only
 	Debugger   bool     // True if this is a tracer window
+	Tid        int      // Thread a tracer window belongs to
+	Tname      string   // That thread's name, if any
 
 	// Editor state (local to gritt)
 	Modified     bool
@@ -20,109 +24,33 @@ type EditorWindow struct {
 	CursorCol    int
 }
 
-// NewEditorWindow creates an EditorWindow from OpenWindow/UpdateWindow message args
-func NewEditorWindow(args map[string]any) *EditorWindow {
-	w := &EditorWindow{}
-
-	if token, ok := args["token"].(float64); ok {
-		w.Token = int(token)
-	}
-	if name, ok := args["name"].(string); ok {
-		w.Name = name
-	}
-	if entityType, ok := args["entityType"].(float64); ok {
-		w.EntityType = int(entityType)
-	}
-	if currentRow, ok := args["currentRow"].(float64); ok {
-		w.CurrentRow = int(currentRow)
-		w.CursorRow = int(currentRow)
-	}
-	// debugger is 0/1 integer, not boolean
-	if debugger, ok := args["debugger"].(float64); ok {
-		w.Debugger = debugger != 0
-	}
-	// readOnly can be 0/1 integer or true/false boolean depending on Dyalog version
-	if readOnly, ok := args["readOnly"].(float64); ok {
-		w.ReadOnly = readOnly != 0
-	} else if readOnly, ok := args["readOnly"].(bool); ok {
-		w.ReadOnly = readOnly
-	}
-
-	// Parse text array
-	if text, ok := args["text"].([]any); ok {
-		w.Text = make([]string, len(text))
-		for i, line := range text {
-			if s, ok := line.(string); ok {
-				w.Text[i] = s
-			}
-		}
-	}
-
-	// Parse stop array (breakpoints)
-	if stop, ok := args["stop"].([]any); ok {
-		w.Stop = make([]int, len(stop))
-		for i, line := range stop {
-			if n, ok := line.(float64); ok {
-				w.Stop[i] = int(n)
-			}
-		}
-	}
-
-	// Parse monitor array
-	if monitor, ok := args["monitor"].([]any); ok {
-		w.Monitor = make([]int, len(monitor))
-		for i, line := range monitor {
-			if n, ok := line.(float64); ok {
-				w.Monitor[i] = int(n)
-			}
-		}
+// NewEditorWindow creates an EditorWindow from an OpenWindow message
+func NewEditorWindow(ow *ride.OpenWindow) *EditorWindow {
+	return &EditorWindow{
+		Token:      ow.Token,
+		Name:       ow.Name,
+		Text:       ow.Text,
+		EntityType: ow.EntityType,
+		Stop:       ow.Stop,
+		Monitor:    ow.Monitor,
+		Trace:      ow.Trace,
+		CurrentRow: ow.CurrentRow,
+		CursorRow:  ow.CurrentRow,
+		ReadOnly:   bool(ow.ReadOnly),
+		Debugger:   bool(ow.Debugger),
+		Tid:        ow.Tid,
+		Tname:      ow.Tname,
 	}
-
-	// Parse trace array
-	if trace, ok := args["trace"].([]any); ok {
-		w.Trace = make([]int, len(trace))
-		for i, line := range trace {
-			if n, ok := line.(float64); ok {
-				w.Trace[i] = int(n)
-			}
-		}
-	}
-
-	return w
 }
 
-// Update refreshes window content from UpdateWindow message args
-func (w *EditorWindow) Update(args map[string]any) {
-	if text, ok := args["text"].([]any); ok {
-		w.Text = make([]string, len(text))
-		for i, line := range text {
-			if s, ok := line.(string); ok {
-				w.Text[i] = s
-			}
-		}
-	}
-	if currentRow, ok := args["currentRow"].(float64); ok {
-		w.CurrentRow = int(currentRow)
-	}
-	if entityType, ok := args["entityType"].(float64); ok {
-		w.EntityType = int(entityType)
-	}
-	if debugger, ok := args["debugger"].(float64); ok {
-		w.Debugger = debugger != 0
-	}
-	if readOnly, ok := args["readOnly"].(float64); ok {
-		w.ReadOnly = readOnly != 0
-	} else if readOnly, ok := args["readOnly"].(bool); ok {
-		w.ReadOnly = readOnly
-	}
-	if stop, ok := args["stop"].([]any); ok {
-		w.Stop = make([]int, len(stop))
-		for i, line := range stop {
-			if n, ok := line.(float64); ok {
-				w.Stop[i] = int(n)
-			}
-		}
-	}
+// Update refreshes window content from an UpdateWindow message
+func (w *EditorWindow) Update(uw *ride.UpdateWindow) {
+	w.Text = uw.Text
+	w.CurrentRow = uw.CurrentRow
+	w.EntityType = uw.EntityType
+	w.Debugger = bool(uw.Debugger)
+	w.ReadOnly = bool(uw.ReadOnly)
+	w.Stop = uw.Stop
 }
 
 // HasStop returns true if the given line has a breakpoint
@@ -7,6 +7,7 @@ import (
 	"github.com/charmbracelet/bubbles/key"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss/v2"
+	"github.com/cursork/gritt/syntax"
 )
 
 // EditorPane implements PaneContent for editing APL functions
@@ -20,6 +21,15 @@ type EditorPane struct {
 	// Tracer key bindings (from command registry)
 	tracerBindings []tracerBinding
 
+	// Inline trace: the sub-expression being looked at, on line inlineLine
+	inlineLine         int // -1 = none
+	inlineStart        int
+	inlineEnd          int
+	PendingInlineTrace bool // Inline trace key pressed; the model opens the pane
+
+	// Conditions etc. on stop lines, for the gutter marks (may be nil)
+	breakpoints *Breakpoints
+
 	// Callbacks
 	onSave            func()
 	onClose           func()
@@ -41,11 +51,14 @@ type EditorPane struct {
 	lineNumStyle     lipgloss.Style
 	breakpointStyle  lipgloss.Style
 	tracerLineStyle  lipgloss.Style // Bold for current line in tracer
+	inlineStyle      lipgloss.Style // Sub-expression under inline trace
 	highlightLine    int            // -1 = none, otherwise 0-based line for tracer highlight
 }
 
 // tracerBinding pairs a key.Binding with a callback for tracer mode dispatch.
+// A nil callback is handled by the pane itself, by name.
 type tracerBinding struct {
+	name     string
 	binding  key.Binding
 	callback func()
 }
@@ -62,7 +75,9 @@ func NewEditorPane(w *EditorWindow, onSave, onClose func()) *EditorPane {
 		lineNumStyle:    lipgloss.NewStyle().Foreground(lipgloss.Color("243")),
 		breakpointStyle: lipgloss.NewStyle().Foreground(lipgloss.Color("9")), // Red
 		tracerLineStyle: lipgloss.NewStyle().Foreground(AccentColor),
+		inlineStyle:     lipgloss.NewStyle().Background(AccentColor).Foreground(lipgloss.Color("0")),
 		highlightLine:   -1,
+		inlineLine:      -1,
 	}
 }
 
@@ -71,6 +86,7 @@ func (e *EditorPane) SetWindow(w *EditorWindow) {
 	e.window = w
 	e.scrollY = 0
 	e.highlightLine = -1
+	e.inlineLine = -1
 	e.editMode = false
 	// Position cursor at highlighted line if set
 	if w.CurrentRow >= 0 && w.CurrentRow < len(w.Text) {
@@ -133,7 +149,7 @@ func (e *EditorPane) Render(w, h int) string {
 		// Breakpoint indicator
 		bp := " "
 		if e.window.HasStop(lineIdx) {
-			bp = e.breakpointStyle.Render("●")
+			bp = e.breakpointStyle.Render(e.breakpoints.Mark(e.window.Name, lineIdx))
 		}
 
 		// Line number
@@ -152,7 +168,9 @@ func (e *EditorPane) Render(w, h int) string {
 		// Render line with cursor if on this line
 		var lineContent string
 		isCurrentLine := lineIdx == e.window.CursorRow
-		if isCurrentLine {
+		if lineIdx == e.inlineLine && e.InTracerMode() {
+			lineContent = e.renderLineWithSpan(textRunes, contentW)
+		} else if isCurrentLine {
 			// Pass tracer style if in tracer mode
 			var lineStyle *lipgloss.Style
 			if e.InTracerMode() {
@@ -160,7 +178,7 @@ func (e *EditorPane) Render(w, h int) string {
 			}
 			lineContent = e.renderLineWithCursor(textRunes, e.window.CursorCol, contentW, lineStyle)
 		} else {
-			lineContent = e.renderLine(textRunes, contentW)
+			lineContent = e.renderLine(text, textRunes, contentW)
 		}
 
 		// In tracer mode, highlight entire current line including line number
@@ -175,11 +193,55 @@ func (e *EditorPane) Render(w, h int) string {
 }
 
 // renderLine renders a line without cursor, padded/truncated to width
-func (e *EditorPane) renderLine(runes []rune, w int) string {
+func (e *EditorPane) renderLine(text string, runes []rune, w int) string {
+	pad := ""
 	if len(runes) >= w {
-		return string(runes[:w])
+		runes = runes[:w]
+	} else {
+		pad = strings.Repeat(" ", w-len(runes))
+	}
+	if !e.highlighted() {
+		return string(runes) + pad
 	}
-	return string(runes) + strings.Repeat(" ", w-len(runes))
+	return highlightRunes(runes, syntax.KindAt(text), -1, e.cursorStyle) + pad
+}
+
+// renderLineWithSpan renders the inline-traced line in tracer style, with
+// the sub-expression under trace picked out in place of the cursor.
+func (e *EditorPane) renderLineWithSpan(runes []rune, w int) string {
+	if len(runes) > w {
+		runes = runes[:w]
+	}
+	start, end := min(e.inlineStart, len(runes)), min(e.inlineEnd, len(runes))
+	line := e.tracerLineStyle.Render(string(runes[:start])) +
+		e.inlineStyle.Render(string(runes[start:end])) +
+		e.tracerLineStyle.Render(string(runes[end:]))
+	if len(runes) < w {
+		line += strings.Repeat(" ", w-len(runes))
+	}
+	return line
+}
+
+// isArrayEntity reports whether an editor entity type is an array
+func isArrayEntity(entityType int) bool {
+	switch entityType {
+	case 2, 4, 8, 16, 128: // char, numeric, mixed, nested arrays; char vector
+		return true
+	}
+	return false
+}
+
+// highlighted reports whether the window holds code to syntax-highlight,
+// as opposed to an array being edited.
+func (e *EditorPane) highlighted() bool {
+	if e.window.Debugger {
+		return true
+	}
+	switch e.window.EntityType {
+	case 2, 4, 8, 16, 32, 64, 128, 262144: // arrays, files, ⎕OR, APLAN
+		return false
+	}
+	return true
 }
 
 // renderLineWithCursor renders a line with cursor highlight at col position
@@ -193,6 +255,14 @@ func (e *EditorPane) renderLineWithCursor(runes []rune, col, w int, lineStyle *l
 		col = 0
 	}
 
+	if lineStyle == nil && e.highlighted() {
+		line := highlightRunes(runes, syntax.KindAt(string(runes)), col, e.cursorStyle)
+		if visibleLen := max(len(runes), col+1); visibleLen < w {
+			line += strings.Repeat(" ", w-visibleLen)
+		}
+		return line
+	}
+
 	// Build parts: before cursor, cursor char, after cursor
 	before := string(runes[:col])
 
@@ -257,9 +327,12 @@ func (e *EditorPane) HandleKey(msg tea.KeyMsg) bool {
 		default:
 			for _, tb := range e.tracerBindings {
 				if key.Matches(msg, tb.binding) {
-					if tb.callback != nil {
+					switch {
+					case tb.callback != nil:
 						tb.callback()
-					} else {
+					case tb.name == "inline-trace":
+						e.PendingInlineTrace = true
+					default:
 						// nil callback = edit-mode toggle (handled locally)
 						e.editMode = true
 					}
@@ -540,6 +613,17 @@ func (e *EditorPane) SetHighlightLine(line int) {
 	}
 }
 
+// SetInlineSpan picks out runes start to end of line, the sub-expression
+// the inline trace pane is showing.
+func (e *EditorPane) SetInlineSpan(line, start, end int) {
+	e.inlineLine, e.inlineStart, e.inlineEnd = line, start, end
+}
+
+// ClearInlineSpan removes the inline trace highlight
+func (e *EditorPane) ClearInlineSpan() {
+	e.inlineLine = -1
+}
+
 // TracerCallbacks holds all tracer control callbacks
 type TracerCallbacks struct {
 	StepInto  func()
@@ -0,0 +1,32 @@
+// apldap is a Debug Adapter Protocol server for Dyalog APL.
+// Reads DAP messages from stdin, writes responses and events to stdout.
+// The interpreter is launched or attached by the client's launch/attach
+// request, so there are no flags.
+//
+// VS Code launch.json:
+//
+//	{ "type": "apl", "request": "launch", "link": ["${workspaceFolder}/src"],
+//	  "expression": "Main 42", "stopOnEntry": true }
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+	"os/signal"
+
+	"github.com/cursork/gritt/dap"
+)
+
+func main() {
+	// stdout carries the protocol; keep log output on stderr.
+	log.SetOutput(os.Stderr)
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+
+	srv := dap.NewServer()
+	if err := srv.Serve(ctx, os.Stdin, os.Stdout); err != nil {
+		log.Fatal(err)
+	}
+}
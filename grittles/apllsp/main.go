@@ -0,0 +1,66 @@
+// apllsp is a Language Server Protocol server for Dyalog APL source files.
+// Reads LSP messages from stdin, writes responses to stdout, and drives a
+// Dyalog interpreter over RIDE for completion, formatting and diagnostics.
+//
+// Usage:
+//
+//	apllsp                              # auto-launch Dyalog
+//	apllsp -addr localhost:4502         # use running Dyalog
+//	apllsp -link src -link test         # link directories before serving
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+
+	"github.com/cursork/gritt/lsp"
+	"github.com/cursork/gritt/session"
+)
+
+func main() {
+	addr := flag.String("addr", "", "Connect to running Dyalog at host:port (skips launch)")
+	version := flag.String("version", "", "Dyalog version (e.g. 20.0) or path to binary")
+	var links []string
+	flag.Func("link", "Link a directory into # before serving (repeatable)", func(dir string) error {
+		links = append(links, dir)
+		return nil
+	})
+	flag.Parse()
+
+	// stdout carries the protocol; keep log output on stderr.
+	log.SetOutput(os.Stderr)
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+
+	var sess *session.Session
+	var err error
+	if *addr != "" {
+		sess, err = session.Connect(ctx, session.ConnectOptions{Addr: *addr})
+	} else {
+		sess, err = session.Launch(ctx, session.LaunchOptions{Version: *version})
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer sess.Close()
+
+	for _, dir := range links {
+		abs, err := filepath.Abs(dir)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err := sess.Link(ctx, abs); err != nil {
+			log.Fatalf("link %s: %v", dir, err)
+		}
+	}
+
+	srv := lsp.NewServer(sess)
+	if err := srv.Serve(ctx, os.Stdin, os.Stdout); err != nil {
+		log.Fatal(err)
+	}
+}
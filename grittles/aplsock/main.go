@@ -6,6 +6,15 @@
 //	aplsock -l -sock :4200           # Launch Dyalog, serve on TCP 4200
 //	aplsock -sock /tmp/apl.sock      # Connect to existing Dyalog on :4502
 //	aplsock -addr host:4502 -sock :4200
+//	aplsock -listen :4502 -sock :4200  # Wait for Dyalog with RIDE_INIT=CONNECT:host:4502
+//	aplsock -l -private                # Each client evaluates in its own namespace
+//	aplsock -l -timeout 30s            # Interrupt expressions that run longer
+//
+// Each client gets a prepl connection of its own, so clients don't wait
+// on each other. Expressions still running at shutdown, or past -timeout,
+// are interrupted. What an expression displays in the session comes back
+// to its client as out lines when no other client's is running; the rest
+// is logged.
 //
 // Clients connect with netcat, telnet, or gritt (phase 2):
 //
@@ -13,7 +22,7 @@
 package main
 
 import (
-	"bufio"
+	"context"
 	"flag"
 	"fmt"
 	"log"
@@ -28,29 +37,53 @@ import (
 	"github.com/cursork/gritt/prepl"
 	"github.com/cursork/gritt/ride"
 	"github.com/cursork/gritt/session"
+	"github.com/cursork/gritt/sockserve"
 )
 
 func main() {
 	addr := flag.String("addr", "localhost:4502", "Dyalog RIDE address")
+	listen := flag.String("listen", "", "Wait on host:port for Dyalog to connect (RIDE_INIT=CONNECT) instead of dialling -addr")
 	launch := flag.Bool("launch", false, "Launch Dyalog automatically")
 	flag.BoolVar(launch, "l", false, "Launch Dyalog automatically")
 	version := flag.String("version", "", "Dyalog version or path to binary")
 	sock := flag.String("sock", ":4200", "Socket to serve on (:port or /path)")
-	mode := flag.String("mode", "aplan", "Output mode: plain, aplan, aplor")
+	modeName := flag.String("mode", "aplan", "Output mode: plain, aplan, aplor")
+	private := flag.Bool("private", false, "Give each client its own evaluation namespace instead of #")
+	timeout := flag.Duration("timeout", 0, "Interrupt any expression running longer than this (0 for no limit)")
 	// Legacy alias
 	repl := flag.Bool("repl", false, "Legacy alias for -mode plain")
 	flag.Parse()
 
 	if *repl {
-		*mode = "plain"
+		*modeName = "plain"
+	}
+	mode, err := sockserve.ParseMode(*modeName)
+	if err != nil {
+		log.Fatal(err)
 	}
 
-	// 1. Launch Dyalog if requested
+	if *listen != "" && *launch {
+		log.Fatal("-listen and -launch are mutually exclusive")
+	}
+
+	// 1. Launch Dyalog if requested. The launched interpreter dials back to
+	// a listener of ours, just as with -listen.
+	var ln *ride.Listener
+	if *launch {
+		*listen = "127.0.0.1:0"
+	}
+	if *listen != "" {
+		var err error
+		ln, err = ride.Listen(*listen)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
 	var dyalogCmd *exec.Cmd
 	if *launch {
-		var port int
-		dyalogCmd, port = launchDyalog(*version)
-		*addr = fmt.Sprintf("localhost:%d", port)
+		dyalogCmd = launchDyalog(*version, ln.Addr())
+		// Don't wait forever for an interpreter that failed to start.
+		time.AfterFunc(15*time.Second, func() { ln.Close() })
 	}
 	cleanup := func() {
 		if dyalogCmd != nil && dyalogCmd.Process != nil {
@@ -61,75 +94,68 @@ func main() {
 	defer cleanup()
 
 	// 2. Connect via RIDE
-	rc, err := ride.Connect(*addr)
-	if err != nil {
-		log.Fatalf("RIDE connect to %s: %v", *addr, err)
+	var rc *ride.Client
+	if ln != nil {
+		log.Printf("Waiting for Dyalog on %s", ln.Addr())
+		rc, err = ln.Accept()
+		ln.Close()
+		if err != nil {
+			log.Fatalf("RIDE accept on %s: %v", ln.Addr(), err)
+		}
+		log.Printf("RIDE accepted on %s", ln.Addr())
+	} else {
+		rc, err = ride.Connect(*addr)
+		if err != nil {
+			log.Fatalf("RIDE connect to %s: %v", *addr, err)
+		}
+		log.Printf("RIDE connected to %s", *addr)
 	}
-	log.Printf("RIDE connected to %s", *addr)
 
 	// 3. Bootstrap: inject APL prepl code, set mode, start server on a thread
 	internalPort := 10000 + rand.Intn(50000)
-	bootstrap(rc, internalPort, *mode)
+	bootstrap(rc, internalPort, mode)
 
-	// 4. Drain RIDE messages in background so the connection doesn't back up.
-	go func() {
-		for {
-			msg, _, err := rc.Recv()
-			if err != nil {
-				return
-			}
-			if msg != nil && msg.Command == "AppendSessionOutput" {
-				if result, ok := msg.Args["result"].(string); ok {
-					if t, ok := msg.Args["type"].(float64); !ok || t != 14 {
-						log.Printf("APL: %s", strings.TrimRight(result, "\n"))
-					}
-				}
-			}
+	// 4. Drain RIDE messages in background so the connection doesn't back
+	// up, sorting session output by the client whose expression showed it.
+	output := &prepl.Output{Unclaimed: func(line string) { log.Printf("APL: %s", line) }}
+	rc.Subscribe(func(msg *ride.Message) {
+		var out ride.AppendSessionOutput
+		if msg.Decode(&out) == nil && out.Type != 14 {
+			output.Write(out.Result)
 		}
-	}()
+	}, "AppendSessionOutput")
+	rc.Start()
 
-	// 5. Connect to the APL prepl server
+	// 5. Wait for the APL prepl server
 	preplAddr := fmt.Sprintf("localhost:%d", internalPort)
-	pc := waitForPrepl(preplAddr)
-	log.Printf("prepl connected on internal port %d", internalPort)
+	waitForPrepl(preplAddr).Close()
+	log.Printf("prepl listening on internal port %d", internalPort)
 
-	// 6. Serve external clients (pc shared across all client connections)
-	serve(pc, *sock, *mode, cleanup)
+	// 6. Serve external clients, each on a prepl connection of its own
+	serve(handleConn(preplAddr, output, mode, *private, *timeout), *sock, cleanup)
 }
 
-// launchDyalog starts Dyalog APL with RIDE on a random port.
-func launchDyalog(version string) (*exec.Cmd, int) {
+// launchDyalog starts Dyalog APL with RIDE dialling back to rideAddr.
+func launchDyalog(version, rideAddr string) *exec.Cmd {
 	exe, err := session.FindDyalog(version)
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	port := 10000 + rand.Intn(50000)
 	cmd := exec.Command(exe, "+s", "-q")
-	cmd.Env = append(os.Environ(), fmt.Sprintf("RIDE_INIT=SERVE:*:%d", port))
+	cmd.Env = append(os.Environ(), "RIDE_INIT=CONNECT:"+rideAddr)
 	cmd.Env = append(cmd.Env, "RIDE_SPAWNED=1", "DYALOG_LINEEDITOR_MODE=1")
 	cmd.Env = append(cmd.Env, session.DyalogEnv(exe)...)
 	setProcessGroup(cmd)
 	if err := cmd.Start(); err != nil {
 		log.Fatalf("start Dyalog (%s): %v", exe, err)
 	}
-
-	rideAddr := fmt.Sprintf("localhost:%d", port)
-	for i := 0; i < 50; i++ {
-		conn, err := net.DialTimeout("tcp", rideAddr, 100*time.Millisecond)
-		if err == nil {
-			conn.Close()
-			log.Printf("Dyalog launched on RIDE port %d (pid %d)", port, cmd.Process.Pid)
-			return cmd, port
-		}
-		time.Sleep(100 * time.Millisecond)
-	}
-	log.Fatalf("Dyalog did not start RIDE on port %d", port)
-	return nil, 0
+	log.Printf("Dyalog launched (pid %d)", cmd.Process.Pid)
+	return cmd
 }
 
 // bootstrap injects the APL prepl namespace, sets mode, and starts the server.
-func bootstrap(rc *ride.Client, port int, mode string) {
+func bootstrap(rc *ride.Client, port int, mode sockserve.Mode) {
 	f, err := os.CreateTemp("", "prepl-*.apln")
 	if err != nil {
 		log.Fatalf("create temp file: %v", err)
@@ -147,7 +173,7 @@ func bootstrap(rc *ride.Client, port int, mode string) {
 	log.Printf("⎕FIX: %s", strings.Join(out, ""))
 
 	// Set output mode before starting
-	if mode != "aplan" {
+	if mode != sockserve.APLAN {
 		out, err = rc.Execute(fmt.Sprintf("Prepl.SetMode '%s'", mode))
 		if err != nil {
 			log.Fatalf("SetMode failed: %v", err)
@@ -181,100 +207,52 @@ func waitForPrepl(addr string) *prepl.Client {
 	return nil
 }
 
-// serve listens on the given address and proxies client connections to the APL prepl.
-func serve(pc *prepl.Client, sockAddr string, mode string, cleanup func()) {
-	var listener net.Listener
-	var err error
-	var isUnix bool
-
-	if strings.Contains(sockAddr, ":") {
-		listener, err = net.Listen("tcp", sockAddr)
-	} else {
-		isUnix = true
-		os.Remove(sockAddr)
-		listener, err = net.Listen("unix", sockAddr)
-	}
-	if err != nil {
-		log.Fatalf("listen %s: %v", sockAddr, err)
-	}
-	defer listener.Close()
-
-	log.Printf("serving on %s", sockAddr)
-
-	sigCh := make(chan os.Signal, 1)
-	signal.Notify(sigCh, termSignals()...)
-	go func() {
-		<-sigCh
-		listener.Close()
-		pc.Close()
-		if isUnix {
-			os.Remove(sockAddr)
-		}
-		cleanup()
-		os.Exit(0)
-	}()
-
-	for {
-		conn, err := listener.Accept()
+// handleConn serves one client through a prepl connection of its own: the
+// APL server keeps a buffer (and with private, a namespace) per connection
+// and evaluates each on its own thread, so a slow client holds up only
+// itself. What its expressions display is taken from output. An expression
+// running past timeout (if > 0) is interrupted.
+func handleConn(preplAddr string, output *prepl.Output, mode sockserve.Mode, private bool, timeout time.Duration) sockserve.Handler {
+	return sockserve.HandlerFunc(func(ctx context.Context, conn net.Conn) {
+		pc, err := prepl.Connect(preplAddr)
 		if err != nil {
+			log.Printf("client %s: prepl connect: %v", conn.RemoteAddr(), err)
 			return
 		}
-		switch mode {
-		case "plain":
-			go handleConnPlain(pc, conn)
-		default:
-			// Both 'aplan' and 'aplor' use raw APLAN passthrough.
-			// The difference is what the APL side puts in val:
-			// aplan → APLAN text, aplor → 220⌶ signed int vector.
-			// The consumer knows which mode and parses accordingly.
-			go handleConn(pc, conn)
+		defer pc.Close()
+		if err := pc.CaptureOutput(output); err != nil {
+			log.Printf("client %s: %v", conn.RemoteAddr(), err)
+			return
 		}
-	}
+		if private {
+			if err := pc.Private(); err != nil {
+				log.Printf("client %s: %v", conn.RemoteAddr(), err)
+				return
+			}
+		}
+		ev := sockserve.Timeout(sockserve.Prepl(pc, mode), timeout)
+		sockserve.Lines(ev).ServeConn(ctx, conn)
+	})
 }
 
-// handleConn pipes between client and APL prepl — raw APLAN passthrough.
-// No parsing, no decoding. Tooling reads the tagged APLAN protocol directly.
-func handleConn(pc *prepl.Client, conn net.Conn) {
-	defer conn.Close()
-	scanner := bufio.NewScanner(conn)
-	for scanner.Scan() {
-		expr := scanner.Text()
-		if expr == "" {
-			continue
-		}
-		raw, err := pc.EvalRaw(expr)
-		if err != nil {
-			log.Printf("eval error: %v", err)
-			return
-		}
-		fmt.Fprintf(conn, "%s\n", raw)
+// serve listens on the given address and serves client connections with h.
+// On a termination signal it stops taking new expressions, finishes those
+// already read, and exits.
+func serve(h sockserve.Handler, sockAddr string, cleanup func()) {
+	srv := sockserve.New(h)
+	if _, err := srv.Listen(sockAddr); err != nil {
+		log.Fatal(err)
 	}
-}
+	log.Printf("serving on %s", sockAddr)
 
-// handleConnPlain decodes APLAN and returns plain text — for interactive use.
-func handleConnPlain(pc *prepl.Client, conn net.Conn) {
-	defer conn.Close()
-	scanner := bufio.NewScanner(conn)
-	for scanner.Scan() {
-		expr := scanner.Text()
-		if expr == "" {
-			continue
-		}
-		resp, err := pc.Eval(expr)
-		if err != nil {
-			log.Printf("eval error: %v", err)
-			return
-		}
-		switch resp.Tag {
-		case "ret":
-			if resp.Raw != "" {
-				fmt.Fprintf(conn, "%s\n", resp.Raw)
-			}
-		case "err":
-			fmt.Fprintf(conn, "%s\n", resp.Err.Message)
-			for _, line := range resp.Err.DM {
-				fmt.Fprintf(conn, "%s\n", line)
-			}
-		}
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, termSignals()...)
+	<-sigCh
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		log.Printf("shutdown: %v", err)
 	}
+	cleanup()
+	os.Exit(0)
 }
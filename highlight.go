@@ -0,0 +1,90 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/charmbracelet/lipgloss/v2"
+	"github.com/cursork/gritt/syntax"
+)
+
+// defaultTheme gives the colour for each token kind, by syntax.Kind name.
+// "accent" means AccentColor; kinds not listed are left unstyled. Entries
+// in the config's "theme" override these, and "none" turns one off.
+var defaultTheme = map[string]string{
+	"comment":  "245",
+	"string":   "114",
+	"number":   "141",
+	"system":   "81",
+	"keyword":  "accent",
+	"command":  "accent",
+	"function": "223",
+	"operator": "180",
+	"dfn":      "209",
+	"assign":   "245",
+}
+
+// syntaxStyles holds the resolved theme; see initSyntaxTheme.
+var syntaxStyles = map[syntax.Kind]lipgloss.Style{}
+
+// initSyntaxTheme resolves the theme against the defaults. Call after
+// initColors so that "accent" picks up the configured accent.
+func initSyntaxTheme(theme map[string]string) {
+	syntaxStyles = map[syntax.Kind]lipgloss.Style{}
+	for _, kind := range syntax.Kinds() {
+		c, ok := theme[kind.String()]
+		if !ok {
+			c = defaultTheme[kind.String()]
+		}
+		switch c {
+		case "", "none":
+			continue
+		case "accent":
+			syntaxStyles[kind] = lipgloss.NewStyle().Foreground(AccentColor)
+		default:
+			syntaxStyles[kind] = lipgloss.NewStyle().Foreground(lipgloss.Color(c))
+		}
+	}
+}
+
+// highlight renders a line of APL with syntax colours.
+func highlight(line string) string {
+	runes := []rune(line)
+	return highlightRunes(runes, syntax.KindAt(line), -1, cursorStyle)
+}
+
+// highlightRunes renders runes with syntax colours. kinds comes from
+// syntax.KindAt on the whole line, so it may run past a truncated runes.
+// If cursor is within [0, len(runes)], that rune — or a trailing blank
+// when cursor == len(runes) — is drawn with cursor instead.
+func highlightRunes(runes []rune, kinds []syntax.Kind, cursor int, cursorSt lipgloss.Style) string {
+	var sb strings.Builder
+	flush := func(start, end int) {
+		if start >= end {
+			return
+		}
+		text := string(runes[start:end])
+		if st, ok := syntaxStyles[kinds[start]]; ok {
+			text = st.Render(text)
+		}
+		sb.WriteString(text)
+	}
+
+	start := 0
+	for i := range runes {
+		if i == cursor {
+			flush(start, i)
+			sb.WriteString(cursorSt.Render(string(runes[i])))
+			start = i + 1
+			continue
+		}
+		if i > start && kinds[i] != kinds[start] {
+			flush(start, i)
+			start = i
+		}
+	}
+	flush(start, len(runes))
+	if cursor == len(runes) {
+		sb.WriteString(cursorSt.Render(" "))
+	}
+	return sb.String()
+}
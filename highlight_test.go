@@ -0,0 +1,39 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/cursork/gritt/syntax"
+)
+
+func TestHighlight(t *testing.T) {
+	initSyntaxTheme(map[string]string{"number": "none", "name": "#FF0000"})
+	defer initSyntaxTheme(nil)
+
+	if _, ok := syntaxStyles[syntax.Number]; ok {
+		t.Error(`"none" should leave numbers unstyled`)
+	}
+	if _, ok := syntaxStyles[syntax.Name]; !ok {
+		t.Error("theme should add a style for names")
+	}
+	if _, ok := syntaxStyles[syntax.Comment]; !ok {
+		t.Error("defaults should still apply to kinds the theme omits")
+	}
+
+	line := "r←⎕IO+1 ⍝ note"
+	out := highlight(line)
+	if got := stripANSI(out); got != line {
+		t.Errorf("highlight changed the text: %q", got)
+	}
+	if !strings.Contains(out, "\x1b[") {
+		t.Errorf("highlight added no styling: %q", out)
+	}
+
+	// The cursor past the end draws a trailing blank.
+	runes := []rune("x←1")
+	out = highlightRunes(runes, syntax.KindAt("x←1"), len(runes), cursorStyle)
+	if got := stripANSI(out); got != "x←1 " {
+		t.Errorf("cursor at end = %q, want %q", got, "x←1 ")
+	}
+}
@@ -0,0 +1,612 @@
+// Package inline breaks a line of APL into the function applications the
+// interpreter makes when it runs the line, for the tracer's inline trace.
+//
+// The interpreter only traces whole lines, so gritt works the applications
+// out itself: Parse reads the line the way APL does — operators bind to
+// their operands left to right, arrays strand together, functions apply
+// right to left — and returns one Step per application, in the order they
+// are evaluated. Whether a name is an array, a function or an operator
+// depends on the workspace, so the caller looks the names up (⎕NC) and
+// passes a classifier.
+//
+// Parse is deliberately conservative: anything it can't be sure of, such
+// as an assignment inside the line or a glyph it doesn't know, is an error
+// rather than a guess.
+package inline
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/cursork/gritt/syntax"
+)
+
+// Class is the syntactic class of a name or expression.
+type Class int
+
+const (
+	Unknown   Class = iota
+	Array           // Including namespace references
+	Niladic         // A niladic function: an array, but running it has effects
+	Function        // Monadic, dyadic or ambivalent
+	MonadicOp       // Operator taking a left operand only
+	DyadicOp        // Operator taking left and right operands
+)
+
+// NameClass classifies a name from its ⎕NC name class and the function and
+// operator valences ⎕AT reports for it.
+func NameClass(nc, fnValence, opValence int) Class {
+	switch nc {
+	case 2, 9:
+		return Array
+	case 3:
+		if fnValence == 0 {
+			return Niladic
+		}
+		return Function
+	case 4:
+		switch opValence {
+		case 1:
+			return MonadicOp
+		case 2:
+			return DyadicOp
+		}
+	}
+	return Unknown
+}
+
+// Span is a piece of the line, in runes.
+type Span struct {
+	Start, End int
+	Text       string
+}
+
+// Step is one function application.
+type Step struct {
+	Expr  Span  // The whole application, arguments included
+	Func  Span  // The function, derived or not, less any axis
+	Axis  *Span // The axis expression inside [ ], if any
+	Left  *Span // The left argument; nil when applied monadically
+	Right Span
+
+	// AfterAssign is set for steps in a statement that follows an
+	// assignment on the same line: their values can't be known before
+	// the line runs.
+	AfterAssign bool
+}
+
+// dyadicOps are the primitive operators taking two operands; the rest of
+// syntax's operators take one.
+const dyadicOps = "∘.⍣⍤⍥@⌺⍠"
+
+// replicates are the operators that act as functions with an array on
+// their left: 1 0 1/x is replicate, not a reduction.
+const replicates = "/⌿\\⍀"
+
+// systemArrays are the system names that give arrays; other system names
+// are functions, except for the operators in systemOps.
+var systemArrays = map[string]bool{}
+
+var systemOps = map[string]bool{"⎕R": true, "⎕S": true, "⎕OPT": true}
+
+// safeSystemFns are the system functions that only compute a result, so
+// Pure lets them through.
+var safeSystemFns = map[string]bool{
+	"⎕UCS": true, "⎕DR": true, "⎕FMT": true, "⎕JSON": true, "⎕NC": true,
+	"⎕CR": true, "⎕VR": true, "⎕NR": true, "⎕SIZE": true, "⎕XML": true,
+}
+
+func init() {
+	for _, n := range strings.Fields(`A AI AN AV AVU CT D DCT DIV DM DMX EN
+		ET EXCEPTION FAVAIL FNAMES FNUMS FR IO KL LC LX ML NNAMES NNUMS NSI
+		NULL PATH PP PW RL RSI RTL SD SE SI SM STACK TC TCNUMS THIS TID
+		TNAME TNUMS TPOOL TRAP TS USING WA WSID WX XSI`) {
+		systemArrays["⎕"+n] = true
+	}
+}
+
+// systemClass classifies a system name, which needn't be looked up.
+func systemClass(name string) Class {
+	name = strings.ToUpper(name)
+	switch {
+	case name == "⎕" || name == "⍞" || systemArrays[name]:
+		return Array
+	case systemOps[name]:
+		return DyadicOp
+	}
+	return Function
+}
+
+// token is a syntax token, with qualified names (a.b.c, #.x, ⎕SE.y)
+// joined into one.
+type token struct {
+	kind  syntax.Kind
+	text  string
+	start int
+	end   int
+}
+
+// tokens splits line into tokens less blanks and comments.
+func tokens(line string) []token {
+	var toks []token
+	for _, t := range syntax.Tokenize(line) {
+		if t.Kind == syntax.Space || t.Kind == syntax.Comment {
+			continue
+		}
+		tok := token{kind: t.Kind, text: t.Text, start: t.Start, end: t.Start + len([]rune(t.Text))}
+		if t.Kind == syntax.Other && (t.Text == "#" || t.Text == "##") {
+			tok.kind = syntax.Name
+		}
+		// Join name.name, with no blanks in between
+		if n := len(toks); n >= 2 && (tok.kind == syntax.Name || tok.kind == syntax.SystemName) &&
+			toks[n-1].text == "." && toks[n-1].start == toks[n-2].end && tok.start == toks[n-1].end &&
+			(toks[n-2].kind == syntax.Name || toks[n-2].kind == syntax.SystemName) {
+			toks[n-2].text += "." + tok.text
+			toks[n-2].end = tok.end
+			toks[n-2].kind = syntax.Name
+			toks = toks[:n-1]
+			continue
+		}
+		toks = append(toks, tok)
+	}
+	return toks
+}
+
+// Names lists the names in line that Parse needs classified, each once:
+// user names, qualified names included, but not simple system names.
+func Names(line string) []string {
+	var names []string
+	seen := make(map[string]bool)
+	for _, t := range tokens(line) {
+		if t.kind == syntax.Name && !seen[t.text] {
+			seen[t.text] = true
+			names = append(names, t.text)
+		}
+	}
+	return names
+}
+
+// Pure reports whether an expression can be evaluated ahead of the line
+// without changing anything: it calls no user-defined functions or
+// operators, dfns, ⍎, ? or ⌶, reads no ⎕ or ⍞ input, assigns nothing and
+// uses no system functions beyond a few that only compute.
+func Pure(text string, class func(name string) Class) bool {
+	for _, t := range tokens(text) {
+		switch t.kind {
+		case syntax.Name:
+			if c := class(t.text); c != Array && c != Unknown {
+				return false
+			}
+		case syntax.SystemName:
+			if t.text == "⎕" || t.text == "⍞" {
+				return false
+			}
+			if systemClass(t.text) != Array && !safeSystemFns[strings.ToUpper(t.text)] {
+				return false
+			}
+		case syntax.Dfn:
+			if t.text != "⍺" && t.text != "⍵" {
+				return false
+			}
+		case syntax.Assign:
+			return false
+		case syntax.Function, syntax.Operator:
+			if strings.ContainsAny(t.text, "⍎?⌶") {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// item is a parsed piece of an expression: an array, a function or an
+// operator, with the steps that evaluating it takes.
+type item struct {
+	class  Class
+	start  int
+	end    int
+	axis   *Span
+	axisAt int // Where the axis's [ is
+	steps  []Step
+	outer  bool // ∘. waiting for its function
+}
+
+// join concatenates step lists into a new one.
+func join(lists ...[]Step) []Step {
+	var steps []Step
+	for _, l := range lists {
+		steps = append(steps, l...)
+	}
+	return steps
+}
+
+type parser struct {
+	line     []rune
+	toks     []token
+	class    func(name string) Class
+	assigned map[string]bool // Names assigned by earlier statements
+}
+
+func (p *parser) span(start, end int) Span {
+	return Span{Start: start, End: end, Text: string(p.line[start:end])}
+}
+
+// Parse returns the applications on line in the order the interpreter
+// makes them. Statements separated by ⋄ (and a dfn guard and its
+// expression) follow each other; a control keyword and anything up to an
+// assignment are skipped, as neither applies a function. class classifies
+// the user names that Names lists.
+func Parse(line string, class func(name string) Class) ([]Step, error) {
+	p := &parser{line: []rune(line), toks: tokens(line), class: class, assigned: make(map[string]bool)}
+	var steps []Step
+	assigned := false
+	for _, stmt := range p.statements() {
+		// Skip a leading keyword and everything up to the last
+		// top-level assignment or branch
+		from := 0
+		depth := 0
+		for i, t := range stmt {
+			switch {
+			case t.text == "(" || t.text == "[" || t.text == "{":
+				depth++
+			case t.text == ")" || t.text == "]" || t.text == "}":
+				depth--
+			case depth == 0 && (t.kind == syntax.Keyword || t.kind == syntax.Assign):
+				from = i + 1
+			}
+		}
+		// A lone name or constant applies nothing (and may be a label)
+		if body := stmt[from:]; len(body) > 1 {
+			it, err := p.expr(body)
+			if err != nil {
+				return nil, err
+			}
+			for _, s := range it.steps {
+				s.AfterAssign = assigned
+				steps = append(steps, s)
+			}
+		}
+		if from > 0 && stmt[from-1].kind == syntax.Assign {
+			assigned = true
+			for _, t := range stmt[:from] {
+				if t.kind == syntax.Name {
+					p.assigned[t.text] = true
+				}
+			}
+		}
+	}
+	return steps, nil
+}
+
+// statements splits the tokens at top-level ⋄ and dfn guard colons.
+func (p *parser) statements() [][]token {
+	var stmts [][]token
+	depth, from := 0, 0
+	for i, t := range p.toks {
+		switch {
+		case t.text == "(" || t.text == "[" || t.text == "{":
+			depth++
+		case t.text == ")" || t.text == "]" || t.text == "}":
+			depth--
+		case depth == 0 && (t.text == "⋄" || t.text == ":"):
+			stmts = append(stmts, p.toks[from:i])
+			from = i + 1
+		}
+	}
+	return append(stmts, p.toks[from:])
+}
+
+// closing returns the index of the bracket closing the one at toks[i].
+func closing(toks []token, i int) (int, error) {
+	open := toks[i].text
+	shut := map[string]string{"(": ")", "[": "]", "{": "}"}[open]
+	depth := 0
+	for j := i; j < len(toks); j++ {
+		switch toks[j].text {
+		case "(", "[", "{":
+			depth++
+		case ")", "]", "}":
+			depth--
+			if depth == 0 {
+				if toks[j].text != shut {
+					return 0, fmt.Errorf("mismatched %s", toks[j].text)
+				}
+				return j, nil
+			}
+		}
+	}
+	return 0, fmt.Errorf("unclosed %s", open)
+}
+
+// expr parses an expression: its items, operators bound, arrays stranded
+// and functions applied. The result is an array, or a function for a
+// train or derived function.
+func (p *parser) expr(toks []token) (item, error) {
+	items, err := p.items(toks)
+	if err != nil {
+		return item{}, err
+	}
+	if items, err = p.bind(items); err != nil {
+		return item{}, err
+	}
+	items = p.strand(items)
+	return p.apply(items)
+}
+
+// items reads the atoms of an expression.
+func (p *parser) items(toks []token) ([]item, error) {
+	var items []item
+	for i := 0; i < len(toks); i++ {
+		t := toks[i]
+		it := item{start: t.start, end: t.end}
+		switch {
+		case t.kind == syntax.Number || t.kind == syntax.String:
+			it.class = Array
+		case t.kind == syntax.Name:
+			switch c := p.class(t.text); c {
+			case Niladic:
+				it.class = Array
+			case Unknown:
+				// Not there yet, but set earlier on the line
+				if !p.assigned[t.text] {
+					return nil, fmt.Errorf("%s is not defined", t.text)
+				}
+				it.class = Array
+			default:
+				it.class = c
+			}
+		case t.kind == syntax.SystemName:
+			it.class = systemClass(t.text)
+		case t.text == "⍺" || t.text == "⍵":
+			it.class = Array
+		case t.text == "⍺⍺" || t.text == "⍵⍵" || t.text == "∇":
+			it.class = Function
+		case t.text == "{":
+			j, err := closing(toks, i)
+			if err != nil {
+				return nil, err
+			}
+			it.class = dfnClass(toks[i+1 : j])
+			it.end = toks[j].end
+			i = j
+		case t.text == "(":
+			j, err := closing(toks, i)
+			if err != nil {
+				return nil, err
+			}
+			if j == i+1 {
+				return nil, fmt.Errorf("empty parentheses")
+			}
+			inner, err := p.expr(toks[i+1 : j])
+			if err != nil {
+				return nil, err
+			}
+			it.class, it.steps = inner.class, inner.steps
+			it.end = toks[j].end
+			i = j
+		case t.text == "[":
+			j, err := closing(toks, i)
+			if err != nil {
+				return nil, err
+			}
+			if len(items) == 0 {
+				return nil, fmt.Errorf("[ with nothing before it")
+			}
+			if err := p.bracket(&items[len(items)-1], toks[i:j+1]); err != nil {
+				return nil, err
+			}
+			i = j
+			continue
+		case t.text == "∘" && i+1 < len(toks) && toks[i+1].text == "." && toks[i+1].start == t.end:
+			it.outer = true
+			it.end = toks[i+1].end
+			i++
+		case t.kind == syntax.Function:
+			it.class = Function
+		case t.kind == syntax.Operator || t.text == "⍠":
+			it.class = MonadicOp
+			if strings.Contains(dyadicOps, t.text) {
+				it.class = DyadicOp
+			}
+		case t.kind == syntax.Assign:
+			return nil, fmt.Errorf("can't trace an assignment inside an expression")
+		default:
+			return nil, fmt.Errorf("can't trace %s", t.text)
+		}
+		items = append(items, it)
+	}
+	return items, nil
+}
+
+// dfnClass tells a dfn from a dfn operator by the operands it refers to.
+func dfnClass(body []token) Class {
+	class := Function
+	depth := 0
+	for _, t := range body {
+		switch t.text {
+		case "{":
+			depth++
+		case "}":
+			depth--
+		case "⍺⍺":
+			if depth == 0 && class == Function {
+				class = MonadicOp
+			}
+		case "⍵⍵":
+			if depth == 0 {
+				class = DyadicOp
+			}
+		}
+	}
+	return class
+}
+
+// bracket applies [ ] to the item before it: an index for an array, an
+// axis for a function or operator.
+func (p *parser) bracket(it *item, toks []token) error {
+	inner := toks[1 : len(toks)-1]
+	// Each ;-separated part is an expression of its own
+	var steps []Step
+	depth, from := 0, 0
+	for i := 0; i <= len(inner); i++ {
+		if i < len(inner) {
+			switch inner[i].text {
+			case "(", "[", "{":
+				depth++
+				continue
+			case ")", "]", "}":
+				depth--
+				continue
+			}
+			if inner[i].text != ";" || depth > 0 {
+				continue
+			}
+		}
+		if part := inner[from:i]; len(part) > 0 {
+			sub, err := p.expr(part)
+			if err != nil {
+				return err
+			}
+			steps = join(sub.steps, steps) // right to left
+		}
+		from = i + 1
+	}
+
+	open, close := toks[0], toks[len(toks)-1]
+	if it.class == Array {
+		right := p.span(it.start, it.end)
+		it.steps = join(steps, it.steps, []Step{{
+			Expr:  p.span(it.start, close.end),
+			Func:  p.span(open.start, close.end),
+			Right: right,
+		}})
+	} else {
+		if len(inner) == 0 {
+			return fmt.Errorf("empty axis")
+		}
+		axis := p.span(inner[0].start, inner[len(inner)-1].end)
+		it.axis = &axis
+		it.axisAt = open.start
+		it.steps = join(it.steps, steps)
+	}
+	it.end = close.end
+	return nil
+}
+
+// bind applies operators to their operands, left to right.
+func (p *parser) bind(items []item) ([]item, error) {
+	var out []item
+	for i := 0; i < len(items); i++ {
+		it := items[i]
+		switch {
+		case it.outer:
+			if i+1 == len(items) || items[i+1].class != Function {
+				return nil, fmt.Errorf("∘. needs a function")
+			}
+			f := items[i+1]
+			out = append(out, item{class: Function, start: it.start, end: f.end, axis: f.axis, axisAt: f.axisAt, steps: f.steps})
+			i++
+		case it.class == MonadicOp:
+			if len(out) == 0 {
+				return nil, fmt.Errorf("%s has no operand", p.span(it.start, it.end).Text)
+			}
+			operand := out[len(out)-1]
+			glyph := string(p.line[it.start])
+			if strings.Contains(replicates, glyph) && operand.class == Array {
+				it.class = Function
+				out = append(out, it)
+				continue
+			}
+			out[len(out)-1] = item{
+				class:  Function,
+				start:  operand.start,
+				end:    it.end,
+				axis:   it.axis,
+				axisAt: it.axisAt,
+				steps:  join(operand.steps, it.steps),
+			}
+		case it.class == DyadicOp:
+			if len(out) == 0 || i+1 == len(items) {
+				return nil, fmt.Errorf("%s needs two operands", p.span(it.start, it.end).Text)
+			}
+			left := out[len(out)-1]
+			right := items[i+1]
+			i++
+			if right.class == Array {
+				// An array right operand takes the whole strand: ⍤1 0
+				for i+1 < len(items) && items[i+1].class == Array {
+					i++
+					right.steps = join(items[i].steps, right.steps)
+					right.end = items[i].end
+				}
+			} else if right.class != Function {
+				return nil, fmt.Errorf("%s needs a right operand", p.span(it.start, it.end).Text)
+			}
+			out[len(out)-1] = item{
+				class:  Function,
+				start:  left.start,
+				end:    right.end,
+				axis:   right.axis,
+				axisAt: right.axisAt,
+				steps:  join(right.steps, it.steps, left.steps),
+			}
+		default:
+			out = append(out, it)
+		}
+	}
+	return out, nil
+}
+
+// strand joins neighbouring arrays into one, evaluated right to left.
+func (p *parser) strand(items []item) []item {
+	var out []item
+	for _, it := range items {
+		if n := len(out); n > 0 && it.class == Array && out[n-1].class == Array {
+			out[n-1].steps = join(it.steps, out[n-1].steps)
+			out[n-1].end = it.end
+			continue
+		}
+		out = append(out, it)
+	}
+	return out
+}
+
+// apply applies the functions right to left. A sequence ending in a
+// function is a train (or a lone function) and applies nothing.
+func (p *parser) apply(items []item) (item, error) {
+	last := items[len(items)-1]
+	if last.class != Array {
+		whole := item{class: Function, start: items[0].start, end: last.end}
+		if len(items) == 1 {
+			whole.axis, whole.axisAt, whole.steps = last.axis, last.axisAt, last.steps
+		}
+		return whole, nil
+	}
+	result := last
+	for i := len(items) - 2; i >= 0; {
+		f := items[i]
+		if f.class != Function {
+			return item{}, fmt.Errorf("can't apply %s", p.span(f.start, f.end).Text)
+		}
+		fn := f.end
+		if f.axis != nil {
+			fn = f.axisAt
+		}
+		step := Step{Func: p.span(f.start, fn), Axis: f.axis, Right: p.span(result.start, result.end)}
+		steps := join(result.steps, f.steps)
+		start := f.start
+		if i > 0 && items[i-1].class == Array {
+			left := items[i-1]
+			l := p.span(left.start, left.end)
+			step.Left = &l
+			steps = join(steps, left.steps)
+			start = left.start
+			i -= 2
+		} else {
+			i--
+		}
+		step.Expr = p.span(start, result.end)
+		result = item{class: Array, start: start, end: result.end, steps: join(steps, []Step{step})}
+	}
+	return result, nil
+}
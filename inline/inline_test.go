@@ -0,0 +1,169 @@
+package inline
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// classes is a workspace where foo is a function, op a monadic operator,
+// now a niladic function and every other name an array.
+func classes(name string) Class {
+	switch name {
+	case "foo":
+		return Function
+	case "op":
+		return MonadicOp
+	case "now":
+		return Niladic
+	case "gone":
+		return Unknown
+	}
+	return Array
+}
+
+// describe renders each step as "left func[axis] right".
+func describe(steps []Step) []string {
+	var out []string
+	for _, s := range steps {
+		d := s.Func.Text
+		if s.Axis != nil {
+			d += "[" + s.Axis.Text + "]"
+		}
+		if s.Left != nil {
+			d = s.Left.Text + " " + d
+		}
+		d += " " + s.Right.Text
+		out = append(out, d)
+	}
+	return out
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		line string
+		want []string
+	}{
+		{"(+/⍵)÷≢⍵", []string{"≢ ⍵", "+/ ⍵", "(+/⍵) ÷ ≢⍵"}},
+		{"r←foo 2×x  ⍝ double", []string{"2 × x", "foo 2×x"}},
+		{"1 0 1/x", []string{"1 0 1 / x"}},
+		{"+⌿[1]m", []string{"+⌿[1] m"}},
+		{"v[⍳2]", []string{"⍳ 2", "[⍳2] v"}},
+		{"0=⍵:1 ⋄ ⍵×∇⍵-1", []string{"0 = ⍵", "⍵ - 1", "∇ ⍵-1", "⍵ × ∇⍵-1"}},
+		{"x∘.×y", []string{"x ∘.× y"}},
+		{"+⍤1 0⊢m", []string{"⊢ m", "+⍤1 0 ⊢m"}},
+		{"(+/÷≢)x", []string{"(+/÷≢) x"}},
+		{"-op 1 2", []string{"-op 1 2"}},
+		{"foo bar baz", []string{"foo bar baz"}},
+		{"a ns.foo.b+now", []string{"a ns.foo.b + now"}},
+		{":If x>0", []string{"x > 0"}},
+		{"label:", nil},
+		{"→0", nil},
+	}
+	for _, tt := range tests {
+		steps, err := Parse(tt.line, classes)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", tt.line, err)
+			continue
+		}
+		if got := describe(steps); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Parse(%q) = %q, want %q", tt.line, got, tt.want)
+		}
+	}
+}
+
+func TestParseSpans(t *testing.T) {
+	steps, err := Parse("r←⌽⍳n", classes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(steps) != 2 {
+		t.Fatalf("got %d steps", len(steps))
+	}
+	if s := steps[1]; s.Expr.Start != 2 || s.Expr.End != 5 || s.Func.Start != 2 || s.Right.Start != 3 {
+		t.Errorf("⌽ step spans: %+v", s)
+	}
+}
+
+func TestParseAfterAssign(t *testing.T) {
+	steps, err := Parse("t←2×x ⋄ t+1", classes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(steps) != 2 || steps[0].AfterAssign || !steps[1].AfterAssign {
+		t.Errorf("steps: %+v", steps)
+	}
+	// A name only set earlier on the line is taken for an array
+	if _, err := Parse("gone←⍳3 ⋄ gone+1", classes); err != nil {
+		t.Errorf("assigned on the line: %v", err)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for line, want := range map[string]string{
+		"a+(b←2)":  "assignment",
+		"gone+1":   "not defined",
+		"(1+2":     "unclosed",
+		"+/":       "",
+		"x ¨":      "",
+		"1 2 foo ": "",
+	} {
+		_, err := Parse(line, classes)
+		if want == "" {
+			continue // only mustn't panic
+		}
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("Parse(%q) error = %v, want %q", line, err, want)
+		}
+	}
+}
+
+func TestNames(t *testing.T) {
+	got := Names("ns.f x+#.y×x ⎕IO ⎕SE.z")
+	want := []string{"ns.f", "x", "#.y", "⎕SE.z"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Names = %q, want %q", got, want)
+	}
+}
+
+func TestPure(t *testing.T) {
+	for text, want := range map[string]bool{
+		"x+1":     true,
+		"⍵[⍳2]":   true,
+		"⎕UCS 65": true,
+		"⎕IO+⍳3":  true,
+		"foo x":   false,
+		"now":     false,
+		"?6":      false,
+		"⍎'1'":    false,
+		"⎕DL 1":   false,
+		"{⍵}1":    false,
+		"⍞":       false,
+		"x op":    false,
+		"a+(b←2)": false,
+		"gone":    true,
+	} {
+		if got := Pure(text, classes); got != want {
+			t.Errorf("Pure(%q) = %v, want %v", text, got, want)
+		}
+	}
+}
+
+func TestNameClass(t *testing.T) {
+	for _, tt := range []struct {
+		nc, fv, ov int
+		want       Class
+	}{
+		{2, 0, 0, Array},
+		{9, 0, 0, Array},
+		{3, 0, 0, Niladic},
+		{3, -2, 0, Function},
+		{4, 1, 1, MonadicOp},
+		{4, 2, 2, DyadicOp},
+		{0, 0, 0, Unknown},
+	} {
+		if got := NameClass(tt.nc, tt.fv, tt.ov); got != tt.want {
+			t.Errorf("NameClass(%d, %d, %d) = %v, want %v", tt.nc, tt.fv, tt.ov, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss/v2"
+	"github.com/cursork/gritt/inline"
+)
+
+// InlineTracePane steps through the function applications on the tracer's
+// current line (see package inline), showing each one's function, axis,
+// arguments and the result of the step before. The values are worked out
+// ahead of the line, in the suspended function, for the pieces that can
+// be evaluated without side effects.
+//
+// Like the workspace pane it talks to the model through Pending fields:
+// the model classifies PendingNames and answers with SetClasses, then
+// evaluates PendingValues and answers with SetValues.
+type InlineTracePane struct {
+	Row  int // Line number in the traced function
+	Line string
+
+	classes map[string]inline.Class
+	steps   []inline.Step
+	pure    map[string]bool   // Expressions that can be evaluated ahead
+	values  map[string]string // Expression → its display, once evaluated
+	step    int
+	err     string
+
+	PendingNames  []string // Names to classify, by ⎕NC and ⎕AT
+	PendingValues []string // Expressions to evaluate
+
+	// Styles
+	labelStyle  lipgloss.Style
+	exprStyle   lipgloss.Style
+	statusStyle lipgloss.Style
+}
+
+// NewInlineTracePane creates an inline trace pane with no line yet
+func NewInlineTracePane() *InlineTracePane {
+	return &InlineTracePane{
+		Row:         -1,
+		labelStyle:  lipgloss.NewStyle().Foreground(lipgloss.Color("243")),
+		exprStyle:   lipgloss.NewStyle().Foreground(AccentColor).Bold(true),
+		statusStyle: lipgloss.NewStyle().Foreground(lipgloss.Color("245")),
+	}
+}
+
+// SetLine starts tracing a new line. The line's names are classified
+// first; a line without names is parsed straight away.
+func (p *InlineTracePane) SetLine(row int, line string) {
+	if row == p.Row && line == p.Line {
+		return
+	}
+	p.Row, p.Line = row, line
+	p.classes = nil
+	p.steps, p.pure, p.values, p.step, p.err = nil, nil, nil, 0, ""
+	p.PendingValues = nil
+	p.PendingNames = inline.Names(line)
+	if len(p.PendingNames) == 0 {
+		p.SetClasses(nil)
+	}
+}
+
+// SetClasses parses the line with its names classified, and asks for the
+// values of the steps' pure pieces.
+func (p *InlineTracePane) SetClasses(classes map[string]inline.Class) {
+	p.PendingNames = nil
+	p.classes = classes
+	steps, err := inline.Parse(p.Line, p.class)
+	if err != nil {
+		p.err = err.Error()
+		return
+	}
+	if len(steps) == 0 {
+		p.err = "nothing is applied on this line"
+		return
+	}
+	p.steps = steps
+	p.pure = make(map[string]bool)
+	p.values = make(map[string]string)
+	for _, s := range steps {
+		if s.AfterAssign {
+			continue
+		}
+		for _, span := range []*inline.Span{&s.Expr, s.Axis, s.Left, &s.Right} {
+			if span == nil {
+				continue
+			}
+			if !p.pure[span.Text] && inline.Pure(span.Text, p.class) {
+				p.pure[span.Text] = true
+				p.PendingValues = append(p.PendingValues, span.Text)
+			}
+		}
+	}
+}
+
+// SetValues records the display of the expressions evaluated
+func (p *InlineTracePane) SetValues(values map[string]string) {
+	p.PendingValues = nil
+	for expr, v := range values {
+		p.values[expr] = v
+	}
+}
+
+func (p *InlineTracePane) class(name string) inline.Class {
+	return p.classes[name]
+}
+
+// Current returns the step shown, or nil before the line is parsed
+func (p *InlineTracePane) Current() *inline.Step {
+	if p.step < len(p.steps) {
+		return &p.steps[p.step]
+	}
+	return nil
+}
+
+func (p *InlineTracePane) Title() string {
+	if len(p.steps) == 0 {
+		return "inline trace"
+	}
+	return fmt.Sprintf("inline trace %d/%d", p.step+1, len(p.steps))
+}
+
+// value describes an expression's value for display
+func (p *InlineTracePane) value(s inline.Step, span inline.Span) string {
+	v, ok := p.values[span.Text]
+	switch {
+	case s.AfterAssign:
+		return "(known once the line runs)"
+	case !p.pure[span.Text]:
+		return "(not evaluated: side effects)"
+	case !ok:
+		return "…"
+	}
+	return v
+}
+
+func (p *InlineTracePane) Render(w, h int) string {
+	var lines []string
+	add := func(label, text string) {
+		for i, l := range strings.Split(text, "\n") {
+			if i > 0 {
+				label = ""
+			}
+			l, _ = fitLine(l, "", w-10)
+			lines = append(lines, p.labelStyle.Render(fmt.Sprintf("%-10s", label))+l)
+		}
+	}
+	// arg shows an argument's text, and its value when that says more
+	arg := func(label string, s inline.Step, span inline.Span) {
+		v := p.value(s, span)
+		if v == span.Text {
+			add(label, v)
+			return
+		}
+		add(label, span.Text)
+		add("", v)
+	}
+
+	s := p.Current()
+	switch {
+	case p.err != "":
+		add("", "can't trace this line: "+p.err)
+	case s == nil:
+		add("", "…")
+	default:
+		text, _ := fitLine(s.Expr.Text, "", w)
+		lines = append(lines, p.exprStyle.Render(text))
+		add("function", s.Func.Text)
+		if s.Axis != nil {
+			arg("axis", *s, *s.Axis)
+		}
+		if s.Left != nil {
+			arg("left", *s, *s.Left)
+		}
+		arg("right", *s, s.Right)
+		if p.step > 0 {
+			prev := p.steps[p.step-1]
+			arg("previous", prev, prev.Expr)
+		}
+	}
+
+	listH := h - 1 // Last line: key help
+	if len(lines) > listH {
+		lines = lines[:max(listH, 0)]
+	}
+	for len(lines) < listH {
+		lines = append(lines, "")
+	}
+	footer, _ := fitLine("← → step  Home/End first/last", "", w)
+	lines = append(lines, p.statusStyle.Render(footer))
+	return strings.Join(lines, "\n")
+}
+
+func (p *InlineTracePane) HandleKey(msg tea.KeyMsg) bool {
+	switch msg.Type {
+	case tea.KeyLeft, tea.KeyUp:
+		if p.step > 0 {
+			p.step--
+		}
+		return true
+	case tea.KeyRight, tea.KeyDown:
+		if p.step < len(p.steps)-1 {
+			p.step++
+		}
+		return true
+	case tea.KeyHome:
+		p.step = 0
+		return true
+	case tea.KeyEnd:
+		p.step = max(len(p.steps)-1, 0)
+		return true
+	}
+	return false
+}
+
+func (p *InlineTracePane) HandleMouse(x, y int, msg tea.MouseMsg) bool {
+	return false
+}
+
+// inlineNamesExpr classifies names: one row per name of its ⎕NC class and
+// the result, function and operator valences from ⎕AT.
+func inlineNamesExpr(names []string) string {
+	quoted := make([]string, len(names))
+	for i, n := range names {
+		quoted[i] = "(⊂,'" + n + "')"
+	}
+	return "↑{3 4∊⍨⌊⎕NC⊂⍵:(⌊⎕NC⊂⍵),⊃⎕AT⍵ ⋄ (⌊⎕NC⊂⍵),0 0 0}¨" + strings.Join(quoted, ",")
+}
+
+// parseInlineNames reads inlineNamesExpr's output. Names it can't account
+// for are left out, so they stay Unknown.
+func parseInlineNames(names []string, outputs []string) map[string]inline.Class {
+	classes := make(map[string]inline.Class)
+	i := 0
+	for _, line := range strings.Split(strings.Join(outputs, ""), "\n") {
+		fields := strings.Fields(strings.ReplaceAll(line, "¯", "-"))
+		if len(fields) != 4 || i == len(names) {
+			continue
+		}
+		var n [4]int
+		ok := true
+		for j, f := range fields {
+			v, err := strconv.Atoi(f)
+			if err != nil {
+				ok = false
+			}
+			n[j] = v
+		}
+		if ok {
+			classes[names[i]] = inline.NameClass(n[0], n[2], n[3])
+		}
+		i++
+	}
+	return classes
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/cursork/gritt/inline"
+	"github.com/cursork/gritt/ride"
+	"github.com/cursork/gritt/ride/ridetest"
+)
+
+func TestInlineTracePane(t *testing.T) {
+	p := NewInlineTracePane()
+	p.SetLine(2, "r←(+/v)÷foo v")
+	if !reflect.DeepEqual(p.PendingNames, []string{"r", "v", "foo"}) {
+		t.Fatalf("PendingNames = %q", p.PendingNames)
+	}
+	p.SetClasses(parseInlineNames(p.PendingNames, []string{" 2 0  0 0\n 2 0  0 0\n 3 1 ¯2 0\n"}))
+	if p.err != "" || len(p.steps) != 3 {
+		t.Fatalf("parse: err %q, %d steps", p.err, len(p.steps))
+	}
+	// foo is a user function: its result can't be had ahead of the line
+	exprs := p.PendingValues
+	if want := []string{"v", "+/v", "(+/v)"}; !reflect.DeepEqual(exprs, want) {
+		t.Fatalf("PendingValues = %q, want %q", exprs, want)
+	}
+	p.SetValues(parseEvalEach(exprs, []string{"⍝GRITT 0\n1 2 3\n", "⍝GRITT 1\n6\n⍝GRITT 2\n⍝GRITT !\n"}))
+
+	out := stripANSI(p.Render(40, 8))
+	for _, want := range []string{"foo v", "function  foo", "right     v", "          1 2 3"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("step 1 render lacks %q:\n%s", want, out)
+		}
+	}
+	p.HandleKey(tea.KeyMsg{Type: tea.KeyRight})
+	p.HandleKey(tea.KeyMsg{Type: tea.KeyRight})
+	out = stripANSI(p.Render(40, 10))
+	for _, want := range []string{"(+/v)÷foo v", "left      (+/v)", "(error)", "(not evaluated: side effects)", "previous  +/v", "          6"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("step 3 render lacks %q:\n%s", want, out)
+		}
+	}
+	if p.Title() != "inline trace 3/3" {
+		t.Errorf("title %q", p.Title())
+	}
+	p.HandleKey(tea.KeyMsg{Type: tea.KeyHome})
+	if s := p.Current(); s == nil || s.Func.Text != "foo" {
+		t.Errorf("Home: step %+v", s)
+	}
+}
+
+func TestInlineTraceExprs(t *testing.T) {
+	if got, want := inlineNamesExpr([]string{"a", "ns.b"}), "↑{3 4∊⍨⌊⎕NC⊂⍵:(⌊⎕NC⊂⍵),⊃⎕AT⍵ ⋄ (⌊⎕NC⊂⍵),0 0 0}¨(⊂,'a'),(⊂,'ns.b')"; got != want {
+		t.Errorf("inlineNamesExpr = %s", got)
+	}
+	if got, want := evalEachExpr([]string{"x", "'a'"}), "⎕←'⍝GRITT 0' ⋄ ⎕←'''⍝GRITT !'''⎕EA'x' ⋄ ⎕←'⍝GRITT 1' ⋄ ⎕←'''⍝GRITT !'''⎕EA'''a'''"; got != want {
+		t.Errorf("evalEachExpr = %s", got)
+	}
+	got := parseInlineNames([]string{"f", "op", "x"}, []string{"3 1 ¯2 0\n4 1 1 2\n"})
+	want := map[string]inline.Class{"f": inline.Function, "op": inline.DyadicOp}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseInlineNames = %v", got)
+	}
+}
+
+func TestInlineTraceModel(t *testing.T) {
+	client, srv := fakeInterpreter(t, func(*ride.Message) []*ride.Message { return nil })
+	m := newTestModel(t, client)
+	m.recv(&ride.Message{Command: "OpenWindow", Args: map[string]any{
+		"token": 1, "name": "f", "debugger": 1, "text": []string{"r←f y", "r←1+y"}, "currentRow": 1,
+	}})
+	m.recv(&ride.Message{Command: "SetHighlightLine", Args: map[string]any{"win": 1, "line": 1}})
+
+	// t in the tracer opens the pane, which looks up the line's names
+	tracer := m.tracerEditorPane()
+	m.update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'t'}})
+	if m.panes.Get("inline") == nil || m.internalQuery == "" {
+		t.Fatalf("pane %v, query %q", m.panes.Get("inline"), m.internalQuery)
+	}
+	m.recv(ridetest.Prompt(0))
+	m.recv(ridetest.Output(2, " 2 0 0 0\n 2 0 0 0\n"))
+	m.recv(ridetest.Prompt(1))
+	if !strings.Contains(m.internalQuery, "⎕EA'1+y'") {
+		t.Fatalf("values query = %q", m.internalQuery)
+	}
+	if tracer.inlineLine != 1 || tracer.inlineStart != 2 || tracer.inlineEnd != 5 {
+		t.Errorf("tracer highlight: line %d, %d-%d", tracer.inlineLine, tracer.inlineStart, tracer.inlineEnd)
+	}
+
+	// Esc closes the pane and the highlight with it
+	m.update(tea.KeyMsg{Type: tea.KeyEscape})
+	if m.panes.Get("inline") != nil || tracer.inlineLine != -1 {
+		t.Errorf("after Esc: pane %v, highlight line %d", m.panes.Get("inline"), tracer.inlineLine)
+	}
+	waitReceived(srv, 2)
+	texts := executed(srv)
+	if len(texts) != 2 || !strings.Contains(texts[0], "⎕NC") {
+		t.Errorf("executed %q", texts)
+	}
+}
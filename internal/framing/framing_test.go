@@ -0,0 +1,42 @@
+package framing
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	for _, v := range []any{map[string]any{"method": "x", "params": "⍳5"}, "two"} {
+		if err := Write(&buf, v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	br := bufio.NewReader(&buf)
+	body, err := Read(br)
+	if err != nil || !strings.Contains(string(body), "⍳5") {
+		t.Errorf("first = %q, %v", body, err)
+	}
+	if body, err := Read(br); err != nil || string(body) != `"two"` {
+		t.Errorf("second = %q, %v", body, err)
+	}
+	if _, err := Read(br); !errors.Is(err, io.EOF) {
+		t.Errorf("at end: %v, want EOF", err)
+	}
+}
+
+func TestReadBadHeader(t *testing.T) {
+	for _, in := range []string{
+		"Content-Length: x\r\n\r\n{}",
+		"Content-Type: json\r\n\r\n{}",
+		"Content-Length: 10\r\n\r\n{}",
+	} {
+		if _, err := Read(bufio.NewReader(strings.NewReader(in))); err == nil || errors.Is(err, io.EOF) {
+			t.Errorf("Read(%q) = %v, want an error", in, err)
+		}
+	}
+}
@@ -0,0 +1,509 @@
+// Package lsp implements a Language Server Protocol server for Dyalog APL
+// source files, backed by a live interpreter via the session package.
+//
+// JSON-RPC 2.0 over stdio with LSP's Content-Length framing. Provides:
+//
+//   - completion via RIDE GetAutocomplete (same flow as the TUI)
+//   - hover from the cached Dyalog docs and I-beam tables
+//   - whole-document formatting via Dyalog's formatter
+//   - diagnostics from ⎕FIX of function files, run on open and save
+//
+// Positions are exchanged as LSP UTF-16 offsets. Every APL glyph lives in
+// the Basic Multilingual Plane, so those are treated as rune offsets.
+package lsp
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/cursork/gritt/docs"
+	"github.com/cursork/gritt/ibeam"
+	"github.com/cursork/gritt/internal/framing"
+	"github.com/cursork/gritt/session"
+)
+
+// Server implements the Language Server Protocol.
+type Server struct {
+	sess   *session.Session // nil: completion, formatting and diagnostics are disabled
+	docsDB *sql.DB
+
+	docs map[string][]string // open documents by URI, split into lines
+
+	wmu sync.Mutex // serialises writes to the client
+	w   io.Writer
+}
+
+// NewServer creates an LSP server driving sess. A nil session is allowed;
+// the server then only answers hover requests.
+func NewServer(sess *session.Session) *Server {
+	s := &Server{sess: sess, docs: make(map[string][]string)}
+	if db, err := docs.OpenCache(); err == nil {
+		if db.Ping() == nil {
+			s.docsDB = db
+		} else {
+			db.Close()
+		}
+	}
+	return s
+}
+
+// JSON-RPC 2.0 message types.
+
+type rpcMessage struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method,omitempty"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+type rpcResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  any             `json:"result"`
+	Error   *rpcError       `json:"error,omitempty"`
+}
+
+type rpcNotification struct {
+	JSONRPC string `json:"jsonrpc"`
+	Method  string `json:"method"`
+	Params  any    `json:"params"`
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// LSP structures (only the fields gritt uses).
+
+type position struct {
+	Line      int `json:"line"`
+	Character int `json:"character"`
+}
+
+type lspRange struct {
+	Start position `json:"start"`
+	End   position `json:"end"`
+}
+
+type textEdit struct {
+	Range   lspRange `json:"range"`
+	NewText string   `json:"newText"`
+}
+
+type diagnostic struct {
+	Range    lspRange `json:"range"`
+	Severity int      `json:"severity"`
+	Source   string   `json:"source"`
+	Message  string   `json:"message"`
+}
+
+type textDocumentPosition struct {
+	TextDocument struct {
+		URI string `json:"uri"`
+	} `json:"textDocument"`
+	Position position `json:"position"`
+}
+
+// Serve reads LSP messages from r and writes responses and notifications to w.
+// Returns nil when the client sends "exit".
+func (s *Server) Serve(ctx context.Context, r io.Reader, w io.Writer) error {
+	s.w = w
+	br := bufio.NewReader(r)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+
+		body, err := framing.Read(br)
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+
+		var msg rpcMessage
+		if err := json.Unmarshal(body, &msg); err != nil {
+			s.write(rpcResponse{
+				JSONRPC: "2.0",
+				ID:      json.RawMessage("null"),
+				Error:   &rpcError{Code: -32700, Message: "parse error"},
+			})
+			continue
+		}
+		switch msg.Method {
+		case "":
+			continue // a response to something we never send
+		case "exit":
+			return nil
+		}
+
+		result, rerr := s.handle(ctx, msg)
+		if msg.ID == nil {
+			continue // notifications get no response
+		}
+		resp := rpcResponse{JSONRPC: "2.0", ID: msg.ID, Result: result}
+		if rerr != nil {
+			resp.Result = nil
+			resp.Error = rerr
+		}
+		s.write(resp)
+	}
+}
+
+func (s *Server) handle(ctx context.Context, msg rpcMessage) (any, *rpcError) {
+	switch msg.Method {
+	case "initialize":
+		return map[string]any{
+			"capabilities": map[string]any{
+				"textDocumentSync": map[string]any{
+					"openClose": true,
+					"change":    1, // full document sync
+					"save":      map[string]any{"includeText": true},
+				},
+				"completionProvider":         map[string]any{"triggerCharacters": []string{"⎕", "."}},
+				"hoverProvider":              true,
+				"documentFormattingProvider": s.sess != nil,
+			},
+			"serverInfo": map[string]any{"name": "apllsp", "version": "0.1.0"},
+		}, nil
+	case "initialized", "shutdown", "$/cancelRequest", "$/setTrace":
+		return nil, nil
+	case "textDocument/didOpen":
+		var p struct {
+			TextDocument struct {
+				URI  string `json:"uri"`
+				Text string `json:"text"`
+			} `json:"textDocument"`
+		}
+		if err := json.Unmarshal(msg.Params, &p); err != nil {
+			return nil, invalidParams(err)
+		}
+		s.docs[p.TextDocument.URI] = splitLines(p.TextDocument.Text)
+		s.publishDiagnostics(ctx, p.TextDocument.URI)
+		return nil, nil
+	case "textDocument/didChange":
+		var p struct {
+			TextDocument struct {
+				URI string `json:"uri"`
+			} `json:"textDocument"`
+			ContentChanges []struct {
+				Text string `json:"text"`
+			} `json:"contentChanges"`
+		}
+		if err := json.Unmarshal(msg.Params, &p); err != nil {
+			return nil, invalidParams(err)
+		}
+		if n := len(p.ContentChanges); n > 0 {
+			s.docs[p.TextDocument.URI] = splitLines(p.ContentChanges[n-1].Text)
+		}
+		return nil, nil
+	case "textDocument/didSave":
+		var p struct {
+			TextDocument struct {
+				URI string `json:"uri"`
+			} `json:"textDocument"`
+			Text *string `json:"text"`
+		}
+		if err := json.Unmarshal(msg.Params, &p); err != nil {
+			return nil, invalidParams(err)
+		}
+		if p.Text != nil {
+			s.docs[p.TextDocument.URI] = splitLines(*p.Text)
+		}
+		s.publishDiagnostics(ctx, p.TextDocument.URI)
+		return nil, nil
+	case "textDocument/didClose":
+		var p struct {
+			TextDocument struct {
+				URI string `json:"uri"`
+			} `json:"textDocument"`
+		}
+		if err := json.Unmarshal(msg.Params, &p); err != nil {
+			return nil, invalidParams(err)
+		}
+		delete(s.docs, p.TextDocument.URI)
+		s.notify("textDocument/publishDiagnostics", map[string]any{
+			"uri":         p.TextDocument.URI,
+			"diagnostics": []diagnostic{},
+		})
+		return nil, nil
+	case "textDocument/completion":
+		var p textDocumentPosition
+		if err := json.Unmarshal(msg.Params, &p); err != nil {
+			return nil, invalidParams(err)
+		}
+		return s.completion(ctx, p)
+	case "textDocument/hover":
+		var p textDocumentPosition
+		if err := json.Unmarshal(msg.Params, &p); err != nil {
+			return nil, invalidParams(err)
+		}
+		return s.hover(p), nil
+	case "textDocument/formatting":
+		var p struct {
+			TextDocument struct {
+				URI string `json:"uri"`
+			} `json:"textDocument"`
+		}
+		if err := json.Unmarshal(msg.Params, &p); err != nil {
+			return nil, invalidParams(err)
+		}
+		return s.formatting(ctx, p.TextDocument.URI)
+	default:
+		if msg.ID == nil {
+			return nil, nil // unknown notifications are ignored
+		}
+		return nil, &rpcError{Code: -32601, Message: fmt.Sprintf("method not found: %s", msg.Method)}
+	}
+}
+
+func invalidParams(err error) *rpcError {
+	return &rpcError{Code: -32602, Message: "invalid params: " + err.Error()}
+}
+
+// --- Features ---
+
+func (s *Server) completion(ctx context.Context, p textDocumentPosition) (any, *rpcError) {
+	line := s.line(p.TextDocument.URI, p.Position.Line)
+	if s.sess == nil || line == "" {
+		return []any{}, nil
+	}
+	pos := min(p.Position.Character, len([]rune(line)))
+
+	c, err := s.sess.Complete(ctx, line, pos)
+	if err != nil {
+		return nil, &rpcError{Code: -32603, Message: err.Error()}
+	}
+
+	start := max(pos-c.Skip, 0)
+	edit := lspRange{
+		Start: position{Line: p.Position.Line, Character: start},
+		End:   position{Line: p.Position.Line, Character: pos},
+	}
+	items := make([]map[string]any, 0, len(c.Options))
+	for _, opt := range c.Options {
+		items = append(items, map[string]any{
+			"label":    opt,
+			"textEdit": textEdit{Range: edit, NewText: opt},
+		})
+	}
+	return items, nil
+}
+
+func (s *Server) hover(p textDocumentPosition) any {
+	if s.docsDB == nil {
+		return nil
+	}
+	runes := []rune(s.line(p.TextDocument.URI, p.Position.Line))
+
+	var markdown string
+	if n, ok := ibeamAt(runes, p.Position.Character); ok {
+		if e := ibeam.Lookup(s.docsDB, n); e != nil {
+			markdown = fmt.Sprintf("**%d⌶ %s**\n\n`%s`", e.Number, e.Name, e.Signature)
+			if e.Description != "" {
+				markdown += "\n\n" + e.Description
+			}
+			if e.DocPath != "" {
+				if content, err := docs.Content(s.docsDB, e.DocPath); err == nil {
+					markdown += "\n\n" + content
+				}
+			}
+		}
+	} else if symbol := symbolAt(runes, p.Position.Character); symbol != "" {
+		var navPath string
+		if err := s.docsDB.QueryRow("SELECT path FROM help_urls WHERE symbol = ?", symbol).Scan(&navPath); err == nil {
+			markdown, _ = docs.Content(s.docsDB, navPath)
+		}
+	}
+
+	if markdown == "" {
+		return nil
+	}
+	return map[string]any{
+		"contents": map[string]any{"kind": "markdown", "value": markdown},
+	}
+}
+
+func (s *Server) formatting(ctx context.Context, uri string) (any, *rpcError) {
+	lines, ok := s.docs[uri]
+	if s.sess == nil || !ok {
+		return []textEdit{}, nil
+	}
+
+	formatted, err := s.sess.FormatCode(ctx, lines)
+	if err != nil {
+		return nil, &rpcError{Code: -32603, Message: err.Error()}
+	}
+
+	last := len(lines) - 1
+	return []textEdit{{
+		Range: lspRange{
+			Start: position{},
+			End:   position{Line: last, Character: len([]rune(lines[last]))},
+		},
+		NewText: strings.Join(formatted, "\n"),
+	}}, nil
+}
+
+func (s *Server) publishDiagnostics(ctx context.Context, uri string) {
+	lines, ok := s.docs[uri]
+	if s.sess == nil || !ok {
+		return
+	}
+
+	diags := []diagnostic{}
+	if err := s.sess.Validate(ctx, lines); err != nil {
+		diags = append(diags, diagnosticFor(err, lines))
+	}
+	s.notify("textDocument/publishDiagnostics", map[string]any{
+		"uri":         uri,
+		"diagnostics": diags,
+	})
+}
+
+// line returns line n of an open document, or "" if unknown.
+func (s *Server) line(uri string, n int) string {
+	lines := s.docs[uri]
+	if n < 0 || n >= len(lines) {
+		return ""
+	}
+	return lines[n]
+}
+
+// --- Helpers ---
+
+var (
+	bracketLineRe = regexp.MustCompile(`\[(\d+)\]`)
+	wordLineRe    = regexp.MustCompile(`(?i)\bline (\d+)`)
+)
+
+// diagnosticFor turns a ⎕FIX failure into a diagnostic. Dyalog reports
+// function errors as name[n] (n counted from the header at line 0) and
+// script errors as "line n" (1-based); anything else lands on line 0.
+func diagnosticFor(err error, lines []string) diagnostic {
+	msg := err.Error()
+	row := 0
+
+	var aplErr *session.APLError
+	if errors.As(err, &aplErr) {
+		text := strings.Join(aplErr.Lines, "\n")
+		if m := bracketLineRe.FindStringSubmatch(text); m != nil {
+			row, _ = strconv.Atoi(m[1])
+		} else if m := wordLineRe.FindStringSubmatch(text); m != nil {
+			row, _ = strconv.Atoi(m[1])
+			row--
+		}
+		msg = strings.TrimSpace(text)
+	}
+
+	row = max(0, min(row, len(lines)-1))
+	width := 0
+	if row < len(lines) {
+		width = len([]rune(lines[row]))
+	}
+	return diagnostic{
+		Range: lspRange{
+			Start: position{Line: row},
+			End:   position{Line: row, Character: width},
+		},
+		Severity: 1,
+		Source:   "⎕FIX",
+		Message:  msg,
+	}
+}
+
+func isWordChar(r rune) bool {
+	return r == '_' || r == '∆' || r == '⍙' ||
+		(r >= 'A' && r <= 'Z') || (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9')
+}
+
+// symbolAt returns the docs lookup key under column col: a ⎕name, a
+// :Keyword, or a single glyph. Mirrors the TUI's symbolAtCursor but looks
+// at the character under the cursor rather than the one before it.
+func symbolAt(runes []rune, col int) string {
+	if col >= len(runes) {
+		col = len(runes) - 1
+	}
+	if col < 0 {
+		return ""
+	}
+
+	r := runes[col]
+	if r == '⎕' && col+1 < len(runes) && isWordChar(runes[col+1]) {
+		col++
+		r = runes[col]
+	}
+
+	if isWordChar(r) {
+		start, end := col, col
+		for start > 0 && isWordChar(runes[start-1]) {
+			start--
+		}
+		for end+1 < len(runes) && isWordChar(runes[end+1]) {
+			end++
+		}
+		if start > 0 && (runes[start-1] == '⎕' || runes[start-1] == ':') {
+			return string(runes[start-1 : end+1])
+		}
+		return "" // user-defined name; nothing in the docs
+	}
+
+	if r > 127 || strings.ContainsRune("+-×÷*!?|<>=≠≤≥∨∧~,./\\@&#;:()[]{}", r) {
+		return string(r)
+	}
+	return ""
+}
+
+// ibeamAt reports the I-beam number if col sits on an N⌶ token.
+func ibeamAt(runes []rune, col int) (int, bool) {
+	if col < 0 || col >= len(runes) {
+		return 0, false
+	}
+	// Move onto the ⌶ if the cursor is on the digits.
+	for col < len(runes) && runes[col] >= '0' && runes[col] <= '9' {
+		col++
+	}
+	if col >= len(runes) || runes[col] != '⌶' {
+		return 0, false
+	}
+	start := col
+	for start > 0 && runes[start-1] >= '0' && runes[start-1] <= '9' {
+		start--
+	}
+	n, err := strconv.Atoi(string(runes[start:col]))
+	if err != nil {
+		return 0, false
+	}
+	return n, true
+}
+
+func splitLines(text string) []string {
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	return strings.Split(text, "\n")
+}
+
+// --- Framing ---
+
+func (s *Server) write(v any) {
+	s.wmu.Lock()
+	defer s.wmu.Unlock()
+	framing.Write(s.w, v)
+}
+
+func (s *Server) notify(method string, params any) {
+	s.write(rpcNotification{JSONRPC: "2.0", Method: method, Params: params})
+}
@@ -0,0 +1,140 @@
+package lsp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/cursork/gritt/internal/framing"
+	"github.com/cursork/gritt/session"
+)
+
+func frame(t *testing.T, msgs ...any) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	for _, m := range msgs {
+		if err := framing.Write(&buf, m); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return &buf
+}
+
+func readAll(t *testing.T, out *bytes.Buffer) []map[string]any {
+	t.Helper()
+	br := bufio.NewReader(out)
+	var msgs []map[string]any
+	for {
+		body, err := framing.Read(br)
+		if err != nil {
+			break
+		}
+		var m map[string]any
+		if err := json.Unmarshal(body, &m); err != nil {
+			t.Fatalf("bad JSON %q: %v", body, err)
+		}
+		msgs = append(msgs, m)
+	}
+	return msgs
+}
+
+func TestServeLifecycle(t *testing.T) {
+	in := frame(t,
+		map[string]any{"jsonrpc": "2.0", "id": 1, "method": "initialize", "params": map[string]any{}},
+		map[string]any{"jsonrpc": "2.0", "method": "initialized", "params": map[string]any{}},
+		map[string]any{"jsonrpc": "2.0", "method": "textDocument/didOpen", "params": map[string]any{
+			"textDocument": map[string]any{"uri": "file:///x.aplf", "text": "r←f x\nr←⍳x"},
+		}},
+		map[string]any{"jsonrpc": "2.0", "id": 2, "method": "textDocument/completion", "params": map[string]any{
+			"textDocument": map[string]any{"uri": "file:///x.aplf"},
+			"position":     map[string]any{"line": 1, "character": 3},
+		}},
+		map[string]any{"jsonrpc": "2.0", "id": 3, "method": "bogus"},
+		map[string]any{"jsonrpc": "2.0", "id": 4, "method": "shutdown"},
+		map[string]any{"jsonrpc": "2.0", "method": "exit"},
+	)
+	var out bytes.Buffer
+	s := &Server{docs: make(map[string][]string)}
+	if err := s.Serve(context.Background(), in, &out); err != nil {
+		t.Fatal(err)
+	}
+
+	msgs := readAll(t, &out)
+	if len(msgs) != 4 {
+		t.Fatalf("got %d messages, want 4: %v", len(msgs), msgs)
+	}
+	caps, _ := msgs[0]["result"].(map[string]any)["capabilities"].(map[string]any)
+	if caps["hoverProvider"] != true {
+		t.Errorf("capabilities = %v", caps)
+	}
+	if items, ok := msgs[1]["result"].([]any); !ok || len(items) != 0 {
+		t.Errorf("completion without session = %v", msgs[1]["result"])
+	}
+	if msgs[2]["error"] == nil {
+		t.Errorf("bogus method should error: %v", msgs[2])
+	}
+	if _, ok := msgs[3]["result"]; !ok || msgs[3]["error"] != nil {
+		t.Errorf("shutdown = %v", msgs[3])
+	}
+}
+
+func TestSymbolAt(t *testing.T) {
+	tests := []struct {
+		line string
+		col  int
+		want string
+	}{
+		{"x←⍳5", 2, "⍳"},
+		{"⎕DL 1", 0, "⎕DL"},
+		{"⎕DL 1", 2, "⎕DL"},
+		{":If x", 2, ":If"},
+		{"foo+bar", 1, ""},
+		{"foo+bar", 3, "+"},
+		{"", 0, ""},
+	}
+	for _, tt := range tests {
+		if got := symbolAt([]rune(tt.line), tt.col); got != tt.want {
+			t.Errorf("symbolAt(%q, %d) = %q, want %q", tt.line, tt.col, got, tt.want)
+		}
+	}
+}
+
+func TestIbeamAt(t *testing.T) {
+	tests := []struct {
+		line string
+		col  int
+		want int
+		ok   bool
+	}{
+		{"1(220⌶)x", 5, 220, true},
+		{"1(220⌶)x", 3, 220, true},
+		{"1(220⌶)x", 0, 0, false},
+		{"⌶", 0, 0, false},
+	}
+	for _, tt := range tests {
+		got, ok := ibeamAt([]rune(tt.line), tt.col)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("ibeamAt(%q, %d) = %d, %v; want %d, %v", tt.line, tt.col, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestDiagnosticFor(t *testing.T) {
+	lines := []string{"r←f x", "r←x+", "r←1"}
+	d := diagnosticFor(&session.APLError{Message: "SYNTAX ERROR", Lines: []string{"f[1] SYNTAX ERROR"}}, lines)
+	if d.Range.Start.Line != 1 || d.Range.End.Character != 4 {
+		t.Errorf("range = %+v", d.Range)
+	}
+
+	d = diagnosticFor(&session.APLError{Message: "DOMAIN ERROR", Lines: []string{"Error on line 3"}}, lines)
+	if d.Range.Start.Line != 2 {
+		t.Errorf("line = %d, want 2", d.Range.Start.Line)
+	}
+
+	d = diagnosticFor(&session.APLError{Message: "DOMAIN ERROR", Lines: []string{"line 99"}}, lines)
+	if d.Range.Start.Line != 2 {
+		t.Errorf("out of range line should clamp, got %d", d.Range.Start.Line)
+	}
+}
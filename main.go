@@ -2,8 +2,10 @@ package main
 
 import (
 	"bufio"
+	"encoding/json"
 	"flag"
 	"fmt"
+	"io"
 	"log"
 	"math/rand"
 	"net"
@@ -15,19 +17,24 @@ import (
 
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/colorprofile"
+	"github.com/cursork/gritt/codec"
+	"github.com/cursork/gritt/prepl"
 	"github.com/cursork/gritt/ride"
 	"github.com/cursork/gritt/session"
+	"github.com/cursork/gritt/sockserve"
 )
 
 // launchDyalog starts Dyalog APL with RIDE on a random port.
 // version constrains which installed version to use (empty = highest available).
-func launchDyalog(version string) (*exec.Cmd, int) {
+// env is added to the interpreter's environment.
+func launchDyalog(version string, env ...string) (*exec.Cmd, int) {
 	exe := resolveDyalog(version)
 
 	port := 10000 + rand.Intn(50000)
 	cmd := exec.Command(exe, "+s", "-q")
 	cmd.Env = append(os.Environ(), fmt.Sprintf("RIDE_INIT=SERVE:*:%d", port))
 	cmd.Env = append(cmd.Env, session.DyalogEnv(exe)...)
+	cmd.Env = append(cmd.Env, env...)
 	setProcessGroup(cmd)
 	if err := cmd.Start(); err != nil {
 		log.Fatalf("Failed to start Dyalog (%s): %v", exe, err)
@@ -114,11 +121,18 @@ func (m *multiFlag) Set(value string) error {
 
 func main() {
 	addr := flag.String("addr", "localhost:4502", "Dyalog RIDE address")
+	listen := flag.String("listen", "", "Wait on host:port for Dyalog to connect (RIDE_INIT=CONNECT:host:port) instead of dialling -addr")
+	preplAddr := flag.String("prepl", "", "Run the TUI over a prepl server (e.g. aplsock) at host:port instead of RIDE")
 	logFile := flag.String("log", "", "Log protocol messages to file")
+	recordFile := flag.String("record", "", "Record a replayable RIDE transcript to file")
 	var exprs multiFlag
 	flag.Var(&exprs, "e", "Execute expression and exit (can be repeated)")
 	stdin := flag.Bool("stdin", false, "Read expressions from stdin")
+	script := flag.String("run", "", "Run an APL script and exit; later arguments go to the script (for #! lines)")
+	jsonOut := flag.Bool("json", false, "With -e or -stdin, print each result as a JSON document (exit status 1 on APL errors)")
 	sock := flag.String("sock", "", "Listen for injection on Unix path (contains '/') or TCP port (e.g. 9876, :9876, host:port)")
+	sockProto := flag.String("sock-proto", "lines", "Protocol for -sock: lines (expressions in, session text out) or jsonrpc")
+	sockMode := flag.String("sock-mode", "plain", "Replies for -sock-proto lines: plain (session text), aplan or aplor (prepl responses)")
 	var links multiFlag
 	flag.Var(&links, "link", "Link directory (path or ns:path, can be repeated)")
 	launch := flag.Bool("launch", false, "Launch Dyalog automatically (alias: -l)")
@@ -133,7 +147,17 @@ func main() {
 		cfgSet = true
 		return nil
 	})
-	flag.Parse()
+	args, scriptArgs := splitRunArgs(os.Args[1:])
+	flag.CommandLine.Parse(args)
+
+	// Exit status for scripted runs, set once the deferred cleanup (closing
+	// the connection, stopping a launched interpreter) has run.
+	exitCode := 0
+	defer func() {
+		if exitCode != 0 {
+			os.Exit(exitCode)
+		}
+	}()
 
 	// Print history and exit — no Dyalog needed
 	if *historyMode {
@@ -146,13 +170,25 @@ func main() {
 		cfgArg = &cfgFlag
 	}
 
+	if *listen != "" && *launch {
+		log.Fatal("-listen and -launch are mutually exclusive")
+	}
+	if *preplAddr != "" && (*launch || *listen != "" || *fmtMode || *script != "" || len(exprs) > 0 || *stdin || len(links) > 0) {
+		log.Fatal("-prepl runs the interactive TUI only; it can't be combined with -l, -listen, -fmt, -run, -e, -stdin or -link")
+	}
+
 	// Launch Dyalog if requested
 	var dyalogCmd *exec.Cmd
 	dyalogExited := make(chan struct{}) // pre-closed unless we launch
 	close(dyalogExited)
 	if *launch {
 		var port int
-		dyalogCmd, port = launchDyalog(*version)
+		var env []string
+		if *script != "" {
+			// Definitions in scripts go through the line editor
+			env = append(env, "DYALOG_LINEEDITOR_MODE=1")
+		}
+		dyalogCmd, port = launchDyalog(*version, env...)
 		*addr = fmt.Sprintf("localhost:%d", port)
 
 		// One owner of cmd.Wait() — closes the channel when the process
@@ -200,6 +236,28 @@ func main() {
 		defer logWriter.Close()
 		ride.Logger = logWriter
 	}
+	if *recordFile != "" {
+		f, err := os.Create(*recordFile)
+		if err != nil {
+			log.Fatalf("Failed to create transcript: %v", err)
+		}
+		defer f.Close()
+		ride.Recorder = ride.NewTranscript(f)
+	}
+
+	// Listen mode: the interpreter dials us
+	var listener *ride.Listener
+	connect := func() (*ride.Client, error) { return ride.Connect(*addr) }
+	if *listen != "" {
+		var err error
+		listener, err = ride.Listen(*listen)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer listener.Close()
+		*addr = listener.Addr()
+		connect = listener.Accept
+	}
 
 	// Format mode
 	if *fmtMode {
@@ -207,7 +265,7 @@ func main() {
 		if len(files) == 0 {
 			log.Fatal("-fmt requires at least one file")
 		}
-		client, err := ride.Connect(*addr)
+		client, err := connect()
 		if err != nil {
 			log.Fatal(err)
 		}
@@ -216,24 +274,70 @@ func main() {
 		return
 	}
 
+	// Script mode
+	if *script != "" {
+		if len(exprs) > 0 || *stdin || *sock != "" {
+			log.Fatal("-run can't be combined with -e, -stdin or -sock")
+		}
+		client, err := connect()
+		if err != nil {
+			log.Fatal(err)
+		}
+		runLinks(client, links, os.Stderr)
+		status, gone := runScript(client, *script, scriptArgs, os.Stdin, os.Stdout, os.Stderr)
+		if gone && dyalogCmd != nil {
+			// ⎕OFF: the script's exit code is the interpreter's
+			select {
+			case <-dyalogExited:
+				status = dyalogCmd.ProcessState.ExitCode()
+			case <-time.After(5 * time.Second):
+			}
+		}
+		closeClient(client, *launch && !gone)
+		exitCode = status
+		return
+	}
+
 	// Non-interactive mode
 	if len(exprs) > 0 && *stdin {
 		log.Fatal("-e and -stdin are mutually exclusive")
 	}
+	if *jsonOut && len(exprs) == 0 && !*stdin {
+		log.Fatal("-json needs -e or -stdin")
+	}
+	// In -json mode stdout carries only the documents, and an APL error
+	// fails the run.
+	linkOut := io.Writer(os.Stdout)
+	run := func(client *ride.Client, line string) {
+		runExpr(client, line)
+	}
+	if *jsonOut {
+		linkOut = os.Stderr
+		loaded := false
+		run = func(client *ride.Client, line string) {
+			if !loaded {
+				loadPreplForJSON(client)
+				loaded = true
+			}
+			if !runExprJSON(client, line) {
+				exitCode = 1
+			}
+		}
+	}
 	if len(exprs) > 0 {
-		client, err := ride.Connect(*addr)
+		client, err := connect()
 		if err != nil {
 			log.Fatal(err)
 		}
 		defer closeClient(client, *launch)
-		runLinks(client, links)
+		runLinks(client, links, linkOut)
 		var executed []string
 		for _, expr := range exprs {
 			// Split multiline expressions and execute each line
 			for _, line := range strings.Split(expr, "\n") {
 				line = strings.TrimSpace(line)
 				if line != "" {
-					runExpr(client, line)
+					run(client, line)
 					executed = append(executed, line)
 				}
 			}
@@ -244,17 +348,20 @@ func main() {
 		return
 	}
 	if *stdin {
-		client, err := ride.Connect(*addr)
+		client, err := connect()
 		if err != nil {
 			log.Fatal(err)
 		}
 		defer closeClient(client, *launch)
-		runLinks(client, links)
+		runLinks(client, links, linkOut)
 		var executed []string
 		scanner := bufio.NewScanner(os.Stdin)
 		for scanner.Scan() {
 			line := scanner.Text()
-			runExpr(client, line)
+			if *jsonOut && strings.TrimSpace(line) == "" {
+				continue // no document for an empty line
+			}
+			run(client, line)
 			executed = append(executed, line)
 		}
 		if err := scanner.Err(); err != nil {
@@ -272,21 +379,30 @@ func main() {
 		colorProfile = colorprofile.TrueColor
 	}
 
-	p := tea.NewProgram(NewModel(*addr, logWriter, colorProfile, cfgArg, dyalogCmd, dyalogExited), tea.WithAltScreen(), tea.WithMouseCellMotion())
+	model := NewModel(*addr, logWriter, colorProfile, cfgArg, dyalogCmd, dyalogExited)
+	model.listener = listener
+	model.preplAddr = *preplAddr
+	var feed *sessionFeed
+	if *sock != "" {
+		feed = newSessionFeed()
+		model.feed = feed
+	}
+	p := tea.NewProgram(model, tea.WithAltScreen(), tea.WithMouseCellMotion())
 
 	// -sock injection listener. Runs alongside the TUI; each connection's
 	// lines are submitted into the bubbletea program and processed
 	// sequentially when the interpreter is idle.
 	if *sock != "" {
-		network, address := parseSockAddr(*sock)
-		listener, err := startSocketListener(network, address, p)
+		mode, err := sockserve.ParseMode(*sockMode)
 		if err != nil {
-			log.Fatalf("Failed to open -sock listener: %v", err)
+			log.Fatalf("-sock-mode: %v", err)
 		}
-		defer listener.Close()
-		if network == "unix" {
-			defer os.Remove(address)
+		srv, err := startSocketServer(*sock, *sockProto, mode, p, feed)
+		if err != nil {
+			log.Fatalf("Failed to open -sock listener: %v", err)
 		}
+		// Nothing runs requests once the TUI has gone, so don't wait.
+		defer srv.Close()
 	}
 
 	if _, err := p.Run(); err != nil {
@@ -294,15 +410,15 @@ func main() {
 	}
 }
 
-// runLinks runs ]link.create for each spec
-func runLinks(client *ride.Client, specs []string) {
+// runLinks runs ]link.create for each spec, writing its output to w
+func runLinks(client *ride.Client, specs []string, w io.Writer) {
 	for _, spec := range specs {
-		runLink(client, spec)
+		runLink(client, spec, w)
 	}
 }
 
 // runLink runs ]link.create with the given spec
-func runLink(client *ride.Client, spec string) {
+func runLink(client *ride.Client, spec string, w io.Writer) {
 	var cmd string
 	if idx := strings.Index(spec, ":"); idx >= 0 {
 		// ns:path -> ]link.create ns path
@@ -313,7 +429,7 @@ func runLink(client *ride.Client, spec string) {
 		// path -> ]link.create path
 		cmd = fmt.Sprintf("]link.create %s", spec)
 	}
-	runExpr(client, cmd)
+	runExprTo(client, cmd, w)
 }
 
 // runFormat formats APL files in place using FormatCode
@@ -380,10 +496,10 @@ func runFormat(client *ride.Client, files []string) {
 
 	// Close dummy windows
 	if fnToken >= 0 {
-		client.Send("CloseWindow", map[string]any{"win": fnToken})
+		client.Send("CloseWindow", ride.CloseWindow{Win: fnToken})
 	}
 	if nsToken >= 0 {
-		client.Send("CloseWindow", map[string]any{"win": nsToken})
+		client.Send("CloseWindow", ride.CloseWindow{Win: nsToken})
 	}
 }
 
@@ -393,11 +509,7 @@ var fmtCounter int
 func openDummyEditor(client *ride.Client) int {
 	fmtCounter++
 	name := fmt.Sprintf("gritt∆fmt%d", fmtCounter)
-	if err := client.Send("Edit", map[string]any{
-		"win":  0,
-		"text": name,
-		"pos":  0,
-	}); err != nil {
+	if err := client.Send("Edit", ride.Edit{Text: name}); err != nil {
 		log.Fatalf("Failed to send Edit: %v", err)
 	}
 	return waitForOpenWindow(client)
@@ -408,11 +520,7 @@ func openDummyNamespace(client *ride.Client) int {
 	fmtCounter++
 	name := fmt.Sprintf("gritt∆fmt%d", fmtCounter)
 	runExpr(client, fmt.Sprintf("⎕FIX ':Namespace %s' ':EndNamespace'", name))
-	if err := client.Send("Edit", map[string]any{
-		"win":  0,
-		"text": name,
-		"pos":  0,
-	}); err != nil {
+	if err := client.Send("Edit", ride.Edit{Text: name}); err != nil {
 		log.Fatalf("Failed to send Edit: %v", err)
 	}
 	return waitForOpenWindow(client)
@@ -426,24 +534,18 @@ func waitForOpenWindow(client *ride.Client) int {
 			log.Fatalf("Recv failed waiting for OpenWindow: %v", err)
 		}
 		if msg != nil && msg.Command == "OpenWindow" {
-			if t, ok := msg.Args["token"].(float64); ok {
-				return int(t)
+			var w ride.OpenWindow
+			if err := msg.Decode(&w); err != nil {
+				log.Fatal(err)
 			}
+			return w.Token
 		}
 	}
 }
 
 // formatCode sends FormatCode and waits for ReplyFormatCode
 func formatCode(client *ride.Client, win int, lines []string) []string {
-	text := make([]any, len(lines))
-	for i, l := range lines {
-		text[i] = l
-	}
-
-	if err := client.Send("FormatCode", map[string]any{
-		"win":  win,
-		"text": text,
-	}); err != nil {
+	if err := client.Send("FormatCode", ride.FormatCode{Win: win, Text: lines}); err != nil {
 		log.Fatalf("FormatCode failed: %v", err)
 	}
 
@@ -453,24 +555,33 @@ func formatCode(client *ride.Client, win int, lines []string) []string {
 			log.Fatalf("Recv failed waiting for ReplyFormatCode: %v", err)
 		}
 		if msg != nil && msg.Command == "ReplyFormatCode" {
-			if result, ok := msg.Args["text"].([]any); ok {
-				out := make([]string, len(result))
-				for i, l := range result {
-					out[i], _ = l.(string)
-				}
-				return out
+			var reply ride.ReplyFormatCode
+			if err := msg.Decode(&reply); err != nil {
+				log.Fatal(err)
 			}
+			return reply.Text
 		}
 	}
 }
 
 // runExpr executes an expression and prints the result
 func runExpr(client *ride.Client, expr string) {
+	runExprTo(client, expr, os.Stdout)
+}
+
+// runExprTo executes an expression and writes the result to w
+func runExprTo(client *ride.Client, expr string, w io.Writer) {
+	execExpr(client, expr, func(ev *ride.AppendSessionOutput) {
+		fmt.Fprint(w, ev.Result)
+	})
+}
+
+// execExpr executes an expression, passing each piece of session output
+// (other than the input echo) to emit, and returns once the interpreter
+// is ready again.
+func execExpr(client *ride.Client, expr string, emit func(ev *ride.AppendSessionOutput)) {
 	// Send execute
-	if err := client.Send("Execute", map[string]any{
-		"text":  expr + "\n",
-		"trace": 0,
-	}); err != nil {
+	if err := client.Send("Execute", ride.Execute{Text: expr + "\n"}); err != nil {
 		log.Fatalf("Execute failed: %v", err)
 	}
 
@@ -480,20 +591,109 @@ func runExpr(client *ride.Client, expr string) {
 		if err != nil {
 			log.Fatalf("Recv failed: %v", err)
 		}
+		if msg == nil {
+			continue
+		}
 
-		switch msg.Command {
-		case "AppendSessionOutput":
+		ev, err := msg.Typed()
+		if err != nil {
+			log.Printf("skipping %s: %v", msg.Command, err)
+			continue
+		}
+		switch ev := ev.(type) {
+		case *ride.AppendSessionOutput:
 			// type:14 is input echo, skip it
-			if t, ok := msg.Args["type"].(float64); ok && t == 14 {
-				continue
-			}
-			if result, ok := msg.Args["result"].(string); ok {
-				fmt.Print(result)
+			if ev.Type != 14 {
+				emit(ev)
 			}
-		case "SetPromptType":
-			if t, ok := msg.Args["type"].(float64); ok && t == 1 {
+		case *ride.SetPromptType:
+			if ev.Type == 1 {
 				return // Ready for next input
 			}
 		}
 	}
 }
+
+// jsonError is the -json document for an APL error
+type jsonError struct {
+	Error jsonErrorDetail `json:"error"`
+}
+
+type jsonErrorDetail struct {
+	EN      int      `json:"en"`
+	Message string   `json:"message"`
+	DM      []string `json:"dm"`
+}
+
+// loadPreplForJSON fixes the prepl namespace into ⎕SE; -json evaluates
+// through its serialising wrapper.
+func loadPreplForJSON(client *ride.Client) {
+	var errs []string
+	execExpr(client, prepl.FixExpr(), func(ev *ride.AppendSessionOutput) {
+		if ev.Type == 5 {
+			errs = append(errs, ev.Result)
+		}
+	})
+	if len(errs) > 0 {
+		log.Fatalf("-json: load prepl: %s", strings.TrimSpace(strings.Join(errs, "")))
+	}
+}
+
+// runExprJSON evaluates an expression through ⎕SE.Prepl.EvalAs and prints
+// one JSON document for it, after writing anything the expression displayed
+// to stderr. It reports whether the expression succeeded.
+func runExprJSON(client *ride.Client, expr string) bool {
+	var out strings.Builder
+	var errs []string
+	execExpr(client, prepl.EvalAsExpr("aplan", expr, prepl.EvalAsWidth), func(ev *ride.AppendSessionOutput) {
+		if ev.Type == 5 {
+			errs = append(errs, ev.Result)
+			return
+		}
+		out.WriteString(ev.Result)
+	})
+	doc, display, ok := jsonDocument(out.String(), errs)
+	for _, line := range display {
+		fmt.Fprintln(os.Stderr, line)
+	}
+	fmt.Println(string(doc))
+	return ok
+}
+
+// jsonDocument turns the session output of prepl.EvalAsExpr into a JSON
+// document: the value as codec.ToJSON renders it (null if there is none),
+// or {"error": ...}. display holds the lines the expression displayed
+// itself. sessionErrs holds any error output from the wrapper itself. ok
+// is false for errors.
+func jsonDocument(output string, sessionErrs []string) (doc []byte, display []string, ok bool) {
+	var detail jsonErrorDetail
+	switch {
+	case len(sessionErrs) > 0:
+		dm := strings.Split(strings.TrimSuffix(strings.Join(sessionErrs, ""), "\n"), "\n")
+		detail = jsonErrorDetail{Message: dm[0], DM: dm}
+	default:
+		resp, err := prepl.ParseEvalAs(output)
+		if err != nil {
+			detail = jsonErrorDetail{Message: err.Error(), DM: []string{}}
+			break
+		}
+		display = resp.Out
+		if resp.Err == nil {
+			b, err := codec.ToJSONBytes(resp.Val)
+			if err == nil {
+				return b, display, true
+			}
+			detail = jsonErrorDetail{Message: err.Error(), DM: []string{}}
+			break
+		}
+		detail = jsonErrorDetail{EN: resp.Err.EN, Message: resp.Err.Message, DM: resp.Err.DM}
+		if detail.DM == nil {
+			detail.DM = []string{}
+		}
+		if detail.Message == "" && len(detail.DM) > 0 {
+			detail.Message = detail.DM[0]
+		}
+	}
+	b, _ := json.Marshal(jsonError{Error: detail})
+	return b, display, false
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestJSONDocument(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		output string
+		errs   []string
+		want   string
+		ok     bool
+	}{
+		{"vector", "⍝PREPL← (tag: 'ret' ⋄ val: 1 2 3)\n", nil, `[1,2,3]`, true},
+		{"chunked", "⍝PREPL← (tag: 'ret' ⋄ val: 'hel\n⍝PREPL← lo')\n", nil, `"hello"`, true},
+		{"void", "⍝PREPL← (tag: 'ret')\n", nil, `null`, true},
+		{"namespace", "⍝PREPL← (tag: 'ret' ⋄ val: (a: 1))\n", nil, `{"data":{"a":1},"type":"namespace"}`, true},
+		{"matrix", "⍝PREPL← (tag: 'ret' ⋄ val: [1 2 ⋄ 3 4])\n", nil, `{"data":[[1,2],[3,4]],"shape":[2,2],"type":"array"}`, true},
+		{"displayed first", "hi\n⍝PREPL← (tag: 'ret' ⋄ val: 1)\n", nil, `1`, true},
+		{
+			"apl error",
+			"⍝PREPL← (tag: 'err' ⋄ en: 11 ⋄ message: 'Divide by zero' ⋄ dm: ('DOMAIN ERROR: Divide by zero' '      1÷0' '       ∧'))\n", nil,
+			`{"error":{"en":11,"message":"Divide by zero","dm":["DOMAIN ERROR: Divide by zero","      1÷0","       ∧"]}}`, false,
+		},
+		{
+			"wrapper error", "", []string{"VALUE ERROR: Undefined name: Prepl\n      ⎕SE.Prepl.EvalAs\n"},
+			`{"error":{"en":0,"message":"VALUE ERROR: Undefined name: Prepl","dm":["VALUE ERROR: Undefined name: Prepl","      ⎕SE.Prepl.EvalAs"]}}`, false,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, _, ok := jsonDocument(tt.output, tt.errs)
+			if string(doc) != tt.want || ok != tt.ok {
+				t.Errorf("jsonDocument = %s, %v; want %s, %v", doc, ok, tt.want, tt.ok)
+			}
+		})
+	}
+
+	// What the expression displays is kept apart from the document
+	_, display, _ := jsonDocument("hi\nthere\n⍝PREPL← (tag: 'ret' ⋄ val: 1)\n", nil)
+	if want := []string{"hi", "there"}; !reflect.DeepEqual(display, want) {
+		t.Errorf("display = %q, want %q", display, want)
+	}
+
+	// Unparseable output is still a well-formed error document
+	doc, _, ok := jsonDocument("garbage", nil)
+	var v jsonError
+	if ok || json.Unmarshal(doc, &v) != nil || v.Error.Message == "" || v.Error.DM == nil {
+		t.Errorf("garbage: %s, %v", doc, ok)
+	}
+}
@@ -0,0 +1,172 @@
+// Package multiline frames APL source for the interpreter's session
+// input, where each Execute carries one line and the interpreter collects
+// definitions that span lines itself: a tradfn opened with ∇ goes through
+// the line editor (SetPromptType type 3) until its closing ∇, a
+// :Namespace script until its :EndNamespace, and a dfn or parenthesised
+// expression until its brackets balance.
+//
+// Frame splits a script into such blocks; Block.Texts gives the Execute
+// text for each line, prefixed the way the session itself would show it.
+// The TUI's multiline mode and gritt -run both send these one per prompt.
+package multiline
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/cursork/gritt/syntax"
+)
+
+// Indent is the session's input prompt, six blanks.
+const Indent = "      "
+
+// Kind is the shape of a block.
+type Kind int
+
+const (
+	Single Kind = iota // One line
+	Nabla              // ∇ tradfn definition, through the line editor
+	Script             // :Namespace, :Class or :Interface up to its :End…
+	Open               // A dfn or other brackets left open across lines
+)
+
+// Block is one unit of input: a line, or the lines of a definition that
+// the interpreter collects before running it.
+type Block struct {
+	Kind  Kind
+	Start int // 1-based line number of Lines[0] in the source
+	Lines []string
+}
+
+// Texts returns the Execute text for each of the block's lines. The first
+// line has the normal prompt; the rest of a ∇ definition are numbered
+// "[n]  " as the line editor numbers them, and other continuation lines
+// keep the normal prompt.
+func (b Block) Texts() []string {
+	texts := make([]string, len(b.Lines))
+	for i, line := range b.Lines {
+		if b.Kind == Nabla && i > 0 {
+			texts[i] = fmt.Sprintf("[%d]  %s\n", i, line)
+		} else {
+			texts[i] = Indent + line + "\n"
+		}
+	}
+	return texts
+}
+
+// Texts frames lines typed as a single input, as the TUI's multiline mode
+// does: a ∇ definition if the first line opens one, otherwise plain lines.
+func Texts(lines []string) []string {
+	if len(lines) == 0 {
+		return nil
+	}
+	kind := Single
+	if opensNabla(lines[0]) {
+		kind = Nabla
+	}
+	return Block{Kind: kind, Start: 1, Lines: lines}.Texts()
+}
+
+// Frame splits source lines into blocks. The line opening a block is
+// trimmed; the lines after it are kept as they are, so the indentation of
+// a definition's body reaches the interpreter. Blank and comment-only
+// lines between blocks are dropped, but kept inside them. An error names
+// the line of a block that is never closed.
+func Frame(lines []string) ([]Block, error) {
+	var blocks []Block
+	for i := 0; i < len(lines); i++ {
+		line := strings.TrimSpace(lines[i])
+		code, _ := syntax.SplitComment(line)
+		if strings.TrimSpace(code) == "" {
+			continue
+		}
+
+		b := Block{Start: i + 1, Lines: []string{line}}
+		switch {
+		case opensNabla(line):
+			b.Kind = Nabla
+			for len(b.Lines) == 1 || !closesNabla(b.Lines[len(b.Lines)-1]) {
+				if i++; i == len(lines) {
+					return nil, fmt.Errorf("line %d: ∇ definition is never closed", b.Start)
+				}
+				b.Lines = append(b.Lines, lines[i])
+			}
+		case scriptDepth(line) > 0:
+			b.Kind = Script
+			depth := scriptDepth(line)
+			for depth > 0 {
+				if i++; i == len(lines) {
+					return nil, fmt.Errorf("line %d: %s is never ended", b.Start, strings.Fields(code)[0])
+				}
+				next := lines[i]
+				b.Lines = append(b.Lines, next)
+				depth += scriptDepth(next)
+			}
+		case bracketDepth(line) > 0:
+			b.Kind = Open
+			depth := bracketDepth(line)
+			for depth > 0 {
+				if i++; i == len(lines) {
+					return nil, fmt.Errorf("line %d: brackets are never closed", b.Start)
+				}
+				next := lines[i]
+				b.Lines = append(b.Lines, next)
+				depth += bracketDepth(next)
+			}
+		}
+		blocks = append(blocks, b)
+	}
+	return blocks, nil
+}
+
+func opensNabla(line string) bool {
+	return strings.HasPrefix(strings.TrimSpace(line), "∇")
+}
+
+// closesNabla reports whether a line ends a ∇ definition: its code, less
+// any comment, ends with ∇.
+func closesNabla(line string) bool {
+	code, _ := syntax.SplitComment(line)
+	return strings.HasSuffix(strings.TrimSpace(code), "∇")
+}
+
+// scriptDepth is +1 for a line opening a :Namespace, :Class or
+// :Interface, -1 for one ending it and 0 otherwise.
+func scriptDepth(line string) int {
+	for _, t := range syntax.Tokenize(line) {
+		if t.Kind == syntax.Space {
+			continue
+		}
+		if t.Kind != syntax.Keyword {
+			return 0
+		}
+		switch strings.ToLower(t.Text) {
+		case ":namespace", ":class", ":interface":
+			return 1
+		case ":endnamespace", ":endclass", ":endinterface":
+			return -1
+		}
+		return 0
+	}
+	return 0
+}
+
+// bracketDepth counts the brackets, parentheses and braces a line leaves
+// open, ignoring those in strings and comments. It is negative for a line
+// that closes more than it opens.
+func bracketDepth(line string) int {
+	depth := 0
+	kinds := syntax.KindAt(line)
+	for i, r := range []rune(line) {
+		if kinds[i] == syntax.String || kinds[i] == syntax.Comment {
+			continue
+		}
+		switch r {
+		case '(', '[', '{':
+			depth++
+		case ')', ']', '}':
+			depth--
+		}
+	}
+	return depth
+}
@@ -0,0 +1,86 @@
+package multiline
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestFrame(t *testing.T) {
+	src := strings.Split(`⍝ A script
+x←⍳3
+
+∇ r←Double y
+  ⍝ body comment
+  r←y×2
+∇
+:Namespace utils
+  ∇ r←Sum y
+    r←+/y
+  ∇
+  :Namespace inner
+  :EndNamespace
+:EndNamespace
+f←{
+  ⍺+⍵ ⍝ }
+}
+m←(1 2
+3 4)
+'{' ≡ '{'   ⍝ balanced: quotes and comments don't count (
+Double x`, "\n")
+
+	blocks, err := Frame(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Block{
+		{Single, 2, []string{"x←⍳3"}},
+		{Nabla, 4, []string{"∇ r←Double y", "  ⍝ body comment", "  r←y×2", "∇"}},
+		{Script, 8, []string{":Namespace utils", "  ∇ r←Sum y", "    r←+/y", "  ∇", "  :Namespace inner", "  :EndNamespace", ":EndNamespace"}},
+		{Open, 15, []string{"f←{", "  ⍺+⍵ ⍝ }", "}"}},
+		{Open, 18, []string{"m←(1 2", "3 4)"}},
+		{Single, 20, []string{"'{' ≡ '{'   ⍝ balanced: quotes and comments don't count ("}},
+		{Single, 21, []string{"Double x"}},
+	}
+	if !reflect.DeepEqual(blocks, want) {
+		t.Errorf("Frame:\n got %q\nwant %q", blocks, want)
+	}
+}
+
+func TestFrameUnclosed(t *testing.T) {
+	for src, msg := range map[string]string{
+		"1+1\n∇ f\n1":         "line 2: ∇ definition is never closed",
+		":Namespace x\n∇f\n∇": "line 1: :Namespace is never ended",
+		"x←1\ng←{\n  ⍵\n":     "line 2: brackets are never closed",
+		":class C\nx←1":       "line 1: :class is never ended",
+	} {
+		_, err := Frame(strings.Split(src, "\n"))
+		if err == nil || err.Error() != msg {
+			t.Errorf("Frame(%q) error = %v, want %q", src, err, msg)
+		}
+	}
+}
+
+func TestTexts(t *testing.T) {
+	got := Texts([]string{"∇ r←f y", "r←y", "∇"})
+	want := []string{"      ∇ r←f y\n", "[1]  r←y\n", "[2]  ∇\n"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("nabla Texts = %q, want %q", got, want)
+	}
+
+	got = Texts([]string{":Namespace n", "a←1", ":EndNamespace"})
+	want = []string{"      :Namespace n\n", "      a←1\n", "      :EndNamespace\n"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("namespace Texts = %q, want %q", got, want)
+	}
+
+	got = Block{Kind: Nabla, Lines: []string{"∇ f", "  :If 1", "    ⎕←1", "  :EndIf", "∇"}}.Texts()
+	want = []string{"      ∇ f\n", "[1]    :If 1\n", "[2]      ⎕←1\n", "[3]    :EndIf\n", "[4]  ∇\n"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("indented nabla Texts = %q, want %q", got, want)
+	}
+
+	if Texts(nil) != nil {
+		t.Error("Texts(nil) should be nil")
+	}
+}
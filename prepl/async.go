@@ -0,0 +1,212 @@
+package prepl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// pendingEval is an async request waiting for its response.
+type pendingEval struct {
+	ch   chan *Response
+	out  func(line string) // nil to collect output into Response.Out
+	buf  []string
+	k    *capture    // its session output, if captured
+	stop func() bool // stops watching the request's context
+}
+
+// EvalAsync sends an expression without waiting for the response, which
+// arrives on the returned channel. Requests are written back to back and
+// matched to their responses by ⍝ID: (a fresh UUIDv7 each), so many can
+// be in flight on one connection.
+//
+// The first call switches the client to async mode: a reader goroutine
+// takes over the connection, Eval and EvalStream go through it too, and
+// EvalRaw stops working. If ctx is done before the response arrives, or
+// the connection fails, the channel is closed without a value; a done ctx
+// also interrupts the expression (see Interrupt).
+//
+// IDs need the server in aplan (or plain) mode; aplor responses can't
+// carry them.
+func (c *Client) EvalAsync(ctx context.Context, expr string) <-chan *Response {
+	return c.send(ctx, expr, UUIDv7(), nil, false)
+}
+
+// Batch sends exprs back to back and waits for all of their responses,
+// which are returned in the same order.
+func (c *Client) Batch(ctx context.Context, exprs []string) ([]*Response, error) {
+	chans := make([]<-chan *Response, len(exprs))
+	for i, e := range exprs {
+		chans[i] = c.EvalAsync(ctx, e)
+	}
+	resps := make([]*Response, len(exprs))
+	for i, ch := range chans {
+		resp, ok := <-ch
+		if !ok {
+			if err := ctx.Err(); err != nil {
+				return resps, err
+			}
+			return resps, c.failure()
+		}
+		resps[i] = resp
+	}
+	return resps, nil
+}
+
+// Errors reports problems with the connection in async mode: the
+// failure that ends it, and responses that can't be parsed or matched to
+// a request. Errors are dropped while nobody is receiving.
+func (c *Client) Errors() <-chan error {
+	return c.errs
+}
+
+// evalAsync is evalStream in async mode. A done ctx interrupts the
+// expression, and the interrupted response is still waited for.
+func (c *Client) evalAsync(ctx context.Context, expr string, out func(line string), id string) (*Response, error) {
+	if id == "" {
+		id = UUIDv7()
+	}
+	resp, ok := <-c.send(ctx, expr, id, out, true)
+	if !ok {
+		return nil, c.failure()
+	}
+	return resp, nil
+}
+
+// send writes a request with the given ID, starting the reader if this
+// is the first. If ctx is done before the response arrives, the request
+// is interrupted and, unless wait, given up on.
+func (c *Client) send(ctx context.Context, expr, id string, out func(line string), wait bool) <-chan *Response {
+	ch := make(chan *Response, 1)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.async {
+		c.async = true
+		c.pending = make(map[string]*pendingEval)
+		go c.readLoop()
+	}
+
+	c.pmu.Lock()
+	if c.err != nil {
+		c.pmu.Unlock()
+		close(ch)
+		return ch
+	}
+	p := &pendingEval{ch: ch, out: out, k: c.capture(id, out)}
+	c.pending[id] = p
+	c.pmu.Unlock()
+
+	if _, err := fmt.Fprintf(c.conn, "%s ⍝ID:%s\n", expr, id); err != nil {
+		c.fail(fmt.Errorf("send: %w", err))
+		return ch
+	}
+	stop := context.AfterFunc(ctx, func() {
+		if !wait {
+			c.drop(id)
+		}
+		c.Interrupt(id)
+	})
+	c.pmu.Lock()
+	if c.pending[id] == p {
+		p.stop = stop
+	} else {
+		stop() // answered already
+	}
+	c.pmu.Unlock()
+	return ch
+}
+
+// readLoop hands each response to the request with its ID.
+func (c *Client) readLoop() {
+	for {
+		line, err := c.reader.ReadString('\n')
+		if err != nil {
+			c.fail(fmt.Errorf("recv: %w", err))
+			return
+		}
+		resp, err := ParseResponse(line)
+		if err != nil {
+			c.report(err)
+			continue
+		}
+
+		c.pmu.Lock()
+		p := c.pending[resp.ID]
+		if p != nil && resp.Tag != "out" {
+			delete(c.pending, resp.ID)
+			if p.stop != nil {
+				p.stop()
+			}
+		}
+		c.pmu.Unlock()
+		if p == nil && resp.Tag == "interrupted" {
+			continue // for a request given up on
+		}
+		if p == nil {
+			c.report(fmt.Errorf("response for unknown request %q: %s", resp.ID, strings.TrimSpace(line)))
+			continue
+		}
+
+		if resp.Tag == "out" {
+			if p.out != nil {
+				for _, l := range resp.Out {
+					p.out(l)
+				}
+			} else {
+				p.buf = append(p.buf, resp.Out...)
+			}
+			continue
+		}
+		resp.Out = append(p.buf, p.k.wait()...)
+		p.ch <- resp
+	}
+}
+
+// drop gives up on a request whose context is done.
+func (c *Client) drop(id string) {
+	c.pmu.Lock()
+	p := c.pending[id]
+	delete(c.pending, id)
+	c.pmu.Unlock()
+	if p != nil {
+		p.k.close()
+		close(p.ch)
+	}
+}
+
+// fail ends async mode: every waiting request is given up on, and so is
+// any made later.
+func (c *Client) fail(err error) {
+	c.pmu.Lock()
+	if c.err != nil {
+		c.pmu.Unlock()
+		return
+	}
+	c.err = err
+	pending := c.pending
+	c.pending = nil
+	c.pmu.Unlock()
+	for _, p := range pending {
+		p.k.close()
+		close(p.ch)
+	}
+	c.report(err)
+}
+
+// failure is why the connection failed.
+func (c *Client) failure() error {
+	c.pmu.Lock()
+	defer c.pmu.Unlock()
+	if c.err == nil {
+		return errors.New("prepl: request dropped")
+	}
+	return c.err
+}
+
+func (c *Client) report(err error) {
+	select {
+	case c.errs <- err:
+	default:
+	}
+}
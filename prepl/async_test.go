@@ -0,0 +1,186 @@
+package prepl
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// pipelineServer reads n requests, then answers them in reverse order:
+// each expression's value is itself as a string, after an out line if it
+// starts with "say".
+func pipelineServer(t *testing.T, n int) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		var reqs [][2]string
+		for len(reqs) < n {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			expr, id, _ := strings.Cut(strings.TrimRight(line, "\n"), " ⍝ID:")
+			reqs = append(reqs, [2]string{expr, id})
+		}
+		for i := len(reqs) - 1; i >= 0; i-- {
+			expr, id := reqs[i][0], reqs[i][1]
+			if strings.HasPrefix(expr, "say") {
+				fmt.Fprintf(conn, "(id: '%s' ⋄ tag: 'out' ⋄ val: 'said')\n", id)
+			}
+			fmt.Fprintf(conn, "(id: '%s' ⋄ tag: 'ret' ⋄ val: '%s')\n", id, expr)
+		}
+		r.ReadString('\n') // hold the connection open
+	}()
+	return ln.Addr().String()
+}
+
+func TestBatchOutOfOrder(t *testing.T) {
+	c, err := Connect(pipelineServer(t, 3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	resps, err := c.Batch(context.Background(), []string{"a", "say b", "c"})
+	if err != nil {
+		t.Fatalf("Batch: %v", err)
+	}
+	for i, want := range []string{"a", "say b", "c"} {
+		if resps[i].Val != want {
+			t.Errorf("response %d = %v, want %s", i, resps[i].Val, want)
+		}
+	}
+	if len(resps[1].Out) != 1 || resps[1].Out[0] != "said" || resps[0].Out != nil {
+		t.Errorf("Out: %q, %q", resps[0].Out, resps[1].Out)
+	}
+
+	if _, err := c.EvalRaw("x"); err == nil {
+		t.Error("EvalRaw should refuse in async mode")
+	}
+}
+
+func TestEvalAsyncMixedWithEval(t *testing.T) {
+	c, err := Connect(pipelineServer(t, 2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	ch := c.EvalAsync(context.Background(), "first")
+	var out []string
+	resp, err := c.EvalStream("say second", func(line string) { out = append(out, line) })
+	if err != nil || resp.Val != "say second" || len(out) != 1 || resp.Out != nil {
+		t.Fatalf("EvalStream = %+v, %v (out %q)", resp, err, out)
+	}
+	if resp := <-ch; resp == nil || resp.Val != "first" {
+		t.Errorf("EvalAsync = %+v", resp)
+	}
+}
+
+func TestEvalAsyncCancel(t *testing.T) {
+	addr, cleanup := slowServer(t)
+	defer cleanup()
+	c, err := Connect(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	ch := c.EvalAsync(ctx, "slow")
+	cancel()
+	select {
+	case resp, ok := <-ch:
+		if ok {
+			t.Errorf("got %+v after cancelling", resp)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("channel not closed on cancel")
+	}
+
+	// The server was told to stop, and its answer for the dropped
+	// request isn't an error.
+	if resp, err := c.Eval("next"); err != nil || resp.Val != "next" {
+		t.Errorf("Eval = %+v, %v", resp, err)
+	}
+	select {
+	case err := <-c.Errors():
+		t.Errorf("Errors() gave %v", err)
+	default:
+	}
+}
+
+func TestEvalContextAsync(t *testing.T) {
+	addr, cleanup := slowServer(t)
+	defer cleanup()
+	c, err := Connect(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	ch := c.EvalAsync(context.Background(), "first")
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	resp, err := c.EvalContext(ctx, "slow")
+	if err != nil || resp.Tag != "interrupted" {
+		t.Errorf("EvalContext = %+v, %v", resp, err)
+	}
+	if resp := <-ch; resp == nil || resp.Val != "first" {
+		t.Errorf("EvalAsync = %+v", resp)
+	}
+}
+
+func TestEvalAsyncConnectionLost(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		bufio.NewReader(conn).ReadString('\n')
+		conn.Close()
+	}()
+
+	c, err := Connect(ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	if _, err := c.Batch(context.Background(), []string{"1", "2"}); err == nil || !strings.Contains(err.Error(), "recv") {
+		t.Errorf("Batch err = %v", err)
+	}
+	select {
+	case err := <-c.Errors():
+		if !strings.Contains(err.Error(), "recv") {
+			t.Errorf("Errors() gave %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no connection error reported")
+	}
+	if _, ok := <-c.EvalAsync(context.Background(), "3"); ok {
+		t.Error("request after failure should be given up on")
+	}
+	if _, err := c.Eval("4"); err == nil {
+		t.Error("Eval after failure should fail")
+	}
+}
@@ -5,18 +5,30 @@
 //
 //	(tag: 'ret' ⋄ val: 1 2 3)
 //	(tag: 'err' ⋄ en: 11 ⋄ message: 'DOMAIN ERROR' ⋄ dm: (...))
+//
+// Anything the expression displays with ⎕← or ⍞← can come first, a line
+// at a time (see CaptureOutput):
+//
+//	(tag: 'out' ⋄ val: 'progress: 50%')
+//
+// An expression stopped by an interrupt (see EvalContext) is answered with
+//
+//	(tag: 'interrupted')
 package prepl
 
 import (
 	"bufio"
+	"context"
 	"crypto/rand"
 	"encoding/binary"
 	"fmt"
 	"net"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 
+	"github.com/cursork/gritt/amicable"
 	"github.com/cursork/gritt/codec"
 )
 
@@ -37,15 +49,28 @@ type Client struct {
 	conn   net.Conn
 	reader *bufio.Reader
 	mu     sync.Mutex
+
+	// Async mode (see EvalAsync): once started, a reader goroutine owns
+	// reader and mu only guards writes.
+	async   bool
+	pmu     sync.Mutex
+	pending map[string]*pendingEval
+	err     error // why the connection failed, once it has
+	errs    chan error
+
+	// Session output, once CaptureOutput has set it up
+	output *Output
+	token  string
 }
 
 // Response is a parsed response from the prepl server.
 type Response struct {
 	ID  string // Request ID (if client sent one)
-	Tag string // "ret" or "err"
-	Val any    // Parsed APLAN value (for "ret"), nil for void
-	Raw string // APLAN string of the value (for "ret")
-	Err *Error // Error details (for "err")
+	Tag string   // "ret", "err", "interrupted", or "out" for a line of output
+	Val any      // Parsed APLAN value (for "ret"), nil for void
+	Raw string   // APLAN string of the value (for "ret")
+	Err *Error   // Error details (for "err", and INTERRUPT for "interrupted")
+	Out []string // Lines displayed while evaluating, in order
 }
 
 // Error holds structured error information from ⎕DMX.
@@ -66,37 +91,116 @@ func Connect(addr string) (*Client, error) {
 	return &Client{
 		conn:   conn,
 		reader: bufio.NewReader(conn),
+		errs:   make(chan error, 16),
 	}, nil
 }
 
-// Eval sends an expression to the prepl server and returns the response.
+// Eval sends an expression to the prepl server and returns the response,
+// with any output it displayed in Out.
 // If id is non-empty, it is sent as a UUID prefix for correlation.
 func (c *Client) Eval(expr string, id ...string) (*Response, error) {
+	return c.EvalContext(context.Background(), expr, id...)
+}
+
+// EvalContext is Eval for expressions that may run away: if ctx is done
+// before the response arrives, the expression is interrupted (see
+// Interrupt) and the response is tagged "interrupted" — unless it
+// finished first. ctx's error is returned only if ctx was done before
+// the expression was sent. The request always carries an ID (a fresh
+// UUIDv7 if none is given), so the interrupt can only reach it.
+func (c *Client) EvalContext(ctx context.Context, expr string, id ...string) (*Response, error) {
+	var out []string
+	resp, err := c.evalStream(ctx, expr, func(line string) { out = append(out, line) }, firstID(id))
+	if err != nil {
+		return nil, err
+	}
+	resp.Out = out
+	return resp, nil
+}
+
+// EvalStream is Eval, but hands each line of output to out as it arrives
+// instead of collecting it, for long-running expressions that report
+// progress. out may be nil to discard output.
+func (c *Client) EvalStream(expr string, out func(line string), id ...string) (*Response, error) {
+	return c.evalStream(context.Background(), expr, out, firstID(id))
+}
+
+// evalStream is EvalStream, interrupting the expression if ctx is done
+// before it is answered.
+func (c *Client) evalStream(ctx context.Context, expr string, out func(line string), id string) (*Response, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 	c.mu.Lock()
+	if c.async {
+		c.mu.Unlock()
+		return c.evalAsync(ctx, expr, out, id)
+	}
 	defer c.mu.Unlock()
 
+	if id == "" && ctx.Done() != nil {
+		id = UUIDv7() // so an interrupt names this request
+	}
 	line := expr
-	if len(id) > 0 && id[0] != "" {
-		line = expr + " ⍝ID:" + id[0]
+	if id != "" {
+		line = expr + " ⍝ID:" + id
 	}
+	k := c.capture(id, out)
 	if _, err := fmt.Fprintf(c.conn, "%s\n", line); err != nil {
+		k.close()
 		return nil, fmt.Errorf("send: %w", err)
 	}
+	defer c.interruptUntil(ctx, id)()
 
-	line, err := c.reader.ReadString('\n')
-	if err != nil {
-		return nil, fmt.Errorf("recv: %w", err)
+	for {
+		line, err := c.reader.ReadString('\n')
+		if err != nil {
+			k.close()
+			return nil, fmt.Errorf("recv: %w", err)
+		}
+		resp, err := ParseResponse(line)
+		if err != nil || resp.Tag != "out" {
+			k.wait()
+			return resp, err
+		}
+		if out != nil {
+			for _, l := range resp.Out {
+				out(l)
+			}
+		}
 	}
-	line = strings.TrimRight(line, "\r\n")
+}
 
-	parsed, err := codec.APLAN(line)
-	if err != nil {
-		return nil, fmt.Errorf("parse APLAN response: %w: %q", err, line)
-	}
+// ParseResponse parses one response line from the prepl server, in either
+// output mode: an APLAN namespace (aplan, plain) or a 220⌶ signed byte
+// vector (aplor).
+func ParseResponse(line string) (*Response, error) {
+	line = strings.TrimRight(line, "\r\n")
 
-	ns, ok := parsed.(*codec.Namespace)
-	if !ok {
-		return nil, fmt.Errorf("expected namespace response, got %T", parsed)
+	var ns *codec.Namespace
+	if strings.HasPrefix(line, "¯33 ") {
+		// 220⌶ blobs start with the magic byte 0xDF.
+		data, err := signedBytes(line)
+		if err != nil {
+			return nil, fmt.Errorf("parse 220⌶ response: %w", err)
+		}
+		parsed, err := amicable.Unmarshal(data)
+		if err != nil {
+			return nil, fmt.Errorf("parse 220⌶ response: %w", err)
+		}
+		var ok bool
+		if ns, ok = parsed.(*codec.Namespace); !ok {
+			return nil, fmt.Errorf("expected namespace response, got %T", parsed)
+		}
+	} else {
+		parsed, err := codec.APLAN(line)
+		if err != nil {
+			return nil, fmt.Errorf("parse APLAN response: %w: %q", err, line)
+		}
+		var ok bool
+		if ns, ok = parsed.(*codec.Namespace); !ok {
+			return nil, fmt.Errorf("expected namespace response, got %T", parsed)
+		}
 	}
 
 	tagVal, ok := ns.Values["tag"]
@@ -123,6 +227,18 @@ func (c *Client) Eval(expr string, id ...string) (*Response, error) {
 		}
 		return resp, nil
 
+	case "out":
+		resp := &Response{ID: respID, Tag: "out"}
+		if v, ok := ns.Values["val"].(string); ok {
+			resp.Out = []string{v}
+		} else {
+			resp.Out = []string{""} // ⍬ for an empty line
+		}
+		return resp, nil
+
+	case "interrupted":
+		return &Response{ID: respID, Tag: "interrupted", Err: &Error{Message: "INTERRUPT", EN: 1003}}, nil
+
 	case "err":
 		resp := &Response{ID: respID, Tag: "err", Err: &Error{}}
 		if v, ok := ns.Values["message"].(string); ok {
@@ -141,20 +257,109 @@ func (c *Client) Eval(expr string, id ...string) (*Response, error) {
 	}
 }
 
-// EvalRaw sends an expression and returns the raw APLAN response line.
+// EvalRaw sends an expression and returns the raw APLAN response line,
+// preceded by any out lines, newline-separated. It can't be used once
+// the client is in async mode.
 func (c *Client) EvalRaw(expr string) (string, error) {
+	return c.EvalRawContext(context.Background(), expr)
+}
+
+// EvalRawContext is EvalRaw, interrupting the expression if ctx is done
+// before it is answered; the raw interrupted response is returned then.
+// The response is passed on untouched, so no ID is added: the interrupt
+// names none, and the server applies it only to requests sent before it.
+func (c *Client) EvalRawContext(ctx context.Context, expr string) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
 	c.mu.Lock()
 	defer c.mu.Unlock()
+	if c.async {
+		return "", fmt.Errorf("EvalRaw: client is in async mode")
+	}
 
+	id := requestID(strings.TrimRight(expr, "\r"))
+	k := c.capture(id, nil)
 	if _, err := fmt.Fprintf(c.conn, "%s\n", expr); err != nil {
+		k.close()
 		return "", fmt.Errorf("send: %w", err)
 	}
+	defer c.interruptUntil(ctx, "")()
+
+	var lines []string
+	for {
+		line, err := c.reader.ReadString('\n')
+		if err != nil {
+			k.close()
+			return "", fmt.Errorf("recv: %w", err)
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if resp, err := ParseResponse(line); err != nil || resp.Tag != "out" {
+			for _, out := range k.wait() {
+				lines = append(lines, FormatOut(out, id))
+			}
+			return strings.Join(append(lines, line), "\n"), nil
+		}
+		lines = append(lines, line)
+	}
+}
+
+// Interrupt asks the server to stop the request with the given ID,
+// whether it is being evaluated or still queued, or with id "" every
+// request this connection sent before it and that isn't answered yet. Each request stopped is
+// answered with an "interrupted" response; one already answered is left
+// alone. Interrupt doesn't wait, and may be called while an Eval on
+// another goroutine is waiting.
+//
+// The server kills the thread evaluating the expression, wherever it is,
+// along with any threads it started.
+func (c *Client) Interrupt(id string) error {
+	line := "⍝PREPL interrupt"
+	if id != "" {
+		line += " " + id
+	}
+	// One Write, so it can't interleave with a request being sent.
+	if _, err := fmt.Fprintf(c.conn, "%s\n", line); err != nil {
+		return fmt.Errorf("interrupt: %w", err)
+	}
+	return nil
+}
+
+// interruptUntil interrupts request id if ctx is done before the returned
+// stop is called. Once stop has returned no interrupt is sent — one
+// already being written is waited for — so a late one can't land after
+// the connection's next request.
+func (c *Client) interruptUntil(ctx context.Context, id string) (stop func()) {
+	var mu sync.Mutex
+	live := true
+	after := context.AfterFunc(ctx, func() {
+		mu.Lock()
+		defer mu.Unlock()
+		if live {
+			c.Interrupt(id)
+		}
+	})
+	return func() {
+		if after() {
+			return // never started
+		}
+		mu.Lock()
+		live = false
+		mu.Unlock()
+	}
+}
 
-	line, err := c.reader.ReadString('\n')
+// Private makes the server evaluate this connection's expressions in a
+// namespace of its own instead of #. Each connection starts shared.
+func (c *Client) Private() error {
+	resp, err := c.Eval("⍝PREPL private")
 	if err != nil {
-		return "", fmt.Errorf("recv: %w", err)
+		return err
 	}
-	return strings.TrimRight(line, "\r\n"), nil
+	if resp.Err != nil {
+		return fmt.Errorf("private: %w", resp.Err)
+	}
+	return nil
 }
 
 // Close closes the connection to the prepl server.
@@ -162,6 +367,28 @@ func (c *Client) Close() error {
 	return c.conn.Close()
 }
 
+// firstID is the optional request ID of Eval and friends.
+func firstID(id []string) string {
+	if len(id) > 0 {
+		return id[0]
+	}
+	return ""
+}
+
+// signedBytes parses ⍕ of a 220⌶ result ("¯33 ¯92 ...") into bytes.
+func signedBytes(s string) ([]byte, error) {
+	fields := strings.Fields(strings.ReplaceAll(s, "¯", "-"))
+	data := make([]byte, len(fields))
+	for i, f := range fields {
+		n, err := strconv.Atoi(f)
+		if err != nil || n < -128 || n > 127 {
+			return nil, fmt.Errorf("bad byte %q", f)
+		}
+		data[i] = byte(int8(n))
+	}
+	return data, nil
+}
+
 // toStringSlice converts an APLAN vector value to []string.
 func toStringSlice(v any) []string {
 	switch val := v.(type) {
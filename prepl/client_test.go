@@ -2,13 +2,18 @@ package prepl
 
 import (
 	"bufio"
+	"context"
 	"fmt"
 	"net"
+	"reflect"
 	"regexp"
+	"strconv"
 	"strings"
 	"sync"
 	"testing"
 	"time"
+
+	"github.com/cursork/gritt/amicable"
 )
 
 // --- UUIDv7 ---
@@ -121,7 +126,8 @@ func TestErrorInterface(t *testing.T) {
 // --- Mock server for Eval/EvalRaw tests ---
 
 // mockServer creates a TCP listener that responds to prepl requests.
-// The handler receives each line and returns a response line.
+// The handler receives each line and returns a response line, or "" to
+// send nothing.
 func mockServer(t *testing.T, handler func(line string) string) (addr string, close func()) {
 	t.Helper()
 	ln, err := net.Listen("tcp", "127.0.0.1:0")
@@ -144,8 +150,9 @@ func mockServer(t *testing.T, handler func(line string) string) (addr string, cl
 				return
 			}
 			line = strings.TrimRight(line, "\r\n")
-			resp := handler(line)
-			fmt.Fprintf(conn, "%s\n", resp)
+			if resp := handler(line); resp != "" {
+				fmt.Fprintf(conn, "%s\n", resp)
+			}
 		}
 	}()
 	return ln.Addr().String(), func() {
@@ -532,6 +539,309 @@ func TestEvalRawPassesExpressionThrough(t *testing.T) {
 	}
 }
 
+// --- Output ---
+
+const outReply = "(id: 'x' ⋄ tag: 'out' ⋄ val: 'step 1')\n" +
+	"(id: 'x' ⋄ tag: 'out' ⋄ val: '')\n" +
+	"(id: 'x' ⋄ tag: 'ret' ⋄ val: 42)"
+
+func TestEvalOut(t *testing.T) {
+	addr, cleanup := mockServer(t, func(line string) string { return outReply })
+	defer cleanup()
+
+	c, err := Connect(addr)
+	if err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+	defer c.Close()
+
+	resp, err := c.Eval("f 1", "x")
+	if err != nil {
+		t.Fatalf("Eval: %v", err)
+	}
+	if resp.Tag != "ret" || resp.Val != 42 || resp.ID != "x" {
+		t.Errorf("resp = %+v", resp)
+	}
+	if want := []string{"step 1", ""}; !reflect.DeepEqual(resp.Out, want) {
+		t.Errorf("Out = %q, want %q", resp.Out, want)
+	}
+
+	// Each call gets only its own output
+	var streamed []string
+	resp, err = c.EvalStream("f 2", func(line string) { streamed = append(streamed, line) })
+	if err != nil {
+		t.Fatalf("EvalStream: %v", err)
+	}
+	if len(streamed) != 2 || resp.Out != nil || resp.Val != 42 {
+		t.Errorf("streamed %q, resp %+v", streamed, resp)
+	}
+}
+
+func TestEvalRawOut(t *testing.T) {
+	addr, cleanup := mockServer(t, func(line string) string { return outReply })
+	defer cleanup()
+
+	c, err := Connect(addr)
+	if err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+	defer c.Close()
+
+	for i := 0; i < 2; i++ {
+		raw, err := c.EvalRaw("f 1")
+		if err != nil {
+			t.Fatalf("EvalRaw: %v", err)
+		}
+		if raw != outReply {
+			t.Errorf("EvalRaw = %q, want %q", raw, outReply)
+		}
+	}
+}
+
+// --- Private ---
+
+func TestPrivate(t *testing.T) {
+	var received []string
+	addr, cleanup := mockServer(t, func(line string) string {
+		received = append(received, line)
+		if line == "⍝PREPL private" {
+			return "(tag: 'ret')"
+		}
+		return "(tag: 'err' ⋄ en: 11 ⋄ message: 'Unknown prepl directive' ⋄ dm: ⊂'⍝PREPL x')"
+	})
+	defer cleanup()
+
+	c, err := Connect(addr)
+	if err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+	defer c.Close()
+
+	if err := c.Private(); err != nil {
+		t.Fatalf("Private: %v", err)
+	}
+	if len(received) != 1 || received[0] != "⍝PREPL private" {
+		t.Errorf("server received %q", received)
+	}
+	if _, err := c.EvalRaw("⍝PREPL x"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPrivateRefused(t *testing.T) {
+	addr, cleanup := mockServer(t, func(line string) string {
+		return "(tag: 'err' ⋄ en: 11 ⋄ message: 'Unknown prepl directive' ⋄ dm: ⊂'⍝PREPL private')"
+	})
+	defer cleanup()
+
+	c, err := Connect(addr)
+	if err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+	defer c.Close()
+
+	err = c.Private()
+	if err == nil || !strings.Contains(err.Error(), "Unknown prepl directive") {
+		t.Errorf("Private = %v, want the server's error", err)
+	}
+}
+
+// --- Interrupt ---
+
+// slowServer answers "slow" only when it is interrupted, as the server
+// does for ⍝PREPL interrupt; anything else gets its own text back.
+func slowServer(t *testing.T) (addr string, close func()) {
+	var running string
+	busy := false
+	reply := func(id, resp string) string {
+		if id == "" {
+			return resp
+		}
+		return "(id: '" + id + "' ⋄ " + resp[1:]
+	}
+	return mockServer(t, func(line string) string {
+		expr, id, _ := strings.Cut(line, " ⍝ID:")
+		if want, ok := strings.CutPrefix(line, "⍝PREPL interrupt"); ok {
+			want = strings.TrimSpace(want)
+			if !busy || (want != "" && want != running) {
+				return ""
+			}
+			busy = false
+			return reply(running, "(tag: 'interrupted')")
+		}
+		if expr == "slow" {
+			running, busy = id, true
+			return ""
+		}
+		return reply(id, "(tag: 'ret' ⋄ val: '"+expr+"')")
+	})
+}
+
+func TestEvalContextInterrupt(t *testing.T) {
+	addr, cleanup := slowServer(t)
+	defer cleanup()
+	c, err := Connect(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	resp, err := c.EvalContext(ctx, "slow", "req-1")
+	if err != nil {
+		t.Fatalf("EvalContext: %v", err)
+	}
+	if resp.Tag != "interrupted" || resp.ID != "req-1" || resp.Err == nil || resp.Err.EN != 1003 {
+		t.Errorf("got %+v", resp)
+	}
+
+	// Still in step with the server
+	if resp, err := c.Eval("after"); err != nil || resp.Val != "after" {
+		t.Errorf("Eval after interrupt = %+v, %v", resp, err)
+	}
+	// Finished in time: not interrupted
+	if resp, err := c.EvalContext(context.Background(), "quick"); err != nil || resp.Tag != "ret" {
+		t.Errorf("EvalContext(quick) = %+v, %v", resp, err)
+	}
+}
+
+func TestEvalContextDoneFirst(t *testing.T) {
+	addr, cleanup := slowServer(t)
+	defer cleanup()
+	c, err := Connect(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := c.EvalContext(ctx, "slow"); err != context.Canceled {
+		t.Errorf("EvalContext = %v, want context.Canceled", err)
+	}
+	if _, err := c.EvalRawContext(ctx, "slow"); err != context.Canceled {
+		t.Errorf("EvalRawContext = %v, want context.Canceled", err)
+	}
+	if resp, err := c.Eval("next"); err != nil || resp.Val != "next" {
+		t.Errorf("Eval = %+v, %v (slow was sent?)", resp, err)
+	}
+}
+
+func TestEvalRawContextInterrupt(t *testing.T) {
+	addr, cleanup := slowServer(t)
+	defer cleanup()
+	c, err := Connect(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	raw, err := c.EvalRawContext(ctx, "slow")
+	if err != nil || raw != "(tag: 'interrupted')" {
+		t.Errorf("EvalRawContext = %q, %v", raw, err)
+	}
+}
+
+func TestInterruptNotLate(t *testing.T) {
+	// Answers arrive right at the deadline, so the interrupt races them;
+	// it must never follow the next request or name another.
+	var mu sync.Mutex
+	var lines []string
+	addr, cleanup := mockServer(t, func(line string) string {
+		mu.Lock()
+		lines = append(lines, line)
+		mu.Unlock()
+		if strings.HasPrefix(line, "⍝PREPL interrupt") {
+			return ""
+		}
+		if strings.HasPrefix(line, "edge") {
+			time.Sleep(time.Millisecond)
+		}
+		expr, id, _ := strings.Cut(line, " ⍝ID:")
+		if id != "" {
+			return "(id: '" + id + "' ⋄ tag: 'ret' ⋄ val: '" + expr + "')"
+		}
+		return "(tag: 'ret' ⋄ val: '" + expr + "')"
+	})
+	defer cleanup()
+	c, err := Connect(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	for i := range 100 {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+		if i%2 == 0 {
+			_, err = c.EvalContext(ctx, "edge")
+		} else {
+			_, err = c.EvalRawContext(ctx, "edge")
+		}
+		cancel()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp, err := c.Eval("next"); err != nil || resp.Val != "next" {
+			t.Fatalf("Eval(next) = %+v, %v", resp, err)
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	var edgeID string
+	for _, line := range lines {
+		switch {
+		case strings.HasPrefix(line, "edge"):
+			_, edgeID, _ = strings.Cut(line, " ⍝ID:")
+		case strings.HasPrefix(line, "next"):
+			edgeID = "-" // no interrupt may follow
+		default:
+			if id := strings.TrimSpace(strings.TrimPrefix(line, "⍝PREPL interrupt")); edgeID == "-" || id != edgeID {
+				t.Fatalf("stray interrupt %q in %q", line, lines)
+			}
+		}
+	}
+}
+
+func TestInterruptUntil(t *testing.T) {
+	client, server := net.Pipe()
+	defer server.Close()
+	c := &Client{conn: client}
+	r := bufio.NewReader(server)
+
+	// An interrupt being written when stop is called is waited for
+	ctx, cancel := context.WithCancel(context.Background())
+	stop := c.interruptUntil(ctx, "a")
+	cancel() // its write blocks: nobody is reading yet
+	time.Sleep(10 * time.Millisecond)
+	stopped := make(chan struct{})
+	go func() {
+		stop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+		t.Fatal("stop returned while the interrupt was still being written")
+	case <-time.After(20 * time.Millisecond):
+	}
+	if line, _ := r.ReadString('\n'); line != "⍝PREPL interrupt a\n" {
+		t.Errorf("got %q", line)
+	}
+	<-stopped
+
+	// After stop, none is sent
+	ctx, cancel = context.WithCancel(context.Background())
+	c.interruptUntil(ctx, "b")()
+	cancel()
+	server.SetReadDeadline(time.Now().Add(20 * time.Millisecond))
+	if line, err := r.ReadString('\n'); err == nil {
+		t.Errorf("interrupt sent after stop: %q", line)
+	}
+}
+
 // --- Connect ---
 
 func TestConnectRefused(t *testing.T) {
@@ -643,3 +953,74 @@ func TestResponseFields(t *testing.T) {
 		t.Errorf("unexpected error Response fields: %+v", r2)
 	}
 }
+
+// --- ParseResponse ---
+
+func TestParseResponseAPLAN(t *testing.T) {
+	resp, err := ParseResponse("(tag: 'ret' ⋄ val: 1 2 3)\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Tag != "ret" || resp.Raw != "1 2 3" {
+		t.Errorf("got %+v", resp)
+	}
+}
+
+func TestParseResponse220(t *testing.T) {
+	// Namespace blobs need a live interpreter (see amicable's e2e tests);
+	// a vector still exercises the byte decoding.
+	data, err := amicable.Marshal([]any{1, 2, 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fields := make([]string, 0, len(data))
+	for _, b := range amicable.BytesToSigned(data) {
+		fields = append(fields, strings.ReplaceAll(strconv.Itoa(int(b)), "-", "¯"))
+	}
+	_, err = ParseResponse(strings.Join(fields, " "))
+	if err == nil || !strings.Contains(err.Error(), "expected namespace") {
+		t.Errorf("got %v, want expected namespace error", err)
+	}
+
+	if _, err := ParseResponse("¯33 999"); err == nil || !strings.Contains(err.Error(), "220⌶") {
+		t.Errorf("got %v, want 220⌶ parse error", err)
+	}
+}
+
+// --- Session expressions ---
+
+func TestFixExpr(t *testing.T) {
+	expr := FixExpr()
+	if !strings.HasPrefix(expr, "{}2 ⎕SE.⎕FIX ,¨'") || strings.ContainsAny(expr, "\r\n") {
+		t.Errorf("FixExpr() = %.60q...", expr)
+	}
+	if !strings.Contains(expr, "'    ∇ r←mode EvalAs expr;_mode'") {
+		t.Error("FixExpr() is missing EvalAs")
+	}
+}
+
+func TestEvalAsExpr(t *testing.T) {
+	got := EvalAsExpr("aplor", "'it''s'", 1000)
+	want := "{r←'aplor' ⎕SE.Prepl.EvalAs ⍵⋄⎕IO←1⋄⎕PW←32767⋄{}{⎕←'⍝PREPL← ',⍵}¨(1=1000|⍳≢r)⊂r}'''it''''s'''"
+	if got != want {
+		t.Errorf("EvalAsExpr = %q, want %q", got, want)
+	}
+	// expr must run before the dfn sets its own ⎕IO and ⎕PW
+	if strings.Index(got, "⎕IO←") < strings.Index(got, "EvalAs") {
+		t.Errorf("⎕IO is set before EvalAs runs: %s", got)
+	}
+}
+
+func TestParseEvalAs(t *testing.T) {
+	resp, err := ParseEvalAs("hello\n50%⍝PREPL← (tag: 'ret' ⋄ v\n⍝PREPL← al: 42)\n")
+	if err != nil {
+		t.Fatalf("ParseEvalAs: %v", err)
+	}
+	if resp.Val != 42 || !reflect.DeepEqual(resp.Out, []string{"hello", "50%"}) {
+		t.Errorf("resp = %+v", resp)
+	}
+
+	if _, err := ParseEvalAs("just display\n"); err == nil {
+		t.Error("expected error without a framed response")
+	}
+}
@@ -1,8 +1,83 @@
 package prepl
 
-import _ "embed"
+import (
+	_ "embed"
+	"fmt"
+	"strings"
+)
 
 // Source is the APL prepl server namespace source code.
 //
 //go:embed Prepl.apln
 var Source string
+
+// FixExpr returns a single-line expression that fixes the prepl namespace
+// into ⎕SE. It carries the source rather than a file path so that it also
+// works with interpreters on other machines.
+func FixExpr() string {
+	lines := strings.Split(strings.ReplaceAll(Source, "\r\n", "\n"), "\n")
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	quoted := make([]string, len(lines))
+	for i, l := range lines {
+		quoted[i] = "'" + strings.ReplaceAll(l, "'", "''") + "'"
+	}
+	return "{}2 ⎕SE.⎕FIX ,¨" + strings.Join(quoted, " ")
+}
+
+// evalAsFrame starts each line of the response EvalAsExpr prints, setting
+// it apart from whatever expr displays itself.
+const evalAsFrame = "⍝PREPL← "
+
+// EvalAsWidth is the chunk width for EvalAsExpr: well under the ⎕PW it
+// prints with, so the interpreter never wraps a chunk.
+const EvalAsWidth = 1000
+
+// EvalAsExpr returns a single-line expression that evaluates expr with
+// ⎕SE.Prepl.EvalAs in the given mode ("aplan" or "aplor") and prints the
+// response line in chunks of width characters, so that the interpreter
+// never wraps it, each behind a frame. ParseEvalAs reads the response
+// back out of the session output. expr runs under the session's own ⎕IO
+// and ⎕PW; the dfn only sets its own once EvalAs has returned, for the
+// chunking.
+func EvalAsExpr(mode, expr string, width int) string {
+	return fmt.Sprintf("{r←'%s' ⎕SE.Prepl.EvalAs ⍵⋄⎕IO←1⋄⎕PW←32767⋄{}{⎕←'%s',⍵}¨(1=%d|⍳≢r)⊂r}'%s'",
+		mode, evalAsFrame, width, strings.ReplaceAll(expr, "'", "''"))
+}
+
+// ParseEvalAs parses the session output of an EvalAsExpr expression: the
+// framed lines make up the response, and any others — what expr displayed
+// with ⎕← or ⍞← — are returned in its Out.
+func ParseEvalAs(output string) (*Response, error) {
+	response, display, ok := SplitEvalAs(output)
+	if !ok {
+		return nil, fmt.Errorf("no response in output: %q", output)
+	}
+	resp, err := ParseResponse(response)
+	if err != nil {
+		return nil, err
+	}
+	resp.Out = display
+	return resp, nil
+}
+
+// SplitEvalAs splits the session output of an EvalAsExpr expression into
+// the response line, as a prepl server would have sent it, and the lines
+// expr displayed itself. ok is false if there is no response in it.
+func SplitEvalAs(output string) (response string, display []string, ok bool) {
+	var framed strings.Builder
+	for _, line := range strings.Split(strings.TrimSuffix(output, "\n"), "\n") {
+		before, chunk, found := strings.Cut(line, evalAsFrame)
+		if !found {
+			display = append(display, line)
+			continue
+		}
+		if before != "" { // ⍞← left without a newline
+			display = append(display, before)
+		}
+		framed.WriteString(chunk)
+		ok = true
+	}
+	return framed.String(), display, ok
+}
@@ -1,6 +1,7 @@
 package prepl
 
 import (
+	"context"
 	"fmt"
 	"math"
 	"os"
@@ -469,6 +470,143 @@ func TestIntegration(t *testing.T) {
 		assertVal(t, row9[0], 91)
 		assertVal(t, row9[9], 100)
 	})
+
+	// === Output ===
+
+	t.Run("out_lines", func(t *testing.T) {
+		r := eval(t, "⎕←'hello' ⋄ {⎕←⍵}2 2⍴⍳4 ⋄ ⍞←'⎕←' ⋄ 42")
+		assertVal(t, r.Val, 42)
+		want := []string{"hello", "1 2", "3 4", "⎕←"}
+		if strings.Join(r.Out, "|") != strings.Join(want, "|") {
+			t.Fatalf("Out = %q, want %q", r.Out, want)
+		}
+	})
+
+	t.Run("out_from_defined_function", func(t *testing.T) {
+		// Defined by an earlier line (as by Link or the workspace), so
+		// nothing in the line that calls it displays anything itself
+		eval(t, "Shout←{⎕←'shout: ',⍵ ⋄ ≢⍵}")
+		r := eval(t, "Shout 'abc'")
+		assertVal(t, r.Val, 3)
+		if want := []string{"shout: abc"}; strings.Join(r.Out, "|") != strings.Join(want, "|") {
+			t.Fatalf("Out = %q, want %q", r.Out, want)
+		}
+		if r := eval(t, "1+1"); len(r.Out) != 0 {
+			t.Fatalf("next request got Out = %q", r.Out)
+		}
+	})
+
+	t.Run("evalas_session_settings", func(t *testing.T) {
+		// The wrapper chunks under its own ⎕IO and ⎕PW; the expression
+		// must still see the session's
+		eval(t, "⎕IO←0")
+		defer eval(t, "⎕IO←1")
+		r := eval(t, EvalAsExpr("aplan", "⎕←⍳40 ⋄ ⍳3", 1000))
+		inner, err := ParseEvalAs(strings.Join(r.Out, "\n"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		vec, ok := inner.Val.([]any)
+		if !ok || len(vec) != 3 {
+			t.Fatalf("Val = %v, want 0 1 2", inner.Val)
+		}
+		assertVal(t, vec[0], 0)
+		if len(inner.Out) < 2 {
+			t.Errorf("⎕←⍳40 not wrapped at the session's ⎕PW: %q", inner.Out)
+		}
+	})
+
+	// === Multiple connections ===
+
+	t.Run("concurrent_connections", func(t *testing.T) {
+		slow, err := Connect(fmt.Sprintf("localhost:%d", port))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer slow.Close()
+		done := make(chan error, 1)
+		go func() {
+			_, err := slow.Eval("⎕DL 2")
+			done <- err
+		}()
+		time.Sleep(200 * time.Millisecond)
+		start := time.Now()
+		assertVal(t, eval(t, "1+1").Val, 2)
+		if d := time.Since(start); d > time.Second {
+			t.Errorf("waited %v behind another connection's ⎕DL", d)
+		}
+		if err := <-done; err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("pipelined_batch", func(t *testing.T) {
+		async, err := Connect(fmt.Sprintf("localhost:%d", port))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer async.Close()
+		exprs := make([]string, 100)
+		for i := range exprs {
+			exprs[i] = fmt.Sprintf("⎕←%d ⋄ %d×2", i, i)
+		}
+		resps, err := async.Batch(context.Background(), exprs)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i, r := range resps {
+			assertVal(t, r.Val, i*2)
+			if len(r.Out) != 1 || r.Out[0] != fmt.Sprint(i) {
+				t.Fatalf("%d: Out = %q", i, r.Out)
+			}
+		}
+	})
+
+	t.Run("private_namespace", func(t *testing.T) {
+		other, err := Connect(fmt.Sprintf("localhost:%d", port))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer other.Close()
+		if err := other.Private(); err != nil {
+			t.Fatal(err)
+		}
+		eval(t, "preplShared←1")
+		if _, err := other.Eval("preplMine←2"); err != nil {
+			t.Fatal(err)
+		}
+		r, err := other.Eval("preplShared")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if r.Tag != "err" {
+			t.Errorf("private connection sees #.preplShared: %+v", r)
+		}
+		assertVal(t, eval(t, "⎕NC'preplMine'").Val, 0)
+	})
+
+	t.Run("interrupt", func(t *testing.T) {
+		other, err := Connect(fmt.Sprintf("localhost:%d", port))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer other.Close()
+		ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+		defer cancel()
+		start := time.Now()
+		r, err := other.EvalContext(ctx, "⎕DL 30")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if r.Tag != "interrupted" || time.Since(start) > 10*time.Second {
+			t.Fatalf("got %+v after %v", r, time.Since(start))
+		}
+		r, err = other.Eval("1+1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertVal(t, r.Val, 2)
+	})
 }
 
 func assertVal(t *testing.T, got any, want int) {
@@ -0,0 +1,201 @@
+package prepl
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// marker starts the lines the server displays in the session around each
+// evaluation of a connection that asked with ⍝PREPL output:
+//
+//	⍝PREPL⍝ <token> begin <id>
+//	⍝PREPL⍝ <token> end <id>
+const marker = "⍝PREPL⍝ "
+
+// outputWait is how long a response waits for its evaluation's end marker
+// to come through the session; the server displays it before replying,
+// but the session and the connection are different routes.
+const outputWait = time.Second
+
+// Output sorts an interpreter's session output by the prepl request that
+// displayed it, so whatever ⎕← and ⍞← show — from the line sent or from
+// any function it calls — reaches the client as out lines. Feed it
+// everything the session displays (aplsock does, from its RIDE client)
+// and hand it to clients with CaptureOutput.
+//
+// A line is put down to a request when it is the only one being
+// evaluated; anything else, such as the output of several connections
+// running side by side, goes to Unclaimed.
+type Output struct {
+	// Unclaimed receives the lines that belong to no request. nil drops
+	// them.
+	Unclaimed func(line string)
+
+	mu       sync.Mutex
+	partial  string              // display after the last newline
+	open     []string            // keys of the evaluations under way
+	captures map[string]*capture // by key
+}
+
+// capture collects the output of one request.
+type capture struct {
+	o    *Output
+	key  string
+	out  func(line string) // nil to collect into buf
+	buf  []string
+	done chan struct{} // closed at the end marker
+}
+
+// Write adds text displayed in the session; lines may come in pieces.
+func (o *Output) Write(text string) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	text = o.partial + text
+	lines := strings.Split(text, "\n")
+	o.partial = lines[len(lines)-1]
+	for _, line := range lines[:len(lines)-1] {
+		o.line(strings.TrimSuffix(line, "\r"))
+	}
+}
+
+// line handles one complete line of session output. A marker may follow
+// display that ⍞← left without a newline.
+func (o *Output) line(line string) {
+	before, mark, ok := strings.Cut(line, marker)
+	if !ok {
+		o.emit(line)
+		return
+	}
+	if before != "" {
+		o.emit(before)
+	}
+	f := strings.Fields(mark)
+	if len(f) < 2 {
+		return
+	}
+	key := f[0] + " "
+	if len(f) > 2 {
+		key += f[2]
+	}
+	switch f[1] {
+	case "begin":
+		o.open = append(o.open, key)
+	case "end":
+		for i, k := range o.open {
+			if k == key {
+				o.open = append(o.open[:i], o.open[i+1:]...)
+				break
+			}
+		}
+		if c := o.captures[key]; c != nil {
+			delete(o.captures, key)
+			close(c.done)
+		}
+	}
+}
+
+// emit gives a line of display to the request it belongs to.
+func (o *Output) emit(line string) {
+	if len(o.open) == 1 {
+		if c := o.captures[o.open[0]]; c != nil {
+			if c.out != nil {
+				c.out(line)
+			} else {
+				c.buf = append(c.buf, line)
+			}
+			return
+		}
+	}
+	if o.Unclaimed != nil {
+		o.Unclaimed(line)
+	}
+}
+
+// expect starts collecting the output of the evaluation with the given
+// key, before its request is sent.
+func (o *Output) expect(key string, out func(line string)) *capture {
+	c := &capture{o: o, key: key, out: out, done: make(chan struct{})}
+	o.mu.Lock()
+	if o.captures == nil {
+		o.captures = make(map[string]*capture)
+	}
+	o.captures[key] = c
+	o.mu.Unlock()
+	return c
+}
+
+// wait waits, once the response has arrived, for the evaluation's output
+// to be complete, and returns what was collected. Nothing is delivered
+// after it returns. A nil capture has nothing to wait for.
+func (c *capture) wait() []string {
+	if c == nil {
+		return nil
+	}
+	select {
+	case <-c.done:
+	case <-time.After(outputWait):
+	}
+	c.close()
+	return c.buf
+}
+
+// close stops collecting, for a request that won't be answered.
+func (c *capture) close() {
+	if c == nil {
+		return
+	}
+	c.o.mu.Lock()
+	if c.o.captures[c.key] == c {
+		delete(c.o.captures, c.key)
+	}
+	c.o.mu.Unlock()
+}
+
+// CaptureOutput asks the server to mark each of this connection's
+// evaluations in the session, and o to send what they display to the
+// request, as out lines: EvalStream's out, Response.Out, and EvalRaw's
+// raw lines (always APLAN, whatever the server's mode). o must be fed the
+// session output of the interpreter the server runs in. Call it before
+// the client is shared.
+func (c *Client) CaptureOutput(o *Output) error {
+	resp, err := c.Eval("⍝PREPL output")
+	if err != nil {
+		return err
+	}
+	if resp.Err != nil {
+		return fmt.Errorf("output: %w", resp.Err)
+	}
+	token, ok := resp.Val.(string)
+	if !ok {
+		return fmt.Errorf("output: unexpected token %v", resp.Val)
+	}
+	c.output, c.token = o, token
+	return nil
+}
+
+// capture starts collecting the session output of request id, if the
+// client captures output.
+func (c *Client) capture(id string, out func(line string)) *capture {
+	if c.output == nil {
+		return nil
+	}
+	return c.output.expect(c.token+" "+id, out)
+}
+
+// FormatOut formats a line of output as an out response for request id
+// (maybe ""), in APLAN.
+func FormatOut(line, id string) string {
+	resp := "(tag: 'out' ⋄ val: '" + strings.ReplaceAll(line, "'", "''") + "')"
+	if id != "" {
+		resp = "(id: '" + id + "' ⋄ " + resp[1:]
+	}
+	return resp
+}
+
+// requestID is the ⍝ID: an expression carries, as the server reads it.
+func requestID(expr string) string {
+	_, id, _ := strings.Cut(expr, "⍝ID:")
+	return id
+}
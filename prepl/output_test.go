@@ -0,0 +1,132 @@
+package prepl
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestOutputSorting(t *testing.T) {
+	var unclaimed []string
+	o := &Output{Unclaimed: func(line string) { unclaimed = append(unclaimed, line) }}
+	a := o.expect("A 1", nil)
+	b := o.expect("B ", nil)
+
+	o.Write("before\n⍝PREPL⍝ A begin 1\nfrom a\npart")
+	o.Write("ial\n50%⍝PREPL⍝ A end 1\n")
+	o.Write("⍝PREPL⍝ B begin \n⍝PREPL⍝ C begin 2\nboth\n⍝PREPL⍝ C end 2\nfrom b\n⍝PREPL⍝ B end \nafter\n")
+
+	if got, want := a.wait(), []string{"from a", "partial", "50%"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("A = %q, want %q", got, want)
+	}
+	if got, want := b.wait(), []string{"from b"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("B = %q, want %q", got, want)
+	}
+	if want := []string{"before", "both", "after"}; !reflect.DeepEqual(unclaimed, want) {
+		t.Errorf("unclaimed = %q, want %q", unclaimed, want)
+	}
+}
+
+func TestOutputClosed(t *testing.T) {
+	var unclaimed []string
+	o := &Output{Unclaimed: func(line string) { unclaimed = append(unclaimed, line) }}
+	k := o.expect("A ", nil)
+	k.close()
+	o.Write("⍝PREPL⍝ A begin \nlate\n⍝PREPL⍝ A end \n")
+	if k.buf != nil || !reflect.DeepEqual(unclaimed, []string{"late"}) {
+		t.Errorf("buf %q, unclaimed %q", k.buf, unclaimed)
+	}
+}
+
+// sessionServer is a mock prepl server with output marked in o's session:
+// each request displays "shown: <expr>" there, as a function defined
+// beforehand would with ⎕←, after a delay.
+func sessionServer(t *testing.T, o *Output, delay time.Duration) (addr string, close func()) {
+	return mockServer(t, func(line string) string {
+		expr, _, _ := strings.Cut(line, " ⍝ID:")
+		id := requestID(line)
+		if expr == "⍝PREPL output" {
+			return "(tag: 'ret' ⋄ val: 'prepl.CON1')"
+		}
+		show := func() {
+			o.Write("⍝PREPL⍝ prepl.CON1 begin " + id + "\nshown: " + expr + "\n⍝PREPL⍝ prepl.CON1 end " + id + "\n")
+		}
+		if delay > 0 {
+			time.AfterFunc(delay, show)
+		} else {
+			show()
+		}
+		if id != "" {
+			return "(id: '" + id + "' ⋄ tag: 'ret' ⋄ val: 1)"
+		}
+		return "(tag: 'ret' ⋄ val: 1)"
+	})
+}
+
+func TestCaptureOutput(t *testing.T) {
+	o := &Output{}
+	addr, cleanup := sessionServer(t, o, 50*time.Millisecond)
+	defer cleanup()
+
+	c, err := Connect(addr)
+	if err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+	defer c.Close()
+	if err := c.CaptureOutput(o); err != nil {
+		t.Fatalf("CaptureOutput: %v", err)
+	}
+
+	// The session is slower than the connection: the response waits
+	resp, err := c.Eval("Shout 'fn'")
+	if err != nil {
+		t.Fatalf("Eval: %v", err)
+	}
+	if want := []string{"shown: Shout 'fn'"}; !reflect.DeepEqual(resp.Out, want) {
+		t.Errorf("Out = %q, want %q", resp.Out, want)
+	}
+
+	raw, err := c.EvalRaw("Shout 'it''s' ⍝ID:x")
+	if err != nil {
+		t.Fatalf("EvalRaw: %v", err)
+	}
+	want := "(id: 'x' ⋄ tag: 'out' ⋄ val: 'shown: Shout ''it''''s''')\n(id: 'x' ⋄ tag: 'ret' ⋄ val: 1)"
+	if raw != want {
+		t.Errorf("EvalRaw = %q, want %q", raw, want)
+	}
+	resp, err = ParseResponse(strings.Split(raw, "\n")[0])
+	if err != nil || resp.Out[0] != "shown: Shout 'it''s'" {
+		t.Errorf("out line parses as %+v, %v", resp, err)
+	}
+
+	resps, err := c.Batch(context.Background(), []string{"Shout 1", "Shout 2"})
+	if err != nil {
+		t.Fatalf("Batch: %v", err)
+	}
+	for i, r := range resps {
+		if want := []string{"shown: Shout " + string(rune('1'+i))}; !reflect.DeepEqual(r.Out, want) {
+			t.Errorf("%d: Out = %q, want %q", i, r.Out, want)
+		}
+	}
+}
+
+func TestCaptureOutputRefused(t *testing.T) {
+	addr, cleanup := mockServer(t, func(line string) string {
+		return "(tag: 'err' ⋄ en: 11 ⋄ message: 'Unknown prepl directive')"
+	})
+	defer cleanup()
+
+	c, err := Connect(addr)
+	if err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+	defer c.Close()
+	if err := c.CaptureOutput(&Output{}); err == nil {
+		t.Fatal("CaptureOutput succeeded against an old server")
+	}
+	if c.output != nil {
+		t.Error("output captured anyway")
+	}
+}
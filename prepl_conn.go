@@ -0,0 +1,195 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/cursork/gritt/codec"
+	"github.com/cursork/gritt/prepl"
+	"github.com/cursork/gritt/ride"
+)
+
+// preplConn stands in for the RIDE connection when gritt runs with
+// -prepl. Execute requests are evaluated in order over a prepl
+// connection, and each response comes back as the RIDE messages the
+// session already handles: the input echo, output, errors and prompts.
+// Internal queries, socket requests and interrupts work unchanged;
+// anything else RIDE would do (editors, the tracer) isn't available.
+type preplConn struct {
+	client *prepl.Client
+	exec   chan preplRequest
+	events chan rideEvent
+}
+
+type preplRequest struct {
+	text    string
+	display bool // show results as the session displays them, not APLAN
+}
+
+// newPreplConn starts evaluating requests sent with execute.
+func newPreplConn(c *prepl.Client) *preplConn {
+	p := &preplConn{
+		client: c,
+		exec:   make(chan preplRequest, 16),
+		events: make(chan rideEvent),
+	}
+	go p.run()
+	return p
+}
+
+// execute queues text (one or more newline-terminated lines) for
+// evaluation. Results are shown as APLAN, or with display (for internal
+// queries, which parse the session's display) as displayText has them.
+func (p *preplConn) execute(text string, display bool) error {
+	select {
+	case p.exec <- preplRequest{text, display}:
+		return nil
+	default:
+		return fmt.Errorf("prepl: too many requests queued")
+	}
+}
+
+// interrupt stops the expression being evaluated, and any lines of the
+// request still to come. Requests queued behind it still run.
+func (p *preplConn) interrupt() error {
+	return p.client.Interrupt("")
+}
+
+// Close closes the prepl connection; the session sees it as a disconnect.
+func (p *preplConn) Close() error {
+	return p.client.Close()
+}
+
+func (p *preplConn) run() {
+	emit := func(cmd string, args map[string]any) {
+		p.events <- rideEvent{msg: &ride.Message{Command: cmd, Args: args}}
+	}
+	output := func(text string, typ int) {
+		emit("AppendSessionOutput", map[string]any{"result": text, "type": typ})
+	}
+	for req := range p.exec {
+		emit("SetPromptType", map[string]any{"type": 0})
+		output(req.text, 14)
+	lines:
+		for _, line := range strings.Split(strings.TrimSuffix(req.text, "\n"), "\n") {
+			line = strings.TrimSpace(line)
+			if line == "" {
+				continue // the server doesn't answer empty lines
+			}
+			resp, err := p.client.EvalStream(line, func(out string) {
+				output(out+"\n", 1)
+			})
+			if err != nil {
+				p.events <- rideEvent{err: err}
+				return
+			}
+			switch {
+			case resp.Tag == "interrupted":
+				output("INTERRUPT\n", 5)
+				emit("HadError", map[string]any{"error": resp.Err.EN})
+				break lines
+			case resp.Err != nil:
+				output(preplErrorText(resp.Err), 5)
+				emit("HadError", map[string]any{"error": resp.Err.EN})
+			case resp.Raw != "" && req.display:
+				output(displayText(resp.Val)+"\n", 1)
+			case resp.Raw != "":
+				p.events <- rideEvent{
+					msg:   &ride.Message{Command: "AppendSessionOutput", Args: map[string]any{"result": resp.Raw + "\n", "type": 1}},
+					value: explorable(resp.Val),
+				}
+			}
+		}
+		emit("SetPromptType", map[string]any{"type": 1})
+	}
+}
+
+// preplErrorText shows a prepl error as the session shows one: ⎕DM (or
+// the message, if there is none), followed by the error number.
+func preplErrorText(e *prepl.Error) string {
+	lines := e.DM
+	if len(lines) == 0 {
+		lines = []string{e.Message}
+	}
+	return strings.Join(lines, "\n") + fmt.Sprintf("\n⍝ EN %d\n", e.EN)
+}
+
+// displayText approximates the session's display of simple values —
+// scalars, and vectors and matrices of them — for internal queries that
+// parse it. Anything else is shown as APLAN.
+func displayText(v any) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case []any:
+		if s, ok := rowText(v); ok {
+			return s
+		}
+	case *codec.Array:
+		if len(v.Shape) != 2 {
+			break
+		}
+		lines := make([]string, len(v.Data))
+		for i, row := range v.Data {
+			r, _ := row.([]any)
+			s, ok := rowText(r)
+			if !ok {
+				return codec.Serialize(v, codec.SerializeOptions{UseDiamond: true})
+			}
+			lines[i] = s
+		}
+		return strings.Join(lines, "\n")
+	}
+	return codec.Serialize(v, codec.SerializeOptions{UseDiamond: true})
+}
+
+// rowText displays a simple vector: characters run together, numbers
+// separated by spaces. ok is false if it holds anything else.
+func rowText(v []any) (text string, ok bool) {
+	chars := true
+	parts := make([]string, len(v))
+	for i, e := range v {
+		switch e := e.(type) {
+		case string:
+			if utf8.RuneCountInString(e) != 1 {
+				return "", false
+			}
+			parts[i] = e
+		case int, float64, complex128:
+			chars = false
+			parts[i] = codec.Serialize(e)
+		default:
+			return "", false
+		}
+	}
+	if chars {
+		return strings.Join(parts, ""), true
+	}
+	return strings.Join(parts, " "), true
+}
+
+// explorable returns v if the data browser can open it, else nil.
+func explorable(v any) any {
+	switch v.(type) {
+	case *codec.Namespace, *codec.Array, []any:
+		return v
+	}
+	return nil
+}
+
+// rideOnly names the feature a RIDE command serves, for the status line
+// when gritt runs over -prepl and can't send it.
+func rideOnly(cmd string) string {
+	switch cmd {
+	case "Edit", "SaveChanges", "CloseWindow", "CloseAllWindows", "SetLineAttributes", "FormatCode", "ShowAsArrayNotation", "GetWindowLayout":
+		return "editors"
+	case "StepInto", "RunCurrentLine", "ContinueTrace", "Continue", "RestartThreads", "TraceBackward", "TraceForward":
+		return "the tracer"
+	case "GetThreads", "SetThread":
+		return "threads"
+	case "GetAutocomplete":
+		return "autocomplete"
+	}
+	return cmd
+}
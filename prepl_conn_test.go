@@ -0,0 +1,169 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cursork/gritt/codec"
+	"github.com/cursork/gritt/prepl"
+	"github.com/cursork/gritt/ride"
+)
+
+// fakePrepl serves prepl requests with reply, which gives the response
+// lines for each expression, or "" for none.
+func fakePrepl(t *testing.T, reply func(expr string) string) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			if resp := reply(strings.TrimRight(line, "\r\n")); resp != "" {
+				fmt.Fprintf(conn, "%s\n", resp)
+			}
+		}
+	}()
+	return ln.Addr().String()
+}
+
+func TestPreplSession(t *testing.T) {
+	slow := make(chan struct{})
+	addr := fakePrepl(t, func(expr string) string {
+		switch expr {
+		case "⎕DL 60":
+			close(slow)
+			return ""
+		case "⍝PREPL interrupt":
+			return "(tag: 'interrupted')"
+		case "⎕←'hi' ⋄ 2 2⍴⍳4":
+			return "(tag: 'out' ⋄ val: 'hi')\n(tag: 'ret' ⋄ val: [1 2 ⋄ 3 4])"
+		case "1÷0":
+			return "(tag: 'err' ⋄ en: 11 ⋄ message: 'DOMAIN ERROR' ⋄ dm: ('DOMAIN ERROR: Divide by zero' '      1÷0' '       ∧'))"
+		case "⎕NL 2":
+			return "(tag: 'ret' ⋄ val: 'x')"
+		}
+		return "(tag: 'ret')"
+	})
+	m := newTestModel(t, nil)
+	m.preplAddr, m.connecting = addr, true
+	m.lines = []Line{{Text: aplIndent}}
+	m.update(m.Init()())
+	if !m.connected || !m.ready || m.prepl == nil {
+		t.Fatalf("not connected: %v", m.err)
+	}
+	// pump handles events until the prompt comes back
+	pump := func() {
+		t.Helper()
+		for {
+			select {
+			case ev := <-m.msgs:
+				next, _ := m.handleRide(ev)
+				m.Model = next.(Model)
+				if ev.msg != nil && ev.msg.Command == "SetPromptType" && m.ready {
+					return
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("no prompt")
+			}
+		}
+	}
+	run := func(expr string) {
+		t.Helper()
+		m.setCurrentLine(aplIndent + expr)
+		next, _ := m.execute()
+		m.Model = next.(Model)
+		pump()
+	}
+	text := func() string {
+		var lines []string
+		for _, l := range m.lines {
+			lines = append(lines, l.Text)
+		}
+		return strings.Join(lines, "\n")
+	}
+
+	run("⎕←'hi' ⋄ 2 2⍴⍳4")
+	if want := aplIndent + "⎕←'hi' ⋄ 2 2⍴⍳4\nhi\n[1 2 ⋄ 3 4]\n" + aplIndent; text() != want {
+		t.Errorf("session:\n%s\nwant:\n%s", text(), want)
+	}
+	run("1÷0")
+	if !strings.Contains(text(), "DOMAIN ERROR: Divide by zero\n      1÷0\n       ∧\n⍝ EN 11\n") {
+		t.Errorf("error not shown:\n%s", text())
+	}
+
+	// The last compound result can be explored
+	m.explore()
+	if p := m.panes.Get("explore"); p == nil {
+		t.Error("explore didn't open the data browser")
+	} else if _, ok := p.Content.(*DataBrowserPane); !ok {
+		t.Errorf("explore opened %T", p.Content)
+	}
+
+	// Internal queries go over prepl too
+	var got []string
+	m.executeInternal("⎕NL 2", func(outputs []string) { got = outputs })
+	pump()
+	if strings.Join(got, "") != "x\n" || strings.Contains(text(), "⎕NL") {
+		t.Errorf("internal query gave %q; session:\n%s", got, text())
+	}
+
+	// Interrupts stop the expression being evaluated
+	m.setCurrentLine(aplIndent + "⎕DL 60")
+	next, _ := m.execute()
+	m.Model = next.(Model)
+	for range 2 { // prompt and echo; the line is sent next
+		next, _ = m.handleRide(<-m.msgs)
+		m.Model = next.(Model)
+	}
+	<-slow
+	if err := m.send("WeakInterrupt", ride.WeakInterrupt{}); err != nil {
+		t.Fatal(err)
+	}
+	pump()
+	if !strings.HasSuffix(text(), "⎕DL 60\nINTERRUPT\n"+aplIndent) {
+		t.Errorf("interrupt not shown:\n%s", text())
+	}
+
+	// RIDE-only features say so
+	if err := m.send("Edit", ride.Edit{Text: "f"}); err == nil || !strings.Contains(m.transientErr, "editors") {
+		t.Errorf("Edit: err %v, status %q", err, m.transientErr)
+	}
+}
+
+func TestPreplText(t *testing.T) {
+	if got := preplErrorText(&prepl.Error{Message: "VALUE ERROR", EN: 6}); got != "VALUE ERROR\n⍝ EN 6\n" {
+		t.Errorf("got %q", got)
+	}
+	for aplan, want := range map[string]string{
+		"'abc'":           "abc",
+		"1 ¯2 3":          "1 ¯2 3",
+		"['ab' ⋄ 'cd']":   "ab\ncd",
+		"[1 0 0 ⋄ 2 3 4]": "1 0 0\n2 3 4",
+		"('ab' 'cd')":     "('ab' ⋄ 'cd')",
+		"(x: 1)":          "(x: 1)",
+	} {
+		v, err := codec.APLAN(aplan)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := displayText(v); got != want {
+			t.Errorf("displayText(%s) = %q, want %q", aplan, got, want)
+		}
+	}
+}
@@ -2,6 +2,7 @@ package ride
 
 import (
 	"bufio"
+	"context"
 	"fmt"
 	"io"
 	"net"
@@ -15,6 +16,13 @@ type Client struct {
 	reader *bufio.Reader
 	writer io.Writer
 	mu     sync.Mutex // Protects reads
+	wmu    sync.Mutex // Keeps concurrent senders from interleaving frames
+
+	// Dispatcher state, see Start.
+	smu  sync.Mutex
+	subs []*subscription
+	done chan struct{}
+	err  error
 }
 
 // Connect connects to a Dyalog interpreter in SERVE mode and performs handshake.
@@ -24,11 +32,7 @@ func Connect(addr string) (*Client, error) {
 		return nil, fmt.Errorf("dial: %w", err)
 	}
 
-	c := &Client{
-		conn:   conn,
-		reader: bufio.NewReader(conn),
-		writer: conn,
-	}
+	c := newClient(conn)
 	if err := c.handshake(); err != nil {
 		conn.Close()
 		return nil, fmt.Errorf("handshake: %w", err)
@@ -37,6 +41,14 @@ func Connect(addr string) (*Client, error) {
 	return c, nil
 }
 
+func newClient(conn net.Conn) *Client {
+	return &Client{
+		conn:   conn,
+		reader: bufio.NewReader(conn),
+		writer: conn,
+	}
+}
+
 // handshake performs the RIDE protocol handshake for SERVE mode.
 // In SERVE mode, Dyalog sends first.
 func (c *Client) handshake() error {
@@ -62,6 +74,42 @@ func (c *Client) handshake() error {
 		return fmt.Errorf("unexpected: %q", raw)
 	}
 
+	return c.identify()
+}
+
+// acceptHandshake performs the RIDE protocol handshake for CONNECT mode,
+// where Dyalog dialled us. Neither side waits for the other here, so send
+// ours straight away and take Dyalog's two strings in either order.
+func (c *Client) acceptHandshake() error {
+	if err := sendRaw(c.writer, "SupportedProtocols=2"); err != nil {
+		return err
+	}
+	if err := sendRaw(c.writer, "UsingProtocol=2"); err != nil {
+		return err
+	}
+
+	var supported, using bool
+	for !supported || !using {
+		_, raw, err := Recv(c.reader)
+		if err != nil {
+			return fmt.Errorf("recv handshake: %w", err)
+		}
+		switch raw {
+		case "SupportedProtocols=2":
+			supported = true
+		case "UsingProtocol=2":
+			using = true
+		default:
+			return fmt.Errorf("unexpected: %q", raw)
+		}
+	}
+
+	return c.identify()
+}
+
+// identify completes either handshake: Identify, Connect, then wait for
+// the interpreter to become ready.
+func (c *Client) identify() error {
 	// Send Identify and Connect
 	if err := Send(c.writer, "Identify", map[string]any{"apiVersion": 1, "identity": 1}); err != nil {
 		return err
@@ -77,7 +125,8 @@ func (c *Client) handshake() error {
 			return fmt.Errorf("waiting for ready: %w", err)
 		}
 		if msg != nil && msg.Command == "SetPromptType" {
-			if t, ok := msg.Args["type"].(float64); ok && t > 0 {
+			var p SetPromptType
+			if msg.Decode(&p) == nil && p.Ready() {
 				return nil
 			}
 		}
@@ -89,20 +138,29 @@ func (c *Client) Close() error {
 	return c.conn.Close()
 }
 
-// Send sends a command to the interpreter.
-func (c *Client) Send(cmd string, args map[string]any) error {
+// Send sends a command to the interpreter. Args is a map or one of the
+// typed message structs. Safe for concurrent use.
+func (c *Client) Send(cmd string, args any) error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
 	return Send(c.writer, cmd, args)
 }
 
 // SendRaw sends a raw JSON message to the interpreter.
 func (c *Client) SendRaw(json string) error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
 	return sendRaw(c.writer, json)
 }
 
 // Recv receives a single message from the interpreter.
 // Returns (message, raw, error). For JSON messages, message is non-nil.
 // For handshake messages, raw is the string.
+// Returns ErrStarted once Start has been called.
 func (c *Client) Recv() (*Message, string, error) {
+	if c.Done() != nil {
+		return nil, "", ErrStarted
+	}
 	c.mu.Lock()
 	defer c.mu.Unlock()
 	return Recv(c.reader)
@@ -110,14 +168,25 @@ func (c *Client) Recv() (*Message, string, error) {
 
 // Execute runs APL code and returns the output.
 // Skips input echo (type 14) and waits for SetPromptType.
+// Works whether or not the client is dispatching.
 func (c *Client) Execute(code string) ([]string, error) {
-	if err := Send(c.writer, "Execute", map[string]any{"text": code + "\n", "trace": 0}); err != nil {
+	next := func() (*Message, error) {
+		msg, _, err := c.Recv()
+		return msg, err
+	}
+	if c.Done() != nil {
+		q := c.Queue("AppendSessionOutput", "SetPromptType")
+		defer q.Close()
+		next = func() (*Message, error) { return q.Next(context.Background()) }
+	}
+
+	if err := c.Send("Execute", Execute{Text: code + "\n"}); err != nil {
 		return nil, err
 	}
 
 	var outputs []string
 	for {
-		msg, _, err := c.Recv()
+		msg, err := next()
 		if err != nil {
 			return outputs, err
 		}
@@ -127,15 +196,15 @@ func (c *Client) Execute(code string) ([]string, error) {
 
 		switch msg.Command {
 		case "AppendSessionOutput":
+			var out AppendSessionOutput
 			// type 14 is input echo - skip it
-			if t, ok := msg.Args["type"].(float64); ok && t == 14 {
+			if msg.Decode(&out) != nil || out.Type == 14 {
 				continue
 			}
-			if result, ok := msg.Args["result"].(string); ok {
-				outputs = append(outputs, result)
-			}
+			outputs = append(outputs, out.Result)
 		case "SetPromptType":
-			if t, ok := msg.Args["type"].(float64); ok && t > 0 {
+			var p SetPromptType
+			if msg.Decode(&p) == nil && p.Ready() {
 				return outputs, nil
 			}
 		}
@@ -0,0 +1,165 @@
+package ride
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// ErrStarted is returned by Recv once the client is dispatching messages.
+var ErrStarted = errors.New("ride: client is dispatching; use Subscribe or Queue")
+
+// subscription is one registered handler.
+type subscription struct {
+	fn   func(*Message)
+	cmds map[string]bool // nil means every command
+}
+
+// Start launches a goroutine that reads every incoming message and hands
+// it to the handlers registered with Subscribe and Queue. This lets
+// several consumers share one connection. Once started, Recv returns
+// ErrStarted. Start is a no-op if already called.
+func (c *Client) Start() {
+	c.smu.Lock()
+	defer c.smu.Unlock()
+	if c.done != nil {
+		return
+	}
+	c.done = make(chan struct{})
+	go c.dispatchLoop()
+}
+
+// Done is closed when the dispatch loop stops, i.e. the connection is lost
+// or closed. It is nil before Start.
+func (c *Client) Done() <-chan struct{} {
+	c.smu.Lock()
+	defer c.smu.Unlock()
+	return c.done
+}
+
+// Err returns the error that stopped the dispatch loop, if any.
+func (c *Client) Err() error {
+	c.smu.Lock()
+	defer c.smu.Unlock()
+	return c.err
+}
+
+// Subscribe registers fn for messages with the given commands, or for all
+// messages if none are given. Handlers run on the dispatch goroutine in
+// registration order and must not block; use Queue to process messages
+// elsewhere. The returned function removes the handler.
+func (c *Client) Subscribe(fn func(*Message), cmds ...string) (unsubscribe func()) {
+	sub := &subscription{fn: fn}
+	if len(cmds) > 0 {
+		sub.cmds = make(map[string]bool, len(cmds))
+		for _, cmd := range cmds {
+			sub.cmds[cmd] = true
+		}
+	}
+	c.smu.Lock()
+	c.subs = append(c.subs, sub)
+	c.smu.Unlock()
+
+	return func() {
+		c.smu.Lock()
+		defer c.smu.Unlock()
+		for i, s := range c.subs {
+			if s == sub {
+				c.subs = append(c.subs[:i:i], c.subs[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+func (c *Client) dispatchLoop() {
+	for {
+		msg, _, err := Recv(c.reader)
+		if err != nil {
+			c.smu.Lock()
+			c.err = err
+			close(c.done)
+			c.smu.Unlock()
+			return
+		}
+		if msg == nil {
+			continue // stray handshake text
+		}
+		c.smu.Lock()
+		subs := c.subs
+		c.smu.Unlock()
+		for _, s := range subs {
+			if s.cmds == nil || s.cmds[msg.Command] {
+				s.fn(msg)
+			}
+		}
+	}
+}
+
+// Queue buffers subscribed messages for a consumer that reads them in
+// order with Next. Register the queue before sending the request whose
+// replies it should see.
+type Queue struct {
+	client *Client
+	stop   func()
+
+	mu     sync.Mutex
+	msgs   []*Message
+	notify chan struct{}
+}
+
+// Queue subscribes to the given commands (all if none) with an unbounded
+// buffer. Close it when done.
+func (c *Client) Queue(cmds ...string) *Queue {
+	q := &Queue{client: c, notify: make(chan struct{}, 1)}
+	q.stop = c.Subscribe(q.push, cmds...)
+	return q
+}
+
+func (q *Queue) push(msg *Message) {
+	q.mu.Lock()
+	q.msgs = append(q.msgs, msg)
+	q.mu.Unlock()
+	select {
+	case q.notify <- struct{}{}:
+	default:
+	}
+}
+
+// Next returns the next queued message, waiting if necessary. It fails
+// with ctx's error, or with the connection's error once the dispatch loop
+// has stopped and the queue is drained.
+func (q *Queue) Next(ctx context.Context) (*Message, error) {
+	for {
+		q.mu.Lock()
+		if len(q.msgs) > 0 {
+			msg := q.msgs[0]
+			q.msgs = q.msgs[1:]
+			q.mu.Unlock()
+			return msg, nil
+		}
+		q.mu.Unlock()
+
+		select {
+		case <-q.notify:
+		case <-q.client.Done():
+			// Pick up anything pushed just before the loop stopped.
+			q.mu.Lock()
+			empty := len(q.msgs) == 0
+			q.mu.Unlock()
+			if empty {
+				if err := q.client.Err(); err != nil {
+					return nil, err
+				}
+				return nil, errors.New("ride: connection closed")
+			}
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// Close unsubscribes the queue. Buffered messages are dropped.
+func (q *Queue) Close() {
+	q.stop()
+}
@@ -0,0 +1,110 @@
+package ride_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/cursork/gritt/ride"
+	"github.com/cursork/gritt/ride/ridetest"
+)
+
+func TestTypedDecode(t *testing.T) {
+	tests := []struct {
+		msg  *ride.Message
+		want any
+	}{
+		{
+			&ride.Message{Command: "OpenWindow", Args: map[string]any{
+				"token": 3.0, "name": "f", "text": []any{"f", "1"}, "debugger": 1.0, "readOnly": false,
+			}},
+			&ride.OpenWindow{Token: 3, Name: "f", Text: []string{"f", "1"}, Debugger: true},
+		},
+		{
+			&ride.Message{Command: "WindowTypeChanged", Args: map[string]any{"win": 3.0, "tracer": true}},
+			&ride.WindowTypeChanged{Win: 3, Tracer: true},
+		},
+		{
+			&ride.Message{Command: "SetPromptType", Args: map[string]any{"type": 3.0}},
+			&ride.SetPromptType{Type: 3},
+		},
+	}
+	for _, tt := range tests {
+		got, err := tt.msg.Typed()
+		if err != nil {
+			t.Fatalf("%s: %v", tt.msg.Command, err)
+		}
+		switch want := tt.want.(type) {
+		case *ride.OpenWindow:
+			ow, ok := got.(*ride.OpenWindow)
+			if !ok || ow.Token != want.Token || ow.Name != want.Name || len(ow.Text) != 2 || ow.Debugger != want.Debugger || bool(ow.ReadOnly) {
+				t.Errorf("OpenWindow = %+v", got)
+			}
+		case *ride.WindowTypeChanged:
+			if wtc, ok := got.(*ride.WindowTypeChanged); !ok || *wtc != *want {
+				t.Errorf("WindowTypeChanged = %+v", got)
+			}
+		case *ride.SetPromptType:
+			if p, ok := got.(*ride.SetPromptType); !ok || *p != *want || !p.Ready() {
+				t.Errorf("SetPromptType = %+v", got)
+			}
+		}
+	}
+
+	if v, err := (&ride.Message{Command: "Unknown"}).Typed(); v != nil || err != nil {
+		t.Errorf("unknown command = %v, %v", v, err)
+	}
+}
+
+func TestSubscribersShareConnection(t *testing.T) {
+	srv, err := ridetest.NewServer(ridetest.Eval(map[string]string{"⍳3": "1 2 3"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+
+	client, err := ride.Connect(srv.Addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	outputs := make(chan string, 10)
+	client.Subscribe(func(msg *ride.Message) {
+		var out ride.AppendSessionOutput
+		if msg.Decode(&out) == nil && out.Type == 1 {
+			outputs <- out.Result
+		}
+	}, "AppendSessionOutput")
+	client.Start()
+
+	if _, _, err := client.Recv(); err != ride.ErrStarted {
+		t.Errorf("Recv after Start = %v, want ErrStarted", err)
+	}
+
+	// Execute reads through its own queue while the subscriber also sees output.
+	got, err := client.Execute("⍳3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[0] != "1 2 3\n" {
+		t.Errorf("Execute = %q", got)
+	}
+	select {
+	case out := <-outputs:
+		if out != "1 2 3\n" {
+			t.Errorf("subscriber got %q", out)
+		}
+	case <-time.After(time.Second):
+		t.Error("subscriber saw no output")
+	}
+
+	// Closing the connection ends pending Next calls.
+	q := client.Queue("Nothing")
+	srv.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if _, err := q.Next(ctx); err == nil || err == ctx.Err() {
+		t.Errorf("Next after close = %v, want connection error", err)
+	}
+}
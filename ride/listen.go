@@ -0,0 +1,46 @@
+package ride
+
+import (
+	"fmt"
+	"net"
+)
+
+// Listener accepts interpreters started with RIDE_INIT=CONNECT:host:port,
+// which dial out to the front end instead of waiting to be dialled.
+type Listener struct {
+	ln net.Listener
+}
+
+// Listen listens on addr ("host:port"; port 0 picks a free one).
+func Listen(addr string) (*Listener, error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("listen: %w", err)
+	}
+	return &Listener{ln: ln}, nil
+}
+
+// Addr returns the address to put in RIDE_INIT, e.g. "127.0.0.1:41234".
+func (l *Listener) Addr() string {
+	return l.ln.Addr().String()
+}
+
+// Accept waits for an interpreter to connect and performs the handshake.
+// Close unblocks a pending Accept.
+func (l *Listener) Accept() (*Client, error) {
+	conn, err := l.ln.Accept()
+	if err != nil {
+		return nil, fmt.Errorf("accept: %w", err)
+	}
+	c := newClient(conn)
+	if err := c.acceptHandshake(); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("handshake: %w", err)
+	}
+	return c, nil
+}
+
+// Close stops listening. Clients already accepted stay connected.
+func (l *Listener) Close() error {
+	return l.ln.Close()
+}
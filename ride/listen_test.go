@@ -0,0 +1,36 @@
+package ride_test
+
+import (
+	"testing"
+
+	"github.com/cursork/gritt/ride"
+	"github.com/cursork/gritt/ride/ridetest"
+)
+
+func TestListenAccept(t *testing.T) {
+	ln, err := ride.Listen("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	interp, err := ridetest.Dial(ln.Addr(), ridetest.Eval(map[string]string{"1+1": "2"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer interp.Close()
+
+	client, err := ln.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	out, err := client.Execute("1+1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(out) != 1 || out[0] != "2\n" {
+		t.Errorf("Execute = %q", out)
+	}
+}
@@ -0,0 +1,296 @@
+package ride
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Typed RIDE messages. Field names follow the protocol's JSON keys; only
+// the fields gritt reads or writes are listed. Receive with Message.Decode
+// or Message.Typed, send by passing a value to Client.Send.
+
+// --- Session ---
+
+// Execute runs a line of APL. Text must end in "\n".
+type Execute struct {
+	Text  string `json:"text"`
+	Trace int    `json:"trace"` // 1 to start in the tracer
+}
+
+// AppendSessionOutput carries interpreter output.
+//
+// Types seen in practice: 1 normal output, 5 error, 11 multiline body
+// echo, 14 input echo.
+type AppendSessionOutput struct {
+	Result string `json:"result"`
+	Type   int    `json:"type"`
+	Group  int    `json:"group,omitempty"`
+}
+
+// SetPromptType reports the interpreter's input state.
+//
+// Types: 0 busy, 1 normal, 2 ⎕ input, 3 line editor, 4 ⍞ input.
+type SetPromptType struct {
+	Type int `json:"type"`
+}
+
+// Ready reports whether the interpreter is waiting for input.
+func (p SetPromptType) Ready() bool {
+	return p.Type > 0
+}
+
+// HadError is sent after an error, before the prompt returns.
+type HadError struct {
+	Error int `json:"error"`
+	DMX   int `json:"dmx"`
+}
+
+// WeakInterrupt, StrongInterrupt, GetWindowLayout and CloseAllWindows
+// take no arguments.
+type (
+	WeakInterrupt   struct{}
+	StrongInterrupt struct{}
+	GetWindowLayout struct{}
+	CloseAllWindows struct{}
+)
+
+// --- Editor and tracer windows ---
+
+// Edit asks the interpreter to open an editor on the name at Pos in Text.
+type Edit struct {
+	Win  int    `json:"win"`
+	Text string `json:"text"`
+	Pos  int    `json:"pos"`
+}
+
+// OpenWindow opens an editor or tracer window.
+type OpenWindow struct {
+	Token      int      `json:"token"`
+	Name       string   `json:"name"`
+	Filename   string   `json:"filename,omitempty"`
+	Text       []string `json:"text"`
+	EntityType int      `json:"entityType"`
+	CurrentRow int      `json:"currentRow"`
+	Debugger   Flag     `json:"debugger"`
+	ReadOnly   Flag     `json:"readOnly"`
+	Stop       []int    `json:"stop"`
+	Monitor    []int    `json:"monitor"`
+	Trace      []int    `json:"trace"`
+	Tid        int      `json:"tid"`
+	Tname      string   `json:"tname"`
+}
+
+// UpdateWindow replaces the contents of an open window. It carries the
+// same fields as OpenWindow.
+type UpdateWindow OpenWindow
+
+// CloseWindow closes a window, in either direction.
+type CloseWindow struct {
+	Win int `json:"win"`
+}
+
+// WindowTypeChanged switches a window between editor and tracer.
+type WindowTypeChanged struct {
+	Win    int  `json:"win"`
+	Tracer Flag `json:"tracer"`
+}
+
+// SetHighlightLine moves the tracer's current line (0-based).
+type SetHighlightLine struct {
+	Win  int `json:"win"`
+	Line int `json:"line"`
+}
+
+// SaveChanges fixes an editor's text along with its line attributes.
+type SaveChanges struct {
+	Win     int      `json:"win"`
+	Text    []string `json:"text"`
+	Stop    Lines    `json:"stop"`
+	Monitor Lines    `json:"monitor"`
+	Trace   Lines    `json:"trace"`
+}
+
+// ReplySaveChanges reports the result of SaveChanges. Err is 0 on success.
+type ReplySaveChanges struct {
+	Win int `json:"win"`
+	Err int `json:"err"`
+}
+
+// SetLineAttributes sets stop, monitor and trace points on a window
+// without saving its text.
+type SetLineAttributes struct {
+	Win     int   `json:"win"`
+	Stop    Lines `json:"stop"`
+	Monitor Lines `json:"monitor"`
+	Trace   Lines `json:"trace"`
+}
+
+// FormatCode asks the interpreter to reformat Text in the context of Win.
+type FormatCode struct {
+	Win  int      `json:"win"`
+	Text []string `json:"text"`
+}
+
+// ReplyFormatCode carries the formatted text.
+type ReplyFormatCode struct {
+	Win  int      `json:"win"`
+	Text []string `json:"text"`
+}
+
+// ShowAsArrayNotation switches an editor to APLAN.
+type ShowAsArrayNotation struct {
+	Win int `json:"win"`
+}
+
+// TraceCommand is the argument of the tracer's window-scoped commands:
+// RunCurrentLine, StepInto, TraceForward, TraceBackward, ContinueTrace,
+// Continue, Cutback and RestartThreads.
+type TraceCommand struct {
+	Win int `json:"win"`
+}
+
+// --- Threads ---
+
+// GetThreads asks for the interpreter's threads; it takes no arguments.
+type GetThreads struct{}
+
+// ReplyGetThreads lists the threads that exist.
+type ReplyGetThreads struct {
+	Threads []ThreadInfo `json:"threads"`
+}
+
+// ThreadInfo describes one thread. State is e.g. "Session", "Pending" or
+// "Suspended"; Description is the interpreter's text for the thread.
+type ThreadInfo struct {
+	Tid         int    `json:"tid"`
+	Description string `json:"description"`
+	State       string `json:"state"`
+	Flags       string `json:"flags"`
+	Treq        string `json:"Treq"`
+}
+
+// SetThread makes Tid the current thread: the one the session executes
+// in and the tracer commands apply to.
+type SetThread struct {
+	Tid int `json:"tid"`
+}
+
+// --- Dialogs and autocomplete ---
+
+// OptionsDialog asks the user to pick one of Options.
+type OptionsDialog struct {
+	Title   string   `json:"title"`
+	Text    string   `json:"text"`
+	Type    int      `json:"type"`
+	Options []string `json:"options"`
+	Token   int      `json:"token"`
+}
+
+// ReplyOptionsDialog answers an OptionsDialog with a 0-based Index
+// (-1 to cancel).
+type ReplyOptionsDialog struct {
+	Index int `json:"index"`
+	Token int `json:"token"`
+}
+
+// GetAutocomplete asks for completions of Line at rune offset Pos.
+type GetAutocomplete struct {
+	Line  string `json:"line"`
+	Pos   int    `json:"pos"`
+	Token int    `json:"token"`
+}
+
+// ReplyGetAutocomplete answers GetAutocomplete. Skip is the number of
+// characters before Pos that the chosen option replaces.
+type ReplyGetAutocomplete struct {
+	Skip    int      `json:"skip"`
+	Options []string `json:"options"`
+	Token   int      `json:"token"`
+}
+
+// Flag is a protocol boolean. Depending on the interpreter version and
+// message, these arrive as 0/1 or as JSON booleans.
+type Flag bool
+
+// UnmarshalJSON accepts true/false and numbers.
+func (f *Flag) UnmarshalJSON(data []byte) error {
+	var b bool
+	if err := json.Unmarshal(data, &b); err == nil {
+		*f = Flag(b)
+		return nil
+	}
+	var n float64
+	if err := json.Unmarshal(data, &n); err != nil {
+		return fmt.Errorf("flag: %s", data)
+	}
+	*f = n != 0
+	return nil
+}
+
+// MarshalJSON writes 0 or 1, which every interpreter version accepts.
+func (f Flag) MarshalJSON() ([]byte, error) {
+	if f {
+		return []byte("1"), nil
+	}
+	return []byte("0"), nil
+}
+
+// Lines is a list of 0-based line numbers. A nil Lines is sent as an
+// empty array rather than null, which the interpreter rejects.
+type Lines []int
+
+// MarshalJSON implements json.Marshaler.
+func (l Lines) MarshalJSON() ([]byte, error) {
+	if l == nil {
+		return []byte("[]"), nil
+	}
+	return json.Marshal([]int(l))
+}
+
+// typed maps received commands to their argument types.
+var typed = map[string]func() any{
+	"AppendSessionOutput":  func() any { return new(AppendSessionOutput) },
+	"SetPromptType":        func() any { return new(SetPromptType) },
+	"HadError":             func() any { return new(HadError) },
+	"OpenWindow":           func() any { return new(OpenWindow) },
+	"UpdateWindow":         func() any { return new(UpdateWindow) },
+	"CloseWindow":          func() any { return new(CloseWindow) },
+	"WindowTypeChanged":    func() any { return new(WindowTypeChanged) },
+	"SetHighlightLine":     func() any { return new(SetHighlightLine) },
+	"ReplySaveChanges":     func() any { return new(ReplySaveChanges) },
+	"ReplyFormatCode":      func() any { return new(ReplyFormatCode) },
+	"ReplyGetThreads":      func() any { return new(ReplyGetThreads) },
+	"OptionsDialog":        func() any { return new(OptionsDialog) },
+	"ReplyGetAutocomplete": func() any { return new(ReplyGetAutocomplete) },
+}
+
+// Decode unmarshals the message's arguments into v.
+func (m *Message) Decode(v any) error {
+	data := m.raw
+	if data == nil {
+		// Built in code rather than parsed off the wire.
+		var err error
+		if data, err = json.Marshal(m.Args); err != nil {
+			return fmt.Errorf("%s: %w", m.Command, err)
+		}
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("%s: %w", m.Command, err)
+	}
+	return nil
+}
+
+// Typed decodes the message into a pointer to its typed struct, e.g.
+// *OpenWindow for an OpenWindow message, for use in a type switch.
+// Commands without a struct return (nil, nil).
+func (m *Message) Typed() (any, error) {
+	newArgs, ok := typed[m.Command]
+	if !ok {
+		return nil, nil
+	}
+	v := newArgs()
+	if err := m.Decode(v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
@@ -31,6 +31,7 @@ func sendRaw(w io.Writer, payload string) error {
 		return fmt.Errorf("write payload: %w", err)
 	}
 	logRaw("→", payload)
+	Recorder.record(true, payload)
 	return nil
 }
 
@@ -56,6 +57,7 @@ func recvRaw(r io.Reader) (string, error) {
 		s = s[4:]
 	}
 	logRecv(s)
+	Recorder.record(false, s)
 	return s, nil
 }
 
@@ -63,10 +65,13 @@ func recvRaw(r io.Reader) (string, error) {
 type Message struct {
 	Command string
 	Args    map[string]any
+
+	raw json.RawMessage // args as received, for Decode
 }
 
-// Send writes a JSON command message.
-func Send(w io.Writer, cmd string, args map[string]any) error {
+// Send writes a JSON command message. Args is a map or one of the typed
+// message structs.
+func Send(w io.Writer, cmd string, args any) error {
 	data, err := json.Marshal([]any{cmd, args})
 	if err != nil {
 		return fmt.Errorf("marshal: %w", err)
@@ -80,30 +85,37 @@ func Recv(r io.Reader) (*Message, string, error) {
 	if err != nil {
 		return nil, "", err
 	}
+	if msg := parseMessage(payload); msg != nil {
+		return msg, "", nil
+	}
+	return nil, payload, nil
+}
 
+// parseMessage parses a JSON ["Command", {args}] payload.
+// Returns nil for handshake messages and anything unparseable.
+func parseMessage(payload string) *Message {
 	// Handshake messages aren't JSON
 	if !strings.HasPrefix(payload, "[") {
-		return nil, payload, nil
+		return nil
 	}
 
-	// Parse JSON: ["Command", {args}]
 	var arr []json.RawMessage
 	if err := json.Unmarshal([]byte(payload), &arr); err != nil {
-		return nil, payload, nil // Return as raw if parse fails
+		return nil
 	}
 	if len(arr) < 2 {
-		return nil, payload, nil
+		return nil
 	}
 
 	var cmd string
 	if err := json.Unmarshal(arr[0], &cmd); err != nil {
-		return nil, payload, nil
+		return nil
 	}
 
 	var args map[string]any
 	if err := json.Unmarshal(arr[1], &args); err != nil {
-		return nil, payload, nil
+		return nil
 	}
 
-	return &Message{Command: cmd, Args: args}, "", nil
+	return &Message{Command: cmd, Args: args, raw: arr[1]}
 }
@@ -0,0 +1,361 @@
+// Package ridetest provides a fake Dyalog interpreter for tests.
+//
+// Server listens on a loopback port, performs the SERVE-mode RIDE
+// handshake (SupportedProtocols=2, UsingProtocol=2, Identify, Connect) and
+// answers each client message through a Responder. Responders can be
+// scripted (Eval) or built from a recorded transcript (Replay), so code
+// using ride, session or mcp can be tested without an interpreter:
+//
+//	srv, _ := ridetest.NewServer(ridetest.Eval(map[string]string{"1+1": "2"}))
+//	defer srv.Close()
+//	sess, _ := session.Connect(ctx, session.ConnectOptions{Addr: srv.Addr()})
+//
+// Dial does the same for the reverse direction, connecting to a
+// ride.Listener as an interpreter started with RIDE_INIT=CONNECT would.
+//
+// The server does its own framing rather than going through ride.Send and
+// ride.Recv, so ride.Logger and ride.Recorder only ever see the client side.
+package ridetest
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+
+	"github.com/cursork/gritt/ride"
+)
+
+// Responder answers one client message with the interpreter's messages.
+type Responder func(msg *ride.Message) []*ride.Message
+
+// Server is a fake RIDE interpreter.
+type Server struct {
+	ln      net.Listener
+	respond Responder
+
+	mu       sync.Mutex
+	conns    []net.Conn
+	received []*ride.Message
+	wg       sync.WaitGroup
+
+	wmu sync.Mutex // keeps Push from interleaving with replies
+}
+
+// NewServer starts a fake interpreter on 127.0.0.1 with a random port.
+// Each accepted connection gets its own handshake and reply loop.
+func NewServer(respond Responder) (*Server, error) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	s := &Server{ln: ln, respond: respond}
+	s.wg.Add(1)
+	go s.acceptLoop()
+	return s, nil
+}
+
+// Dial plays an interpreter started with RIDE_INIT=CONNECT: it connects
+// to a ride.Listener at addr and serves that one connection.
+func Dial(addr string, respond Responder) (*Server, error) {
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	s := &Server{respond: respond, conns: []net.Conn{conn}}
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		defer conn.Close()
+		s.serveConn(conn)
+	}()
+	return s, nil
+}
+
+// Addr returns the host:port to pass to ride.Connect. Empty for a Server
+// created by Dial.
+func (s *Server) Addr() string {
+	if s.ln == nil {
+		return ""
+	}
+	return s.ln.Addr().String()
+}
+
+// Received returns every JSON message clients have sent after the handshake.
+func (s *Server) Received() []*ride.Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*ride.Message(nil), s.received...)
+}
+
+// Push sends an unsolicited message to every connected client,
+// e.g. an OpenWindow to simulate the tracer popping up.
+func (s *Server) Push(msg *ride.Message) error {
+	s.mu.Lock()
+	conns := append([]net.Conn(nil), s.conns...)
+	s.mu.Unlock()
+	for _, c := range conns {
+		if err := s.send(c, msg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close stops the listener and drops all connections.
+func (s *Server) Close() error {
+	var err error
+	if s.ln != nil {
+		err = s.ln.Close()
+	}
+	s.mu.Lock()
+	for _, c := range s.conns {
+		c.Close()
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+	return err
+}
+
+func (s *Server) acceptLoop() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		s.conns = append(s.conns, conn)
+		s.mu.Unlock()
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			defer conn.Close()
+			s.serveConn(conn)
+		}()
+	}
+}
+
+func (s *Server) serveConn(conn net.Conn) {
+	r := bufio.NewReader(conn)
+
+	// Handshake, interpreter side. We speak first, which suits both
+	// SERVE mode and a CONNECT-mode client that doesn't wait.
+	if writeFrame(conn, "SupportedProtocols=2") != nil {
+		return
+	}
+	for _, want := range []string{"SupportedProtocols=2", "UsingProtocol=2"} {
+		if got, err := readFrame(r); err != nil || got != want {
+			return
+		}
+	}
+	if writeFrame(conn, "UsingProtocol=2") != nil {
+		return
+	}
+	for _, want := range []string{"Identify", "Connect"} {
+		payload, err := readFrame(r)
+		if err != nil {
+			return
+		}
+		if msg := decode(payload); msg == nil || msg.Command != want {
+			return
+		}
+	}
+	if s.send(conn, Prompt(1)) != nil {
+		return
+	}
+
+	for {
+		payload, err := readFrame(r)
+		if err != nil {
+			return
+		}
+		msg := decode(payload)
+		if msg == nil {
+			continue
+		}
+		s.mu.Lock()
+		s.received = append(s.received, msg)
+		s.mu.Unlock()
+
+		for _, reply := range s.respond(msg) {
+			if s.send(conn, reply) != nil {
+				return
+			}
+		}
+	}
+}
+
+func (s *Server) send(conn net.Conn, msg *ride.Message) error {
+	s.wmu.Lock()
+	defer s.wmu.Unlock()
+	return writeMessage(conn, msg)
+}
+
+// --- Responders ---
+
+// Eval answers Execute requests from a table of expression → output, the
+// way the interpreter does: echo (type 14), busy prompt, output, ready
+// prompt. Outputs starting with "ERROR:" are sent as error output (type 5)
+// without the prefix. Unknown expressions produce a VALUE ERROR.
+// GetAutocomplete gets an empty reply; everything else is ignored.
+func Eval(outputs map[string]string) Responder {
+	return func(msg *ride.Message) []*ride.Message {
+		switch msg.Command {
+		case "Execute":
+			text, _ := msg.Args["text"].(string)
+			code := strings.TrimSpace(text)
+			out, ok := outputs[code]
+			if !ok {
+				out = "ERROR:VALUE ERROR"
+			}
+			return ExecuteReply(code, out)
+		case "GetAutocomplete":
+			return []*ride.Message{{Command: "ReplyGetAutocomplete", Args: map[string]any{
+				"token": msg.Args["token"], "skip": 0, "options": []any{},
+			}}}
+		}
+		return nil
+	}
+}
+
+// LineEditor wraps respond to answer like an interpreter in
+// DYALOG_LINEEDITOR_MODE: a ∇ header or a numbered "[n]" line is echoed as
+// multiline input (type 11) and gets the line-editor prompt (type 3), until
+// the line closing the definition with ∇. Other messages go to respond.
+func LineEditor(respond Responder) Responder {
+	return func(msg *ride.Message) []*ride.Message {
+		text, _ := msg.Args["text"].(string)
+		if msg.Command != "Execute" {
+			return respond(msg)
+		}
+		code := strings.TrimSpace(text)
+		switch {
+		case strings.HasPrefix(text, "[") && strings.HasSuffix(code, "∇"):
+			return []*ride.Message{Output(11, text), Prompt(1)}
+		case strings.HasPrefix(code, "∇"), strings.HasPrefix(text, "["):
+			return []*ride.Message{Output(11, text), Prompt(3)}
+		}
+		return respond(msg)
+	}
+}
+
+// ExecuteReply builds the message sequence for one executed line.
+func ExecuteReply(code, out string) []*ride.Message {
+	replies := []*ride.Message{
+		Output(14, "      "+code+"\n"),
+		Prompt(0),
+	}
+	if errText, isErr := strings.CutPrefix(out, "ERROR:"); isErr {
+		replies = append(replies, Output(5, errText+"\n"))
+	} else if out != "" {
+		replies = append(replies, Output(1, out+"\n"))
+	}
+	return append(replies, Prompt(1))
+}
+
+// Replay answers from a recorded transcript. Each client message in the
+// transcript is paired with the interpreter messages that followed it.
+// An incoming message is matched against the first unused recorded one
+// with the same command (and, for Execute, the same text); its recorded
+// replies are sent back. Unmatched Execute requests get a bare ready
+// prompt so callers don't hang. The handshake portion is skipped.
+func Replay(entries []ride.Entry) Responder {
+	type exchange struct {
+		sent    *ride.Message
+		replies []*ride.Message
+		used    bool
+	}
+	var exchanges []*exchange
+	var cur *exchange
+	for _, e := range entries {
+		msg := e.Message()
+		if msg == nil {
+			continue // handshake
+		}
+		if e.Send {
+			if msg.Command == "Identify" || msg.Command == "Connect" {
+				cur = nil
+				continue
+			}
+			cur = &exchange{sent: msg}
+			exchanges = append(exchanges, cur)
+		} else if cur != nil {
+			cur.replies = append(cur.replies, msg)
+		}
+	}
+
+	var mu sync.Mutex
+	return func(msg *ride.Message) []*ride.Message {
+		mu.Lock()
+		defer mu.Unlock()
+		for _, ex := range exchanges {
+			if ex.used || ex.sent.Command != msg.Command {
+				continue
+			}
+			if msg.Command == "Execute" && ex.sent.Args["text"] != msg.Args["text"] {
+				continue
+			}
+			ex.used = true
+			return ex.replies
+		}
+		if msg.Command == "Execute" {
+			return []*ride.Message{Prompt(0), Prompt(1)}
+		}
+		return nil
+	}
+}
+
+// --- Message constructors ---
+
+// Output builds an AppendSessionOutput message.
+func Output(typ int, result string) *ride.Message {
+	return &ride.Message{Command: "AppendSessionOutput", Args: map[string]any{"result": result, "type": typ}}
+}
+
+// Prompt builds a SetPromptType message.
+func Prompt(typ int) *ride.Message {
+	return &ride.Message{Command: "SetPromptType", Args: map[string]any{"type": typ}}
+}
+
+// --- Framing ---
+
+func writeFrame(w io.Writer, payload string) error {
+	data := []byte("RIDE" + payload)
+	if err := binary.Write(w, binary.BigEndian, uint32(len(data)+4)); err != nil {
+		return err
+	}
+	_, err := w.Write(data)
+	return err
+}
+
+func readFrame(r io.Reader) (string, error) {
+	var length uint32
+	if err := binary.Read(r, binary.BigEndian, &length); err != nil {
+		return "", err
+	}
+	if length < 8 || length > 10*1024*1024 {
+		return "", fmt.Errorf("invalid length: %d", length)
+	}
+	buf := make([]byte, length-4)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return "", err
+	}
+	return strings.TrimPrefix(string(buf), "RIDE"), nil
+}
+
+func writeMessage(w io.Writer, msg *ride.Message) error {
+	data, err := json.Marshal([]any{msg.Command, msg.Args})
+	if err != nil {
+		return err
+	}
+	return writeFrame(w, string(data))
+}
+
+func decode(payload string) *ride.Message {
+	return ride.Entry{Payload: payload}.Message()
+}
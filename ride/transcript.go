@@ -0,0 +1,121 @@
+package ride
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Recorder is an optional transcript of every protocol message, in both
+// directions and including the handshake. Like Logger, set it before
+// creating a Client. Unlike Logger's text, a transcript can be read back
+// with ReadTranscript and replayed by ridetest.Replay.
+var Recorder *Transcript
+
+// Transcript writes RIDE messages as newline-delimited JSON Entries.
+type Transcript struct {
+	mu    sync.Mutex
+	enc   *json.Encoder
+	start time.Time
+}
+
+// NewTranscript returns a Transcript writing to w.
+func NewTranscript(w io.Writer) *Transcript {
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	return &Transcript{enc: enc, start: time.Now()}
+}
+
+// Entry is one recorded message.
+type Entry struct {
+	Elapsed time.Duration // since the transcript was created
+	Send    bool          // true for client → interpreter
+	Payload string        // "SupportedProtocols=2" or a JSON ["Command",{...}] array
+}
+
+// entryJSON is the on-disk form. JSON payloads are embedded as-is so
+// transcripts stay readable; handshake strings are stored as strings.
+type entryJSON struct {
+	MS  int64           `json:"ms"`
+	Dir string          `json:"dir"` // "send" or "recv"
+	Msg json.RawMessage `json:"msg"`
+}
+
+// MarshalJSON implements json.Marshaler.
+func (e Entry) MarshalJSON() ([]byte, error) {
+	dir := "recv"
+	if e.Send {
+		dir = "send"
+	}
+	msg := json.RawMessage(e.Payload)
+	if !strings.HasPrefix(e.Payload, "[") || !json.Valid(msg) {
+		quoted, err := json.Marshal(e.Payload)
+		if err != nil {
+			return nil, err
+		}
+		msg = quoted
+	}
+	return json.Marshal(entryJSON{MS: e.Elapsed.Milliseconds(), Dir: dir, Msg: msg})
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (e *Entry) UnmarshalJSON(data []byte) error {
+	var j entryJSON
+	if err := json.Unmarshal(data, &j); err != nil {
+		return err
+	}
+	switch j.Dir {
+	case "send":
+		e.Send = true
+	case "recv":
+		e.Send = false
+	default:
+		return fmt.Errorf("bad dir %q", j.Dir)
+	}
+	e.Elapsed = time.Duration(j.MS) * time.Millisecond
+	var s string
+	if err := json.Unmarshal(j.Msg, &s); err == nil {
+		e.Payload = s
+	} else {
+		e.Payload = string(j.Msg)
+	}
+	return nil
+}
+
+// Message parses the entry's payload. Returns nil for handshake strings.
+func (e Entry) Message() *Message {
+	return parseMessage(e.Payload)
+}
+
+// record appends one message. Errors are ignored: recording must never
+// break the connection it is observing.
+func (t *Transcript) record(send bool, payload string) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.enc.Encode(Entry{Elapsed: time.Since(t.start), Send: send, Payload: payload})
+}
+
+// ReadTranscript parses a transcript written by Transcript.
+func ReadTranscript(r io.Reader) ([]Entry, error) {
+	var entries []Entry
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 10*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+		var e Entry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		entries = append(entries, e)
+	}
+	return entries, scanner.Err()
+}
@@ -0,0 +1,110 @@
+package ride_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/cursork/gritt/ride"
+	"github.com/cursork/gritt/ride/ridetest"
+)
+
+func TestRecordAndReplay(t *testing.T) {
+	srv, err := ridetest.NewServer(ridetest.Eval(map[string]string{"1+1": "2"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+
+	var buf bytes.Buffer
+	ride.Recorder = ride.NewTranscript(&buf)
+	defer func() { ride.Recorder = nil }()
+
+	c, err := ride.Connect(srv.Addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := c.Execute("1+1")
+	c.Close()
+	ride.Recorder = nil
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(out, "") != "2\n" {
+		t.Fatalf("Execute = %q", out)
+	}
+
+	entries, err := ride.ReadTranscript(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) < 6 {
+		t.Fatalf("only %d entries recorded", len(entries))
+	}
+	if entries[0].Send || entries[0].Payload != "SupportedProtocols=2" {
+		t.Errorf("first entry = %+v, want recv SupportedProtocols=2", entries[0])
+	}
+	var sawExecute bool
+	for _, e := range entries {
+		if m := e.Message(); m != nil && e.Send && m.Command == "Execute" {
+			sawExecute = true
+		}
+	}
+	if !sawExecute {
+		t.Error("Execute not recorded")
+	}
+
+	// Replay the transcript through a fresh fake interpreter.
+	replay, err := ridetest.NewServer(ridetest.Replay(entries))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer replay.Close()
+	c2, err := ride.Connect(replay.Addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c2.Close()
+	out, err = c2.Execute("1+1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(out, "") != "2\n" {
+		t.Errorf("replayed Execute = %q", out)
+	}
+	// Not in the transcript: answered with a bare prompt.
+	out, err = c2.Execute("⍳3")
+	if err != nil || len(out) != 0 {
+		t.Errorf("unmatched Execute = %q, %v", out, err)
+	}
+}
+
+func TestEntryJSON(t *testing.T) {
+	var buf bytes.Buffer
+	entries := []ride.Entry{
+		{Send: true, Payload: "UsingProtocol=2"},
+		{Payload: `["SetPromptType",{"type":1}]`},
+	}
+	for _, e := range entries {
+		data, err := e.MarshalJSON()
+		if err != nil {
+			t.Fatal(err)
+		}
+		buf.Write(append(data, '\n'))
+	}
+	if !strings.Contains(buf.String(), `"msg":["SetPromptType",{"type":1}]`) {
+		t.Errorf("JSON payload should be embedded, got %s", buf.String())
+	}
+	got, err := ride.ReadTranscript(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range entries {
+		if got[i].Send != entries[i].Send || got[i].Payload != entries[i].Payload {
+			t.Errorf("entry %d = %+v, want %+v", i, got[i], entries[i])
+		}
+	}
+	if m := got[1].Message(); m == nil || m.Command != "SetPromptType" {
+		t.Errorf("Message() = %+v", m)
+	}
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/cursork/gritt/multiline"
+	"github.com/cursork/gritt/ride"
+)
+
+// errInterpreterGone means the interpreter closed the connection, which
+// for a script is how ⎕OFF shows up.
+var errInterpreterGone = errors.New("interpreter closed the connection")
+
+// scriptRunner executes an APL script for gritt -run, one block at a time
+// (see multiline.Frame), sending each line when the interpreter prompts
+// for it. Session output goes to stdout, error messages to stderr, and ⎕
+// and ⍞ input is read from stdin. The first APL error stops the script.
+type scriptRunner struct {
+	client *ride.Client
+	path   string
+	stdin  *bufio.Reader
+	stdout io.Writer
+	stderr io.Writer
+
+	prompt int  // Last SetPromptType type
+	failed bool // An error since the last line was sent
+}
+
+// runScript runs the script at path with args exposed to APL as
+// ⎕SE.Gritt.Args (and the path as ⎕SE.Gritt.Script). It returns the exit
+// status, and gone if the interpreter went away — ⎕OFF — in which case the
+// status is the caller's to find out.
+func runScript(client *ride.Client, path string, args []string, stdin io.Reader, stdout, stderr io.Writer) (status int, gone bool) {
+	src, err := os.ReadFile(path)
+	if err != nil {
+		fmt.Fprintf(stderr, "gritt: %v\n", err)
+		return 1, false
+	}
+	lines := strings.Split(strings.ReplaceAll(string(src), "\r\n", "\n"), "\n")
+	if strings.HasPrefix(lines[0], "#!") {
+		lines[0] = "" // keep line numbers
+	}
+	blocks, err := multiline.Frame(lines)
+	if err != nil {
+		fmt.Fprintf(stderr, "gritt: %s: %v\n", path, err)
+		return 1, false
+	}
+
+	r := &scriptRunner{client: client, path: path, stdin: bufio.NewReader(stdin), stdout: stdout, stderr: stderr}
+	setup := multiline.Block{Kind: multiline.Single, Lines: []string{scriptArgsExpr(path, args)}}
+	for _, b := range append([]multiline.Block{setup}, blocks...) {
+		if err := r.run(b); err != nil {
+			if errors.Is(err, errInterpreterGone) {
+				return 0, true
+			}
+			fmt.Fprintf(stderr, "gritt: %s:%d: %v\n", path, b.Start, err)
+			return 1, false
+		}
+	}
+	return 0, false
+}
+
+// run sends a block's lines one per prompt.
+func (r *scriptRunner) run(b multiline.Block) error {
+	r.failed = false
+	for i, text := range b.Texts() {
+		if err := r.client.Send("Execute", ride.Execute{Text: text}); err != nil {
+			return errInterpreterGone
+		}
+		win, err := r.wait()
+		if err != nil {
+			return err
+		}
+		if win != 0 {
+			// No line editor (DYALOG_LINEEDITOR_MODE): ∇ opened an
+			// editor instead, so fix the definition through that.
+			if b.Kind == multiline.Nabla && i == 0 {
+				return r.saveEditor(win, b)
+			}
+			r.client.Send("CloseWindow", ride.CloseWindow{Win: win})
+		}
+		if r.failed {
+			return fmt.Errorf("stopped after an APL error")
+		}
+	}
+	if r.prompt == 3 {
+		return fmt.Errorf("the interpreter is still waiting for the rest of the definition")
+	}
+	return nil
+}
+
+// wait reads messages until the interpreter is ready for the next line,
+// answering ⎕ and ⍞ prompts from stdin. It returns the token of an editor
+// window that opened meanwhile, if any.
+func (r *scriptRunner) wait() (win int, err error) {
+	for {
+		msg, _, err := r.client.Recv()
+		if err != nil {
+			return 0, errInterpreterGone
+		}
+		if msg == nil {
+			continue
+		}
+		ev, err := msg.Typed()
+		if err != nil {
+			continue
+		}
+		switch ev := ev.(type) {
+		case *ride.AppendSessionOutput:
+			r.output(ev)
+		case *ride.HadError:
+			r.failed = true
+		case *ride.OpenWindow:
+			win = ev.Token
+		case *ride.SetPromptType:
+			r.prompt = ev.Type
+			switch ev.Type {
+			case 1, 3: // Normal and line editor: next line
+				return win, nil
+			case 2, 4: // ⎕ and ⍞ input
+				line, err := r.stdin.ReadString('\n')
+				if err != nil && line == "" {
+					r.client.Send("StrongInterrupt", ride.StrongInterrupt{})
+					return win, fmt.Errorf("the script wants input but stdin is closed")
+				}
+				if err := r.client.Send("Execute", ride.Execute{Text: strings.TrimSuffix(line, "\n") + "\n"}); err != nil {
+					return win, errInterpreterGone
+				}
+			}
+		}
+	}
+}
+
+func (r *scriptRunner) output(ev *ride.AppendSessionOutput) {
+	switch ev.Type {
+	case 11, 14: // Echo of our own input
+	case 5:
+		r.failed = true
+		fmt.Fprint(r.stderr, ev.Result)
+	default:
+		fmt.Fprint(r.stdout, ev.Result)
+	}
+}
+
+// saveEditor fixes a ∇ definition through the editor window the
+// interpreter opened for its header line, then closes the window.
+func (r *scriptRunner) saveEditor(win int, b multiline.Block) error {
+	text := []string{strings.TrimSpace(strings.TrimPrefix(b.Lines[0], "∇"))}
+	for _, line := range b.Lines[1 : len(b.Lines)-1] {
+		text = append(text, line)
+	}
+	if last := strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(b.Lines[len(b.Lines)-1]), "∇")); last != "" {
+		text = append(text, last)
+	}
+	if err := r.client.Send("SaveChanges", ride.SaveChanges{Win: win, Text: text}); err != nil {
+		return errInterpreterGone
+	}
+	defer r.client.Send("CloseWindow", ride.CloseWindow{Win: win})
+	for {
+		msg, _, err := r.client.Recv()
+		if err != nil {
+			return errInterpreterGone
+		}
+		if msg == nil {
+			continue
+		}
+		ev, err := msg.Typed()
+		if err != nil {
+			continue
+		}
+		switch ev := ev.(type) {
+		case *ride.AppendSessionOutput:
+			r.output(ev)
+		case *ride.ReplySaveChanges:
+			if ev.Win != win {
+				continue
+			}
+			if ev.Err != 0 {
+				return fmt.Errorf("the interpreter rejected the ∇ definition")
+			}
+			return nil
+		}
+	}
+}
+
+// scriptArgsExpr sets ⎕SE.Gritt.Script to path and ⎕SE.Gritt.Args to the
+// script's arguments, a vector of character vectors.
+func scriptArgsExpr(path string, args []string) string {
+	vec := "(0⍴⊂'')"
+	if len(args) > 0 {
+		items := make([]string, len(args))
+		for i, a := range args {
+			items[i] = "(⊂" + aplString(a) + ")"
+		}
+		vec = "(," + strings.Join(items, ",") + ")"
+	}
+	return fmt.Sprintf("⎕SE.Gritt←⎕NS⍬ ⋄ ⎕SE.Gritt.(Script Args)←%s %s", aplString(path), vec)
+}
+
+// aplString renders s as a single-line APL character vector expression.
+// Newlines, which can't be sent in one Execute, are spliced in with ⎕UCS.
+func aplString(s string) string {
+	parts := strings.Split(s, "\n")
+	for i, p := range parts {
+		parts[i] = "'" + strings.ReplaceAll(p, "'", "''") + "'"
+	}
+	return "(," + strings.Join(parts, ",(⎕UCS 10),") + ")"
+}
+
+// splitRunArgs separates the arguments of a -run script from gritt's own,
+// so that `gritt -l -run script.apl -v x` gives "-v" and "x" to the
+// script rather than parsing -v as a gritt flag. A shebang line passes its
+// options as a single argument ("#!/usr/local/bin/gritt -l -run"), so a
+// leading argument holding several flags is split up first.
+func splitRunArgs(args []string) (gritt, script []string) {
+	if len(args) > 0 && strings.HasPrefix(args[0], "-") && strings.Contains(args[0], " ") {
+		args = append(strings.Fields(args[0]), args[1:]...)
+	}
+	for i, a := range args {
+		switch {
+		case a == "-run" || a == "--run":
+			if i+1 < len(args) {
+				return args[:i+2], args[i+2:]
+			}
+		case strings.HasPrefix(a, "-run=") || strings.HasPrefix(a, "--run="):
+			return args[:i+1], args[i+1:]
+		}
+	}
+	return args, nil
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/cursork/gritt/ride"
+	"github.com/cursork/gritt/ride/ridetest"
+)
+
+// lineEditor answers like an interpreter in DYALOG_LINEEDITOR_MODE (see
+// ridetest.LineEditor), and quietly accepts the script's setup line.
+func lineEditor(outputs map[string]string) ridetest.Responder {
+	eval := ridetest.Eval(outputs)
+	return ridetest.LineEditor(func(msg *ride.Message) []*ride.Message {
+		text, _ := msg.Args["text"].(string)
+		if code := strings.TrimSpace(text); msg.Command == "Execute" && strings.HasPrefix(code, "⎕SE.Gritt←") {
+			return ridetest.ExecuteReply(code, "")
+		}
+		return eval(msg)
+	})
+}
+
+func writeScript(t *testing.T, src string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "script.apl")
+	if err := os.WriteFile(path, []byte(src), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func fakeInterpreter(t *testing.T, respond ridetest.Responder) (*ride.Client, *ridetest.Server) {
+	t.Helper()
+	srv, err := ridetest.NewServer(respond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { srv.Close() })
+	client, err := ride.Connect(srv.Addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Close() })
+	return client, srv
+}
+
+// executed lists the Execute texts the interpreter received.
+func executed(srv *ridetest.Server) []string {
+	var texts []string
+	for _, msg := range srv.Received() {
+		if msg.Command == "Execute" {
+			text, _ := msg.Args["text"].(string)
+			texts = append(texts, text)
+		}
+	}
+	return texts
+}
+
+func TestRunScript(t *testing.T) {
+	path := writeScript(t, `#!/usr/bin/env -S gritt -l -run
+⍝ Doubles its argument
+∇ r←Double y
+  r←y×2
+∇
+
+Double 21
+1÷0
+'not reached'
+`)
+	client, srv := fakeInterpreter(t, lineEditor(map[string]string{
+		"Double 21": "42",
+		"1÷0":       "ERROR:DOMAIN ERROR: Divide by zero",
+	}))
+
+	var stdout, stderr bytes.Buffer
+	status, gone := runScript(client, path, []string{"a", "it's"}, strings.NewReader(""), &stdout, &stderr)
+	if status != 1 || gone {
+		t.Errorf("status = %d, gone = %v; want 1 after the error", status, gone)
+	}
+	if stdout.String() != "42\n" {
+		t.Errorf("stdout = %q", stdout.String())
+	}
+	if !strings.HasPrefix(stderr.String(), "DOMAIN ERROR: Divide by zero\ngritt: "+path+":8: ") {
+		t.Errorf("stderr = %q", stderr.String())
+	}
+
+	want := []string{
+		"      " + scriptArgsExpr(path, []string{"a", "it's"}) + "\n",
+		"      ∇ r←Double y\n",
+		"[1]    r←y×2\n",
+		"[2]  ∇\n",
+		"      Double 21\n",
+		"      1÷0\n",
+	}
+	if got := executed(srv); !reflect.DeepEqual(got, want) {
+		t.Errorf("executed:\n got %q\nwant %q", got, want)
+	}
+}
+
+func TestRunScriptInput(t *testing.T) {
+	path := writeScript(t, "name←⍞\n'hello ',name\n")
+	client, _ := fakeInterpreter(t, func(msg *ride.Message) []*ride.Message {
+		text, _ := msg.Args["text"].(string)
+		switch strings.TrimSpace(text) {
+		case "name←⍞":
+			return []*ride.Message{ridetest.Prompt(0), ridetest.Prompt(4)}
+		case "world":
+			return []*ride.Message{ridetest.Prompt(1)}
+		case "'hello ',name":
+			return ridetest.ExecuteReply("'hello ',name", "hello world")
+		}
+		return []*ride.Message{ridetest.Prompt(1)}
+	})
+
+	var stdout, stderr bytes.Buffer
+	status, _ := runScript(client, path, nil, strings.NewReader("world\n"), &stdout, &stderr)
+	if status != 0 || stdout.String() != "hello world\n" || stderr.Len() != 0 {
+		t.Errorf("status %d, stdout %q, stderr %q", status, stdout.String(), stderr.String())
+	}
+}
+
+func TestRunScriptOff(t *testing.T) {
+	path := writeScript(t, "⎕OFF 3\n'not reached'\n")
+	var srv *ridetest.Server
+	client, srv := fakeInterpreter(t, func(msg *ride.Message) []*ride.Message {
+		if text, _ := msg.Args["text"].(string); strings.Contains(text, "⎕OFF") {
+			go srv.Close()
+			return nil
+		}
+		return []*ride.Message{ridetest.Prompt(1)}
+	})
+
+	var stdout, stderr bytes.Buffer
+	status, gone := runScript(client, path, nil, strings.NewReader(""), &stdout, &stderr)
+	if status != 0 || !gone {
+		t.Errorf("status = %d, gone = %v; want the interpreter gone", status, gone)
+	}
+}
+
+func TestRunScriptEditorFallback(t *testing.T) {
+	path := writeScript(t, "∇ r←F y\n r←y+1\n∇\n")
+	client, srv := fakeInterpreter(t, func(msg *ride.Message) []*ride.Message {
+		switch msg.Command {
+		case "Execute":
+			text, _ := msg.Args["text"].(string)
+			if strings.Contains(text, "∇") {
+				return []*ride.Message{
+					{Command: "OpenWindow", Args: map[string]any{"token": 7, "name": "F", "text": []any{"r←F y"}}},
+					ridetest.Prompt(1),
+				}
+			}
+		case "SaveChanges":
+			return []*ride.Message{{Command: "ReplySaveChanges", Args: map[string]any{"win": 7, "err": 0}}}
+		}
+		return []*ride.Message{ridetest.Prompt(1)}
+	})
+
+	var stdout, stderr bytes.Buffer
+	if status, _ := runScript(client, path, nil, strings.NewReader(""), &stdout, &stderr); status != 0 {
+		t.Fatalf("status %d, stderr %q", status, stderr.String())
+	}
+	var saved []any
+	for _, msg := range srv.Received() {
+		if msg.Command == "SaveChanges" {
+			saved, _ = msg.Args["text"].([]any)
+		}
+	}
+	if !reflect.DeepEqual(saved, []any{"r←F y", " r←y+1"}) {
+		t.Errorf("saved %q", saved)
+	}
+}
+
+func TestRunScriptUnclosed(t *testing.T) {
+	path := writeScript(t, "x←1\n∇ f\n")
+	var stdout, stderr bytes.Buffer
+	if status, _ := runScript(nil, path, nil, strings.NewReader(""), &stdout, &stderr); status != 1 {
+		t.Errorf("status = %d", status)
+	}
+	if want := "gritt: " + path + ": line 2: ∇ definition is never closed\n"; stderr.String() != want {
+		t.Errorf("stderr = %q, want %q", stderr.String(), want)
+	}
+}
+
+func TestScriptArgsExpr(t *testing.T) {
+	if got, want := scriptArgsExpr("s.apl", nil), "⎕SE.Gritt←⎕NS⍬ ⋄ ⎕SE.Gritt.(Script Args)←(,'s.apl') (0⍴⊂'')"; got != want {
+		t.Errorf("no args: %q, want %q", got, want)
+	}
+	got := scriptArgsExpr("s.apl", []string{"x", "a'b\nc"})
+	want := "⎕SE.Gritt←⎕NS⍬ ⋄ ⎕SE.Gritt.(Script Args)←(,'s.apl') (,(⊂(,'x')),(⊂(,'a''b',(⎕UCS 10),'c')))"
+	if got != want {
+		t.Errorf("args: %q, want %q", got, want)
+	}
+}
+
+func TestSplitRunArgs(t *testing.T) {
+	for _, tt := range []struct {
+		in, gritt, script []string
+	}{
+		{[]string{"-l", "-e", "1"}, []string{"-l", "-e", "1"}, nil},
+		{[]string{"-l", "-run", "s.apl", "-v", "x"}, []string{"-l", "-run", "s.apl"}, []string{"-v", "x"}},
+		{[]string{"-run=s.apl", "-l"}, []string{"-run=s.apl"}, []string{"-l"}},
+		// #!/usr/local/bin/gritt -l -run
+		{[]string{"-l -run", "/bin/s.apl", "a"}, []string{"-l", "-run", "/bin/s.apl"}, []string{"a"}},
+	} {
+		gritt, script := splitRunArgs(tt.in)
+		if !reflect.DeepEqual(gritt, tt.gritt) || !reflect.DeepEqual(script, tt.script) {
+			t.Errorf("splitRunArgs(%q) = %q, %q; want %q, %q", tt.in, gritt, script, tt.gritt, tt.script)
+		}
+	}
+}
@@ -0,0 +1,399 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ErrPoolClosed is returned by Pool methods after Close.
+var ErrPoolClosed = errors.New("session pool is closed")
+
+// ErrNotCheckedOut is returned by Release for a session that isn't
+// checked out of the pool: released already, or from elsewhere.
+var ErrNotCheckedOut = errors.New("session is not checked out of the pool")
+
+// PoolOptions configures a Pool.
+type PoolOptions struct {
+	Size   int           // number of interpreters (default 2)
+	Launch LaunchOptions // how each interpreter is spawned
+
+	// Warm-up, run on each interpreter after launch and after any
+	// relaunch: Link each directory into #, ⎕FIX each file, then Warmup.
+	Link   []string
+	Fix    []string
+	Warmup func(ctx context.Context, s *Session) error
+
+	// HealthInterval is how often idle interpreters are checked with
+	// Alive, relaunched if dead and warmed up again if need be (default
+	// 30s, negative to disable). One that can't be is replaced.
+	HealthInterval time.Duration
+}
+
+// Pool runs independent evaluations on several interpreters in parallel.
+// Each Session in the pool is used by one caller at a time: check one out
+// with Acquire (or Do), or let Eval pick an idle one.
+//
+// Interpreters that die are relaunched before being handed out again,
+// and warmed up afresh since their workspace is lost. The health checks
+// replace one that fails to come back, and if no replacement can be
+// launched either, the pool runs short until a later check fills the gap.
+type Pool struct {
+	opts   PoolOptions
+	launch func(ctx context.Context) (*Session, error)
+
+	idle   chan *Session
+	stop   chan struct{}
+	ctx    context.Context // cancelled by Close, for health checks
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	mu       sync.Mutex
+	sessions []*Session
+	warmed   map[*Session]int  // Session.launches at last warm-up
+	out      map[*Session]bool // checked out, or being health-checked
+	missing  int               // evicted and not yet replaced
+	closed   bool
+}
+
+// NewPool launches opts.Size interpreters in parallel and warms them up.
+// If any fails, the others are closed and the errors returned.
+func NewPool(ctx context.Context, opts PoolOptions) (*Pool, error) {
+	return newPool(ctx, opts, func(ctx context.Context) (*Session, error) {
+		return Launch(ctx, opts.Launch)
+	})
+}
+
+func newPool(ctx context.Context, opts PoolOptions, launch func(context.Context) (*Session, error)) (*Pool, error) {
+	if opts.Size <= 0 {
+		opts.Size = 2
+	}
+	if opts.HealthInterval == 0 {
+		opts.HealthInterval = 30 * time.Second
+	}
+	p := &Pool{
+		opts:   opts,
+		launch: launch,
+		idle:   make(chan *Session, opts.Size),
+		stop:   make(chan struct{}),
+		warmed: make(map[*Session]int),
+		out:    make(map[*Session]bool),
+	}
+	p.ctx, p.cancel = context.WithCancel(context.Background())
+
+	sessions := make([]*Session, opts.Size)
+	errs := make([]error, opts.Size)
+	var wg sync.WaitGroup
+	for i := range sessions {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sessions[i], errs[i] = p.start(ctx)
+		}()
+	}
+	wg.Wait()
+	if err := errors.Join(errs...); err != nil {
+		p.cancel()
+		for i, s := range sessions {
+			if errs[i] == nil {
+				s.Close()
+			}
+		}
+		return nil, fmt.Errorf("start pool: %w", err)
+	}
+
+	p.sessions = sessions
+	for _, s := range sessions {
+		p.idle <- s
+	}
+	if opts.HealthInterval > 0 {
+		p.wg.Add(1)
+		go p.healthLoop()
+	}
+	return p, nil
+}
+
+// Size returns the number of interpreters the pool keeps. Fewer are
+// running while one that failed can't be replaced.
+func (p *Pool) Size() int {
+	return p.opts.Size
+}
+
+// Acquire checks out an idle interpreter, waiting for one if all are busy.
+// The caller has exclusive use of it until Release.
+func (p *Pool) Acquire(ctx context.Context) (*Session, error) {
+	select {
+	case <-p.stop:
+		return nil, ErrPoolClosed
+	default:
+	}
+	select {
+	case s := <-p.idle:
+		if !p.checkout(s) {
+			return nil, ErrPoolClosed
+		}
+		s, err := p.ensureHealthy(ctx, s)
+		if err != nil {
+			p.Release(s)
+			return nil, err
+		}
+		return s, nil
+	case <-p.stop:
+		return nil, ErrPoolClosed
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Release returns an interpreter checked out with Acquire to the pool.
+// Releasing one that isn't checked out returns ErrNotCheckedOut.
+func (p *Pool) Release(s *Session) error {
+	p.mu.Lock()
+	if !p.out[s] {
+		p.mu.Unlock()
+		return ErrNotCheckedOut
+	}
+	delete(p.out, s)
+	closed := p.closed
+	p.mu.Unlock()
+	if !closed {
+		p.idle <- s // there is room for every session not checked out
+	}
+	return nil
+}
+
+// checkout marks s, just taken from idle, as checked out. It reports
+// false once the pool is closed.
+func (p *Pool) checkout(s *Session) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return false
+	}
+	p.out[s] = true
+	return true
+}
+
+// Do runs fn with an interpreter checked out for its duration.
+func (p *Pool) Do(ctx context.Context, fn func(*Session) error) error {
+	s, err := p.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer p.Release(s)
+	return fn(s)
+}
+
+// Eval evaluates code on an idle interpreter. See Session.Eval.
+func (p *Pool) Eval(ctx context.Context, code string) (string, error) {
+	var out string
+	err := p.Do(ctx, func(s *Session) error {
+		var err error
+		out, err = s.Eval(ctx, code)
+		return err
+	})
+	return out, err
+}
+
+// Close stops health checks and closes every interpreter, including any
+// still checked out.
+func (p *Pool) Close() error {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil
+	}
+	p.closed = true
+	close(p.stop)
+	p.cancel()
+	sessions := p.sessions
+	p.mu.Unlock()
+
+	p.wg.Wait()
+	var errs []error
+	for _, s := range sessions {
+		errs = append(errs, s.Close())
+	}
+	return errors.Join(errs...)
+}
+
+// ensureHealthy relaunches s if it has died and re-runs the warm-up if it
+// was relaunched since the last one (including by execCollect's own
+// crash recovery). Sessions that can't relaunch themselves are replaced.
+func (p *Pool) ensureHealthy(ctx context.Context, s *Session) (*Session, error) {
+	if !s.Alive() {
+		err := s.Relaunch(ctx)
+		if errors.Is(err, ErrNotLaunched) {
+			var fresh *Session
+			if fresh, err = p.launch(ctx); err == nil {
+				p.replace(s, fresh)
+				s = fresh
+			}
+		}
+		if err != nil {
+			return s, fmt.Errorf("replace dead interpreter: %w", err)
+		}
+	}
+
+	s.mu.Lock()
+	launches := s.launches
+	s.mu.Unlock()
+	p.mu.Lock()
+	warmed, ok := p.warmed[s]
+	p.mu.Unlock()
+	if ok && warmed == launches {
+		return s, nil
+	}
+	return s, p.warm(ctx, s)
+}
+
+// warm runs the configured warm-up on s.
+func (p *Pool) warm(ctx context.Context, s *Session) error {
+	s.mu.Lock()
+	launches := s.launches
+	s.mu.Unlock()
+
+	for _, dir := range p.opts.Link {
+		if err := s.Link(ctx, dir); err != nil {
+			return fmt.Errorf("warm-up: link %s: %w", dir, err)
+		}
+	}
+	for _, path := range p.opts.Fix {
+		if err := s.Fix(ctx, path); err != nil {
+			return fmt.Errorf("warm-up: fix %s: %w", path, err)
+		}
+	}
+	if p.opts.Warmup != nil {
+		if err := p.opts.Warmup(ctx, s); err != nil {
+			return fmt.Errorf("warm-up: %w", err)
+		}
+	}
+
+	p.mu.Lock()
+	p.warmed[s] = launches
+	p.mu.Unlock()
+	return nil
+}
+
+// replace swaps a dead session for a fresh one, checked out if the old
+// one was.
+func (p *Pool) replace(old, fresh *Session) {
+	old.Close()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		fresh.Close() // Close has already run
+		return
+	}
+	delete(p.warmed, old)
+	if p.out[old] {
+		delete(p.out, old)
+		p.out[fresh] = true
+	}
+	for i, s := range p.sessions {
+		if s == old {
+			p.sessions[i] = fresh
+		}
+	}
+}
+
+// renew replaces s, checked out and failing its health check or warm-up,
+// with a freshly launched and warmed interpreter, which is returned
+// checked out. If that fails too, s is evicted and nil returned.
+func (p *Pool) renew(ctx context.Context, s *Session) *Session {
+	fresh, err := p.start(ctx)
+	if err != nil {
+		s.Close()
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		delete(p.warmed, s)
+		delete(p.out, s)
+		for i, x := range p.sessions {
+			if x == s {
+				p.sessions = append(p.sessions[:i], p.sessions[i+1:]...)
+				p.missing++
+				break
+			}
+		}
+		return nil
+	}
+	p.replace(s, fresh)
+	return fresh
+}
+
+// refill launches interpreters in place of those evicted, and hands them
+// out as idle.
+func (p *Pool) refill(ctx context.Context) {
+	p.mu.Lock()
+	missing := p.missing
+	p.mu.Unlock()
+	for range missing {
+		fresh, err := p.start(ctx)
+		if err != nil {
+			return // try again at the next check
+		}
+		p.mu.Lock()
+		if p.closed {
+			p.mu.Unlock()
+			fresh.Close()
+			return
+		}
+		p.sessions = append(p.sessions, fresh)
+		p.missing--
+		p.mu.Unlock()
+		p.idle <- fresh
+	}
+}
+
+// start launches and warms up a new interpreter.
+func (p *Pool) start(ctx context.Context) (*Session, error) {
+	s, err := p.launch(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.warm(ctx, s); err != nil {
+		s.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// healthLoop periodically checks idle interpreters so that dead ones are
+// relaunched (and warmed up) or replaced before a caller needs them, and
+// fills any gaps left by interpreters that couldn't be replaced.
+func (p *Pool) healthLoop() {
+	defer p.wg.Done()
+	ticker := time.NewTicker(p.opts.HealthInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-p.stop:
+			return
+		case <-ticker.C:
+		}
+		for range p.opts.Size {
+			var s *Session
+			select {
+			case s = <-p.idle:
+			default:
+			}
+			if s == nil {
+				break // the rest are checked out
+			}
+			if !p.checkout(s) {
+				return
+			}
+			s, err := p.ensureHealthy(p.ctx, s)
+			if err != nil {
+				if s = p.renew(p.ctx, s); s == nil {
+					continue
+				}
+			}
+			p.Release(s)
+		}
+		p.refill(p.ctx)
+	}
+}
@@ -0,0 +1,223 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cursork/gritt/ride/ridetest"
+)
+
+// fakePool builds a pool of sessions connected to fake interpreters. Each
+// launch starts a new server, so replacing a dead session is visible.
+func fakePool(t *testing.T, opts PoolOptions) (*Pool, func() []*ridetest.Server) {
+	t.Helper()
+	var mu sync.Mutex
+	var servers []*ridetest.Server
+	launch := func(ctx context.Context) (*Session, error) {
+		srv, err := ridetest.NewServer(ridetest.Eval(map[string]string{
+			"2+2":                   "4",
+			"⎕FIX 'file:///x.apln'": "",
+		}))
+		if err != nil {
+			return nil, err
+		}
+		mu.Lock()
+		servers = append(servers, srv)
+		mu.Unlock()
+		return Connect(ctx, ConnectOptions{Addr: srv.Addr()})
+	}
+	if opts.HealthInterval == 0 {
+		opts.HealthInterval = -1
+	}
+	pool, err := newPool(context.Background(), opts, launch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		pool.Close()
+		mu.Lock()
+		defer mu.Unlock()
+		for _, srv := range servers {
+			srv.Close()
+		}
+	})
+	return pool, func() []*ridetest.Server {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]*ridetest.Server(nil), servers...)
+	}
+}
+
+func TestPoolEval(t *testing.T) {
+	var warmups int
+	var wmu sync.Mutex
+	pool, servers := fakePool(t, PoolOptions{
+		Size: 2,
+		Fix:  []string{"/x.apln"},
+		Warmup: func(ctx context.Context, s *Session) error {
+			wmu.Lock()
+			warmups++
+			wmu.Unlock()
+			return nil
+		},
+	})
+	ctx := context.Background()
+
+	if warmups != 2 {
+		t.Errorf("warmups = %d, want 2", warmups)
+	}
+	for _, srv := range servers() {
+		if got := srv.Received(); len(got) == 0 || got[0].Args["text"] != "⎕FIX 'file:///x.apln'\n" {
+			t.Errorf("first message = %v, want the ⎕FIX warm-up", got)
+		}
+	}
+
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if out, err := pool.Eval(ctx, "2+2"); err != nil || out != "4" {
+				t.Errorf("Eval = %q, %v", out, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	// With both checked out, a third caller waits.
+	a, _ := pool.Acquire(ctx)
+	b, _ := pool.Acquire(ctx)
+	if a == b {
+		t.Error("Acquire returned the same session twice")
+	}
+	short, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	if _, err := pool.Acquire(short); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Acquire on busy pool = %v, want deadline exceeded", err)
+	}
+	pool.Release(a)
+	pool.Release(b)
+
+	pool.Close()
+	if _, err := pool.Eval(ctx, "2+2"); !errors.Is(err, ErrPoolClosed) {
+		t.Errorf("Eval after Close = %v, want ErrPoolClosed", err)
+	}
+}
+
+func TestPoolReplacesDeadInterpreter(t *testing.T) {
+	pool, servers := fakePool(t, PoolOptions{Size: 1, Fix: []string{"/x.apln"}})
+	ctx := context.Background()
+
+	first := servers()[0]
+	first.Close()
+	s, _ := pool.Acquire(ctx)
+	pool.Release(s)
+	deadline := time.Now().Add(2 * time.Second)
+	for s.Alive() && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	out, err := pool.Eval(ctx, "2+2")
+	if err != nil || out != "4" {
+		t.Fatalf("Eval after interpreter died = %q, %v", out, err)
+	}
+	all := servers()
+	if len(all) != 2 {
+		t.Fatalf("launched %d interpreters, want 2", len(all))
+	}
+	if got := all[1].Received(); len(got) != 2 || got[0].Args["text"] != "⎕FIX 'file:///x.apln'\n" {
+		t.Errorf("replacement received %v, want warm-up then Eval", got)
+	}
+}
+
+func TestPoolRelease(t *testing.T) {
+	pool, _ := fakePool(t, PoolOptions{Size: 1})
+	ctx := context.Background()
+
+	s, err := pool.Acquire(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := pool.Release(s); err != nil {
+		t.Fatalf("Release = %v", err)
+	}
+	// A second Release would have blocked on the full idle channel
+	if err := pool.Release(s); !errors.Is(err, ErrNotCheckedOut) {
+		t.Errorf("second Release = %v, want ErrNotCheckedOut", err)
+	}
+	if err := pool.Release(&Session{}); !errors.Is(err, ErrNotCheckedOut) {
+		t.Errorf("Release of a stranger = %v, want ErrNotCheckedOut", err)
+	}
+	if _, err := pool.Eval(ctx, "2+2"); err != nil {
+		t.Fatalf("Eval after rejected Releases: %v", err)
+	}
+
+	// Release racing Close doesn't deadlock
+	s, _ = pool.Acquire(ctx)
+	done := make(chan struct{})
+	go func() {
+		pool.Release(s)
+		close(done)
+	}()
+	pool.Close()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Release blocked against Close")
+	}
+}
+
+func TestPoolHealthReplacesFailedWarmup(t *testing.T) {
+	var mu sync.Mutex
+	fail := false
+	pool, servers := fakePool(t, PoolOptions{
+		Size:           1,
+		HealthInterval: 20 * time.Millisecond,
+		Warmup: func(ctx context.Context, s *Session) error {
+			mu.Lock()
+			defer mu.Unlock()
+			if fail {
+				return errors.New("warm-up failed")
+			}
+			return nil
+		},
+	})
+	ctx := context.Background()
+
+	// The interpreter dies, and no replacement warms up: it is evicted
+	mu.Lock()
+	fail = true
+	mu.Unlock()
+	servers()[0].Close()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		pool.mu.Lock()
+		missing := pool.missing
+		pool.mu.Unlock()
+		if missing == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("dead interpreter was not evicted")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// Once warm-ups work again, a later check fills the gap
+	mu.Lock()
+	fail = false
+	mu.Unlock()
+	short, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+	if out, err := pool.Eval(short, "2+2"); err != nil || out != "4" {
+		t.Fatalf("Eval after refill = %q, %v", out, err)
+	}
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+	if len(pool.sessions) != 1 || pool.missing != 0 {
+		t.Errorf("%d sessions, %d missing; want 1, 0", len(pool.sessions), pool.missing)
+	}
+}
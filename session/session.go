@@ -13,15 +13,16 @@ package session
 import (
 	"context"
 	"fmt"
-	"math/rand"
-	"net"
+	"math"
 	"os"
 	"os/exec"
 	"strings"
 	"sync"
 	"time"
 
+	"github.com/cursork/gritt/multiline"
 	"github.com/cursork/gritt/ride"
+	"github.com/cursork/gritt/syntax"
 )
 
 // Session is a connection to a Dyalog APL interpreter.
@@ -34,6 +35,10 @@ type Session struct {
 
 	// Stored for relaunch on crash (Launch mode only).
 	launchOpts *LaunchOptions
+
+	valueFormat ValueFormat
+	preplFixed  bool // prepl namespace is in ⎕SE (see EvalValue)
+	launches    int  // number of relaunches, so Pool knows to warm up again
 }
 
 // LaunchOptions configures how Dyalog is spawned.
@@ -49,6 +54,12 @@ type ConnectOptions struct {
 	Timeout time.Duration // connection timeout (default 10s)
 }
 
+// AcceptOptions configures waiting for an interpreter to dial in.
+type AcceptOptions struct {
+	Addr    string        // "host:port" to listen on (default "localhost:4502")
+	Timeout time.Duration // how long to wait for the interpreter (default: no limit)
+}
+
 // Launch spawns a new Dyalog interpreter and connects via RIDE.
 // The interpreter is killed when the session is closed.
 // Retries up to 3 times if the RIDE handshake fails.
@@ -82,16 +93,22 @@ func Launch(ctx context.Context, opts ...LaunchOptions) (*Session, error) {
 }
 
 // launchOnce performs a single attempt to spawn Dyalog and complete the RIDE handshake.
-// Uses SERVE mode: Dyalog listens on a random port, we connect to it.
+// Uses CONNECT mode: we listen on a free loopback port and Dyalog dials in,
+// so there is no port to guess and nothing to poll.
 func launchOnce(ctx context.Context, opt LaunchOptions) (*ride.Client, *exec.Cmd, error) {
 	exe, err := FindDyalog(opt.Version)
 	if err != nil {
 		return nil, nil, err
 	}
 
-	port := 10000 + rand.Intn(50000)
+	ln, err := ride.Listen("127.0.0.1:0")
+	if err != nil {
+		return nil, nil, err
+	}
+	defer ln.Close()
+
 	cmd := exec.Command(exe, "+s", "-q")
-	cmd.Env = append(os.Environ(), fmt.Sprintf("RIDE_INIT=SERVE:*:%d", port))
+	cmd.Env = append(os.Environ(), "RIDE_INIT=CONNECT:"+ln.Addr())
 	cmd.Env = append(cmd.Env, "RIDE_SPAWNED=1")
 	cmd.Env = append(cmd.Env, "DYALOG_LINEEDITOR_MODE=1")
 	cmd.Env = append(cmd.Env, DyalogEnv(exe)...)
@@ -104,37 +121,48 @@ func launchOnce(ctx context.Context, opt LaunchOptions) (*ride.Client, *exec.Cmd
 		return nil, nil, fmt.Errorf("start dyalog (%s): %w", exe, err)
 	}
 
-	// Poll for RIDE to be ready
-	addr := fmt.Sprintf("localhost:%d", port)
-	deadline := time.After(opt.Timeout)
-	for {
-		select {
-		case <-ctx.Done():
-			kill(cmd)
-			return nil, nil, ctx.Err()
-		case <-deadline:
-			kill(cmd)
-			return nil, nil, fmt.Errorf("dyalog did not start on port %d within %s", port, opt.Timeout)
-		default:
-		}
-
-		conn, err := net.DialTimeout("tcp", addr, 100*time.Millisecond)
-		if err == nil {
-			conn.Close()
-			break
-		}
-		time.Sleep(100 * time.Millisecond)
-	}
-
-	client, err := ride.Connect(addr)
+	client, err := accept(ctx, ln, opt.Timeout)
 	if err != nil {
 		kill(cmd)
-		return nil, nil, fmt.Errorf("ride connect: %w", err)
+		return nil, nil, fmt.Errorf("dyalog did not connect to %s: %w", ln.Addr(), err)
 	}
+	client.Start()
 
 	return client, cmd, nil
 }
 
+// accept waits up to timeout for one interpreter on ln.
+func accept(ctx context.Context, ln *ride.Listener, timeout time.Duration) (*ride.Client, error) {
+	type result struct {
+		client *ride.Client
+		err    error
+	}
+	ch := make(chan result, 1)
+	go func() {
+		client, err := ln.Accept()
+		ch <- result{client, err}
+	}()
+
+	var err error
+	select {
+	case r := <-ch:
+		return r.client, r.err
+	case <-ctx.Done():
+		err = ctx.Err()
+	case <-time.After(timeout):
+		err = fmt.Errorf("timed out after %s", timeout)
+	}
+	// Abandon the wait. A handshake already under way may still finish;
+	// drop that client.
+	ln.Close()
+	go func() {
+		if r := <-ch; r.client != nil {
+			r.client.Close()
+		}
+	}()
+	return nil, err
+}
+
 // Connect connects to an already-running Dyalog interpreter in SERVE mode.
 func Connect(ctx context.Context, opts ...ConnectOptions) (*Session, error) {
 	var opt ConnectOptions
@@ -149,6 +177,37 @@ func Connect(ctx context.Context, opts ...ConnectOptions) (*Session, error) {
 	if err != nil {
 		return nil, err
 	}
+	client.Start()
+
+	return &Session{client: client}, nil
+}
+
+// Accept listens for an interpreter started elsewhere with
+// RIDE_INIT=CONNECT:host:port and returns a session once one connects.
+// Only the first interpreter is accepted.
+func Accept(ctx context.Context, opts ...AcceptOptions) (*Session, error) {
+	var opt AcceptOptions
+	if len(opts) > 0 {
+		opt = opts[0]
+	}
+	if opt.Addr == "" {
+		opt.Addr = "localhost:4502"
+	}
+	if opt.Timeout == 0 {
+		opt.Timeout = math.MaxInt64
+	}
+
+	ln, err := ride.Listen(opt.Addr)
+	if err != nil {
+		return nil, err
+	}
+	defer ln.Close()
+
+	client, err := accept(ctx, ln, opt.Timeout)
+	if err != nil {
+		return nil, err
+	}
+	client.Start()
 
 	return &Session{client: client}, nil
 }
@@ -168,18 +227,36 @@ func (s *Session) Close() error {
 // Alive reports whether the connection is still open and, if we own the process,
 // whether it is still running.
 func (s *Session) Alive() bool {
+	select {
+	case <-s.client.Done():
+		return false
+	default:
+	}
 	if s.cmd != nil {
 		return s.cmd.ProcessState == nil
 	}
 	return true
 }
 
+// Client returns the underlying RIDE connection, for callers that drive
+// protocol messages Session has no API for (e.g. the tracer). The client is
+// already dispatching: use Subscribe or Queue rather than Recv. Session
+// methods only see the replies they asked for, but messages such as
+// AppendSessionOutput go to every subscriber.
+func (s *Session) Client() *ride.Client {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.client
+}
+
 // --- Execution ---
 
 // APLError represents an error from the APL interpreter.
 type APLError struct {
 	Message string   // e.g. "DOMAIN ERROR"
 	Lines   []string // all error output lines
+	EN      int      // ⎕EN, when known (EvalValue)
+	DM      []string // ⎕DM, when known (EvalValue)
 }
 
 func (e *APLError) Error() string {
@@ -194,6 +271,8 @@ var ErrSessionRestarted = fmt.Errorf("interpreter crashed and was restarted; wor
 
 // Eval executes APL code and returns the output as a single string.
 // Input echo (type 14) is filtered. APL errors return *APLError.
+// Code may span lines: ∇ definitions, :Namespace scripts and multi-line
+// dfns are entered as they would be typed into the session.
 func (s *Session) Eval(ctx context.Context, code string) (string, error) {
 	lines, err := s.execCollect(ctx, code)
 	if err != nil {
@@ -284,20 +363,8 @@ func (s *Session) Format(ctx context.Context, paths ...string) error {
 		content := strings.TrimRight(string(data), "\n")
 		lines := strings.Split(content, "\n")
 
-		// Detect namespace files by first non-blank line
-		isNamespace := false
-		for _, l := range lines {
-			trimmed := strings.TrimSpace(l)
-			if trimmed != "" {
-				isNamespace = strings.HasPrefix(trimmed, ":Namespace") ||
-					strings.HasPrefix(trimmed, ":Class") ||
-					strings.HasPrefix(trimmed, ":Interface")
-				break
-			}
-		}
-
 		var token int
-		if isNamespace {
+		if isNamespaceSource(lines) {
 			if nsToken < 0 {
 				var err error
 				nsToken, err = s.openDummyNamespace()
@@ -343,15 +410,78 @@ func (s *Session) Format(ctx context.Context, paths ...string) error {
 
 	// Close dummy windows
 	if fnToken >= 0 {
-		s.client.Send("CloseWindow", map[string]any{"win": fnToken})
+		s.client.Send("CloseWindow", ride.CloseWindow{Win: fnToken})
 	}
 	if nsToken >= 0 {
-		s.client.Send("CloseWindow", map[string]any{"win": nsToken})
+		s.client.Send("CloseWindow", ride.CloseWindow{Win: nsToken})
 	}
 
 	return nil
 }
 
+// FormatCode reformats APL source lines using Dyalog's formatter and returns
+// the result. Nothing is written to disk and the workspace is not modified.
+func (s *Session) FormatCode(ctx context.Context, lines []string) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var token int
+	var err error
+	if isNamespaceSource(lines) {
+		token, err = s.openDummyNamespace()
+	} else {
+		token, err = s.openDummyEditor()
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer s.client.Send("CloseWindow", ride.CloseWindow{Win: token})
+
+	return s.formatCode(token, lines)
+}
+
+// Validate fixes function source into a throwaway namespace so that
+// syntax errors are reported without touching the workspace. Returns
+// *APLError if ⎕FIX rejects the source. Scripts (:Namespace, :Class and
+// :Interface) are not checked: fixing one runs the statements in its
+// body, which may assign into # or do file I/O.
+func (s *Session) Validate(ctx context.Context, lines []string) error {
+	if len(lines) == 0 || isNamespaceSource(lines) {
+		return nil
+	}
+	_, err := s.Eval(ctx, "(⎕NS ⍬).⎕FIX "+aplStrings(lines))
+	return err
+}
+
+// Completion is the interpreter's answer to an autocomplete request.
+type Completion struct {
+	Skip    int      // characters before pos that the options replace
+	Options []string // candidate names
+}
+
+// Complete asks the interpreter for completions of line at rune offset pos,
+// using the same GetAutocomplete request as the TUI's session autocomplete.
+func (s *Session) Complete(ctx context.Context, line string, pos int) (*Completion, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	q := s.client.Queue("ReplyGetAutocomplete")
+	defer q.Close()
+	if err := s.client.Send("GetAutocomplete", ride.GetAutocomplete{Line: line, Pos: pos}); err != nil {
+		return nil, fmt.Errorf("send GetAutocomplete: %w", err)
+	}
+
+	msg, err := q.Next(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("recv ReplyGetAutocomplete: %w", err)
+	}
+	var reply ride.ReplyGetAutocomplete
+	if err := msg.Decode(&reply); err != nil {
+		return nil, err
+	}
+	return &Completion{Skip: reply.Skip, Options: reply.Options}, nil
+}
+
 // Relaunch kills the current interpreter and starts a fresh one.
 // Only works for sessions created with Launch (not Connect).
 func (s *Session) Relaunch(ctx context.Context) error {
@@ -390,24 +520,46 @@ func (s *Session) relaunchLocked(ctx context.Context) error {
 
 	s.client = client
 	s.cmd = cmd
+	s.preplFixed = false
+	s.launches++
 	return nil
 }
 
 // --- Internal ---
 
+// isNamespaceSource detects namespace-style scripts by their first non-blank line.
+func isNamespaceSource(lines []string) bool {
+	for _, l := range lines {
+		code, _ := syntax.SplitComment(l)
+		trimmed := strings.ToLower(strings.TrimSpace(code))
+		if trimmed != "" {
+			return strings.HasPrefix(trimmed, ":namespace") ||
+				strings.HasPrefix(trimmed, ":class") ||
+				strings.HasPrefix(trimmed, ":interface")
+		}
+	}
+	return false
+}
+
+// aplStrings renders lines as an APL expression yielding a vector of
+// character vectors, suitable as a ⎕FIX argument.
+func aplStrings(lines []string) string {
+	quoted := make([]string, len(lines))
+	for i, l := range lines {
+		quoted[i] = "'" + strings.ReplaceAll(l, "'", "''") + "'"
+	}
+	if len(quoted) == 1 {
+		return ",⊂," + quoted[0]
+	}
+	return ",¨" + strings.Join(quoted, " ")
+}
+
 var fmtCounter int
 
 func (s *Session) openDummyEditor() (int, error) {
 	fmtCounter++
 	name := fmt.Sprintf("gritt∆fmt%d", fmtCounter)
-	if err := s.client.Send("Edit", map[string]any{
-		"win":  0,
-		"text": name,
-		"pos":  0,
-	}); err != nil {
-		return 0, fmt.Errorf("send Edit: %w", err)
-	}
-	return s.waitForOpenWindow()
+	return s.openWindow(name)
 }
 
 func (s *Session) openDummyNamespace() (int, error) {
@@ -417,121 +569,138 @@ func (s *Session) openDummyNamespace() (int, error) {
 	if err := s.execPrintLocked(fmt.Sprintf("⎕FIX ':Namespace %s' ':EndNamespace'", name)); err != nil {
 		return 0, err
 	}
-	if err := s.client.Send("Edit", map[string]any{
-		"win":  0,
-		"text": name,
-		"pos":  0,
-	}); err != nil {
-		return 0, fmt.Errorf("send Edit: %w", err)
-	}
-	return s.waitForOpenWindow()
+	return s.openWindow(name)
 }
 
-func (s *Session) waitForOpenWindow() (int, error) {
-	for {
-		msg, _, err := s.client.Recv()
-		if err != nil {
-			return 0, fmt.Errorf("recv waiting for OpenWindow: %w", err)
-		}
-		if msg != nil && msg.Command == "OpenWindow" {
-			if t, ok := msg.Args["token"].(float64); ok {
-				return int(t), nil
-			}
-		}
+// openWindow opens an editor on name and returns its window token.
+func (s *Session) openWindow(name string) (int, error) {
+	q := s.client.Queue("OpenWindow")
+	defer q.Close()
+	if err := s.client.Send("Edit", ride.Edit{Text: name}); err != nil {
+		return 0, fmt.Errorf("send Edit: %w", err)
+	}
+	msg, err := q.Next(context.Background())
+	if err != nil {
+		return 0, fmt.Errorf("recv waiting for OpenWindow: %w", err)
+	}
+	var w ride.OpenWindow
+	if err := msg.Decode(&w); err != nil {
+		return 0, err
 	}
+	return w.Token, nil
 }
 
 func (s *Session) formatCode(win int, lines []string) ([]string, error) {
-	text := make([]any, len(lines))
-	for i, l := range lines {
-		text[i] = l
-	}
-
-	if err := s.client.Send("FormatCode", map[string]any{
-		"win":  win,
-		"text": text,
-	}); err != nil {
+	q := s.client.Queue("ReplyFormatCode")
+	defer q.Close()
+	if err := s.client.Send("FormatCode", ride.FormatCode{Win: win, Text: lines}); err != nil {
 		return nil, fmt.Errorf("send FormatCode: %w", err)
 	}
 
-	for {
-		msg, _, err := s.client.Recv()
-		if err != nil {
-			return nil, fmt.Errorf("recv ReplyFormatCode: %w", err)
-		}
-		if msg != nil && msg.Command == "ReplyFormatCode" {
-			if result, ok := msg.Args["text"].([]any); ok {
-				out := make([]string, len(result))
-				for i, l := range result {
-					out[i], _ = l.(string)
-				}
-				return out, nil
-			}
-		}
+	msg, err := q.Next(context.Background())
+	if err != nil {
+		return nil, fmt.Errorf("recv ReplyFormatCode: %w", err)
+	}
+	var reply ride.ReplyFormatCode
+	if err := msg.Decode(&reply); err != nil {
+		return nil, err
 	}
+	return reply.Text, nil
 }
 
 // execCollect sends Execute, collects output, separates errors.
 // If the connection dies and the session was launched, it automatically
 // relaunches the interpreter and returns ErrSessionRestarted.
+//
+// Code with several lines is framed with multiline.Frame and sent one line
+// per prompt, so a ∇ definition goes through the line editor (prompt type
+// 3) and a :Namespace script or open dfn is collected by the interpreter
+// as it would be typed into the session. Evaluation stops at the first
+// block with an error.
 func (s *Session) execCollect(ctx context.Context, code string) ([]string, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	if err := s.client.Send("Execute", map[string]any{
-		"text":  code + "\n",
-		"trace": 0,
-	}); err != nil {
-		if rerr := s.tryRelaunchLocked(ctx); rerr == nil {
-			return nil, ErrSessionRestarted
+	blocks := [][]string{{code + "\n"}}
+	if strings.Contains(code, "\n") {
+		framed, err := multiline.Frame(strings.Split(code, "\n"))
+		if err != nil {
+			return nil, err
+		}
+		blocks = blocks[:0]
+		for _, b := range framed {
+			blocks = append(blocks, b.Texts())
 		}
-		return nil, fmt.Errorf("send execute: %w", err)
 	}
 
+	q := s.client.Queue("AppendSessionOutput", "SetPromptType")
+	defer q.Close()
+
 	var outputs []string
 	var errors []string
 
-	for {
-		select {
-		case <-ctx.Done():
-			s.client.Send("WeakInterrupt", map[string]any{})
-			return outputs, ctx.Err()
-		default:
+	for _, texts := range blocks {
+		prompt := 0
+		for _, text := range texts {
+			if err := s.client.Send("Execute", ride.Execute{Text: text}); err != nil {
+				if rerr := s.tryRelaunchLocked(ctx); rerr == nil {
+					return nil, ErrSessionRestarted
+				}
+				return nil, fmt.Errorf("send execute: %w", err)
+			}
+			var err error
+			prompt, err = s.awaitPromptLocked(ctx, q, &outputs, &errors)
+			if err != nil {
+				return outputs, err
+			}
+			if len(errors) > 0 && prompt != 3 {
+				return nil, makeAPLError(errors)
+			}
+		}
+		if prompt == 3 {
+			return outputs, fmt.Errorf("the interpreter is still waiting for the rest of the definition")
 		}
+	}
+	return outputs, nil
+}
 
-		msg, _, err := s.client.Recv()
+// awaitPromptLocked collects session output from q until the interpreter
+// is ready for input again, and returns the prompt type. Caller must hold mu.
+func (s *Session) awaitPromptLocked(ctx context.Context, q *ride.Queue, outputs, errors *[]string) (int, error) {
+	for {
+		msg, err := q.Next(ctx)
+		if ctx.Err() != nil {
+			s.client.Send("WeakInterrupt", ride.WeakInterrupt{})
+			return 0, ctx.Err()
+		}
 		if err != nil {
 			if rerr := s.tryRelaunchLocked(ctx); rerr == nil {
-				return nil, ErrSessionRestarted
+				return 0, ErrSessionRestarted
 			}
-			return outputs, fmt.Errorf("recv: %w", err)
-		}
-		if msg == nil {
-			continue
+			return 0, fmt.Errorf("recv: %w", err)
 		}
 
-		switch msg.Command {
-		case "AppendSessionOutput":
-			t, _ := msg.Args["type"].(float64)
-			result, _ := msg.Args["result"].(string)
-			result = strings.TrimRight(result, "\n")
-			switch int(t) {
+		ev, err := msg.Typed()
+		if err != nil {
+			return 0, err
+		}
+		switch ev := ev.(type) {
+		case *ride.AppendSessionOutput:
+			result := strings.TrimRight(ev.Result, "\n")
+			switch ev.Type {
 			case 14, 11:
 				// Input echo / multiline body echo — skip
 			case 5:
 				// APL error output
-				errors = append(errors, result)
+				*errors = append(*errors, result)
 			default:
 				if result != "" {
-					outputs = append(outputs, result)
+					*outputs = append(*outputs, result)
 				}
 			}
-		case "SetPromptType":
-			if t, ok := msg.Args["type"].(float64); ok && t > 0 {
-				if len(errors) > 0 {
-					return nil, makeAPLError(errors)
-				}
-				return outputs, nil
+		case *ride.SetPromptType:
+			if ev.Ready() {
+				return ev.Type, nil
 			}
 		}
 	}
@@ -539,25 +708,20 @@ func (s *Session) execCollect(ctx context.Context, code string) ([]string, error
 
 // execPrintLocked executes an expression, discarding output. Caller must hold mu.
 func (s *Session) execPrintLocked(expr string) error {
-	if err := s.client.Send("Execute", map[string]any{
-		"text":  expr + "\n",
-		"trace": 0,
-	}); err != nil {
+	q := s.client.Queue("SetPromptType")
+	defer q.Close()
+	if err := s.client.Send("Execute", ride.Execute{Text: expr + "\n"}); err != nil {
 		return fmt.Errorf("send execute: %w", err)
 	}
 
 	for {
-		msg, _, err := s.client.Recv()
+		msg, err := q.Next(context.Background())
 		if err != nil {
 			return fmt.Errorf("recv: %w", err)
 		}
-		if msg == nil {
-			continue
-		}
-		if msg.Command == "SetPromptType" {
-			if t, ok := msg.Args["type"].(float64); ok && t > 0 {
-				return nil
-			}
+		var p ride.SetPromptType
+		if msg.Decode(&p) == nil && p.Ready() {
+			return nil
 		}
 	}
 }
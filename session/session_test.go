@@ -0,0 +1,323 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cursork/gritt/ride"
+	"github.com/cursork/gritt/ride/ridetest"
+)
+
+func fakeSession(t *testing.T, respond ridetest.Responder) (*Session, *ridetest.Server) {
+	t.Helper()
+	srv, err := ridetest.NewServer(respond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sess, err := Connect(context.Background(), ConnectOptions{Addr: srv.Addr()})
+	if err != nil {
+		srv.Close()
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		sess.Close()
+		srv.Close()
+	})
+	return sess, srv
+}
+
+func TestEval(t *testing.T) {
+	sess, _ := fakeSession(t, ridetest.Eval(map[string]string{
+		"2+2": "4",
+		"x←1": "",
+		"1÷0": "ERROR:DOMAIN ERROR: Divide by zero\n      1÷0\n       ∧",
+	}))
+	ctx := context.Background()
+
+	got, err := sess.Eval(ctx, "2+2")
+	if err != nil || got != "4" {
+		t.Errorf("Eval(2+2) = %q, %v", got, err)
+	}
+	got, err = sess.Eval(ctx, "x←1")
+	if err != nil || got != "" {
+		t.Errorf("Eval(x←1) = %q, %v", got, err)
+	}
+
+	_, err = sess.Eval(ctx, "1÷0")
+	var aplErr *APLError
+	if !errors.As(err, &aplErr) {
+		t.Fatalf("Eval(1÷0) error = %v, want *APLError", err)
+	}
+	if aplErr.Message != "DOMAIN ERROR: Divide by zero" {
+		t.Errorf("Message = %q", aplErr.Message)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	sess, srv := fakeSession(t, ridetest.Eval(nil))
+	ctx := context.Background()
+
+	// Fixing a script would run its body, so scripts aren't sent at all
+	script := []string{"⍝ Utilities", ":namespace utils", "  #.notes←⊃⎕NGET 'notes.txt'", ":EndNamespace"}
+	if err := sess.Validate(ctx, script); err != nil {
+		t.Errorf("Validate(script) = %v", err)
+	}
+	for _, msg := range srv.Received() {
+		if msg.Command == "Execute" {
+			t.Errorf("script sent: %v", msg.Args["text"])
+		}
+	}
+
+	var aplErr *APLError
+	if err := sess.Validate(ctx, []string{"r←F y", "r←y+"}); !errors.As(err, &aplErr) {
+		t.Errorf("Validate(function) = %v, want the APL error", err)
+	}
+}
+
+func TestEvalMultiline(t *testing.T) {
+	sess, srv := fakeSession(t, ridetest.LineEditor(ridetest.Eval(map[string]string{
+		"Double 21": "42",
+		"1÷0":       "ERROR:DOMAIN ERROR",
+	})))
+	ctx := context.Background()
+
+	got, err := sess.Eval(ctx, "∇ r←Double y\n  r←y×2\n∇\n\nDouble 21")
+	if err != nil || got != "42" {
+		t.Fatalf("Eval = %q, %v", got, err)
+	}
+	var texts []string
+	for _, msg := range srv.Received() {
+		if msg.Command == "Execute" {
+			text, _ := msg.Args["text"].(string)
+			texts = append(texts, text)
+		}
+	}
+	want := []string{"      ∇ r←Double y\n", "[1]    r←y×2\n", "[2]  ∇\n", "      Double 21\n"}
+	if !reflect.DeepEqual(texts, want) {
+		t.Errorf("sent %q, want %q", texts, want)
+	}
+
+	var aplErr *APLError
+	if _, err := sess.Eval(ctx, "1÷0\nDouble 21"); !errors.As(err, &aplErr) {
+		t.Errorf("error = %v, want *APLError", err)
+	}
+	if _, err := sess.Eval(ctx, "∇ r←Half y\n  r←y÷2"); err == nil || !strings.Contains(err.Error(), "never closed") {
+		t.Errorf("unclosed ∇: error = %v", err)
+	}
+}
+
+func TestBatchStopsOnError(t *testing.T) {
+	sess, _ := fakeSession(t, ridetest.Eval(map[string]string{"1": "1", "2": "2"}))
+	results, err := sess.Batch(context.Background(), []string{"1", "oops", "2"})
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	if !reflect.DeepEqual(results, []string{"1"}) {
+		t.Errorf("results = %v", results)
+	}
+}
+
+func TestNames(t *testing.T) {
+	sess, _ := fakeSession(t, ridetest.Eval(map[string]string{
+		"↑' '(≠⊆⊢)∊' ',¨(#.⎕NL ¯2 ¯3 ¯4 ¯9)": "foo\nbar",
+	}))
+	names, err := sess.Names(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(names, []string{"foo", "bar"}) {
+		t.Errorf("Names = %v", names)
+	}
+}
+
+func TestComplete(t *testing.T) {
+	sess, srv := fakeSession(t, func(msg *ride.Message) []*ride.Message {
+		if msg.Command != "GetAutocomplete" {
+			return nil
+		}
+		return []*ride.Message{{Command: "ReplyGetAutocomplete", Args: map[string]any{
+			"token": 0, "skip": 2, "options": []any{"⎕IO", "⎕IDLOC"},
+		}}}
+	})
+	c, err := sess.Complete(context.Background(), "⎕I", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Skip != 2 || !reflect.DeepEqual(c.Options, []string{"⎕IO", "⎕IDLOC"}) {
+		t.Errorf("Complete = %+v", c)
+	}
+	got := srv.Received()
+	if len(got) != 1 || got[0].Args["line"] != "⎕I" || got[0].Args["pos"] != 2.0 {
+		t.Errorf("sent %+v", got)
+	}
+}
+
+func TestFormatCode(t *testing.T) {
+	sess, srv := fakeSession(t, func(msg *ride.Message) []*ride.Message {
+		switch msg.Command {
+		case "Edit":
+			return []*ride.Message{{Command: "OpenWindow", Args: map[string]any{"token": 7, "name": msg.Args["text"]}}}
+		case "FormatCode":
+			text := msg.Args["text"].([]any)
+			out := make([]any, len(text))
+			for i, l := range text {
+				out[i] = strings.TrimSpace(l.(string))
+			}
+			return []*ride.Message{{Command: "ReplyFormatCode", Args: map[string]any{"win": 7, "text": out}}}
+		}
+		return nil
+	})
+	got, err := sess.FormatCode(context.Background(), []string{"r←f x", "   r←x"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, []string{"r←f x", "r←x"}) {
+		t.Errorf("FormatCode = %q", got)
+	}
+
+	// The dummy window must be closed again.
+	deadline := time.Now().Add(time.Second)
+	for !closedWindow(srv, 7) {
+		if time.Now().After(deadline) {
+			t.Fatal("CloseWindow not sent")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func closedWindow(srv *ridetest.Server, win float64) bool {
+	for _, m := range srv.Received() {
+		if m.Command == "CloseWindow" && m.Args["win"] == win {
+			return true
+		}
+	}
+	return false
+}
+
+func TestAPLStrings(t *testing.T) {
+	if got := aplStrings([]string{"it's"}); got != ",⊂,'it''s'" {
+		t.Errorf("single = %s", got)
+	}
+	if got := aplStrings([]string{"a", "b"}); got != ",¨'a' 'b'" {
+		t.Errorf("multiple = %s", got)
+	}
+}
+
+func TestAccept(t *testing.T) {
+	ln, err := ride.Listen("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	interp, err := ridetest.Dial(ln.Addr(), ridetest.Eval(map[string]string{"⎕IO": "1"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer interp.Close()
+
+	client, err := accept(context.Background(), ln, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.Start()
+	sess := &Session{client: client}
+	defer sess.Close()
+	if got, err := sess.Eval(context.Background(), "⎕IO"); err != nil || got != "1" {
+		t.Errorf("Eval(⎕IO) = %q, %v", got, err)
+	}
+}
+
+func TestAcceptTimeout(t *testing.T) {
+	ln, err := ride.Listen("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	if _, err := accept(context.Background(), ln, 20*time.Millisecond); err == nil {
+		t.Fatal("expected timeout")
+	}
+}
+
+func TestEvalValue(t *testing.T) {
+	responses := map[string]string{
+		"⍳3":        "(tag: 'ret' ⋄ val: 1 2 3)",
+		"2 2⍴⍳4":    "(tag: 'ret' ⋄ val: [1 2 ⋄ 3 4])",
+		"cfg":       "(tag: 'ret' ⋄ val: (name: 'x' ⋄ size: 3))",
+		"x←1":       "(tag: 'ret')",
+		"1÷0":       "(tag: 'err' ⋄ en: 11 ⋄ message: 'Divide by zero' ⋄ dm: ('DOMAIN ERROR' '      1÷0' '       ∧'))",
+		"'it''s'":   "(tag: 'ret' ⋄ val: 'it''s')",
+		"⎕←'x' ⋄ 1": "(tag: 'ret' ⋄ val: 1)",
+	}
+	// What the expressions display themselves, ahead of the response
+	shown := map[string]string{"⎕←'x' ⋄ 1": "x\n"}
+	var fixes int
+	sess, _ := fakeSession(t, func(msg *ride.Message) []*ride.Message {
+		if msg.Command != "Execute" {
+			return nil
+		}
+		code := strings.TrimSpace(msg.Args["text"].(string))
+		if strings.HasPrefix(code, "{}2 ⎕SE.⎕FIX") {
+			fixes++
+			return ridetest.ExecuteReply(code, "")
+		}
+		// {...}'expr' — recover the quoted argument.
+		i := strings.LastIndex(code, "}'")
+		expr := strings.ReplaceAll(code[i+2:len(code)-1], "''", "'")
+		out, ok := responses[expr]
+		if !ok {
+			t.Errorf("unexpected expression %q", expr)
+		}
+		// Split the way the interpreter prints it, in framed chunks.
+		if len(out) > 10 {
+			out = out[:10] + "\n⍝PREPL← " + out[10:]
+		}
+		return ridetest.ExecuteReply(code, shown[expr]+"⍝PREPL← "+out)
+	})
+	ctx := context.Background()
+
+	v, err := sess.EvalValue(ctx, "⍳3")
+	if err != nil || !reflect.DeepEqual(v, []any{1, 2, 3}) {
+		t.Errorf("⍳3 = %#v, %v", v, err)
+	}
+	if v, err := sess.EvalValue(ctx, "x←1"); v != nil || err != nil {
+		t.Errorf("x←1 = %#v, %v", v, err)
+	}
+	if v, err := sess.EvalValue(ctx, "'it''s'"); v != "it's" || err != nil {
+		t.Errorf("'it''s' = %#v, %v", v, err)
+	}
+	if v, err := sess.EvalValue(ctx, "⎕←'x' ⋄ 1"); v != 1 || err != nil {
+		t.Errorf("⎕←'x' ⋄ 1 = %#v, %v", v, err)
+	}
+
+	_, err = sess.EvalValue(ctx, "1÷0")
+	var aplErr *APLError
+	if !errors.As(err, &aplErr) {
+		t.Fatalf("1÷0 error = %v, want *APLError", err)
+	}
+	if aplErr.EN != 11 || len(aplErr.DM) != 3 || aplErr.Message != "DOMAIN ERROR: Divide by zero" {
+		t.Errorf("APLError = %+v", aplErr)
+	}
+
+	var m [][]int
+	if err := sess.EvalInto(ctx, "2 2⍴⍳4", &m); err != nil || !reflect.DeepEqual(m, [][]int{{1, 2}, {3, 4}}) {
+		t.Errorf("EvalInto matrix = %v, %v", m, err)
+	}
+	var cfg struct {
+		Name string `apl:"name"`
+		Size int    `apl:"size"`
+	}
+	if err := sess.EvalInto(ctx, "cfg", &cfg); err != nil || cfg.Name != "x" || cfg.Size != 3 {
+		t.Errorf("EvalInto namespace = %+v, %v", cfg, err)
+	}
+
+	if fixes != 1 {
+		t.Errorf("prepl fixed %d times, want 1", fixes)
+	}
+	if _, err := sess.EvalValue(ctx, "1\n2"); err == nil {
+		t.Error("expected error for multi-line expression")
+	}
+}
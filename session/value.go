@@ -0,0 +1,109 @@
+package session
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/cursork/gritt/codec"
+	"github.com/cursork/gritt/prepl"
+)
+
+// ValueFormat selects how EvalValue has the interpreter serialise results.
+type ValueFormat int
+
+const (
+	// ValueAPLAN serialises with ⎕SE.Dyalog.Array.Serialise (the default).
+	ValueAPLAN ValueFormat = iota
+	// ValueBinary serialises with 220⌶, which is faster for large arrays
+	// and round-trips values APLAN can't express.
+	ValueBinary
+)
+
+// SetValueFormat sets the serialisation used by EvalValue and EvalInto.
+func (s *Session) SetValueFormat(f ValueFormat) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.valueFormat = f
+}
+
+// EvalValue evaluates a single-line expression and returns its result as
+// Go values rather than display text, decoded as by codec.APLAN: int,
+// float64, string, []any, *codec.Array, *codec.Namespace and so on. An
+// expression without a result returns nil. APL errors return *APLError
+// with EN and DM set. Anything the expression displays is discarded.
+//
+// The first call fixes the prepl namespace into ⎕SE, which does the
+// serialisation on the interpreter side.
+func (s *Session) EvalValue(ctx context.Context, expr string) (any, error) {
+	if strings.ContainsAny(expr, "\r\n") {
+		return nil, fmt.Errorf("EvalValue: expression must be a single line")
+	}
+	if err := s.ensurePrepl(ctx); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	mode := "aplan"
+	if s.valueFormat == ValueBinary {
+		mode = "aplor"
+	}
+	s.mu.Unlock()
+
+	// Print the response in fixed-width chunks
+	lines, err := s.execCollect(ctx, prepl.EvalAsExpr(mode, expr, prepl.EvalAsWidth))
+	if err != nil {
+		return nil, err
+	}
+	resp, err := prepl.ParseEvalAs(strings.Join(lines, ""))
+	if err != nil {
+		return nil, fmt.Errorf("EvalValue: %w", err)
+	}
+	if resp.Err != nil {
+		return nil, preplError(resp.Err)
+	}
+	return resp.Val, nil
+}
+
+// EvalInto evaluates expr and stores the result in the value pointed to by
+// dst, as codec.Decode does: namespaces decode into structs (using `apl`
+// field tags) or maps, vectors into slices and higher-rank arrays into
+// nested slices.
+func (s *Session) EvalInto(ctx context.Context, expr string, dst any) error {
+	v, err := s.EvalValue(ctx, expr)
+	if err != nil {
+		return err
+	}
+	return codec.Decode(v, dst)
+}
+
+// ensurePrepl fixes the prepl namespace into ⎕SE once per interpreter.
+func (s *Session) ensurePrepl(ctx context.Context) error {
+	s.mu.Lock()
+	fixed := s.preplFixed
+	s.mu.Unlock()
+	if fixed {
+		return nil
+	}
+
+	if _, err := s.Eval(ctx, prepl.FixExpr()); err != nil {
+		return fmt.Errorf("load prepl: %w", err)
+	}
+
+	s.mu.Lock()
+	s.preplFixed = true
+	s.mu.Unlock()
+	return nil
+}
+
+// preplError converts a prepl error response to an *APLError.
+func preplError(e *prepl.Error) *APLError {
+	msg := e.Message
+	if len(e.DM) > 0 {
+		msg = strings.TrimSpace(strings.TrimPrefix(e.DM[0], "⍎"))
+		if e.Message != "" && !strings.Contains(msg, e.Message) {
+			msg += ": " + e.Message
+		}
+	}
+	return &APLError{Message: msg, Lines: e.DM, EN: e.EN, DM: e.DM}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	"github.com/cursork/gritt/ride"
+)
+
+// sessionEvent is one thing that happened in the gritt session, as sent to
+// -sock subscribers.
+type sessionEvent struct {
+	Type string    `json:"type"` // input, output, prompt, window-open, window-update, window-close
+	Time time.Time `json:"time"`
+
+	// input and output
+	Text       string `json:"text,omitempty"`
+	OutputType int    `json:"output_type,omitempty"` // AppendSessionOutput type
+	Source     string `json:"source,omitempty"`      // input: user, socket or external
+
+	// prompt
+	Prompt *int `json:"prompt,omitempty"` // SetPromptType type: 0 busy, 1 normal, ...
+	Ready  bool `json:"ready,omitempty"`
+
+	// window-open, window-update (tracers only) and window-close
+	Token  int    `json:"token,omitempty"`
+	Name   string `json:"name,omitempty"`
+	Tracer bool   `json:"tracer,omitempty"`
+	Line   *int   `json:"line,omitempty"` // Tracer's current line
+}
+
+// sessionFeed fans session events out to -sock subscribers. Publishing
+// never blocks the TUI: a subscriber that falls behind loses events.
+type sessionFeed struct {
+	mu   sync.Mutex
+	subs map[chan sessionEvent]struct{}
+}
+
+func newSessionFeed() *sessionFeed {
+	return &sessionFeed{subs: make(map[chan sessionEvent]struct{})}
+}
+
+// subscribe returns a channel of events, until unsubscribe.
+func (f *sessionFeed) subscribe() chan sessionEvent {
+	ch := make(chan sessionEvent, 256)
+	f.mu.Lock()
+	f.subs[ch] = struct{}{}
+	f.mu.Unlock()
+	return ch
+}
+
+// unsubscribe stops and closes ch. It is safe to call more than once.
+func (f *sessionFeed) unsubscribe(ch chan sessionEvent) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, ok := f.subs[ch]; ok {
+		delete(f.subs, ch)
+		close(ch)
+	}
+}
+
+// publish sends ev to every subscriber. A nil feed (no -sock) does nothing.
+func (f *sessionFeed) publish(ev sessionEvent) {
+	if f == nil {
+		return
+	}
+	if ev.Time.IsZero() {
+		ev.Time = time.Now()
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for ch := range f.subs {
+		select {
+		case ch <- ev:
+		default: // subscriber is behind; drop
+		}
+	}
+}
+
+// publishRide turns an interpreter message into a session event for
+// subscribers. Call it before the message is handled, while the Model
+// still knows who sent the input and which windows are tracers. Traffic
+// from internal queries and quiet socket requests is left out.
+func (m *Model) publishRide(msg any) {
+	if m.feed == nil || m.internalQuery != "" || m.activeSocket != nil && m.activeSocket.quiet {
+		return
+	}
+	switch ev := msg.(type) {
+	case *ride.AppendSessionOutput:
+		if ev.Type == 14 || ev.Type == 11 {
+			source := "external"
+			switch {
+			case m.activeSocket != nil:
+				source = "socket"
+			case ev.Result == m.lastExecute || len(m.pendingLines) > 0:
+				source = "user"
+			}
+			m.feed.publish(sessionEvent{Type: "input", Text: ev.Result, OutputType: ev.Type, Source: source})
+			return
+		}
+		m.feed.publish(sessionEvent{Type: "output", Text: ev.Result, OutputType: ev.Type})
+	case *ride.SetPromptType:
+		prompt := ev.Type
+		m.feed.publish(sessionEvent{Type: "prompt", Prompt: &prompt, Ready: ev.Ready()})
+	case *ride.OpenWindow:
+		m.feed.publish(windowEvent("window-open", ev.Token, ev.Name, bool(ev.Debugger), ev.CurrentRow))
+	case *ride.UpdateWindow:
+		if ev.Debugger {
+			m.feed.publish(windowEvent("window-update", ev.Token, ev.Name, true, ev.CurrentRow))
+		}
+	case *ride.CloseWindow:
+		closed := sessionEvent{Type: "window-close", Token: ev.Win, Tracer: m.isInTracerStack(ev.Win)}
+		if w, ok := m.editors[ev.Win]; ok {
+			closed.Name = w.Name
+		}
+		m.feed.publish(closed)
+	}
+}
+
+func windowEvent(typ string, token int, name string, tracer bool, line int) sessionEvent {
+	ev := sessionEvent{Type: typ, Token: token, Name: name, Tracer: tracer}
+	if tracer {
+		ev.Line = &line
+	}
+	return ev
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/cursork/gritt/ride"
+)
+
+func TestPublishRide(t *testing.T) {
+	feed := newSessionFeed()
+	events := feed.subscribe()
+	m := &Model{feed: feed, editors: map[int]*EditorWindow{}, lastExecute: "      1+2\n"}
+
+	m.publishRide(&ride.AppendSessionOutput{Result: "      1+2\n", Type: 14})
+	m.publishRide(&ride.AppendSessionOutput{Result: "3\n", Type: 2})
+	m.publishRide(&ride.SetPromptType{Type: 1})
+	m.publishRide(&ride.OpenWindow{Token: 7, Name: "foo", Debugger: true, CurrentRow: 2})
+	m.tracerStack = []int{7}
+	m.publishRide(&ride.CloseWindow{Win: 7})
+
+	// Internal queries are not published
+	m.internalQuery = "⎕NL 2"
+	m.publishRide(&ride.AppendSessionOutput{Result: "x\n", Type: 2})
+
+	want := []sessionEvent{
+		{Type: "input", Text: "      1+2\n", OutputType: 14, Source: "user"},
+		{Type: "output", Text: "3\n", OutputType: 2},
+		{Type: "prompt", Ready: true},
+		{Type: "window-open", Token: 7, Name: "foo", Tracer: true},
+		{Type: "window-close", Token: 7, Tracer: true},
+	}
+	for _, w := range want {
+		got := <-events
+		if got.Type != w.Type || got.Text != w.Text || got.Source != w.Source || got.Token != w.Token || got.Tracer != w.Tracer || got.Ready != w.Ready {
+			t.Errorf("event = %+v, want %+v", got, w)
+		}
+	}
+	select {
+	case ev := <-events:
+		t.Errorf("unexpected event %+v", ev)
+	default:
+	}
+
+	feed.unsubscribe(events)
+	feed.unsubscribe(events) // safe to repeat
+	feed.publish(sessionEvent{Type: "output"})
+}
+
+func TestJSONRPCSubscribe(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	feed := newSessionFeed()
+	go handleJSONRPCConn(context.Background(), server, &fakeTUI{}, feed)
+
+	client.SetDeadline(time.Now().Add(5 * time.Second))
+	rd := bufio.NewReader(client)
+	read := func() map[string]any {
+		t.Helper()
+		line, err := rd.ReadBytes('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		var msg map[string]any
+		if err := json.Unmarshal(line, &msg); err != nil {
+			t.Fatalf("bad message %s: %v", line, err)
+		}
+		return msg
+	}
+
+	client.Write([]byte(`{"jsonrpc":"2.0","id":1,"method":"subscribe"}` + "\n"))
+	if msg := read(); msg["id"] != 1.0 || msg["error"] != nil {
+		t.Fatalf("subscribe reply = %v", msg)
+	}
+
+	feed.publish(sessionEvent{Type: "output", Text: "hello\n", OutputType: 2})
+	msg := read()
+	params, _ := msg["params"].(map[string]any)
+	if msg["method"] != "event" || params["type"] != "output" || params["text"] != "hello\n" {
+		t.Errorf("event = %v", msg)
+	}
+
+	client.Write([]byte(`{"jsonrpc":"2.0","id":2,"method":"unsubscribe"}` + "\n"))
+	if msg := read(); msg["id"] != 2.0 {
+		t.Fatalf("unsubscribe reply = %v", msg)
+	}
+	feed.mu.Lock()
+	n := len(feed.subs)
+	feed.mu.Unlock()
+	if n != 0 {
+		t.Errorf("%d subscribers left after unsubscribe", n)
+	}
+}
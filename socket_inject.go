@@ -1,31 +1,86 @@
 package main
 
 import (
-	"bufio"
+	"context"
 	"fmt"
 	"net"
-	"os"
-	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	tea "github.com/charmbracelet/bubbletea"
+	"github.com/cursork/gritt/prepl"
+	"github.com/cursork/gritt/sockserve"
 )
 
-// TODO: this is hoisted out of a more complete implementation (the one aplsock
-//       uses) - it may be the case we need to unify the two, or at least
-//       ensure no divergence in behaviour.
-
 // socketRequest is a single line injected via -sock. The reader goroutine
 // owns the connection and blocks on done until the TUI finishes the Execute;
 // the result then gets written back to the connection.
 //
 // outputs accumulates AppendSessionOutput chunks for this request. It is
 // only appended to while m.activeSocket == this request, so the request
-// itself owns its captured output — no parallel buffer in the Model.
+// itself owns its captured output — no parallel buffer in the Model. The
+// Model closes done when it has finished with the request; the fields are
+// the reader's to use after that.
 type socketRequest struct {
-	code    string
-	outputs []string
-	done    chan string
+	code     string
+	quiet    bool // Keep out of the on-screen session (e.g. name listings)
+	outputs  []socketOutput
+	en       int   // Error number from HadError, if the code failed
+	err      error // Set if the Execute couldn't be sent
+	queued   time.Time
+	started  time.Time
+	finished time.Time
+	position chan int // Queue position updates; nil if nobody is listening
+	done     chan struct{}
+}
+
+// socketOutput is one chunk of session output captured for a request.
+type socketOutput struct {
+	text  string
+	error bool // Error message (output type 5)
+}
+
+func newSocketRequest(code string) *socketRequest {
+	return &socketRequest{code: code, queued: time.Now(), done: make(chan struct{})}
+}
+
+// output joins the captured output, with or without error messages.
+func (r *socketRequest) output(withErrors bool) string {
+	var sb strings.Builder
+	for _, o := range r.outputs {
+		if withErrors || !o.error {
+			sb.WriteString(o.text)
+		}
+	}
+	return sb.String()
+}
+
+// errorLines returns the error message lines (⎕DM), or nil if none.
+func (r *socketRequest) errorLines() []string {
+	var lines []string
+	for _, o := range r.outputs {
+		if o.error {
+			lines = append(lines, strings.Split(strings.TrimSuffix(o.text, "\n"), "\n")...)
+		}
+	}
+	return lines
+}
+
+// setPosition reports the request's place in the queue, replacing any
+// update the reader hasn't picked up yet. Only the Model calls this.
+func (r *socketRequest) setPosition(n int) {
+	if r.position == nil {
+		return
+	}
+	select {
+	case <-r.position:
+	default:
+	}
+	select {
+	case r.position <- n:
+	default:
+	}
 }
 
 // socketLineMsg delivers a queued injection to the bubbletea program.
@@ -33,57 +88,144 @@ type socketLineMsg struct {
 	req *socketRequest
 }
 
-// parseSockAddr decides whether the -sock value is a Unix path or a TCP
-// address. Values containing '/' are paths; a bare integer becomes ":N";
-// anything else is passed through (`:9876`, `host:port`).
-func parseSockAddr(value string) (network, address string) {
-	if strings.Contains(value, "/") {
-		return "unix", value
+// socketInterruptMsg interrupts the interpreter on a client's behalf.
+type socketInterruptMsg struct {
+	strong bool
+}
+
+// socketEditMsg opens an editor on a name on a client's behalf.
+type socketEditMsg struct {
+	name string
+}
+
+// msgSender is the part of *tea.Program the socket handlers use.
+type msgSender interface {
+	Send(msg tea.Msg)
+}
+
+// startSocketServer opens the -sock listener. Each accepted connection
+// speaks proto: "lines" reads newline-delimited expressions, submits each
+// to the TUI via socketLineMsg and writes back its result in mode (see
+// socketEvaluator); "jsonrpc" is described in socket_jsonrpc.go. jsonrpc
+// clients can subscribe to session events from feed.
+func startSocketServer(addr, proto string, mode sockserve.Mode, p msgSender, feed *sessionFeed) (*sockserve.Server, error) {
+	var h sockserve.Handler
+	switch proto {
+	case "", "lines":
+		h = sockserve.Lines(&socketEvaluator{p: p, mode: mode})
+	case "jsonrpc":
+		if mode != sockserve.Plain {
+			return nil, fmt.Errorf("-sock-mode %s needs -sock-proto lines", mode)
+		}
+		h = sockserve.HandlerFunc(func(ctx context.Context, conn net.Conn) {
+			handleJSONRPCConn(ctx, conn, p, feed)
+		})
+	default:
+		return nil, fmt.Errorf("unknown -sock-proto %q (want lines or jsonrpc)", proto)
 	}
-	if _, err := strconv.Atoi(value); err == nil {
-		return "tcp", ":" + value
+	srv := sockserve.New(h)
+	if _, err := srv.Listen(addr); err != nil {
+		return nil, err
 	}
-	return "tcp", value
+	return srv, nil
+}
+
+// socketEvaluator runs lines-protocol expressions in the TUI's session.
+//
+// In plain mode the reply is the session output, errors included, and the
+// expression and its output are mirrored on screen. In aplan and aplor
+// modes the expression runs quietly through ⎕SE.Prepl.EvalAs and the reply
+// is the response line an aplsock server in that mode would send; the
+// prepl namespace is fixed into ⎕SE on first use.
+type socketEvaluator struct {
+	p    msgSender
+	mode sockserve.Mode
+
+	mu    sync.Mutex // Serialises fixing the prepl
+	fixed bool
 }
 
-// startSocketListener opens a listener and spawns the accept loop. Each
-// accepted connection gets its own goroutine that reads newline-delimited
-// expressions, submits each to the TUI via socketLineMsg, blocks on the
-// response, and writes it back to the connection.
-func startSocketListener(network, address string, p *tea.Program) (net.Listener, error) {
-	if network == "unix" {
-		_ = os.Remove(address) // stale socket would block Listen
+func (e *socketEvaluator) Eval(ctx context.Context, expr string) (string, error) {
+	if e.mode == sockserve.Plain {
+		req, err := e.run(ctx, newSocketRequest(expr))
+		if err != nil {
+			return "", err
+		}
+		if req.err != nil {
+			return fmt.Sprintf("send failed: %v\n", req.err), nil
+		}
+		return req.output(true), nil
 	}
-	l, err := net.Listen(network, address)
-	if err != nil {
-		return nil, fmt.Errorf("listen %s %s: %w", network, address, err)
-	}
-	go func() {
-		for {
-			conn, err := l.Accept()
-			if err != nil {
-				return
-			}
-			go handleSocketConn(conn, p)
+
+	// EvalAs traps every error in expr, so session errors mean the prepl
+	// isn't there — never fixed, or lost with ⎕SE. Fix it and try again.
+	for attempt := 0; ; attempt++ {
+		if err := e.ensurePrepl(ctx, attempt > 0); err != nil {
+			return "", err
 		}
-	}()
-	return l, nil
-}
-
-func handleSocketConn(conn net.Conn, p *tea.Program) {
-	defer conn.Close()
-	sc := bufio.NewScanner(conn)
-	sc.Buffer(make([]byte, 64*1024), 1024*1024)
-	for sc.Scan() {
-		line := strings.TrimRight(sc.Text(), "\r")
-		if strings.TrimSpace(line) == "" {
-			continue
+		req := newSocketRequest(prepl.EvalAsExpr(string(e.mode), expr, prepl.EvalAsWidth))
+		req.quiet = true
+		req, err := e.run(ctx, req)
+		if err != nil {
+			return "", err
 		}
-		req := &socketRequest{code: line, done: make(chan string, 1)}
-		p.Send(socketLineMsg{req: req})
-		reply := <-req.done
-		if _, err := conn.Write([]byte(reply)); err != nil {
-			return // client gone
+		if req.err != nil {
+			return "", req.err
 		}
+		if req.errorLines() == nil || attempt > 0 {
+			return evalAsReply(req.output(true)), nil
+		}
+	}
+}
+
+// evalAsReply turns the session output of prepl.EvalAsExpr into a reply
+// as a prepl server sends it: an out line for each line the expression
+// displayed itself, then the response. Output without a response (the
+// prepl missing even after fixing) is passed on as one line.
+func evalAsReply(output string) string {
+	response, display, ok := prepl.SplitEvalAs(output)
+	if !ok {
+		return strings.ReplaceAll(output, "\n", "")
+	}
+	var sb strings.Builder
+	for _, line := range display {
+		sb.WriteString(prepl.FormatOut(line, "") + "\n")
+	}
+	return sb.String() + response
+}
+
+// ensurePrepl fixes the prepl namespace into ⎕SE unless that has already
+// been done; again forces it.
+func (e *socketEvaluator) ensurePrepl(ctx context.Context, again bool) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.fixed && !again {
+		return nil
+	}
+	req := newSocketRequest(prepl.FixExpr())
+	req.quiet = true
+	req, err := e.run(ctx, req)
+	if err != nil {
+		return err
+	}
+	if req.err != nil {
+		return req.err
+	}
+	if dm := req.errorLines(); dm != nil {
+		return fmt.Errorf("load prepl: %s", strings.Join(dm, "; "))
+	}
+	e.fixed = true
+	return nil
+}
+
+// run queues req with the TUI and waits for it to finish. If ctx ends
+// first the request still runs, but nobody reads its result.
+func (e *socketEvaluator) run(ctx context.Context, req *socketRequest) (*socketRequest, error) {
+	e.p.Send(socketLineMsg{req: req})
+	select {
+	case <-req.done:
+		return req, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
 	}
 }
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/cursork/gritt/prepl"
+	"github.com/cursork/gritt/sockserve"
+)
+
+// preplTUI stands in for the TUI running socket requests against an
+// interpreter with or without ⎕SE.Prepl.
+type preplTUI struct {
+	mu    sync.Mutex
+	fixed bool
+	codes []string
+	quiet []bool
+}
+
+func (f *preplTUI) Send(msg tea.Msg) {
+	req := msg.(socketLineMsg).req
+	f.mu.Lock()
+	f.codes = append(f.codes, req.code)
+	f.quiet = append(f.quiet, req.quiet)
+	switch {
+	case req.code == prepl.FixExpr():
+		f.fixed = true
+	case !strings.Contains(req.code, "⎕SE.Prepl.EvalAs"):
+		req.outputs = []socketOutput{{text: "3\n"}}
+	case !f.fixed:
+		req.outputs = []socketOutput{{text: "VALUE ERROR: Undefined name: Prepl\n", error: true}}
+	case strings.Contains(req.code, "}'⎕←"):
+		// Displayed by the expression, ahead of the response
+		req.outputs = []socketOutput{{text: "hi\n"}, {text: "it's\n"}, {text: "⍝PREPL← (tag: 'ret' ⋄ val: 3)\n"}}
+	default:
+		// A long response, printed in chunks
+		req.outputs = []socketOutput{{text: "⍝PREPL← (tag: 'ret' ⋄ \n"}, {text: "⍝PREPL← val: 3)\n"}}
+	}
+	f.mu.Unlock()
+	close(req.done)
+}
+
+func TestSocketEvaluatorPlain(t *testing.T) {
+	tui := &preplTUI{}
+	ev := &socketEvaluator{p: tui, mode: sockserve.Plain}
+	got, err := ev.Eval(context.Background(), "1+2")
+	if err != nil || got != "3\n" {
+		t.Fatalf("Eval = %q, %v", got, err)
+	}
+	if len(tui.codes) != 1 || tui.codes[0] != "1+2" || tui.quiet[0] {
+		t.Errorf("sent %q quiet=%v", tui.codes, tui.quiet)
+	}
+}
+
+func TestSocketEvaluatorAPLAN(t *testing.T) {
+	tui := &preplTUI{}
+	ev := &socketEvaluator{p: tui, mode: sockserve.APLAN}
+	for i := 0; i < 2; i++ {
+		got, err := ev.Eval(context.Background(), "1+2")
+		if err != nil || got != "(tag: 'ret' ⋄ val: 3)" {
+			t.Fatalf("Eval = %q, %v", got, err)
+		}
+	}
+	// The prepl is fixed once, and nothing shows in the session
+	if len(tui.codes) != 3 || tui.codes[0] != prepl.FixExpr() {
+		t.Errorf("sent %d requests, first %.20q", len(tui.codes), tui.codes[0])
+	}
+	for i, q := range tui.quiet {
+		if !q {
+			t.Errorf("request %d not quiet", i)
+		}
+	}
+	if want := prepl.EvalAsExpr("aplan", "1+2", prepl.EvalAsWidth); tui.codes[1] != want {
+		t.Errorf("eval code = %q, want %q", tui.codes[1], want)
+	}
+}
+
+func TestSocketEvaluatorOutput(t *testing.T) {
+	ev := &socketEvaluator{p: &preplTUI{}, mode: sockserve.APLAN}
+	got, err := ev.Eval(context.Background(), "⎕←'hi' ⋄ 1+2")
+	want := "(tag: 'out' ⋄ val: 'hi')\n(tag: 'out' ⋄ val: 'it''s')\n(tag: 'ret' ⋄ val: 3)"
+	if err != nil || got != want {
+		t.Fatalf("Eval = %q, %v; want %q", got, err, want)
+	}
+	resp, err := prepl.ParseResponse(strings.Split(got, "\n")[1])
+	if err != nil || resp.Tag != "out" || resp.Out[0] != "it's" {
+		t.Errorf("out line parses as %+v, %v", resp, err)
+	}
+}
+
+func TestSocketEvaluatorRefixes(t *testing.T) {
+	tui := &preplTUI{}
+	ev := &socketEvaluator{p: tui, mode: sockserve.APLOR}
+	ev.fixed = true // but the interpreter has lost it
+	got, err := ev.Eval(context.Background(), "1+2")
+	if err != nil || got != "(tag: 'ret' ⋄ val: 3)" {
+		t.Fatalf("Eval = %q, %v", got, err)
+	}
+	if len(tui.codes) != 3 || tui.codes[1] != prepl.FixExpr() {
+		t.Errorf("sent %d requests; want eval, fix, eval", len(tui.codes))
+	}
+}
+
+func TestStartSocketServerRejectsModeWithJSONRPC(t *testing.T) {
+	if _, err := startSocketServer("127.0.0.1:0", "jsonrpc", sockserve.APLAN, &preplTUI{}, nil); err == nil {
+		t.Error("want error for -sock-mode aplan with -sock-proto jsonrpc")
+	}
+}
@@ -0,0 +1,276 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"net"
+	"strings"
+	"sync"
+)
+
+// The jsonrpc -sock protocol is JSON-RPC 2.0, one message per line in each
+// direction. Requests may be pipelined: each reply carries its request's
+// id, so an interrupt can be sent while an eval is still waiting.
+//
+//	eval      {"code": "1+2"}     → {"output": "3\n", "error": {"en": 11, "dm": [...]}, "queued_ms": 0, "run_ms": 2}
+//	interrupt {"strong": false}   → {}
+//	edit      {"name": "#.foo"}   → {} (opens an editor in the TUI)
+//	names     {"ns": "#"}         → [{"name": "foo", "class": 3.1}, ...]
+//	subscribe   {}                → {}, then "event" notifications
+//	unsubscribe {}                → {}
+//
+// An APL error is not a JSON-RPC error: the eval succeeds and its result
+// carries "error". While an eval or names request waits for the TUI to go
+// idle, gritt sends {"method": "queued", "params": {"id": ..., "position": n}}
+// notifications as its place in the queue changes.
+//
+// A subscribed connection is sent every session event — input from any
+// source, output, prompt changes, windows opening and closing, tracer
+// windows moving to another line or function — as
+// {"method": "event", "params": {"type": "output", "text": ...}}; see
+// sessionEvent. It can still make requests.
+
+// JSON-RPC error codes
+const (
+	rpcParseError     = -32700
+	rpcInvalidRequest = -32600
+	rpcMethodNotFound = -32601
+	rpcInvalidParams  = -32602
+	rpcSendFailed     = -32000 // Couldn't send to the interpreter
+)
+
+type rpcRequest struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+type rpcResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  any             `json:"result,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+}
+
+type rpcNotification struct {
+	JSONRPC string `json:"jsonrpc"`
+	Method  string `json:"method"`
+	Params  any    `json:"params"`
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// rpcEvalResult is the result of an eval request
+type rpcEvalResult struct {
+	Output   string       `json:"output"`
+	Error    *rpcAPLError `json:"error,omitempty"`
+	QueuedMS int64        `json:"queued_ms"` // Waiting for the TUI to go idle
+	RunMS    int64        `json:"run_ms"`    // Execute to prompt
+}
+
+// rpcAPLError describes an APL error: ⎕EN and ⎕DM
+type rpcAPLError struct {
+	EN int      `json:"en"`
+	DM []string `json:"dm"`
+}
+
+// rpcName is one entry in a names result
+type rpcName struct {
+	Name  string  `json:"name"`
+	Class float64 `json:"class"`
+}
+
+// rpcConn serialises writes to a connection shared by concurrent replies
+type rpcConn struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+	ctx context.Context // Cancelled when the server stops
+}
+
+func (c *rpcConn) write(v any) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.enc.Encode(v) // a failed write shows up as EOF on the reader
+}
+
+// reply answers a request. Notifications (no id) get no reply.
+func (c *rpcConn) reply(id json.RawMessage, result any, rerr *rpcError) {
+	if id == nil && rerr == nil {
+		return
+	}
+	if id == nil {
+		id = json.RawMessage("null")
+	}
+	if rerr == nil && result == nil {
+		result = struct{}{}
+	}
+	c.write(rpcResponse{JSONRPC: "2.0", ID: id, Result: result, Error: rerr})
+}
+
+func handleJSONRPCConn(ctx context.Context, conn net.Conn, p msgSender, feed *sessionFeed) {
+	c := &rpcConn{enc: json.NewEncoder(conn), ctx: ctx}
+	var pending sync.WaitGroup
+	var events chan sessionEvent // non-nil while subscribed
+	defer func() {
+		if events != nil {
+			feed.unsubscribe(events)
+		}
+		pending.Wait()
+		conn.Close()
+	}()
+
+	sc := bufio.NewScanner(conn)
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+	for sc.Scan() {
+		line := bytes.TrimSpace(sc.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var req rpcRequest
+		if err := json.Unmarshal(line, &req); err != nil {
+			c.reply(nil, nil, &rpcError{Code: rpcParseError, Message: err.Error()})
+			continue
+		}
+		if req.JSONRPC != "2.0" || req.Method == "" {
+			c.reply(req.ID, nil, &rpcError{Code: rpcInvalidRequest, Message: `want "jsonrpc": "2.0" and a method`})
+			continue
+		}
+
+		var params struct {
+			Code   string `json:"code"`
+			Strong bool   `json:"strong"`
+			Name   string `json:"name"`
+			NS     string `json:"ns"`
+		}
+		if len(req.Params) > 0 {
+			if err := json.Unmarshal(req.Params, &params); err != nil {
+				c.reply(req.ID, nil, &rpcError{Code: rpcInvalidParams, Message: err.Error()})
+				continue
+			}
+		}
+
+		switch req.Method {
+		case "eval":
+			if strings.TrimSpace(params.Code) == "" || strings.ContainsAny(params.Code, "\r\n") {
+				c.reply(req.ID, nil, &rpcError{Code: rpcInvalidParams, Message: "eval needs a single line of code"})
+				continue
+			}
+			sreq := c.submit(req.ID, newSocketRequest(params.Code), p)
+			pending.Add(1)
+			go func() {
+				defer pending.Done()
+				c.await(req.ID, sreq, func() any {
+					res := rpcEvalResult{
+						Output:   sreq.output(false),
+						QueuedMS: sreq.started.Sub(sreq.queued).Milliseconds(),
+						RunMS:    sreq.finished.Sub(sreq.started).Milliseconds(),
+					}
+					if dm := sreq.errorLines(); dm != nil {
+						res.Error = &rpcAPLError{EN: sreq.en, DM: dm}
+					}
+					return res
+				})
+			}()
+
+		case "names":
+			ns := params.NS
+			if ns == "" {
+				ns = "#"
+			}
+			sreq := newSocketRequest(workspaceListExpr(ns))
+			sreq.quiet = true
+			c.submit(req.ID, sreq, p)
+			pending.Add(1)
+			go func() {
+				defer pending.Done()
+				c.await(req.ID, sreq, func() any {
+					entries, _, _ := parseWorkspaceEntries([]string{sreq.output(false)})
+					names := make([]rpcName, len(entries))
+					for i, e := range entries {
+						names[i] = rpcName{Name: e.Name, Class: e.Class}
+					}
+					return names
+				})
+			}()
+
+		case "interrupt":
+			p.Send(socketInterruptMsg{strong: params.Strong})
+			c.reply(req.ID, nil, nil)
+
+		case "edit":
+			if params.Name == "" {
+				c.reply(req.ID, nil, &rpcError{Code: rpcInvalidParams, Message: "edit needs a name"})
+				continue
+			}
+			p.Send(socketEditMsg{name: params.Name})
+			c.reply(req.ID, nil, nil)
+
+		case "subscribe":
+			if feed == nil {
+				c.reply(req.ID, nil, &rpcError{Code: rpcMethodNotFound, Message: "subscriptions are not available"})
+				continue
+			}
+			if events != nil {
+				c.reply(req.ID, nil, nil) // already subscribed
+				continue
+			}
+			// Subscribe before replying so that nothing after the reply is
+			// missed, but only start sending events once it is written.
+			events = feed.subscribe()
+			c.reply(req.ID, nil, nil)
+			pending.Add(1)
+			go func(events chan sessionEvent) {
+				defer pending.Done()
+				for ev := range events {
+					c.write(rpcNotification{JSONRPC: "2.0", Method: "event", Params: ev})
+				}
+			}(events)
+
+		case "unsubscribe":
+			if events != nil {
+				feed.unsubscribe(events)
+				events = nil
+			}
+			c.reply(req.ID, nil, nil)
+
+		default:
+			c.reply(req.ID, nil, &rpcError{Code: rpcMethodNotFound, Message: "unknown method " + req.Method})
+		}
+	}
+}
+
+// submit queues sreq with the TUI. It is called from the reader loop so
+// that requests run in the order they arrived.
+func (c *rpcConn) submit(id json.RawMessage, sreq *socketRequest, p msgSender) *socketRequest {
+	if id != nil {
+		sreq.position = make(chan int, 1)
+	}
+	p.Send(socketLineMsg{req: sreq})
+	return sreq
+}
+
+// await reports sreq's queue position until it has run, then replies with
+// result(). It gives up without replying if the server stops.
+func (c *rpcConn) await(id json.RawMessage, sreq *socketRequest, result func() any) {
+	for {
+		select {
+		case n := <-sreq.position:
+			c.write(rpcNotification{JSONRPC: "2.0", Method: "queued", Params: map[string]any{"id": id, "position": n}})
+		case <-c.ctx.Done():
+			return
+		case <-sreq.done:
+			if sreq.err != nil {
+				c.reply(id, nil, &rpcError{Code: rpcSendFailed, Message: sreq.err.Error()})
+				return
+			}
+			c.reply(id, result(), nil)
+			return
+		}
+	}
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// fakeTUI stands in for the bubbletea program: it runs socket requests
+// immediately with canned output and records everything else.
+type fakeTUI struct {
+	mu   sync.Mutex
+	msgs []tea.Msg
+}
+
+func (f *fakeTUI) Send(msg tea.Msg) {
+	f.mu.Lock()
+	f.msgs = append(f.msgs, msg)
+	f.mu.Unlock()
+
+	lm, ok := msg.(socketLineMsg)
+	if !ok {
+		return
+	}
+	req := lm.req
+	req.setPosition(1)
+	req.started = time.Now()
+	switch req.code {
+	case "1÷0":
+		req.outputs = []socketOutput{{text: "DOMAIN ERROR: Divide by zero\n      1÷0\n       ∧\n", error: true}}
+		req.en = 11
+	case workspaceListExpr("#"):
+		req.outputs = []socketOutput{{text: "foo 3.1\n"}, {text: "x 2.1\n"}}
+	default:
+		req.outputs = []socketOutput{{text: "3\n"}}
+	}
+	req.finished = time.Now()
+	close(req.done)
+}
+
+func TestJSONRPCSocket(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	tui := &fakeTUI{}
+	go handleJSONRPCConn(context.Background(), server, tui, nil)
+
+	rd := bufio.NewReader(client)
+	call := func(line string) map[string]any {
+		t.Helper()
+		client.SetDeadline(time.Now().Add(5 * time.Second))
+		if _, err := client.Write([]byte(line + "\n")); err != nil {
+			t.Fatal(err)
+		}
+		for {
+			reply, err := rd.ReadBytes('\n')
+			if err != nil {
+				t.Fatalf("reading reply to %s: %v", line, err)
+			}
+			var msg map[string]any
+			if err := json.Unmarshal(reply, &msg); err != nil {
+				t.Fatalf("bad reply %s: %v", reply, err)
+			}
+			if msg["method"] == "queued" {
+				continue
+			}
+			return msg
+		}
+	}
+
+	got := call(`{"jsonrpc":"2.0","id":1,"method":"eval","params":{"code":"1+2"}}`)
+	if got["id"] != 1.0 || got["result"].(map[string]any)["output"] != "3\n" {
+		t.Errorf("eval reply = %v", got)
+	}
+
+	got = call(`{"jsonrpc":"2.0","id":"e","method":"eval","params":{"code":"1÷0"}}`)
+	res := got["result"].(map[string]any)
+	aplErr, _ := res["error"].(map[string]any)
+	if got["id"] != "e" || res["output"] != "" || aplErr == nil || aplErr["en"] != 11.0 {
+		t.Fatalf("error reply = %v", got)
+	}
+	if dm := aplErr["dm"].([]any); len(dm) != 3 || dm[0] != "DOMAIN ERROR: Divide by zero" {
+		t.Errorf("dm = %q", dm)
+	}
+
+	got = call(`{"jsonrpc":"2.0","id":2,"method":"names"}`)
+	want := []any{
+		map[string]any{"name": "foo", "class": 3.1},
+		map[string]any{"name": "x", "class": 2.1},
+	}
+	if !reflect.DeepEqual(got["result"], want) {
+		t.Errorf("names = %v", got["result"])
+	}
+
+	got = call(`{"jsonrpc":"2.0","id":3,"method":"interrupt","params":{"strong":true}}`)
+	if _, ok := got["result"]; !ok {
+		t.Errorf("interrupt reply = %v", got)
+	}
+
+	for line, code := range map[string]float64{
+		`not json`: rpcParseError,
+		`{"jsonrpc":"2.0","id":4,"method":"frobnicate"}`:                    rpcMethodNotFound,
+		`{"jsonrpc":"2.0","id":5,"method":"eval","params":{"code":"a\nb"}}`: rpcInvalidParams,
+		`{"id":6,"method":"eval"}`:                                          rpcInvalidRequest,
+	} {
+		got = call(line)
+		if e, _ := got["error"].(map[string]any); e == nil || e["code"] != code {
+			t.Errorf("%s: reply = %v, want error %v", line, got, code)
+		}
+	}
+
+	tui.mu.Lock()
+	defer tui.mu.Unlock()
+	var interrupts []socketInterruptMsg
+	for _, msg := range tui.msgs {
+		if im, ok := msg.(socketInterruptMsg); ok {
+			interrupts = append(interrupts, im)
+		}
+	}
+	if len(interrupts) != 1 || !interrupts[0].strong {
+		t.Errorf("interrupts = %v", interrupts)
+	}
+}
+
+func TestJSONRPCQueuedNotification(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	go handleJSONRPCConn(context.Background(), server, &fakeTUI{}, nil)
+
+	client.SetDeadline(time.Now().Add(5 * time.Second))
+	if _, err := client.Write([]byte(`{"jsonrpc":"2.0","id":7,"method":"eval","params":{"code":"1+2"}}` + "\n")); err != nil {
+		t.Fatal(err)
+	}
+	// The fake reports position 1 before finishing; await may see either
+	// first, so accept the notification if it comes but require the reply.
+	rd := bufio.NewReader(client)
+	for {
+		line, err := rd.ReadBytes('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		var msg map[string]any
+		json.Unmarshal(line, &msg)
+		if msg["method"] == "queued" {
+			params := msg["params"].(map[string]any)
+			if params["id"] != 7.0 || params["position"] != 1.0 {
+				t.Errorf("queued notification = %v", msg)
+			}
+			continue
+		}
+		if msg["id"] != 7.0 {
+			t.Errorf("reply = %v", msg)
+		}
+		return
+	}
+}
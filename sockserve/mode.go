@@ -0,0 +1,124 @@
+package sockserve
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/cursork/gritt/prepl"
+)
+
+// Mode is the form results are sent back in.
+type Mode string
+
+const (
+	// Plain sends display text, for people at netcat or telnet.
+	Plain Mode = "plain"
+	// APLAN sends one prepl response line per expression, with values
+	// in APL Array Notation: (tag: 'ret' ⋄ val: 1 2 3).
+	APLAN Mode = "aplan"
+	// APLOR sends the same response serialised with 220⌶, as a line of
+	// signed bytes, for exact round-trips (functions included).
+	APLOR Mode = "aplor"
+)
+
+// ParseMode checks a mode name from a flag.
+func ParseMode(s string) (Mode, error) {
+	switch m := Mode(s); m {
+	case Plain, APLAN, APLOR:
+		return m, nil
+	}
+	return "", fmt.Errorf("unknown mode %q (want plain, aplan or aplor)", s)
+}
+
+// PlainText renders a prepl response as Plain mode shows it: any output
+// lines, then the value's APLAN, the error message and ⎕DM, or INTERRUPT.
+func PlainText(resp *prepl.Response) string {
+	var sb strings.Builder
+	for _, line := range resp.Out {
+		sb.WriteString(line + "\n")
+	}
+	switch resp.Tag {
+	case "ret":
+		if resp.Raw != "" {
+			sb.WriteString(resp.Raw + "\n")
+		}
+	case "err":
+		sb.WriteString(resp.Err.Message + "\n")
+		for _, line := range resp.Err.DM {
+			sb.WriteString(line + "\n")
+		}
+	case "interrupted":
+		sb.WriteString("INTERRUPT\n")
+	}
+	return sb.String()
+}
+
+// Prepl returns an Evaluator that sends expressions to a prepl server. In
+// APLAN and APLOR modes the server's response lines are passed through
+// untouched — which of the two forms they take depends on the server's
+// own mode, set with Prepl.SetMode — after any out lines (always APLAN;
+// see prepl.Client.CaptureOutput), and in Plain mode they are decoded
+// with PlainText.
+// Connections sharing a client take turns; give each its own for them to
+// run side by side.
+//
+// An expression still running when ctx is done is interrupted, and
+// answered as such; see Timeout for a limit per expression. The Evaluator
+// is an Interrupter too: a client's ⍝PREPL interrupt lines go straight to
+// the server rather than waiting their turn.
+func Prepl(c *prepl.Client, mode Mode) Evaluator {
+	return preplEvaluator{c, mode}
+}
+
+type preplEvaluator struct {
+	c    *prepl.Client
+	mode Mode
+}
+
+func (p preplEvaluator) Eval(ctx context.Context, expr string) (string, error) {
+	if p.mode != Plain {
+		return p.c.EvalRawContext(ctx, expr)
+	}
+	resp, err := p.c.EvalContext(ctx, expr)
+	if err != nil {
+		return "", err
+	}
+	return PlainText(resp), nil
+}
+
+func (p preplEvaluator) Interrupt(line string) bool {
+	id, ok := strings.CutPrefix(line, "⍝PREPL interrupt")
+	if !ok {
+		return false
+	}
+	p.c.Interrupt(strings.TrimSpace(id))
+	return true
+}
+
+// Timeout limits each of ev's evaluations to d, by cancelling the context
+// it is given; with Prepl, an expression that overruns is interrupted.
+// d ≤ 0 means no limit. If ev is an Interrupter, so is the result.
+func Timeout(ev Evaluator, d time.Duration) Evaluator {
+	if d <= 0 {
+		return ev
+	}
+	return timeout{ev, d}
+}
+
+type timeout struct {
+	ev Evaluator
+	d  time.Duration
+}
+
+func (t timeout) Eval(ctx context.Context, expr string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, t.d)
+	defer cancel()
+	return t.ev.Eval(ctx, expr)
+}
+
+func (t timeout) Interrupt(line string) bool {
+	in, ok := t.ev.(Interrupter)
+	return ok && in.Interrupt(line)
+}
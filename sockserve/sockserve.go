@@ -0,0 +1,285 @@
+// Package sockserve serves APL evaluation over TCP and Unix sockets. It is
+// shared by gritt's -sock listener, which evaluates in the TUI's session,
+// and grittles/aplsock, which evaluates through a prepl server.
+//
+// A Server owns the listeners and connections and shuts them down
+// gracefully; a Handler speaks the protocol on each connection. Lines is
+// the plain line protocol: one expression per line in, one reply per
+// expression out, in order.
+package sockserve
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrServerClosed is returned by Serve and Listen after Shutdown or Close.
+var ErrServerClosed = errors.New("sockserve: server closed")
+
+// ParseAddr decides whether a socket address is a Unix path or a TCP
+// address. Values containing '/' are paths; a bare integer becomes ":N";
+// anything else is passed through (`:9876`, `host:port`).
+func ParseAddr(value string) (network, address string) {
+	if strings.Contains(value, "/") {
+		return "unix", value
+	}
+	if _, err := strconv.Atoi(value); err == nil {
+		return "tcp", ":" + value
+	}
+	return "tcp", value
+}
+
+// Handler serves one client connection. ServeConn returns when the client
+// has gone or ctx is cancelled; the Server closes conn afterwards.
+//
+// When the Server shuts down it sets a past read deadline on conn, so a
+// Handler sees its next read fail. It should then finish the requests it
+// has already read and return.
+type Handler interface {
+	ServeConn(ctx context.Context, conn net.Conn)
+}
+
+// HandlerFunc adapts a function to a Handler.
+type HandlerFunc func(ctx context.Context, conn net.Conn)
+
+func (f HandlerFunc) ServeConn(ctx context.Context, conn net.Conn) { f(ctx, conn) }
+
+// Server accepts connections and hands each to its Handler in its own
+// goroutine.
+type Server struct {
+	handler Handler
+
+	mu        sync.Mutex
+	listeners map[net.Listener]struct{}
+	conns     map[net.Conn]struct{}
+	closed    bool
+	active    sync.WaitGroup // ServeConn calls
+	ctx       context.Context
+	cancel    context.CancelFunc
+}
+
+// New returns a Server that serves connections with h.
+func New(h Handler) *Server {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Server{
+		handler:   h,
+		listeners: make(map[net.Listener]struct{}),
+		conns:     make(map[net.Conn]struct{}),
+		ctx:       ctx,
+		cancel:    cancel,
+	}
+}
+
+// Listen opens a listener on value, as parsed by ParseAddr, and serves it
+// in the background. A stale Unix socket file at the path is removed
+// first; the file is removed again when the listener is closed.
+func (s *Server) Listen(value string) (net.Listener, error) {
+	network, address := ParseAddr(value)
+	if network == "unix" {
+		_ = os.Remove(address) // stale socket would block Listen
+	}
+	l, err := net.Listen(network, address)
+	if err != nil {
+		return nil, fmt.Errorf("listen %s %s: %w", network, address, err)
+	}
+	if !s.track(l) {
+		l.Close()
+		return nil, ErrServerClosed
+	}
+	go s.serve(l)
+	return l, nil
+}
+
+// Serve accepts connections on l until it is closed, and always returns a
+// non-nil error: ErrServerClosed after Shutdown or Close.
+func (s *Server) Serve(l net.Listener) error {
+	if !s.track(l) {
+		l.Close()
+		return ErrServerClosed
+	}
+	return s.serve(l)
+}
+
+func (s *Server) track(l net.Listener) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return false
+	}
+	s.listeners[l] = struct{}{}
+	return true
+}
+
+func (s *Server) serve(l net.Listener) error {
+	defer func() {
+		s.mu.Lock()
+		delete(s.listeners, l)
+		s.mu.Unlock()
+		l.Close()
+	}()
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			s.mu.Lock()
+			closed := s.closed
+			s.mu.Unlock()
+			if closed {
+				return ErrServerClosed
+			}
+			return err
+		}
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			conn.Close()
+			return ErrServerClosed
+		}
+		s.conns[conn] = struct{}{}
+		s.active.Add(1)
+		s.mu.Unlock()
+
+		go func() {
+			defer func() {
+				conn.Close()
+				s.mu.Lock()
+				delete(s.conns, conn)
+				s.mu.Unlock()
+				s.active.Done()
+			}()
+			s.handler.ServeConn(s.ctx, conn)
+		}()
+	}
+}
+
+// Shutdown stops accepting connections and stops reading from the open
+// ones, then waits for their handlers to finish the requests already
+// read. If ctx ends first, the handlers are cancelled, the connections
+// closed and ctx's error returned.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.mu.Lock()
+	s.closed = true
+	for l := range s.listeners {
+		l.Close()
+	}
+	for conn := range s.conns {
+		conn.SetReadDeadline(time.Now())
+	}
+	s.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		s.active.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		s.cancel()
+		return nil
+	case <-ctx.Done():
+		s.Close()
+		return ctx.Err()
+	}
+}
+
+// Close stops the server at once: listeners and connections are closed
+// and handlers cancelled without waiting for them.
+func (s *Server) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	s.cancel()
+	for l := range s.listeners {
+		l.Close()
+	}
+	for conn := range s.conns {
+		conn.Close()
+	}
+	return nil
+}
+
+// Evaluator evaluates one expression for a Lines client. The reply is
+// written back as is, with a newline added if it lacks one; an empty
+// reply writes nothing. An error ends the client's connection.
+type Evaluator interface {
+	Eval(ctx context.Context, expr string) (string, error)
+}
+
+// EvaluatorFunc adapts a function to an Evaluator.
+type EvaluatorFunc func(ctx context.Context, expr string) (string, error)
+
+func (f EvaluatorFunc) Eval(ctx context.Context, expr string) (string, error) { return f(ctx, expr) }
+
+// Interrupter is implemented by Evaluators that can stop an expression
+// early. Lines offers it each line as soon as it is read, ahead of the
+// queue; a line it takes (returning true) isn't evaluated.
+type Interrupter interface {
+	Interrupt(line string) bool
+}
+
+// queueSize is how many expressions a Lines connection reads ahead of the
+// one being evaluated.
+const queueSize = 64
+
+// Lines returns a Handler for the line protocol. Each connection has its
+// own queue: expressions are read as they arrive and evaluated one at a
+// time in order, so a client may pipeline several lines and read the
+// replies back in the same order. Blank lines are ignored, and lines an
+// Interrupter takes are acted on at once.
+//
+// When the client closes its end (or the Server shuts down), the
+// expressions already read are still evaluated and answered.
+func Lines(ev Evaluator) Handler {
+	in, _ := ev.(Interrupter)
+	return HandlerFunc(func(ctx context.Context, conn net.Conn) {
+		queue := make(chan string, queueSize)
+		stop := make(chan struct{}) // the reader must not outlive us
+		defer close(stop)
+		go func() {
+			defer close(queue)
+			sc := bufio.NewScanner(conn)
+			sc.Buffer(make([]byte, 64*1024), 1024*1024)
+			for sc.Scan() {
+				line := strings.TrimRight(sc.Text(), "\r")
+				if strings.TrimSpace(line) == "" || in != nil && in.Interrupt(line) {
+					continue
+				}
+				select {
+				case queue <- line:
+				case <-stop:
+					return
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+
+		w := bufio.NewWriter(conn)
+		for expr := range queue {
+			reply, err := ev.Eval(ctx, expr)
+			if err != nil {
+				w.Flush() // earlier replies still count
+				return
+			}
+			if reply != "" && !strings.HasSuffix(reply, "\n") {
+				reply += "\n"
+			}
+			w.WriteString(reply)
+			// Hold replies back while more are queued: a pipelining
+			// client gets them in fewer writes.
+			if len(queue) == 0 {
+				if err := w.Flush(); err != nil {
+					return // client gone
+				}
+			}
+		}
+		w.Flush()
+	})
+}
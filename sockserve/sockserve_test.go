@@ -0,0 +1,292 @@
+package sockserve
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cursork/gritt/prepl"
+)
+
+func TestParseAddr(t *testing.T) {
+	for _, tt := range []struct{ in, network, address string }{
+		{"9876", "tcp", ":9876"},
+		{":9876", "tcp", ":9876"},
+		{"localhost:9876", "tcp", "localhost:9876"},
+		{"/tmp/apl.sock", "unix", "/tmp/apl.sock"},
+		{"./apl.sock", "unix", "./apl.sock"},
+	} {
+		network, address := ParseAddr(tt.in)
+		if network != tt.network || address != tt.address {
+			t.Errorf("ParseAddr(%q) = %q, %q; want %q, %q", tt.in, network, address, tt.network, tt.address)
+		}
+	}
+}
+
+func TestParseMode(t *testing.T) {
+	for _, s := range []string{"plain", "aplan", "aplor"} {
+		if m, err := ParseMode(s); err != nil || string(m) != s {
+			t.Errorf("ParseMode(%q) = %q, %v", s, m, err)
+		}
+	}
+	if _, err := ParseMode("json"); err == nil {
+		t.Error("ParseMode(json): want error")
+	}
+}
+
+func TestPlainText(t *testing.T) {
+	ret := &prepl.Response{Tag: "ret", Raw: "1 2 3"}
+	if got := PlainText(ret); got != "1 2 3\n" {
+		t.Errorf("ret = %q", got)
+	}
+	if got := PlainText(&prepl.Response{Tag: "ret"}); got != "" {
+		t.Errorf("void = %q", got)
+	}
+	errResp := &prepl.Response{Tag: "err", Err: &prepl.Error{Message: "DOMAIN ERROR", DM: []string{"DOMAIN ERROR", "      1÷0", "       ∧"}}}
+	if got := PlainText(errResp); got != "DOMAIN ERROR\nDOMAIN ERROR\n      1÷0\n       ∧\n" {
+		t.Errorf("err = %q", got)
+	}
+	out := &prepl.Response{Tag: "ret", Raw: "2", Out: []string{"step 1", ""}}
+	if got := PlainText(out); got != "step 1\n\n2\n" {
+		t.Errorf("out = %q", got)
+	}
+	stopped := &prepl.Response{Tag: "interrupted", Out: []string{"step 1"}}
+	if got := PlainText(stopped); got != "step 1\nINTERRUPT\n" {
+		t.Errorf("interrupted = %q", got)
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	slow := EvaluatorFunc(func(ctx context.Context, expr string) (string, error) {
+		if expr == "fast" {
+			return "done", nil
+		}
+		<-ctx.Done()
+		return "stopped", nil
+	})
+	ev := Timeout(slow, 20*time.Millisecond)
+	for expr, want := range map[string]string{"fast": "done", "slow": "stopped"} {
+		if got, err := ev.Eval(context.Background(), expr); got != want || err != nil {
+			t.Errorf("Eval(%s) = %q, %v; want %q", expr, got, err, want)
+		}
+	}
+	if got, err := Timeout(echo, 0).Eval(context.Background(), "x"); got != "X" || err != nil {
+		t.Errorf("no limit: %q, %v", got, err)
+	}
+}
+
+// echo replies with the expression, upper-cased.
+var echo = EvaluatorFunc(func(ctx context.Context, expr string) (string, error) {
+	return strings.ToUpper(expr), nil
+})
+
+func dial(t *testing.T, network, addr string) (net.Conn, *bufio.Reader) {
+	t.Helper()
+	conn, err := net.Dial(network, addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	return conn, bufio.NewReader(conn)
+}
+
+func TestLinesPipelined(t *testing.T) {
+	srv := New(Lines(echo))
+	defer srv.Close()
+	l, err := srv.Listen("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conn, rd := dial(t, "tcp", l.Addr().String())
+	// Several expressions in one write, a blank line, and a CRLF
+	if _, err := conn.Write([]byte("a\nb\n\nc\r\n")); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"A\n", "B\n", "C\n"} {
+		got, err := rd.ReadString('\n')
+		if err != nil || got != want {
+			t.Fatalf("got %q, %v; want %q", got, err, want)
+		}
+	}
+}
+
+func TestLinesHalfClose(t *testing.T) {
+	srv := New(Lines(echo))
+	defer srv.Close()
+	l, err := srv.Listen("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conn, rd := dial(t, "tcp", l.Addr().String())
+	conn.Write([]byte("x\ny\n"))
+	conn.(*net.TCPConn).CloseWrite()
+	rest, err := rd.ReadString(0)
+	if rest != "X\nY\n" {
+		t.Fatalf("after half-close got %q, %v", rest, err)
+	}
+}
+
+func TestLinesEvalErrorEndsConnection(t *testing.T) {
+	failing := EvaluatorFunc(func(ctx context.Context, expr string) (string, error) {
+		if expr == "bad" {
+			return "", errors.New("broken")
+		}
+		return expr, nil
+	})
+	srv := New(Lines(failing))
+	defer srv.Close()
+	l, err := srv.Listen("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conn, rd := dial(t, "tcp", l.Addr().String())
+	conn.Write([]byte("ok\nbad\nnever\n"))
+	rest, _ := rd.ReadString(0)
+	if rest != "ok\n" {
+		t.Errorf("got %q, want only the reply before the error", rest)
+	}
+}
+
+// stoppable evaluates "slow" until a "stop" line interrupts it.
+type stoppable struct{ stop chan struct{} }
+
+func (s stoppable) Eval(ctx context.Context, expr string) (string, error) {
+	if expr == "slow" {
+		<-s.stop
+		return "interrupted", nil
+	}
+	return expr, nil
+}
+
+func (s stoppable) Interrupt(line string) bool {
+	if line != "stop" {
+		return false
+	}
+	close(s.stop)
+	return true
+}
+
+func TestLinesInterrupt(t *testing.T) {
+	srv := New(Lines(Timeout(stoppable{make(chan struct{})}, time.Hour)))
+	defer srv.Close()
+	l, err := srv.Listen("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// stop overtakes slow, and isn't evaluated itself
+	conn, rd := dial(t, "tcp", l.Addr().String())
+	conn.Write([]byte("slow\nstop\nnext\n"))
+	for _, want := range []string{"interrupted\n", "next\n"} {
+		if got, err := rd.ReadString('\n'); got != want {
+			t.Fatalf("got %q, %v; want %q", got, err, want)
+		}
+	}
+}
+
+func TestUnixListener(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "apl.sock")
+	// A stale file is removed before listening
+	if err := os.WriteFile(path, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	srv := New(Lines(echo))
+	if _, err := srv.Listen(path); err != nil {
+		t.Fatal(err)
+	}
+
+	conn, rd := dial(t, "unix", path)
+	conn.Write([]byte("z\n"))
+	if got, _ := rd.ReadString('\n'); got != "Z\n" {
+		t.Errorf("got %q", got)
+	}
+	conn.Close()
+
+	if err := srv.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("socket file still there after Shutdown: %v", err)
+	}
+}
+
+func TestShutdownFinishesQueuedWork(t *testing.T) {
+	release := make(chan struct{})
+	started := make(chan struct{}, 1)
+	slow := EvaluatorFunc(func(ctx context.Context, expr string) (string, error) {
+		started <- struct{}{}
+		<-release
+		return expr, nil
+	})
+	srv := New(Lines(slow))
+	l, err := srv.Listen("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conn, rd := dial(t, "tcp", l.Addr().String())
+	conn.Write([]byte("first\n"))
+	<-started
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	var shutdownErr error
+	go func() {
+		defer wg.Done()
+		shutdownErr = srv.Shutdown(context.Background())
+	}()
+
+	// No new connections once shutting down
+	time.Sleep(50 * time.Millisecond)
+	if c, err := net.Dial("tcp", l.Addr().String()); err == nil {
+		c.Close()
+		t.Error("dial succeeded after Shutdown")
+	}
+
+	close(release)
+	if got, _ := rd.ReadString('\n'); got != "first\n" {
+		t.Errorf("in-flight reply = %q", got)
+	}
+	wg.Wait()
+	if shutdownErr != nil {
+		t.Errorf("Shutdown = %v", shutdownErr)
+	}
+	if err := srv.Serve(l); !errors.Is(err, ErrServerClosed) {
+		t.Errorf("Serve after Shutdown = %v", err)
+	}
+}
+
+func TestShutdownDeadline(t *testing.T) {
+	stuck := EvaluatorFunc(func(ctx context.Context, expr string) (string, error) {
+		<-ctx.Done()
+		return "", ctx.Err()
+	})
+	srv := New(Lines(stuck))
+	l, err := srv.Listen("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, rd := dial(t, "tcp", l.Addr().String())
+	conn.Write([]byte("forever\n"))
+	time.Sleep(50 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := srv.Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Shutdown = %v, want deadline exceeded", err)
+	}
+	if _, err := rd.ReadString('\n'); err == nil {
+		t.Error("connection still open after forced shutdown")
+	}
+}
@@ -5,6 +5,7 @@ import (
 
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss/v2"
+	"github.com/cursork/gritt/syntax"
 )
 
 // SymbolSearch is a searchable APL symbol list
@@ -100,7 +101,11 @@ func (s *SymbolSearch) Render(w, h int) string {
 			line := selectedStyle.Render(" "+char+" ") + " " + keyStyle.Render(keycode) + " " + descStyle.Render(desc)
 			sb.WriteString(line)
 		} else {
-			line := symStyle.Render(" "+char+" ") + " " + keyStyle.Render(keycode) + " " + descStyle.Render(desc)
+			st := symStyle
+			if hl, ok := syntaxStyles[syntax.KindAt(char)[0]]; ok {
+				st = hl.Bold(true)
+			}
+			line := st.Render(" "+char+" ") + " " + keyStyle.Render(keycode) + " " + descStyle.Render(desc)
 			sb.WriteString(line)
 		}
 
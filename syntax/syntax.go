@@ -0,0 +1,268 @@
+// Package syntax splits lines of Dyalog APL into tokens for highlighting.
+//
+// Tokenize works one line at a time, which suits APL: strings and
+// comments can't span lines. It is deliberately forgiving — anything it
+// doesn't recognise comes back as Other — since it runs on half-typed
+// input as well as fixed code.
+package syntax
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Kind classifies a token.
+type Kind int
+
+const (
+	Other      Kind = iota // unrecognised text
+	Space                  // blanks
+	Comment                // ⍝ to end of line
+	String                 // 'quoted', including an unterminated string
+	Number                 // 42 ¯1.5E3 1J2 ⍬
+	Name                   // user identifiers
+	SystemName             // ⎕IO ⎕NL ⍞
+	Keyword                // :If :EndFor
+	Command                // )off ]link.create — the whole line
+	Function               // primitive functions: + ⍴ ⍳ ...
+	Operator               // primitive operators: ¨ ⍨ / ...
+	Dfn                    // { } ⍺ ⍵ ⍺⍺ ⍵⍵ ∇ ∇∇
+	Assign                 // ← →
+	Punct                  // ( ) [ ] ; ⋄ :
+)
+
+var kindNames = [...]string{
+	Other:      "other",
+	Space:      "space",
+	Comment:    "comment",
+	String:     "string",
+	Number:     "number",
+	Name:       "name",
+	SystemName: "system",
+	Keyword:    "keyword",
+	Command:    "command",
+	Function:   "function",
+	Operator:   "operator",
+	Dfn:        "dfn",
+	Assign:     "assign",
+	Punct:      "punct",
+}
+
+// String returns the kind's lower-case name, as used for theme keys.
+func (k Kind) String() string {
+	if int(k) < len(kindNames) {
+		return kindNames[k]
+	}
+	return "unknown"
+}
+
+// Kinds lists every Kind, in order.
+func Kinds() []Kind {
+	kinds := make([]Kind, len(kindNames))
+	for i := range kinds {
+		kinds[i] = Kind(i)
+	}
+	return kinds
+}
+
+// Token is a run of text of one Kind. Start is its offset in runes.
+type Token struct {
+	Kind  Kind
+	Text  string
+	Start int
+}
+
+const (
+	functions = "+-×÷*⍟⌹○!?|⌈⌊⊥⊤⊣⊢=≠≤<>≥≡≢∨∧⍲⍱↑↓⊂⊃⊆⌷⍋⍒⍳⍸∊⍷∪∩~,⍪⍴⌽⊖⍉⍎⍕"
+	operators = "¨⍨⍣.∘⍤⍥@⌸⌺⌶/⌿\\⍀&"
+	punct     = "()[];⋄:"
+)
+
+// IsNameRune reports whether r can appear in an APL name after the
+// first character. Names start with a letter, _, ∆ or ⍙.
+func IsNameRune(r rune) bool {
+	return r == '_' || r == '∆' || r == '⍙' || r >= '0' && r <= '9' || unicode.IsLetter(r)
+}
+
+func isNameStart(r rune) bool {
+	return r == '_' || r == '∆' || r == '⍙' || unicode.IsLetter(r)
+}
+
+func isDigit(r rune) bool {
+	return r >= '0' && r <= '9'
+}
+
+// Tokenize splits one line of APL into tokens. Concatenating the tokens'
+// Text gives back the line.
+func Tokenize(line string) []Token {
+	runes := []rune(line)
+	var toks []Token
+	emit := func(kind Kind, start, end int) {
+		toks = append(toks, Token{Kind: kind, Text: string(runes[start:end]), Start: start})
+	}
+
+	// System and user commands take the whole line.
+	if trimmed := strings.TrimLeft(line, " "); strings.HasPrefix(trimmed, ")") || strings.HasPrefix(trimmed, "]") {
+		lead := len(runes) - len([]rune(trimmed))
+		if lead > 0 {
+			emit(Space, 0, lead)
+		}
+		emit(Command, lead, len(runes))
+		return toks
+	}
+
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		j := i + 1
+		kind := Other
+		switch {
+		case r == ' ' || r == '\t':
+			for j < len(runes) && (runes[j] == ' ' || runes[j] == '\t') {
+				j++
+			}
+			emit(Space, i, j)
+			i = j
+			continue
+		case r == '⍝':
+			j = len(runes)
+			kind = Comment
+		case r == '\'':
+			for j < len(runes) {
+				if runes[j] == '\'' {
+					if j+1 < len(runes) && runes[j+1] == '\'' {
+						j += 2 // escaped quote
+						continue
+					}
+					j++
+					break
+				}
+				j++
+			}
+			kind = String
+		case r == ':' && (i == 0 || runes[i-1] == ' ' || runes[i-1] == '⋄') && isKeyword(runes, j):
+			for j < len(runes) && unicode.IsLetter(runes[j]) {
+				j++
+			}
+			kind = Keyword
+		case isDigit(r) || r == '¯' || (r == '.' && j < len(runes) && isDigit(runes[j])):
+			j = scanNumber(runes, i)
+			kind = Number
+		case r == '⍬':
+			kind = Number
+		case r == '⎕':
+			for j < len(runes) && IsNameRune(runes[j]) {
+				j++
+			}
+			kind = SystemName
+		case r == '⍞':
+			kind = SystemName
+		case isNameStart(r):
+			for j < len(runes) && IsNameRune(runes[j]) {
+				j++
+			}
+			kind = Name
+		case r == '⍺' || r == '⍵' || r == '∇':
+			if j < len(runes) && runes[j] == r {
+				j++
+			}
+			kind = Dfn
+		case r == '{' || r == '}':
+			kind = Dfn
+		case r == '←' || r == '→':
+			kind = Assign
+		case strings.ContainsRune(functions, r):
+			kind = Function
+		case strings.ContainsRune(operators, r):
+			kind = Operator
+		case strings.ContainsRune(punct, r):
+			kind = Punct
+		}
+		emit(kind, i, j)
+		i = j
+	}
+	return toks
+}
+
+// keywords are the control structure and script keywords, lower-cased.
+// Requiring a known word (after a blank) keeps dfn guards like x:y and
+// labels from being taken for keywords.
+var keywords = map[string]bool{}
+
+func init() {
+	for _, k := range strings.Fields(`
+		If ElseIf AndIf OrIf Else EndIf While EndWhile Repeat Until EndRepeat
+		For In InEach EndFor Select Case CaseList EndSelect With EndWith
+		Hold EndHold Trap EndTrap GoTo Return Leave Continue Disposable
+		EndDisposable Namespace EndNamespace Class EndClass Interface
+		EndInterface Field Property EndProperty Access Implements Include
+		Require Section EndSection Signature Base Using Public Private
+		Shared Instance Overridable Override`) {
+		keywords[strings.ToLower(k)] = true
+	}
+}
+
+// isKeyword reports whether the letters starting at i form a keyword.
+func isKeyword(runes []rune, i int) bool {
+	j := i
+	for j < len(runes) && unicode.IsLetter(runes[j]) {
+		j++
+	}
+	return j > i && keywords[strings.ToLower(string(runes[i:j]))]
+}
+
+// scanNumber returns the end of the number starting at i: digits with an
+// optional ¯ sign, decimal point and exponent, and a J complex part.
+func scanNumber(runes []rune, i int) int {
+	part := func(i int) int {
+		if i < len(runes) && runes[i] == '¯' {
+			i++
+		}
+		for i < len(runes) && (isDigit(runes[i]) || runes[i] == '.') {
+			i++
+		}
+		if i < len(runes) && (runes[i] == 'E' || runes[i] == 'e') {
+			k := i + 1
+			if k < len(runes) && runes[k] == '¯' {
+				k++
+			}
+			if k < len(runes) && isDigit(runes[k]) {
+				i = k
+				for i < len(runes) && isDigit(runes[i]) {
+					i++
+				}
+			}
+		}
+		return i
+	}
+	j := part(i)
+	if j < len(runes) && (runes[j] == 'J' || runes[j] == 'j') {
+		if k := part(j + 1); k > j+1 {
+			j = k
+		}
+	}
+	return j
+}
+
+// SplitComment splits a line into its code and its comment (from ⍝
+// onwards, outside strings). The comment is empty if there is none.
+func SplitComment(line string) (code, comment string) {
+	for _, t := range Tokenize(line) {
+		if t.Kind == Comment {
+			i := len(string([]rune(line)[:t.Start]))
+			return line[:i], line[i:]
+		}
+	}
+	return line, ""
+}
+
+// KindAt returns the Kind of every rune in line, so that callers drawing
+// a cursor or truncating can style runes individually.
+func KindAt(line string) []Kind {
+	kinds := make([]Kind, 0, len(line))
+	for _, t := range Tokenize(line) {
+		for range []rune(t.Text) {
+			kinds = append(kinds, t.Kind)
+		}
+	}
+	return kinds
+}
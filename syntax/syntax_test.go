@@ -0,0 +1,73 @@
+package syntax
+
+import (
+	"strings"
+	"testing"
+)
+
+// kinds renders tokens compactly for comparison: "kind:text" pairs,
+// skipping blanks.
+func kinds(line string) string {
+	var parts []string
+	for _, t := range Tokenize(line) {
+		if t.Kind != Space {
+			parts = append(parts, t.Kind.String()+":"+t.Text)
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+func TestTokenize(t *testing.T) {
+	tests := []struct {
+		line, want string
+	}{
+		{"x←⍳3", "name:x assign:← function:⍳ number:3"},
+		{"  ¯1.5E¯3 2J¯1 ⍬", "number:¯1.5E¯3 number:2J¯1 number:⍬"},
+		{"'it''s' ⍝ a 'comment'", "string:'it''s' comment:⍝ a 'comment'"},
+		{"'open ⍝ not a comment", "string:'open ⍝ not a comment"},
+		{"⎕IO←0 ⋄ ⍞←⎕TS", "system:⎕IO assign:← number:0 punct:⋄ system:⍞ assign:← system:⎕TS"},
+		{":If x ⋄ :EndIf", "keyword::If name:x punct:⋄ keyword::EndIf"},
+		{"lbl: :For i :In ⍳3", "name:lbl punct:: keyword::For name:i keyword::In function:⍳ number:3"},
+		{"{⍺⍺ ⍵:1 ⋄ ∇∇ ⍵}", "dfn:{ dfn:⍺⍺ dfn:⍵ punct:: number:1 punct:⋄ dfn:∇∇ dfn:⍵ dfn:}"},
+		{"x:foo", "name:x punct:: name:foo"},
+		{"+/¨a∆b_1", "function:+ operator:/ operator:¨ name:a∆b_1"},
+		{"   )load dfns", "command:)load dfns"},
+		{"]link.create # /tmp", "command:]link.create # /tmp"},
+		{"a[1;2]", "name:a punct:[ number:1 punct:; number:2 punct:]"},
+	}
+	for _, tt := range tests {
+		if got := kinds(tt.line); got != tt.want {
+			t.Errorf("Tokenize(%q)\n got %s\nwant %s", tt.line, got, tt.want)
+		}
+	}
+}
+
+func TestTokensCoverLine(t *testing.T) {
+	for _, line := range []string{"", "  x←'a''b' ⍝ c", "⎕←1J2×¯3", ")off", "€ unknown ☃"} {
+		var sb strings.Builder
+		pos := 0
+		for _, tok := range Tokenize(line) {
+			if tok.Start != pos {
+				t.Errorf("%q: token %q starts at %d, want %d", line, tok.Text, tok.Start, pos)
+			}
+			pos += len([]rune(tok.Text))
+			sb.WriteString(tok.Text)
+		}
+		if sb.String() != line {
+			t.Errorf("tokens of %q rebuild %q", line, sb.String())
+		}
+		if n := len(KindAt(line)); n != len([]rune(line)) {
+			t.Errorf("KindAt(%q) has %d entries", line, n)
+		}
+	}
+}
+
+func TestSplitComment(t *testing.T) {
+	code, comment := SplitComment("x←'⍝' ⍝ note")
+	if code != "x←'⍝' " || comment != "⍝ note" {
+		t.Errorf("SplitComment = %q, %q", code, comment)
+	}
+	if code, comment := SplitComment("x←1"); code != "x←1" || comment != "" {
+		t.Errorf("SplitComment without comment = %q, %q", code, comment)
+	}
+}
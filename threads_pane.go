@@ -0,0 +1,200 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss/v2"
+	"github.com/cursork/gritt/ride"
+)
+
+// ThreadRow is one APL thread in the threads pane
+type ThreadRow struct {
+	Tid       int
+	Name      string // Description from GetThreads, or the tracer's tname
+	State     string
+	Suspended string // Innermost traced function and line: foo[3]
+	Frames    int    // Tracer windows open on the thread
+}
+
+// threadRows merges the interpreter's thread list with the tracer windows
+// open on each thread. Threads with tracers but missing from the list (an
+// interpreter that doesn't answer GetThreads) are added as suspended.
+func threadRows(infos []ride.ThreadInfo, tracers []*EditorWindow) []ThreadRow {
+	var rows []ThreadRow
+	index := make(map[int]int)
+	for _, t := range infos {
+		index[t.Tid] = len(rows)
+		rows = append(rows, ThreadRow{Tid: t.Tid, Name: t.Description, State: t.State})
+	}
+	for _, w := range tracers {
+		i, ok := index[w.Tid]
+		if !ok {
+			i = len(rows)
+			index[w.Tid] = i
+			rows = append(rows, ThreadRow{Tid: w.Tid, Name: w.Tname, State: "Suspended"})
+		}
+		rows[i].Frames++
+		rows[i].Suspended = fmt.Sprintf("%s[%d]", w.Name, w.CurrentRow)
+	}
+	return rows
+}
+
+// ThreadsPane lists the interpreter's threads and lets the tracer, stack
+// and variables panes switch between them. Like the workspace pane it
+// talks to the model through Pending fields; the model answers with
+// SetRows.
+type ThreadsPane struct {
+	Infos    []ride.ThreadInfo // Last ReplyGetThreads
+	rows     []ThreadRow
+	current  int // Thread the tracer shows
+	selected int
+	status   string
+
+	PendingRefresh bool   // Ask the interpreter for its threads
+	PendingAction  string // "switch", "continue" or "step", on PendingTid
+	PendingTid     int
+
+	// Styles
+	selectedStyle lipgloss.Style
+	currentStyle  lipgloss.Style
+	statusStyle   lipgloss.Style
+}
+
+// NewThreadsPane creates a threads pane that asks for the thread list
+func NewThreadsPane() *ThreadsPane {
+	return &ThreadsPane{
+		PendingRefresh: true,
+		selectedStyle:  lipgloss.NewStyle().Background(lipgloss.Color("240")),
+		currentStyle:   lipgloss.NewStyle().Foreground(AccentColor).Bold(true),
+		statusStyle:    lipgloss.NewStyle().Foreground(lipgloss.Color("245")),
+	}
+}
+
+// SetRows replaces the displayed threads; current is the tracer's thread.
+// The selection stays on the same thread if it is still there.
+func (p *ThreadsPane) SetRows(rows []ThreadRow, current int) {
+	tid := current
+	if p.selected < len(p.rows) {
+		tid = p.rows[p.selected].Tid
+	}
+	p.rows = rows
+	p.current = current
+	p.selected = 0
+	for i, r := range rows {
+		if r.Tid == tid {
+			p.selected = i
+		}
+	}
+}
+
+func (p *ThreadsPane) Title() string {
+	return fmt.Sprintf("threads (%d)", len(p.rows))
+}
+
+func (p *ThreadsPane) Render(w, h int) string {
+	listH := h - 1 // Last line: status or key help
+	var lines []string
+	for i, r := range p.rows {
+		if len(lines) == listH {
+			break
+		}
+		marker := " "
+		if r.Tid == p.current && r.Frames > 0 {
+			marker = "►"
+		}
+		text := fmt.Sprintf("%-3d %-9s %s", r.Tid, r.State, r.Suspended)
+		if r.Name != "" {
+			text += " " + r.Name
+		}
+		text, _ = fitLine(text, "", w-2)
+		pad := strings.Repeat(" ", max(w-2-len([]rune(text)), 0))
+
+		line := p.currentStyle.Render(marker) + " "
+		if i == p.selected {
+			line += p.selectedStyle.Render(text + pad)
+		} else {
+			line += text + pad
+		}
+		lines = append(lines, line)
+	}
+	if len(p.rows) == 0 && listH > 0 {
+		lines = append(lines, "  (no threads)")
+	}
+	for len(lines) < listH {
+		lines = append(lines, strings.Repeat(" ", w))
+	}
+
+	footer := p.status
+	if footer == "" {
+		footer = "⏎ switch  c continue  n step  F5 refresh"
+	}
+	footer, _ = fitLine(footer, "", w)
+	lines = append(lines, p.statusStyle.Render(footer))
+	return strings.Join(lines, "\n")
+}
+
+func (p *ThreadsPane) HandleKey(msg tea.KeyMsg) bool {
+	p.status = ""
+	if msg.Type == tea.KeyF5 {
+		p.PendingRefresh = true
+		return true
+	}
+	if len(p.rows) == 0 {
+		return false
+	}
+	r := p.rows[min(p.selected, len(p.rows)-1)]
+
+	switch msg.Type {
+	case tea.KeyUp:
+		if p.selected > 0 {
+			p.selected--
+		}
+		return true
+	case tea.KeyDown:
+		if p.selected < len(p.rows)-1 {
+			p.selected++
+		}
+		return true
+	case tea.KeyHome:
+		p.selected = 0
+		return true
+	case tea.KeyEnd:
+		p.selected = len(p.rows) - 1
+		return true
+	case tea.KeyEnter:
+		p.act("switch", r)
+		return true
+	}
+	switch msg.String() {
+	case "c":
+		p.act("continue", r)
+		return true
+	case "n":
+		p.act("step", r)
+		return true
+	}
+	return false
+}
+
+// act queues an action on a thread. Continue and step need a suspended
+// function to apply to.
+func (p *ThreadsPane) act(action string, r ThreadRow) {
+	if action != "switch" && r.Frames == 0 {
+		p.status = fmt.Sprintf("thread %d is not being traced", r.Tid)
+		return
+	}
+	p.PendingAction = action
+	p.PendingTid = r.Tid
+}
+
+func (p *ThreadsPane) HandleMouse(x, y int, msg tea.MouseMsg) bool {
+	if msg.Button == tea.MouseButtonLeft && msg.Action == tea.MouseActionPress {
+		if y >= 0 && y < len(p.rows) {
+			p.selected = y
+		}
+		return true
+	}
+	return false
+}
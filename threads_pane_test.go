@@ -0,0 +1,130 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/cursork/gritt/ride"
+	"github.com/cursork/gritt/ride/ridetest"
+)
+
+func TestThreadRows(t *testing.T) {
+	infos := []ride.ThreadInfo{
+		{Tid: 0, State: "Session"},
+		{Tid: 2, Description: "worker", State: "Suspended"},
+	}
+	tracers := []*EditorWindow{
+		{Token: 1, Name: "Outer", CurrentRow: 3, Tid: 2},
+		{Token: 2, Name: "Inner", CurrentRow: 1, Tid: 2},
+		{Token: 3, Name: "Other", CurrentRow: 0, Tid: 5, Tname: "poller"},
+	}
+	want := []ThreadRow{
+		{Tid: 0, State: "Session"},
+		{Tid: 2, Name: "worker", State: "Suspended", Suspended: "Inner[1]", Frames: 2},
+		{Tid: 5, Name: "poller", State: "Suspended", Suspended: "Other[0]", Frames: 1},
+	}
+	if got := threadRows(infos, tracers); !reflect.DeepEqual(got, want) {
+		t.Errorf("threadRows = %+v\nwant %+v", got, want)
+	}
+}
+
+func TestThreadsPaneKeys(t *testing.T) {
+	p := NewThreadsPane()
+	if !p.PendingRefresh {
+		t.Error("new pane should ask for threads")
+	}
+	p.PendingRefresh = false
+	p.SetRows([]ThreadRow{
+		{Tid: 0, State: "Session"},
+		{Tid: 2, State: "Suspended", Suspended: "Inner[1]", Frames: 2},
+	}, 2)
+	if p.selected != 1 {
+		t.Errorf("selected = %d, want the current thread's row", p.selected)
+	}
+	out := stripANSI(p.Render(40, 4))
+	if !strings.Contains(out, "► 2   Suspended Inner[1]") {
+		t.Errorf("render:\n%s", out)
+	}
+
+	p.HandleKey(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'n'}})
+	if p.PendingAction != "step" || p.PendingTid != 2 {
+		t.Errorf("n: pending %q on %d", p.PendingAction, p.PendingTid)
+	}
+	p.PendingAction = ""
+
+	// The session thread has nothing to continue
+	p.HandleKey(tea.KeyMsg{Type: tea.KeyUp})
+	p.HandleKey(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'c'}})
+	if p.PendingAction != "" || !strings.Contains(p.status, "not being traced") {
+		t.Errorf("c on idle thread: pending %q, status %q", p.PendingAction, p.status)
+	}
+	p.HandleKey(tea.KeyMsg{Type: tea.KeyEnter})
+	if p.PendingAction != "switch" || p.PendingTid != 0 {
+		t.Errorf("enter: pending %q on %d", p.PendingAction, p.PendingTid)
+	}
+	p.HandleKey(tea.KeyMsg{Type: tea.KeyF5})
+	if !p.PendingRefresh {
+		t.Error("F5 should refresh")
+	}
+}
+
+func TestTracerThreads(t *testing.T) {
+	client, srv := fakeInterpreter(t, func(*ride.Message) []*ride.Message { return nil })
+	m := newTestModel(t, client)
+	open := func(token, tid int, name string) {
+		m.recv(&ride.Message{Command: "OpenWindow", Args: map[string]any{
+			"token": token, "name": name, "debugger": 1, "tid": tid, "text": []string{name},
+		}})
+	}
+	open(1, 0, "Main")
+	open(2, 3, "Work")
+	open(3, 3, "Step")
+	if m.tracerCurrent != 3 || m.tracerThread != 3 {
+		t.Fatalf("tracer shows %d on thread %d, want 3 on 3", m.tracerCurrent, m.tracerThread)
+	}
+	m.toggleStackPane()
+	stack := m.panes.Get("stack").Content.(*StackPane)
+	if got := len(stack.getStack()); got != 2 {
+		t.Errorf("stack pane shows %d frames of thread 3, want 2", got)
+	}
+
+	m.toggleThreadsPane()
+	tp := m.panes.Get("threads").Content.(*ThreadsPane)
+	tp.PendingAction, tp.PendingTid = "switch", 0
+	m.serviceThreadsPane(tp)
+	if m.tracerCurrent != 1 || m.tracerThread != 0 {
+		t.Errorf("after switch: tracer shows %d on thread %d, want 1 on 0", m.tracerCurrent, m.tracerThread)
+	}
+	if frames := stack.getStack(); len(frames) != 1 || frames[0].Name != "Main" {
+		t.Errorf("stack pane after switch = %+v", frames)
+	}
+	tp.PendingAction, tp.PendingTid = "continue", 3
+	m.serviceThreadsPane(tp)
+
+	// Thread 0 finishes: the tracer moves to the remaining thread
+	m.recv(&ride.Message{Command: "CloseWindow", Args: map[string]any{"win": 1}})
+	if m.tracerCurrent != 3 || m.tracerThread != 3 {
+		t.Errorf("after close: tracer shows %d on thread %d, want 3 on 3", m.tracerCurrent, m.tracerThread)
+	}
+
+	var sent []string
+	for _, msg := range waitReceived(srv, 3) {
+		sent = append(sent, msg.Command)
+	}
+	want := []string{"GetThreads", "SetThread", "Continue"}
+	if !reflect.DeepEqual(sent[:3], want) {
+		t.Errorf("sent %v, want %v first", sent, want)
+	}
+}
+
+// waitReceived waits briefly for the interpreter to have received n messages
+func waitReceived(srv *ridetest.Server, n int) []*ride.Message {
+	deadline := time.Now().Add(2 * time.Second)
+	for len(srv.Received()) < n && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	return srv.Received()
+}
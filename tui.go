@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
 	"fmt"
@@ -10,6 +11,7 @@ import (
 	"os/exec"
 	"path/filepath"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
 
@@ -22,7 +24,10 @@ import (
 	"github.com/cursork/gritt/aplcart"
 	"github.com/cursork/gritt/codec"
 	"github.com/cursork/gritt/docs"
+	"github.com/cursork/gritt/multiline"
+	"github.com/cursork/gritt/prepl"
 	"github.com/cursork/gritt/ride"
+	"github.com/cursork/gritt/syntax"
 	_ "modernc.org/sqlite"
 )
 
@@ -88,7 +93,11 @@ type Model struct {
 
 	// Connection state
 	addr       string
-	connecting bool // True while initial connection is in progress
+	listener   *ride.Listener // -listen: accept Dyalog here instead of dialling addr
+	preplAddr  string         // -prepl: evaluate over this prepl server instead of RIDE
+	prepl      *preplConn     // Stands in for client with -prepl
+	connecting bool           // True while initial connection is in progress
+	accepting  bool           // True while a reconnect waits on listener
 	connected  bool
 
 	// Session state
@@ -110,6 +119,12 @@ type Model struct {
 	multilineStart int      // Index in m.lines where multiline input began
 	pendingLines   []string // Lines queued for sequential Execute (one per SetPromptType)
 
+	// Continuation (SetPromptType type 3): the interpreter is collecting a
+	// ∇ definition, :Namespace or multi-line dfn. Enter adds lines until
+	// the block is complete, then the rest of it is sent like multiline mode.
+	continuation      bool
+	continuationStart int // Index in m.lines of the block's first line, already sent
+
 	// Focus mode
 	focusMode bool
 
@@ -127,6 +142,8 @@ type Model struct {
 	// Tracer state (for debugger windows)
 	tracerStack   []int // Tokens in stack order: bottom to top
 	tracerCurrent int   // Currently displayed tracer token (0 = none)
+	tracerThread  int   // Thread whose stack the tracer and stack pane show
+	breakpoints   *Breakpoints
 
 	// Help
 	help     help.Model
@@ -182,6 +199,13 @@ type Model struct {
 	internalCallback func(outputs []string) // Where to send results
 	internalOutputs  []string               // Accumulated outputs for internal query
 
+	// Most recent compound result over -prepl, for the explore command
+	lastValue any
+
+	// Set to the name of an array the workspace pane opens, so that its
+	// editor is switched to APLAN and shown in the data browser
+	wsArrayNotation string
+
 	// -sock injections. Interaction (user input + internal queries +
 	// multiline drain) always takes priority; socketQueue only drains
 	// when those are idle. The conn lives in its reader goroutine; the
@@ -189,6 +213,7 @@ type Model struct {
 	// owns the in-flight request's output buffer (req.outputs).
 	socketQueue  []*socketRequest
 	activeSocket *socketRequest
+	feed         *sessionFeed // Session events for -sock subscribers; nil without -sock
 
 	// Terminal dimensions
 	width  int
@@ -235,25 +260,43 @@ var spinnerFrames = []rune{'⠋', '⠙', '⠹', '⠸', '⠼', '⠴', '⠦', '⠧
 const spinnerInterval = 80 * time.Millisecond
 
 type rideEvent struct {
-	msg *ride.Message
-	raw string
-	err error
+	msg   *ride.Message
+	err   error
+	value any // -prepl: the compound result msg displays, if any
 }
 
 // connectResult is sent when the initial connection attempt completes.
 type connectResult struct {
 	client *ride.Client
+	prepl  *prepl.Client // with -prepl, instead of client
 	err    error
 }
 
 // connectCmd returns a command that connects to the RIDE server.
-func connectCmd(addr string) tea.Cmd {
+func connectCmd(dial func() (*ride.Client, error)) tea.Cmd {
 	return func() tea.Msg {
-		client, err := ride.Connect(addr)
+		client, err := dial()
 		return connectResult{client: client, err: err}
 	}
 }
 
+// preplConnectCmd returns a command that connects to a prepl server.
+func preplConnectCmd(addr string) tea.Cmd {
+	return func() tea.Msg {
+		client, err := prepl.Connect(addr)
+		return connectResult{prepl: client, err: err}
+	}
+}
+
+// dial connects to Dyalog: dials addr, or with -listen waits for an
+// interpreter started with RIDE_INIT=CONNECT to dial in.
+func (m Model) dial() (*ride.Client, error) {
+	if m.listener != nil {
+		return m.listener.Accept()
+	}
+	return ride.Connect(m.addr)
+}
+
 // NewModel creates a Model that will connect to the given address.
 // dyalogCmd is the gritt-launched Dyalog process (nil in connect mode).
 // dyalogExited closes when the process has truly exited and been reaped;
@@ -261,6 +304,7 @@ func connectCmd(addr string) tea.Cmd {
 func NewModel(addr string, logFile io.Writer, profile colorprofile.Profile, cfgFile *string, dyalogCmd *exec.Cmd, dyalogExited <-chan struct{}) Model {
 	cfg := LoadConfig(cfgFile)
 	initColors(profile, cfg.Accent)
+	initSyntaxTheme(cfg.Theme)
 	killTimeout := cfg.KillTimeout
 	if killTimeout <= 0 {
 		killTimeout = DefaultKillTimeout
@@ -273,6 +317,7 @@ func NewModel(addr string, logFile io.Writer, profile colorprofile.Profile, cfgF
 		logFile:      logFile,
 		panes:        NewPaneManager(80, 24),
 		editors:      make(map[int]*EditorWindow),
+		breakpoints:  NewBreakpoints(),
 		config:       cfg,
 		help:         help.New(),
 		commands:     buildCommands(&cfg),
@@ -325,7 +370,7 @@ func (m Model) quit() (tea.Model, tea.Cmd) {
 	if m.connected && m.ready && m.client != nil && m.internalQuery == "" {
 		m.log("Sending )off and waiting %s for graceful exit", quitGracePeriod)
 		// Best-effort — send error is irrelevant, escalation handles it.
-		_ = m.client.Send("Execute", map[string]any{"text": ")off\n", "trace": 0})
+		_ = m.client.Send("Execute", ride.Execute{Text: ")off\n"})
 		return m, tea.Batch(gracePeriodCmd(), waitForDyalogExitCmd(m.dyalogExited))
 	}
 
@@ -383,13 +428,17 @@ func (m *Model) cancelKillWait() {
 	m.log("Kill cancelled — gritt and Dyalog left running")
 }
 
-// startRecvLoop starts a goroutine to receive RIDE messages.
+// startRecvLoop subscribes to every RIDE message, starts the client's
+// dispatcher and forwards messages to the returned channel in order.
 func (m *Model) startRecvLoop() <-chan rideEvent {
 	ch := make(chan rideEvent)
+	q := m.client.Queue()
+	m.client.Start()
 	go func() {
+		defer q.Close()
 		for {
-			msg, raw, err := m.client.Recv()
-			ch <- rideEvent{msg: msg, raw: raw, err: err}
+			msg, err := q.Next(context.Background())
+			ch <- rideEvent{msg: msg, err: err}
 			if err != nil {
 				return
 			}
@@ -398,11 +447,23 @@ func (m *Model) startRecvLoop() <-chan rideEvent {
 	return ch
 }
 
-// send wraps client.Send and handles disconnection on error.
-func (m *Model) send(cmd string, args map[string]any) error {
+// send wraps client.Send and handles disconnection on error. Over -prepl
+// only Execute can be sent; anything else is refused with a status line.
+func (m *Model) send(cmd string, args any) error {
 	if !m.connected {
 		return fmt.Errorf("not connected")
 	}
+	if m.prepl != nil {
+		if ex, ok := args.(ride.Execute); ok {
+			return m.prepl.execute(ex.Text, m.internalQuery != "" && ex.Text == m.internalQuery+"\n")
+		}
+		if cmd == "WeakInterrupt" || cmd == "StrongInterrupt" {
+			return m.prepl.interrupt()
+		}
+		m.transientErr = fmt.Sprintf("%s: not available over -prepl (needs RIDE)", rideOnly(cmd))
+		m.log("Not sent over -prepl: %s", cmd)
+		return fmt.Errorf("%s needs RIDE", cmd)
+	}
 	err := m.client.Send(cmd, args)
 	if err != nil {
 		m.connected = false
@@ -419,11 +480,59 @@ func (m *Model) executeInternal(code string, callback func(outputs []string)) er
 	if m.internalQuery != "" {
 		m.log("Replacing pending internal query: %s → %s", m.internalQuery, code)
 	}
+	if m.continuation {
+		m.log("Internal query blocked: interpreter waiting for continuation")
+		return fmt.Errorf("interpreter is waiting for the rest of a definition")
+	}
 	m.internalQuery = code
 	m.internalCallback = callback
 	m.internalOutputs = nil
 	m.log("→ Internal: %s", code)
-	return m.send("Execute", map[string]any{"text": code + "\n", "trace": 0})
+	return m.send("Execute", ride.Execute{Text: code + "\n"})
+}
+
+// evalEachExpr is an internal query evaluating several expressions at
+// once: each one's display follows a marker line, and one that fails
+// shows the error marker instead, so the others still get through.
+func evalEachExpr(exprs []string) string {
+	parts := make([]string, len(exprs))
+	for i, e := range exprs {
+		parts[i] = fmt.Sprintf("⎕←'⍝GRITT %d' ⋄ ⎕←'''⍝GRITT !'''⎕EA'%s'", i, strings.ReplaceAll(e, "'", "''"))
+	}
+	return strings.Join(parts, " ⋄ ")
+}
+
+// parseEvalEach reads evalEachExpr's output into each expression's
+// display. Expressions that failed show as "(error)".
+func parseEvalEach(exprs []string, outputs []string) map[string]string {
+	values := make(map[string]string)
+	for _, e := range exprs {
+		values[e] = "(error)" // until its output turns up
+	}
+	cur := -1
+	var text []string
+	flush := func() {
+		if cur >= 0 && cur < len(exprs) {
+			v := strings.Join(text, "\n")
+			if strings.TrimSpace(v) == "⍝GRITT !" {
+				v = "(error)"
+			}
+			values[exprs[cur]] = v
+		}
+		text = nil
+	}
+	for _, line := range strings.Split(strings.TrimRight(strings.Join(outputs, ""), "\n"), "\n") {
+		if rest, ok := strings.CutPrefix(line, "⍝GRITT "); ok {
+			if n, err := strconv.Atoi(rest); err == nil {
+				flush()
+				cur = n
+				continue
+			}
+		}
+		text = append(text, line)
+	}
+	flush()
+	return values
 }
 
 // reconnect attempts to reconnect to the RIDE server.
@@ -433,13 +542,40 @@ func (m Model) reconnect() (tea.Model, tea.Cmd) {
 		return m, nil
 	}
 
-	m.log("Reconnecting to %s...", m.addr)
-
 	// Close old client if exists
 	if m.client != nil {
 		m.client.Close()
 	}
 
+	if m.preplAddr != "" {
+		if m.prepl != nil {
+			m.prepl.Close()
+		}
+		m.log("Reconnecting to prepl %s...", m.preplAddr)
+		client, err := prepl.Connect(m.preplAddr)
+		if err != nil {
+			m.log("Reconnect failed: %v", err)
+			return m, nil
+		}
+		m.startPrepl(client)
+		m.log("Reconnected to prepl %s", m.preplAddr)
+		return m, waitForRide(m.msgs)
+	}
+
+	// A listening gritt can't dial: wait in the background for Dyalog to
+	// connect again, keeping the session on screen meanwhile.
+	if m.listener != nil {
+		if m.accepting {
+			m.log("Already waiting for Dyalog on %s", m.addr)
+			return m, nil
+		}
+		m.accepting = true
+		m.log("Waiting for Dyalog on %s...", m.addr)
+		return m, connectCmd(m.dial)
+	}
+
+	m.log("Reconnecting to %s...", m.addr)
+
 	// Try to connect
 	client, err := ride.Connect(m.addr)
 	if err != nil {
@@ -454,7 +590,7 @@ func (m Model) reconnect() (tea.Model, tea.Cmd) {
 	m.log("Reconnected to %s", m.addr)
 
 	// Request any open windows from Dyalog (restores orphaned editors)
-	m.send("GetWindowLayout", map[string]any{})
+	m.send("GetWindowLayout", ride.GetWindowLayout{})
 
 	return m, waitForRide(m.msgs)
 }
@@ -536,6 +672,40 @@ func (m *Model) resizeWarningsPane(pane *Pane, count int) {
 	}
 }
 
+// startPrepl puts the session on a prepl connection in place of RIDE.
+func (m *Model) startPrepl(client *prepl.Client) {
+	m.prepl = newPreplConn(client)
+	m.msgs = m.prepl.events
+	m.connected = true
+	m.ready = true
+}
+
+// explore opens the most recent compound -prepl result in the data
+// browser.
+func (m *Model) explore() {
+	if m.lastValue == nil {
+		if m.prepl == nil {
+			m.transientErr = "explore: needs -prepl (RIDE results are display text)"
+		} else {
+			m.transientErr = "explore: no compound result yet"
+		}
+		return
+	}
+	m.panes.Remove("explore")
+	panes := m.panes
+	browser := NewDataBrowserPane("result", m.lastValue, func() { panes.Remove("explore") })
+	paneW := min(m.width-4, 60)
+	paneH := min(m.height-6, 20)
+	if paneW < 30 {
+		paneW = 30
+	}
+	if paneH < 10 {
+		paneH = 10
+	}
+	m.panes.Add(NewPane("explore", browser, (m.width-paneW)/2, (m.height-paneH)/2, paneW, paneH))
+	m.panes.Focus("explore")
+}
+
 // waitForRide waits for the next RIDE message.
 func waitForRide(ch <-chan rideEvent) tea.Cmd {
 	return func() tea.Msg {
@@ -544,22 +714,39 @@ func waitForRide(ch <-chan rideEvent) tea.Cmd {
 }
 
 func (m Model) Init() tea.Cmd {
+	if m.connecting && m.preplAddr != "" {
+		return preplConnectCmd(m.preplAddr)
+	}
 	if m.connecting {
-		return connectCmd(m.addr)
+		return connectCmd(m.dial)
 	}
 	// Request any open windows from Dyalog (restores orphaned editors on reconnect)
-	m.send("GetWindowLayout", map[string]any{})
+	m.send("GetWindowLayout", ride.GetWindowLayout{})
 	return waitForRide(m.msgs)
 }
 
 func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	switch msg := msg.(type) {
 	case connectResult:
+		if m.accepting {
+			m.accepting = false
+			if msg.err != nil {
+				m.log("Reconnect failed: %v", msg.err)
+				return m, nil
+			}
+		}
 		m.connecting = false
 		if msg.err != nil {
 			m.err = msg.err
 			return m, nil
 		}
+		if msg.prepl != nil {
+			m.startPrepl(msg.prepl)
+			m.cursorCol = len(aplIndent)
+			m.log("Connected to prepl %s", m.preplAddr)
+			m.warnOldDocsCache()
+			return m, waitForRide(m.msgs)
+		}
 		m.client = msg.client
 		m.connected = true
 		m.ready = true
@@ -567,7 +754,7 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		m.msgs = m.startRecvLoop()
 		m.log("Connected to %s", m.addr)
 		m.warnOldDocsCache()
-		m.send("GetWindowLayout", map[string]any{})
+		m.send("GetWindowLayout", ride.GetWindowLayout{})
 		return m, waitForRide(m.msgs)
 
 	case tea.WindowSizeMsg:
@@ -657,6 +844,22 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	case socketLineMsg:
 		m.socketQueue = append(m.socketQueue, msg.req)
 		m.drainSocketQueue()
+		m.reportSocketQueue()
+		return m, nil
+
+	case socketInterruptMsg:
+		if msg.strong {
+			m.log("→ StrongInterrupt (socket)")
+			m.send("StrongInterrupt", ride.StrongInterrupt{})
+		} else {
+			m.log("→ WeakInterrupt (socket)")
+			m.send("WeakInterrupt", ride.WeakInterrupt{})
+		}
+		return m, nil
+
+	case socketEditMsg:
+		m.log("→ Edit %q (socket)", msg.name)
+		m.send("Edit", ride.Edit{Text: msg.name, Pos: len([]rune(msg.name))})
 		return m, nil
 
 	case externalEditFinishedMsg:
@@ -676,7 +879,7 @@ func (m *Model) drainSocketQueue() {
 	if !m.connected || !m.ready {
 		return // interpreter busy
 	}
-	if m.internalQuery != "" || len(m.pendingLines) > 0 {
+	if m.internalQuery != "" || len(m.pendingLines) > 0 || m.continuation {
 		return // interaction tier still has work
 	}
 	if len(m.socketQueue) == 0 {
@@ -687,28 +890,40 @@ func (m *Model) drainSocketQueue() {
 	m.activeSocket = req
 	m.lastExecute = req.code + "\n"
 	m.ready = false
+	req.started = time.Now()
 	m.log("→ Socket Execute %q", req.code)
 
 	// Mirror the injected expression into the visible session above the
 	// current input line, so the user can see what produced any output
 	// that follows. Dyalog's type=14 echo of req.code matches lastExecute
 	// and is dropped, avoiding duplication.
-	inputIdx := len(m.lines) - 1
-	m.lines = append(m.lines, Line{})
-	copy(m.lines[inputIdx+1:], m.lines[inputIdx:])
-	m.lines[inputIdx] = Line{Text: aplIndent + req.code}
-	if m.cursorRow >= inputIdx {
-		m.cursorRow++
+	if !req.quiet {
+		inputIdx := len(m.lines) - 1
+		m.lines = append(m.lines, Line{})
+		copy(m.lines[inputIdx+1:], m.lines[inputIdx:])
+		m.lines[inputIdx] = Line{Text: aplIndent + req.code}
+		if m.cursorRow >= inputIdx {
+			m.cursorRow++
+		}
 	}
 
-	if err := m.send("Execute", map[string]any{"text": req.code + "\n", "trace": 0}); err != nil {
+	if err := m.send("Execute", ride.Execute{Text: req.code + "\n"}); err != nil {
 		// send() already logged and marked disconnected. Release the
 		// waiting goroutine with whatever error context we can give.
-		req.done <- fmt.Sprintf("send failed: %v\n", err)
+		req.err = err
+		req.finished = time.Now()
+		close(req.done)
 		m.activeSocket = nil
 	}
 }
 
+// reportSocketQueue tells each waiting socket request its queue position.
+func (m *Model) reportSocketQueue() {
+	for i, req := range m.socketQueue {
+		req.setPosition(i + 1)
+	}
+}
+
 func (m Model) handleKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 	// Fatal-error screen: any keypress exits, honouring the on-screen prompt.
 	if m.err != nil {
@@ -948,6 +1163,19 @@ func (m Model) handleKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 			if ib, ok := fp.Content.(*IBeamSearch); ok && ib.detail != nil {
 				goto routeToPane
 			}
+			// Workspace pane prompting for a rename or delete — Escape cancels it
+			if wp, ok := fp.Content.(*WorkspacePane); ok && (wp.renaming || wp.confirmDelete) {
+				goto routeToPane
+			}
+			// Watch pane adding or editing a watch — Escape cancels it
+			if wp, ok := fp.Content.(*WatchPane); ok && wp.editing {
+				goto routeToPane
+			}
+			// Explored result — Escape cancels an edit or steps back out,
+			// closing the pane at the top
+			if fp.ID == "explore" {
+				goto routeToPane
+			}
 			if fp.ID == "tracer" {
 				// Check if tracer is in edit mode - if so, let the pane handle it
 				if ep, ok := fp.Content.(*EditorPane); ok && ep.editMode {
@@ -996,6 +1224,8 @@ func (m Model) handleKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 				var token int
 				fmt.Sscanf(fp.ID, "editor:%d", &token)
 				m.closeEditor(token)
+			} else if fp.ID == "inline" {
+				m.closeInlineTrace()
 			} else {
 				m.panes.Remove(fp.ID)
 			}
@@ -1104,6 +1334,41 @@ routeToPane:
 			return m, nil
 		}
 
+		// Workspace pane requests: open, delete, rename, list
+		if wp, ok := fp.Content.(*WorkspacePane); ok {
+			m.serviceWorkspacePane(wp)
+			return m, nil
+		}
+
+		// Threads pane requests: refresh, switch, continue, step
+		if tp, ok := fp.Content.(*ThreadsPane); ok {
+			m.serviceThreadsPane(tp)
+			return m, nil
+		}
+
+		// Inline trace: opened from the tracer, stepped in its own pane
+		if ep, ok := fp.Content.(*EditorPane); ok && ep.PendingInlineTrace {
+			ep.PendingInlineTrace = false
+			m.inlineTrace()
+			return m, nil
+		}
+		if ip, ok := fp.Content.(*InlineTracePane); ok {
+			m.serviceInlinePane(ip)
+			return m, nil
+		}
+
+		// Watch pane: evaluate watches added or refreshed
+		if wp, ok := fp.Content.(*WatchPane); ok {
+			m.serviceWatchPane(wp)
+			return m, nil
+		}
+
+		// Breakpoint pane: set the breakpoint entered
+		if bp, ok := fp.Content.(*BreakpointPane); ok {
+			m.serviceBreakpointPane(bp)
+			return m, nil
+		}
+
 		return m, nil // Focused pane consumes all input
 	}
 
@@ -1455,6 +1720,7 @@ func (m *Model) clearScreen() {
 	m.lines = []Line{{Text: aplIndent}}
 	m.cursorRow = 0
 	m.multilineMode = false
+	m.continuation = false
 	// Preserve history navigation — re-place the current entry
 	if m.historyIdx > 0 && m.historyIdx <= len(m.history) {
 		m.setCurrentLine(m.history[m.historyIdx-1])
@@ -1559,7 +1825,7 @@ func (m Model) toggleMultiline() (tea.Model, tea.Cmd) {
 		}
 
 		// Build queue with correct prefixes
-		queue := m.buildMultilineQueue(rawLines)
+		queue := multiline.Texts(rawLines)
 		if len(queue) == 0 {
 			return m, nil
 		}
@@ -1574,7 +1840,7 @@ func (m Model) toggleMultiline() (tea.Model, tea.Cmd) {
 		m.historySaved = ""
 		m.log("→ Execute (multiline, %d queued) %q", len(m.pendingLines), first)
 
-		if err := m.send("Execute", map[string]any{"text": first, "trace": 0}); err != nil {
+		if err := m.send("Execute", ride.Execute{Text: first}); err != nil {
 			return m, nil
 		}
 		return m, tea.Tick(spinnerInterval, func(time.Time) tea.Msg { return spinnerTickMsg{} })
@@ -1591,35 +1857,6 @@ func (m Model) toggleMultiline() (tea.Model, tea.Cmd) {
 	return m, nil
 }
 
-// buildMultilineQueue transforms raw user lines into correctly prefixed Execute texts.
-// Nabla (∇) body lines need [n] prefixes. Namespace lines keep 6-space indent.
-// Plain multi-statement lines get 6-space indent.
-func (m *Model) buildMultilineQueue(lines []string) []string {
-	if len(lines) == 0 {
-		return nil
-	}
-
-	first := lines[0]
-	isNabla := strings.HasPrefix(first, "∇") || strings.HasPrefix(first, "∇")
-
-	var queue []string
-	// First line always gets aplIndent
-	queue = append(queue, aplIndent+first+"\n")
-
-	for i := 1; i < len(lines); i++ {
-		body := lines[i]
-		if isNabla {
-			// Nabla body/close lines need [n]  prefix
-			queue = append(queue, fmt.Sprintf("[%d]  %s\n", i, body))
-		} else {
-			// Namespace and plain expressions use 6-space indent
-			queue = append(queue, aplIndent+body+"\n")
-		}
-	}
-
-	return queue
-}
-
 func (m Model) execute() (tea.Model, tea.Cmd) {
 	if !m.ready && !m.multilineMode {
 		m.log("Execute blocked: not ready")
@@ -1634,6 +1871,10 @@ func (m Model) execute() (tea.Model, tea.Cmd) {
 		return m, nil
 	}
 
+	if m.continuation {
+		return m.continueBlock()
+	}
+
 	editedText := m.currentLine()
 	code := strings.TrimSpace(editedText)
 	isInputLine := m.cursorRow == len(m.lines)-1
@@ -1692,7 +1933,7 @@ func (m Model) execute() (tea.Model, tea.Cmd) {
 	m.log("→ Execute %q", editedText)
 
 	// Send to interpreter
-	if err := m.send("Execute", map[string]any{"text": m.lastExecute, "trace": 0}); err != nil {
+	if err := m.send("Execute", ride.Execute{Text: m.lastExecute}); err != nil {
 		// Disconnect handled by send(), just return
 		return m, nil
 	}
@@ -1700,47 +1941,89 @@ func (m Model) execute() (tea.Model, tea.Cmd) {
 	return m, tea.Tick(spinnerInterval, func(time.Time) tea.Msg { return spinnerTickMsg{} })
 }
 
-func (m *Model) saveEditor(token int) {
-	w, exists := m.editors[token]
-	if !exists {
-		return
+// continueBlock handles Enter while the interpreter is collecting a
+// definition. The lines from continuationStart on are the pending block:
+// its first line has been sent, the rest are held back and can be edited
+// until multiline.Frame finds the block complete (or Enter is pressed on
+// an empty last line), then sent one per prompt as multiline mode does.
+// Enter on a line above the block copies it down to the last line.
+func (m Model) continueBlock() (tea.Model, tea.Cmd) {
+	lastIdx := len(m.lines) - 1
+	if m.cursorRow <= m.continuationStart {
+		text := m.currentLine()
+		if m.lines[m.cursorRow].Edited {
+			m.lines[m.cursorRow].Text = m.lines[m.cursorRow].Original
+			m.lines[m.cursorRow].Edited = false
+			m.lines[m.cursorRow].Original = ""
+		}
+		m.lines[lastIdx].Text = text
+		m.cursorRow = lastIdx
+		m.cursorCol = len([]rune(text))
+		return m, nil
 	}
 
-	// Autolocalise: update header with new locals before saving
-	m.autolocaliseEditor(token)
-
-	// Build text array
-	text := make([]any, len(w.Text))
-	for i, line := range w.Text {
-		text[i] = line
+	// Lines after the first keep their own indentation past the prompt's,
+	// as multiline.Frame keeps it
+	var lines []string
+	for i, line := range m.lines[m.continuationStart:] {
+		if i == 0 {
+			lines = append(lines, strings.TrimSpace(line.Text))
+		} else {
+			lines = append(lines, strings.TrimPrefix(line.Text, aplIndent))
+		}
+	}
+	force := m.cursorRow == lastIdx && strings.TrimSpace(lines[len(lines)-1]) == ""
+	if _, err := multiline.Frame(lines); err != nil && !force {
+		// Not complete yet: open a new line below the cursor
+		row := m.cursorRow + 1
+		m.lines = append(m.lines[:row], append([]Line{{Text: aplIndent}}, m.lines[row:]...)...)
+		m.cursorRow = row
+		m.cursorCol = len(aplIndent)
+		return m, nil
 	}
 
-	// Build stop array (breakpoints)
-	stop := make([]any, len(w.Stop))
-	for i, s := range w.Stop {
-		stop[i] = s
+	for i := m.continuationStart; i < len(m.lines); i++ {
+		m.lines[i].Edited = false
+		m.lines[i].Original = ""
+	}
+	texts := multiline.Texts(lines)
+	for len(texts) > 2 && strings.TrimSpace(lines[len(texts)-1]) == "" {
+		texts = texts[:len(texts)-1] // Trailing blank lines
 	}
+	queue := texts[1:]
+	first := queue[0]
+	m.pendingLines = queue[1:]
+	m.continuation = false
+	m.ready = false
+	m.spinnerFrame = 0
+	m.lastExecute = first
+	m.cursorRow = lastIdx
+	m.cursorCol = len(m.currentLineRunes())
+	m.log("→ Execute (continuation, %d queued) %q", len(m.pendingLines), first)
 
-	// Build monitor array
-	monitor := make([]any, len(w.Monitor))
-	for i, s := range w.Monitor {
-		monitor[i] = s
+	if err := m.send("Execute", ride.Execute{Text: first}); err != nil {
+		return m, nil
 	}
+	return m, tea.Tick(spinnerInterval, func(time.Time) tea.Msg { return spinnerTickMsg{} })
+}
 
-	// Build trace array
-	trace := make([]any, len(w.Trace))
-	for i, s := range w.Trace {
-		trace[i] = s
+func (m *Model) saveEditor(token int) {
+	w, exists := m.editors[token]
+	if !exists {
+		return
 	}
 
+	// Autolocalise: update header with new locals before saving
+	m.autolocaliseEditor(token)
+
 	m.log("→ SaveChanges win=%d", token)
 
-	m.send("SaveChanges", map[string]any{
-		"win":     token,
-		"text":    text,
-		"stop":    stop,
-		"monitor": monitor,
-		"trace":   trace,
+	m.send("SaveChanges", ride.SaveChanges{
+		Win:     token,
+		Text:    w.Text,
+		Stop:    w.Stop,
+		Monitor: w.Monitor,
+		Trace:   w.Trace,
 	})
 }
 
@@ -1750,12 +2033,8 @@ func (m *Model) formatEditor(token int) {
 	if !exists {
 		return
 	}
-	text := make([]any, len(w.Text))
-	for i, line := range w.Text {
-		text[i] = line
-	}
 	m.log("→ FormatCode win=%d", token)
-	m.send("FormatCode", map[string]any{"win": token, "text": text})
+	m.send("FormatCode", ride.FormatCode{Win: token, Text: w.Text})
 }
 
 // autolocaliseEditor runs autolocalise on the given editor window if enabled.
@@ -1905,31 +2184,13 @@ func (m *Model) sendSetLineAttributes(token int) {
 		return
 	}
 
-	// Build stop array (breakpoints)
-	stop := make([]any, len(w.Stop))
-	for i, s := range w.Stop {
-		stop[i] = s
-	}
-
-	// Build monitor array
-	monitor := make([]any, len(w.Monitor))
-	for i, s := range w.Monitor {
-		monitor[i] = s
-	}
-
-	// Build trace array
-	trace := make([]any, len(w.Trace))
-	for i, s := range w.Trace {
-		trace[i] = s
-	}
-
 	m.log("→ SetLineAttributes win=%d stop=%v", token, w.Stop)
 
-	m.send("SetLineAttributes", map[string]any{
-		"win":     token,
-		"stop":    stop,
-		"monitor": monitor,
-		"trace":   trace,
+	m.send("SetLineAttributes", ride.SetLineAttributes{
+		Win:     token,
+		Stop:    w.Stop,
+		Monitor: w.Monitor,
+		Trace:   w.Trace,
 	})
 }
 
@@ -1940,7 +2201,8 @@ func (m *Model) tracerStepInto() {
 		return
 	}
 	m.log("→ StepInto win=%d", m.tracerCurrent)
-	m.send("StepInto", map[string]any{"win": m.tracerCurrent})
+	m.breakpoints.SetStepping(true)
+	m.send("StepInto", ride.TraceCommand{Win: m.tracerCurrent})
 }
 
 func (m *Model) tracerStepOver() {
@@ -1948,7 +2210,8 @@ func (m *Model) tracerStepOver() {
 		return
 	}
 	m.log("→ RunCurrentLine win=%d", m.tracerCurrent)
-	m.send("RunCurrentLine", map[string]any{"win": m.tracerCurrent})
+	m.breakpoints.SetStepping(true)
+	m.send("RunCurrentLine", ride.TraceCommand{Win: m.tracerCurrent})
 }
 
 func (m *Model) tracerStepOut() {
@@ -1956,7 +2219,8 @@ func (m *Model) tracerStepOut() {
 		return
 	}
 	m.log("→ ContinueTrace win=%d", m.tracerCurrent)
-	m.send("ContinueTrace", map[string]any{"win": m.tracerCurrent})
+	m.breakpoints.SetStepping(true)
+	m.send("ContinueTrace", ride.TraceCommand{Win: m.tracerCurrent})
 }
 
 func (m *Model) tracerContinue() {
@@ -1964,12 +2228,14 @@ func (m *Model) tracerContinue() {
 		return
 	}
 	m.log("→ Continue win=%d", m.tracerCurrent)
-	m.send("Continue", map[string]any{"win": m.tracerCurrent})
+	m.breakpoints.SetStepping(false)
+	m.send("Continue", ride.TraceCommand{Win: m.tracerCurrent})
 }
 
 func (m *Model) tracerResumeAll() {
 	m.log("→ RestartThreads")
-	m.send("RestartThreads", map[string]any{})
+	m.breakpoints.SetStepping(false)
+	m.send("RestartThreads", ride.TraceCommand{})
 }
 
 func (m *Model) tracerBackward() {
@@ -1977,7 +2243,8 @@ func (m *Model) tracerBackward() {
 		return
 	}
 	m.log("→ TraceBackward win=%d", m.tracerCurrent)
-	m.send("TraceBackward", map[string]any{"win": m.tracerCurrent})
+	m.breakpoints.SetStepping(true)
+	m.send("TraceBackward", ride.TraceCommand{Win: m.tracerCurrent})
 }
 
 func (m *Model) tracerForward() {
@@ -1985,22 +2252,25 @@ func (m *Model) tracerForward() {
 		return
 	}
 	m.log("→ TraceForward win=%d", m.tracerCurrent)
-	m.send("TraceForward", map[string]any{"win": m.tracerCurrent})
+	m.breakpoints.SetStepping(true)
+	m.send("TraceForward", ride.TraceCommand{Win: m.tracerCurrent})
 }
 
 // closeAllWindows sends CloseAllWindows to Dyalog to close all editor/tracer windows
 // Useful for clearing stuck state after a crash or disconnect
 func (m *Model) closeAllWindows() {
 	m.log("→ CloseAllWindows")
-	m.send("CloseAllWindows", map[string]any{})
+	m.send("CloseAllWindows", ride.CloseAllWindows{})
 	// Clear local state
 	m.editors = make(map[int]*EditorWindow)
 	m.tracerStack = nil
 	m.tracerCurrent = 0
+	m.tracerThread = 0
 	// Remove panes
 	m.panes.Remove("editor")
 	m.panes.Remove("tracer")
 	m.panes.Remove("stack")
+	m.panes.Remove("inline")
 }
 
 func (m *Model) closeEditor(token int) {
@@ -2057,9 +2327,7 @@ func (m *Model) tryDataBrowser(w *EditorWindow) *DataBrowserPane {
 func (m *Model) sendCloseWindow(token int) {
 	m.log("→ CloseWindow win=%d", token)
 
-	m.send("CloseWindow", map[string]any{
-		"win": token,
-	})
+	m.send("CloseWindow", ride.CloseWindow{Win: token})
 	// Don't remove pane yet - wait for CloseWindow from Dyalog
 }
 
@@ -2083,17 +2351,32 @@ func (m *Model) removeFromTracerStack(token int) {
 		}
 	}
 
-	// If we removed the current tracer, switch to new top of stack
+	// If we removed the current tracer, switch to the new top of its
+	// thread's stack, or failing that of another suspended thread
 	if m.tracerCurrent == token {
-		if len(m.tracerStack) > 0 {
-			// Show the new top of stack
+		if stack := m.threadStack(m.tracerThread); len(stack) > 0 {
+			m.showTracer(stack[len(stack)-1])
+		} else if len(m.tracerStack) > 0 {
 			m.showTracer(m.tracerStack[len(m.tracerStack)-1])
 		} else {
 			// Stack empty - hide tracer pane
 			m.tracerCurrent = 0
 			m.panes.Remove("tracer")
+			m.panes.Remove("inline")
 		}
 	}
+	m.syncStackPane()
+}
+
+// threadStack returns the tracer tokens of thread tid, bottom to top
+func (m *Model) threadStack(tid int) []int {
+	var stack []int
+	for _, token := range m.tracerStack {
+		if w, exists := m.editors[token]; exists && w.Tid == tid {
+			stack = append(stack, token)
+		}
+	}
+	return stack
 }
 
 func (m *Model) showTracer(token int) {
@@ -2103,6 +2386,8 @@ func (m *Model) showTracer(token int) {
 	if !exists {
 		return
 	}
+	m.tracerThread = w.Tid
+	m.syncStackPane()
 
 	// Check if tracer pane exists
 	if pane := m.panes.Get("tracer"); pane != nil {
@@ -2116,6 +2401,7 @@ func (m *Model) showTracer(token int) {
 			func() { m.saveEditor(m.tracerCurrent) },
 			func() { m.closeEditor(m.tracerCurrent) },
 		)
+		editorPane.breakpoints = m.breakpoints
 
 		editorPane.onFormat = func() {
 			m.formatEditor(m.tracerCurrent)
@@ -2154,12 +2440,29 @@ func (m *Model) showTracer(token int) {
 		m.panes.Add(pane)
 		m.panes.Focus("tracer")
 	}
+	m.retargetInlinePane()
+	m.refreshWatchPane()
 }
 
-func (m *Model) getStackFrames() []StackFrame {
-	frames := make([]StackFrame, 0, len(m.tracerStack))
-	for _, token := range m.tracerStack {
-		if w, exists := m.editors[token]; exists {
+// syncStackPane points the stack pane at the current thread's frames. The
+// pane outlives this copy of the model, so it is given the stack as it is
+// now; the windows are shared, so moving highlights still show.
+func (m *Model) syncStackPane() {
+	pane := m.panes.Get("stack")
+	if pane == nil {
+		return
+	}
+	if sp, ok := pane.Content.(*StackPane); ok {
+		editors, tokens, current := m.editors, m.threadStack(m.tracerThread), m.tracerCurrent
+		sp.getStack = func() []StackFrame { return stackFrames(editors, tokens, current) }
+	}
+}
+
+// stackFrames describes the tracer windows in tokens, bottom to top
+func stackFrames(editors map[int]*EditorWindow, tokens []int, current int) []StackFrame {
+	frames := make([]StackFrame, 0, len(tokens))
+	for _, token := range tokens {
+		if w, exists := editors[token]; exists {
 			code := ""
 			if w.CurrentRow >= 0 && w.CurrentRow < len(w.Text) {
 				code = strings.TrimSpace(w.Text[w.CurrentRow])
@@ -2169,7 +2472,7 @@ func (m *Model) getStackFrames() []StackFrame {
 				Name:    w.Name,
 				Line:    w.CurrentRow,
 				Code:    code,
-				Current: token == m.tracerCurrent,
+				Current: token == current,
 			})
 		}
 	}
@@ -2183,10 +2486,7 @@ func (m *Model) toggleStackPane() {
 	}
 
 	// Create stack pane
-	stackPane := NewStackPane(
-		func() []StackFrame { return m.getStackFrames() },
-		func(token int) { m.showTracer(token) },
-	)
+	stackPane := NewStackPane(nil, func(token int) { m.showTracer(token) })
 
 	// Position: right side of screen
 	paneW := 30
@@ -2200,6 +2500,326 @@ func (m *Model) toggleStackPane() {
 	pane := NewPane("stack", stackPane, paneX, paneY, paneW, paneH)
 	m.panes.Add(pane)
 	m.panes.Focus("stack")
+	m.syncStackPane()
+}
+
+func (m *Model) toggleThreadsPane() {
+	if p := m.panes.Get("threads"); p != nil {
+		// If already open but not focused, focus it; otherwise close
+		if m.panes.FocusedPane() == p {
+			m.panes.Remove("threads")
+		} else {
+			m.panes.Focus("threads")
+		}
+		return
+	}
+
+	threadsPane := NewThreadsPane()
+	m.updateThreadsPane(threadsPane)
+	m.serviceThreadsPane(threadsPane)
+
+	// Position: right side of screen, below the stack pane
+	paneW := 40
+	paneH := min(m.height-4, 10)
+	if paneH < 5 {
+		paneH = 5
+	}
+	paneX := m.width - paneW - 2
+	paneY := min(18, max(m.height-paneH-2, 2))
+
+	pane := NewPane("threads", threadsPane, paneX, paneY, paneW, paneH)
+	m.panes.Add(pane)
+	m.panes.Focus("threads")
+}
+
+// updateThreadsPane rebuilds the threads pane's rows from its last thread
+// list and the open tracer windows.
+func (m *Model) updateThreadsPane(pane *ThreadsPane) {
+	var tracers []*EditorWindow
+	for _, token := range m.tracerStack {
+		if w, exists := m.editors[token]; exists {
+			tracers = append(tracers, w)
+		}
+	}
+	pane.SetRows(threadRows(pane.Infos, tracers), m.tracerThread)
+}
+
+// refreshThreadsPane updates the threads pane, if open, after tracer
+// windows have come or gone, and asks for the threads' new states.
+func (m *Model) refreshThreadsPane() {
+	if pane := m.panes.Get("threads"); pane != nil {
+		if tp, ok := pane.Content.(*ThreadsPane); ok {
+			m.updateThreadsPane(tp)
+			tp.PendingRefresh = true
+			m.serviceThreadsPane(tp)
+		}
+	}
+}
+
+// serviceThreadsPane carries out the threads pane's pending requests
+func (m *Model) serviceThreadsPane(pane *ThreadsPane) {
+	if pane.PendingRefresh && m.connected {
+		pane.PendingRefresh = false
+		m.log("→ GetThreads")
+		m.send("GetThreads", ride.GetThreads{})
+	}
+	action, tid := pane.PendingAction, pane.PendingTid
+	pane.PendingAction = ""
+	switch action {
+	case "switch":
+		m.switchThread(tid)
+	case "continue":
+		m.threadContinue(tid)
+	case "step":
+		m.threadStep(tid)
+	}
+	if action != "" {
+		m.updateThreadsPane(pane)
+	}
+}
+
+// switchThread makes tid the interpreter's current thread and shows its
+// innermost suspended function in the tracer, stack and variables panes.
+func (m *Model) switchThread(tid int) {
+	m.log("→ SetThread tid=%d", tid)
+	m.send("SetThread", ride.SetThread{Tid: tid})
+	m.tracerThread = tid
+	if stack := m.threadStack(tid); len(stack) > 0 {
+		m.showTracer(stack[len(stack)-1])
+	}
+	m.syncStackPane()
+	if pane := m.panes.Get("variables"); pane != nil {
+		if vp, ok := pane.Content.(*VariablesPane); ok {
+			m.fetchVariables(vp)
+		}
+	}
+}
+
+// threadContinue resumes thread tid only, leaving other threads suspended
+func (m *Model) threadContinue(tid int) {
+	stack := m.threadStack(tid)
+	if len(stack) == 0 {
+		return
+	}
+	win := stack[len(stack)-1]
+	m.log("→ Continue win=%d (thread %d)", win, tid)
+	m.breakpoints.SetStepping(false)
+	m.send("Continue", ride.TraceCommand{Win: win})
+}
+
+// threadStep runs the current line of thread tid's innermost function
+func (m *Model) threadStep(tid int) {
+	stack := m.threadStack(tid)
+	if len(stack) == 0 {
+		return
+	}
+	win := stack[len(stack)-1]
+	m.log("→ RunCurrentLine win=%d (thread %d)", win, tid)
+	m.breakpoints.SetStepping(true)
+	m.send("RunCurrentLine", ride.TraceCommand{Win: win})
+}
+
+// inlineTrace opens the inline trace pane on the tracer's current line,
+// or closes it if it is focused.
+func (m *Model) inlineTrace() {
+	if p := m.panes.Get("inline"); p != nil {
+		if m.panes.FocusedPane() == p {
+			m.closeInlineTrace()
+		} else {
+			m.panes.Focus("inline")
+		}
+		return
+	}
+	if m.tracerEditorPane() == nil {
+		return
+	}
+
+	inlinePane := NewInlineTracePane()
+
+	// Position: below the tracer pane
+	paneW := min(m.width-4, 60)
+	paneH := min(m.height-4, 12)
+	if paneH < 6 {
+		paneH = 6
+	}
+	paneX := (m.width - paneW) / 2
+	paneY := max(m.height-paneH-2, 2)
+
+	pane := NewPane("inline", inlinePane, paneX, paneY, paneW, paneH)
+	m.panes.Add(pane)
+	m.panes.Focus("inline")
+	m.retargetInlinePane()
+}
+
+// closeInlineTrace closes the inline trace pane and its highlight
+func (m *Model) closeInlineTrace() {
+	m.panes.Remove("inline")
+	if ep := m.tracerEditorPane(); ep != nil {
+		ep.ClearInlineSpan()
+	}
+}
+
+// tracerEditorPane returns the tracer pane's editor, or nil
+func (m *Model) tracerEditorPane() *EditorPane {
+	if pane := m.panes.Get("tracer"); pane != nil {
+		if ep, ok := pane.Content.(*EditorPane); ok {
+			return ep
+		}
+	}
+	return nil
+}
+
+// retargetInlinePane points the inline trace pane, if open, at the
+// tracer's current line.
+func (m *Model) retargetInlinePane() {
+	pane := m.panes.Get("inline")
+	if pane == nil {
+		return
+	}
+	ip, ok := pane.Content.(*InlineTracePane)
+	if !ok {
+		return
+	}
+	if w, exists := m.editors[m.tracerCurrent]; exists && w.CurrentRow >= 0 && w.CurrentRow < len(w.Text) {
+		ip.SetLine(w.CurrentRow, w.Text[w.CurrentRow])
+	}
+	m.serviceInlinePane(ip)
+}
+
+// serviceInlinePane moves the tracer's highlight to the step the inline
+// trace pane shows, and runs the pane's pending queries one at a time, as
+// for the workspace pane. An answer for a line the pane has since left is
+// dropped.
+func (m *Model) serviceInlinePane(pane *InlineTracePane) {
+	if ep := m.tracerEditorPane(); ep != nil {
+		if s := pane.Current(); s != nil {
+			ep.SetInlineSpan(pane.Row, s.Expr.Start, s.Expr.End)
+		} else {
+			ep.ClearInlineSpan()
+		}
+	}
+	if !m.connected || !m.ready || m.internalQuery != "" || m.continuation {
+		return
+	}
+	row, line := pane.Row, pane.Line
+	if names := pane.PendingNames; len(names) > 0 {
+		pane.PendingNames = nil
+		m.executeInternal(inlineNamesExpr(names), func(outputs []string) {
+			if pane.Row == row && pane.Line == line {
+				pane.SetClasses(parseInlineNames(names, outputs))
+			}
+		})
+		return
+	}
+	if exprs := pane.PendingValues; len(exprs) > 0 {
+		pane.PendingValues = nil
+		m.executeInternal(evalEachExpr(exprs), func(outputs []string) {
+			if pane.Row == row && pane.Line == line {
+				pane.SetValues(parseEvalEach(exprs, outputs))
+			}
+		})
+	}
+}
+
+// refreshAtPrompt brings the panes that show the workspace up to date
+// once the interpreter is ready again: the user's code may have changed
+// names and values, or the tracer stopped somewhere new.
+func (m *Model) refreshAtPrompt() {
+	// Refresh variables pane if open
+	if pane := m.panes.Get("variables"); pane != nil {
+		if vp, ok := pane.Content.(*VariablesPane); ok {
+			m.fetchVariables(vp)
+		}
+	}
+
+	// Refresh workspace pane: the user's code may have changed names
+	if pane := m.panes.Get("workspace"); pane != nil {
+		if wp, ok := pane.Content.(*WorkspacePane); ok {
+			wp.ReloadExpanded()
+			m.serviceWorkspacePane(wp)
+		}
+	}
+
+	// Inline trace lookups held back while the line ran
+	if pane := m.panes.Get("inline"); pane != nil {
+		if ip, ok := pane.Content.(*InlineTracePane); ok {
+			m.serviceInlinePane(ip)
+		}
+	}
+
+	// Watches are re-evaluated at every stop
+	m.refreshWatchPane()
+}
+
+// toggleWatchPane opens the watch expressions pane, focuses it, or closes
+// it if it is focused.
+func (m *Model) toggleWatchPane() {
+	if p := m.panes.Get("watch"); p != nil {
+		if m.panes.FocusedPane() == p {
+			m.panes.Remove("watch")
+		} else {
+			m.panes.Focus("watch")
+		}
+		return
+	}
+
+	watchPane := NewWatchPane(cachePath(watchesFile))
+
+	// Position: right side of screen, below the variables pane if present
+	paneW := min(m.width-4, 45)
+	paneH := min(m.height-4, 10)
+	if paneH < 5 {
+		paneH = 5
+	}
+	paneX := m.width - paneW - 2
+	paneY := 2
+	if varsPane := m.panes.Get("variables"); varsPane != nil {
+		paneY = varsPane.Y + varsPane.Height + 1
+	}
+
+	pane := NewPane("watch", watchPane, paneX, paneY, paneW, paneH)
+	m.panes.Add(pane)
+	m.panes.Focus("watch")
+	m.refreshWatchPane()
+}
+
+// refreshWatchPane shows the watches of the function the tracer is in, or
+// the session's outside the tracer, and has them all evaluated again.
+func (m *Model) refreshWatchPane() {
+	pane := m.panes.Get("watch")
+	if pane == nil {
+		return
+	}
+	wp, ok := pane.Content.(*WatchPane)
+	if !ok {
+		return
+	}
+	fn := ""
+	if w, exists := m.editors[m.tracerCurrent]; exists && m.tracerCurrent != 0 {
+		fn = w.Name
+	}
+	wp.SetFunction(fn)
+	wp.Refresh()
+	m.serviceWatchPane(wp)
+}
+
+// serviceWatchPane evaluates the watch pane's pending expressions, in one
+// query as for the inline trace. An answer for a function the pane has
+// since left is dropped.
+func (m *Model) serviceWatchPane(pane *WatchPane) {
+	if len(pane.PendingEval) == 0 {
+		return
+	}
+	if !m.connected || !m.ready || m.internalQuery != "" || m.continuation {
+		return
+	}
+	exprs, fn := pane.PendingEval, pane.fn
+	pane.PendingEval = nil
+	m.executeInternal(evalEachExpr(exprs), func(outputs []string) {
+		if pane.fn == fn {
+			pane.SetValues(parseEvalEach(exprs, outputs))
+		}
+	})
 }
 
 func (m *Model) toggleVariablesPane() {
@@ -2218,7 +2838,7 @@ func (m *Model) toggleVariablesPane() {
 	varsPane = NewVariablesPane(
 		func(name string) {
 			// Use Edit protocol message (not )ed) to avoid session pollution
-			m.send("Edit", map[string]any{"win": 0, "text": name, "pos": 0})
+			m.send("Edit", ride.Edit{Text: name})
 		},
 		func(mode VarsMode) {
 			// Re-fetch when mode changes
@@ -2248,6 +2868,87 @@ func (m *Model) toggleVariablesPane() {
 	m.panes.Focus("variables")
 }
 
+func (m *Model) toggleWorkspacePane() {
+	if p := m.panes.Get("workspace"); p != nil {
+		// If already open but not focused, focus it; otherwise close
+		if m.panes.FocusedPane() == p {
+			m.panes.Remove("workspace")
+		} else {
+			m.panes.Focus("workspace")
+		}
+		return
+	}
+
+	wsPane := NewWorkspacePane()
+	wsPane.Expand("#")
+	m.serviceWorkspacePane(wsPane)
+
+	// Position: left side of screen
+	paneW := 35
+	paneH := min(m.height-4, 20)
+	if paneH < 5 {
+		paneH = 5
+	}
+
+	pane := NewPane("workspace", wsPane, 2, 2, paneW, paneH)
+	m.panes.Add(pane)
+	m.panes.Focus("workspace")
+}
+
+// serviceWorkspacePane carries out the workspace pane's pending requests.
+// Queries wait until no other internal query is running; the next one is
+// sent when the current one completes.
+func (m *Model) serviceWorkspacePane(pane *WorkspacePane) {
+	if path := pane.PendingOpen; path != "" {
+		pane.PendingOpen = ""
+		// Edit protocol message, as for the variables pane
+		m.wsArrayNotation = ""
+		if n := pane.find(path); n != nil && n.class >= 2 && n.class < 3 {
+			m.wsArrayNotation = path
+		}
+		m.send("Edit", ride.Edit{Text: path, Pos: len([]rune(path))})
+	}
+	if !m.connected || !m.ready || m.internalQuery != "" || m.continuation {
+		return
+	}
+
+	// Delete and rename re-list the namespace in the same query
+	if path := pane.PendingDelete; path != "" {
+		pane.PendingDelete = ""
+		m.listWorkspace(pane, parentPath(path), workspaceDeleteExpr(path))
+		return
+	}
+	if path, newName := pane.PendingRename[0], pane.PendingRename[1]; path != "" {
+		pane.PendingRename = [2]string{}
+		m.listWorkspace(pane, parentPath(path), workspaceRenameExpr(path, newName))
+		return
+	}
+	if len(pane.PendingList) > 0 {
+		ns := pane.PendingList[0]
+		pane.PendingList = pane.PendingList[1:]
+		m.listWorkspace(pane, ns, "")
+	}
+}
+
+// listWorkspace runs before (if any) and then lists namespace ns into the
+// workspace pane. Listing # also picks up linked namespaces.
+func (m *Model) listWorkspace(pane *WorkspacePane, ns, before string) {
+	expr := before + workspaceListExpr(ns)
+	if ns == "#" {
+		expr = workspaceLinksExpr + " ⋄ " + expr
+	}
+	m.executeInternal(expr, func(outputs []string) {
+		entries, links, errs := parseWorkspaceEntries(outputs)
+		for _, l := range links {
+			pane.AddLink(l[0], l[1])
+		}
+		pane.SetEntries(ns, entries)
+		if len(errs) > 0 {
+			pane.SetError(strings.Join(errs, "; "))
+		}
+	})
+}
+
 // fetchVariables fetches variables and populates the variables pane
 func (m *Model) fetchVariables(pane *VariablesPane) {
 	if m.client == nil {
@@ -2411,13 +3112,12 @@ func (m *Model) requestAutocomplete(token int) {
 		return
 	}
 
+	if m.prepl != nil {
+		return // no completions without RIDE; not worth a status line per keystroke
+	}
 	m.acPending = true
 	m.log("→ GetAutocomplete line=%q pos=%d token=%d", line, pos, token)
-	m.send("GetAutocomplete", map[string]any{
-		"line":  line,
-		"pos":   pos,
-		"token": token,
-	})
+	m.send("GetAutocomplete", ride.GetAutocomplete{Line: line, Pos: pos, Token: token})
 }
 
 // shouldTriggerAutocomplete checks if cursor position is valid for autocomplete
@@ -2626,13 +3326,125 @@ func (m *Model) toggleBreakpoint() {
 		return
 	}
 
-	// Toggle the breakpoint
+	// Toggle the breakpoint, and drop its condition when it goes
 	ep.window.ToggleStop(ep.window.CursorRow)
+	if m.breakpoints != nil && !ep.window.HasStop(ep.window.CursorRow) {
+		m.breakpoints.Set(ep.window.Name, ep.window.CursorRow, nil)
+	}
 
 	// Send immediately so breakpoint takes effect without requiring save
 	m.sendSetLineAttributes(ep.window.Token)
 }
 
+// editBreakpoint opens the breakpoint pane on the current line of the
+// focused editor/tracer, to set a condition, hit count or log message.
+func (m *Model) editBreakpoint() {
+	fp := m.panes.FocusedPane()
+	if fp == nil {
+		return
+	}
+	ep, ok := fp.Content.(*EditorPane)
+	if !ok {
+		return
+	}
+	if m.breakpoints == nil {
+		m.breakpoints = NewBreakpoints()
+	}
+	w := ep.window
+	bpPane := NewBreakpointPane(w.Name, w.CursorRow, m.breakpoints.Get(w.Name, w.CursorRow))
+	bpPane.Token, bpPane.PaneID = w.Token, fp.ID
+
+	paneW := min(m.width-4, 50)
+	paneH := 6
+	paneX := (m.width - paneW) / 2
+	paneY := (m.height - paneH) / 2
+
+	pane := NewPane("breakpoint", bpPane, paneX, paneY, paneW, paneH)
+	m.panes.Add(pane)
+	m.panes.Focus("breakpoint")
+}
+
+// serviceBreakpointPane sets the breakpoint entered, making the line a stop
+// line if it wasn't, and goes back to the window it was opened from.
+func (m *Model) serviceBreakpointPane(pane *BreakpointPane) {
+	if !pane.PendingSave {
+		return
+	}
+	pane.PendingSave = false
+	m.panes.Remove("breakpoint")
+	m.breakpoints.Set(pane.Fn, pane.Line, pane.Breakpoint())
+	if w, exists := m.editors[pane.Token]; exists {
+		if !w.HasStop(pane.Line) {
+			w.ToggleStop(pane.Line)
+		}
+		m.sendSetLineAttributes(pane.Token)
+	}
+	if m.panes.Get(pane.PaneID) != nil {
+		m.panes.Focus(pane.PaneID)
+	}
+}
+
+// checkBreakpoint decides a stop, when a tracer window has moved since the
+// last prompt other than by a step, onto a stop line with a condition,
+// hit count or log message. It reports whether it took the prompt over:
+// the stop is decided once its expressions are evaluated, and then stands
+// or runs on (see serviceBreakpoints).
+func (m *Model) checkBreakpoint() bool {
+	b := m.breakpoints
+	if b == nil {
+		return false
+	}
+	win := b.arrived
+	b.arrived, b.stepping = 0, false
+	w, exists := m.editors[win]
+	if !exists || !w.HasStop(w.CurrentRow) {
+		return false
+	}
+	bp := b.Get(w.Name, w.CurrentRow)
+	if bp == nil {
+		return false
+	}
+	m.log("  breakpoint %s[%d]: %s", w.Name, w.CurrentRow, bp)
+	exprs := bp.exprs()
+	if len(exprs) == 0 {
+		b.verdict = bp.decide(win, nil)
+		m.serviceBreakpoints()
+		return true
+	}
+	if err := m.executeInternal(evalEachExpr(exprs), func(outputs []string) {
+		b.verdict = bp.decide(win, parseEvalEach(exprs, outputs))
+	}); err != nil {
+		return false
+	}
+	return true
+}
+
+// serviceBreakpoints carries out a breakpoint's verdict: its lines go to
+// the session, then the tracer runs on, or stops as at any prompt.
+func (m *Model) serviceBreakpoints() {
+	b := m.breakpoints
+	if b == nil || b.verdict == nil {
+		return
+	}
+	v := b.verdict
+	b.verdict = nil
+	for _, line := range v.lines {
+		m.lines = append(m.lines, Line{Text: line})
+	}
+	if !v.stop {
+		m.ready = false
+		m.log("→ Continue win=%d (breakpoint)", v.win)
+		m.send("Continue", ride.TraceCommand{Win: v.win})
+		m.cursorRow = len(m.lines) - 1
+		m.cursorCol = 0
+		return
+	}
+	m.lines = append(m.lines, Line{Text: aplIndent})
+	m.cursorRow = len(m.lines) - 1
+	m.cursorCol = len(aplIndent)
+	m.refreshAtPrompt()
+}
+
 // dispatchCommand is kept for any callers that still use string-based dispatch.
 // It delegates to the command registry.
 func (m *Model) dispatchCommand(action string) (tea.Model, tea.Cmd) {
@@ -2656,7 +3468,8 @@ func (m *Model) buildTracerBindings() []tracerBinding {
 		{"resume-all", func() { m.tracerResumeAll() }},
 		{"trace-back", func() { m.tracerBackward() }},
 		{"trace-forward", func() { m.tracerForward() }},
-		{"edit-mode", nil}, // handled specially in EditorPane
+		{"edit-mode", nil},    // handled specially in EditorPane
+		{"inline-trace", nil}, // EditorPane sets PendingInlineTrace
 	}
 	var bindings []tracerBinding
 	for _, d := range defs {
@@ -2668,6 +3481,7 @@ func (m *Model) buildTracerBindings() []tracerBinding {
 				// Will be handled by returning true with nil callback
 			}
 			bindings = append(bindings, tracerBinding{
+				name:     d.name,
 				binding:  cmd.Binding,
 				callback: cb,
 			})
@@ -3060,11 +3874,13 @@ func (m *Model) doSaveConfig(path string) {
 		Bindings     map[string]BindingDef `json:"bindings"`
 		Navigation   NavConfig             `json:"navigation"`
 		Autolocalise bool                  `json:"autolocalise,omitempty"`
+		Theme        map[string]string     `json:"theme,omitempty"`
 	}{
 		Accent:       m.config.Accent,
 		Bindings:     m.config.Bindings,
 		Navigation:   m.config.Navigation,
 		Autolocalise: m.config.Autolocalise,
+		Theme:        m.config.Theme,
 	}
 
 	data, err := json.MarshalIndent(cfg, "", "  ")
@@ -3162,13 +3978,6 @@ func (m Model) handleRide(ev rideEvent) (tea.Model, tea.Cmd) {
 		return m, nil
 	}
 
-	if ev.msg == nil {
-		if ev.raw != "" {
-			m.log("← raw: %s", ev.raw)
-		}
-		return m, waitForRide(m.msgs)
-	}
-
 	msg := ev.msg
 
 	// Log full message for debugging
@@ -3178,29 +3987,35 @@ func (m Model) handleRide(ev rideEvent) (tea.Model, tea.Cmd) {
 		m.log("← %s %v", msg.Command, msg.Args)
 	}
 
-	switch msg.Command {
-	case "AppendSessionOutput":
+	typed, err := msg.Typed()
+	if err != nil {
+		m.log("  (undecodable: %v)", err)
+		return m, waitForRide(m.msgs)
+	}
+	m.publishRide(typed)
+	value := ev.value
+
+	switch ev := typed.(type) {
+	case *ride.AppendSessionOutput:
 		// Skip multiline body echo (type 11) when draining queue
-		if t, ok := msg.Args["type"].(float64); ok && int(t) == 11 {
+		if ev.Type == 11 {
 			m.log("  (skipped: multiline body echo)")
 			return m, waitForRide(m.msgs)
 		}
 		// Skip input echo (type 14) only if it matches what we sent
-		if t, ok := msg.Args["type"].(float64); ok && int(t) == 14 {
-			if result, ok := msg.Args["result"].(string); ok && result == m.lastExecute {
+		if ev.Type == 14 {
+			if ev.Result == m.lastExecute {
 				m.log("  (skipped: our input echo)")
 				m.lastExecute = "" // Clear after matching
 				return m, waitForRide(m.msgs)
 			}
 			// Skip internal query echo
-			if m.internalQuery != "" {
-				if result, ok := msg.Args["result"].(string); ok && result == m.internalQuery+"\n" {
-					m.log("  (skipped: internal query echo)")
-					return m, waitForRide(m.msgs)
-				}
+			if m.internalQuery != "" && ev.Result == m.internalQuery+"\n" {
+				m.log("  (skipped: internal query echo)")
+				return m, waitForRide(m.msgs)
 			}
 			// Skip )off from external input - just noise before disconnect
-			if result, ok := msg.Args["result"].(string); ok && strings.TrimSpace(result) == ")off" {
+			if strings.TrimSpace(ev.Result) == ")off" {
 				m.log("  (skipped: external )off)")
 				return m, waitForRide(m.msgs)
 			}
@@ -3210,107 +4025,151 @@ func (m Model) handleRide(ev rideEvent) (tea.Model, tea.Cmd) {
 
 		// Route output to internal query if one is pending
 		if m.internalQuery != "" {
-			if result, ok := msg.Args["result"].(string); ok {
-				m.internalOutputs = append(m.internalOutputs, result)
-				m.log("  (internal query output)")
+			m.internalOutputs = append(m.internalOutputs, ev.Result)
+			m.log("  (internal query output)")
+			return m, waitForRide(m.msgs)
+		}
+
+		// Mirror to the active socket request's buffer so the
+		// reader goroutine can return it to the client. The TUI
+		// session still receives the same chunk below — Dyalog
+		// only has one RIDE client, so output is shared.
+		if m.activeSocket != nil {
+			m.activeSocket.outputs = append(m.activeSocket.outputs, socketOutput{text: ev.Result, error: ev.Type == 5})
+			if m.activeSocket.quiet {
+				return m, waitForRide(m.msgs)
 			}
+		}
+		if value != nil {
+			m.lastValue = value
+		}
+		result := strings.TrimSuffix(ev.Result, "\n")
+		for _, line := range strings.Split(result, "\n") {
+			m.lines = append(m.lines, Line{Text: line})
+		}
+		m.cursorRow = len(m.lines) - 1
+		m.cursorCol = 0
+
+	case *ride.HadError:
+		if m.activeSocket != nil {
+			m.activeSocket.en = ev.Error
+		}
+
+	case *ride.SetPromptType:
+		wasReady := m.ready
+		m.ready = ev.Ready()
+		m.log("  ready: %v → %v", wasReady, m.ready)
+		if m.ready && ev.Type != 3 {
+			m.continuation = false // Block done, or interrupted
+		}
+
+		// Drain pending multiline queue — one line per prompt
+		if m.ready && len(m.pendingLines) > 0 {
+			next := m.pendingLines[0]
+			m.pendingLines = m.pendingLines[1:]
+			m.ready = false
+			m.lastExecute = next
+			m.log("→ Execute (queued, %d remaining) %q", len(m.pendingLines), next)
+			m.send("Execute", ride.Execute{Text: next})
 			return m, waitForRide(m.msgs)
 		}
 
-		if result, ok := msg.Args["result"].(string); ok {
-			// Mirror to the active socket request's buffer so the
-			// reader goroutine can return it to the client. The TUI
-			// session still receives the same chunk below — Dyalog
-			// only has one RIDE client, so output is shared.
-			if m.activeSocket != nil {
-				m.activeSocket.outputs = append(m.activeSocket.outputs, result)
+		// Complete internal query if one was pending
+		// Only on not-ready→ready transition (type=0→1), not duplicate type=1→1
+		if m.ready && !wasReady && m.internalQuery != "" {
+			m.log("  internal query complete: %d outputs", len(m.internalOutputs))
+			oldQuery := m.internalQuery
+			if m.internalCallback != nil {
+				m.internalCallback(m.internalOutputs)
 			}
-			result = strings.TrimSuffix(result, "\n")
-			for _, line := range strings.Split(result, "\n") {
-				m.lines = append(m.lines, Line{Text: line})
+			// Only clear if callback didn't start a new query
+			if m.internalQuery == oldQuery {
+				m.internalQuery = ""
+				m.internalCallback = nil
+				m.internalOutputs = nil
 			}
-			m.cursorRow = len(m.lines) - 1
-			m.cursorCol = 0
-		}
-
-	case "SetPromptType":
-		if t, ok := msg.Args["type"].(float64); ok {
-			wasReady := m.ready
-			m.ready = t > 0
-			m.log("  ready: %v → %v", wasReady, m.ready)
-
-			// Drain pending multiline queue — one line per prompt
-			if t > 0 && len(m.pendingLines) > 0 {
-				next := m.pendingLines[0]
-				m.pendingLines = m.pendingLines[1:]
-				m.ready = false
-				m.lastExecute = next
-				m.log("→ Execute (queued, %d remaining) %q", len(m.pendingLines), next)
-				m.send("Execute", map[string]any{"text": next, "trace": 0})
-				return m, waitForRide(m.msgs)
+			// A breakpoint's expressions decide whether its stop stands
+			m.serviceBreakpoints()
+			// Workspace listings queue up behind each other
+			if pane := m.panes.Get("workspace"); pane != nil {
+				if wp, ok := pane.Content.(*WorkspacePane); ok {
+					m.serviceWorkspacePane(wp)
+				}
 			}
-
-			// Complete internal query if one was pending
-			// Only on not-ready→ready transition (type=0→1), not duplicate type=1→1
-			if m.ready && !wasReady && m.internalQuery != "" {
-				m.log("  internal query complete: %d outputs", len(m.internalOutputs))
-				oldQuery := m.internalQuery
-				if m.internalCallback != nil {
-					m.internalCallback(m.internalOutputs)
+			// As do the inline trace's lookups
+			if pane := m.panes.Get("inline"); pane != nil {
+				if ip, ok := pane.Content.(*InlineTracePane); ok {
+					m.serviceInlinePane(ip)
 				}
-				// Only clear if callback didn't start a new query
-				if m.internalQuery == oldQuery {
-					m.internalQuery = ""
-					m.internalCallback = nil
-					m.internalOutputs = nil
+			}
+			if pane := m.panes.Get("watch"); pane != nil {
+				if wp, ok := pane.Content.(*WatchPane); ok {
+					m.serviceWatchPane(wp)
 				}
-				// Don't add new input line for internal queries
-				return m, waitForRide(m.msgs)
 			}
+			// Don't add new input line for internal queries
+			return m, waitForRide(m.msgs)
+		}
 
-			// Complete the in-flight socket injection: hand its
-			// captured output back to the reader goroutine, which
-			// writes it to the client and returns to its read loop.
-			if m.ready && !wasReady && m.activeSocket != nil {
-				req := m.activeSocket
-				m.activeSocket = nil
-				m.log("  socket Execute complete: %d outputs", len(req.outputs))
-				req.done <- strings.Join(req.outputs, "")
-				// Fall through to drain the next socket request or
-				// add a new input line if the queue is empty.
-			}
+		// The interpreter wants the rest of a definition typed in the
+		// session: hold further lines back until the block is complete
+		if ev.Type == 3 && !wasReady && m.activeSocket == nil {
+			m.continuation = true
+			m.continuationStart = len(m.lines) - 1
+			m.log("  continuation (start=%d)", m.continuationStart)
+		}
+
+		// Complete the in-flight socket injection: hand its
+		// captured output back to the reader goroutine, which
+		// writes it to the client and returns to its read loop.
+		if m.ready && !wasReady && m.activeSocket != nil {
+			req := m.activeSocket
+			m.activeSocket = nil
+			m.log("  socket Execute complete: %d outputs", len(req.outputs))
+			req.finished = time.Now()
+			close(req.done)
+			// Fall through to drain the next socket request or
+			// add a new input line if the queue is empty.
+		}
+
+		// Pop the next socket injection if the interaction tier
+		// is idle. Mirrors the multiline-drain pattern above.
+		if m.ready && !wasReady && len(m.socketQueue) > 0 && m.internalQuery == "" {
+			m.drainSocketQueue()
+			m.reportSocketQueue()
+			return m, waitForRide(m.msgs)
+		}
 
-			// Pop the next socket injection if the interaction tier
-			// is idle. Mirrors the multiline-drain pattern above.
-			if m.ready && !wasReady && len(m.socketQueue) > 0 && m.internalQuery == "" {
-				m.drainSocketQueue()
+		if m.ready && !wasReady {
+			// A stop at a conditional breakpoint or logpoint may not stand
+			if !m.continuation && m.checkBreakpoint() {
 				return m, waitForRide(m.msgs)
 			}
 
-			if m.ready && !wasReady {
-				// Add new input line with APL indent
-				m.lines = append(m.lines, Line{Text: aplIndent})
-				m.cursorRow = len(m.lines) - 1
-				m.cursorCol = len(aplIndent)
-
-				// Refresh variables pane if open
-				if pane := m.panes.Get("variables"); pane != nil {
-					if vp, ok := pane.Content.(*VariablesPane); ok {
-						m.fetchVariables(vp)
-					}
-				}
+			// Add new input line with APL indent
+			m.lines = append(m.lines, Line{Text: aplIndent})
+			m.cursorRow = len(m.lines) - 1
+			m.cursorCol = len(aplIndent)
+			if m.continuation {
+				return m, waitForRide(m.msgs)
 			}
+			m.refreshAtPrompt()
 		}
 
-	case "OpenWindow":
-		w := NewEditorWindow(msg.Args)
+	case *ride.OpenWindow:
+		w := NewEditorWindow(ev)
 		m.editors[w.Token] = w
+		// Only for the array asked for: an Edit that failed opens nothing
+		arrayNotation := m.wsArrayNotation != "" && sameEntity(m.wsArrayNotation, w.Name)
+		m.wsArrayNotation = ""
 
 		if w.Debugger {
 			// Tracer window - add to stack, show single tracer pane
 			m.tracerStack = append(m.tracerStack, w.Token)
+			m.breakpoints.Arrive(w.Token)
 			m.showTracer(w.Token)
-			m.log("  opened tracer: %s (token=%d, stack depth=%d)", w.Name, w.Token, len(m.tracerStack))
+			m.refreshThreadsPane()
+			m.log("  opened tracer: %s (token=%d, thread=%d, stack depth=%d)", w.Name, w.Token, w.Tid, len(m.tracerStack))
 		} else if browser := m.tryDataBrowser(w); browser != nil {
 			// APLAN compound value - open structured data browser
 			paneW := min(m.width-4, 60)
@@ -3336,9 +4195,10 @@ func (m Model) handleRide(ev rideEvent) (tea.Model, tea.Cmd) {
 				func() { m.saveEditor(token) },
 				func() { m.closeEditor(token) },
 			)
+			editorPane.breakpoints = m.breakpoints
 			editorPane.onArrayNotation = func() {
 				m.log("→ ShowAsArrayNotation win=%d", token)
-				m.send("ShowAsArrayNotation", map[string]any{"win": token})
+				m.send("ShowAsArrayNotation", ride.ShowAsArrayNotation{Win: token})
 			}
 			editorPane.onFormat = func() {
 				m.formatEditor(token)
@@ -3346,6 +4206,10 @@ func (m Model) handleRide(ev rideEvent) (tea.Model, tea.Cmd) {
 			editorPane.onNewline = func() {
 				m.autolocaliseEditor(token)
 			}
+			if arrayNotation && isArrayEntity(w.EntityType) {
+				m.log("→ ShowAsArrayNotation win=%d (from workspace pane)", token)
+				m.send("ShowAsArrayNotation", ride.ShowAsArrayNotation{Win: token})
+			}
 
 			// Position: center of screen
 			paneW := min(m.width-4, 60)
@@ -3366,10 +4230,10 @@ func (m Model) handleRide(ev rideEvent) (tea.Model, tea.Cmd) {
 			m.log("  opened editor: %s (token=%d, entityType=%d, readOnly=%v)", w.Name, w.Token, w.EntityType, w.ReadOnly)
 		}
 
-	case "UpdateWindow":
-		token := int(msg.Args["token"].(float64))
+	case *ride.UpdateWindow:
+		token := ev.Token
 		if w, exists := m.editors[token]; exists {
-			w.Update(msg.Args)
+			w.Update(ev)
 			// Clamp cursor to new text bounds
 			if w.CursorRow >= len(w.Text) {
 				w.CursorRow = max(len(w.Text)-1, 0)
@@ -3395,12 +4259,14 @@ func (m Model) handleRide(ev rideEvent) (tea.Model, tea.Cmd) {
 			m.log("  updated: %s (token=%d, entityType=%d, readOnly=%v)", w.Name, token, w.EntityType, w.ReadOnly)
 		}
 
-	case "CloseWindow":
-		win := int(msg.Args["win"].(float64))
+	case *ride.CloseWindow:
+		win := ev.Win
 
 		// Check if this is a tracer window
 		if m.isInTracerStack(win) {
 			m.removeFromTracerStack(win)
+			delete(m.editors, win)
+			m.refreshThreadsPane()
 			m.log("  closed tracer: token=%d (stack depth=%d)", win, len(m.tracerStack))
 		} else {
 			// Regular editor
@@ -3417,12 +4283,8 @@ func (m Model) handleRide(ev rideEvent) (tea.Model, tea.Cmd) {
 			}
 		}
 
-	case "ReplySaveChanges":
-		win := int(msg.Args["win"].(float64))
-		errCode := 0
-		if e, ok := msg.Args["err"].(float64); ok {
-			errCode = int(e)
-		}
+	case *ride.ReplySaveChanges:
+		win, errCode := ev.Win, ev.Err
 
 		if errCode == 0 {
 			m.log("  save succeeded: token=%d", win)
@@ -3442,32 +4304,25 @@ func (m Model) handleRide(ev rideEvent) (tea.Model, tea.Cmd) {
 			}
 		}
 
-	case "ReplyFormatCode":
-		win := int(msg.Args["win"].(float64))
-		if w, exists := m.editors[win]; exists {
-			if lines, ok := msg.Args["text"].([]any); ok {
-				text := make([]string, len(lines))
-				for i, l := range lines {
-					text[i], _ = l.(string)
-				}
-				w.Text = text
-				// Clamp cursor
-				if w.CursorRow >= len(w.Text) {
-					w.CursorRow = max(len(w.Text)-1, 0)
-				}
-				if w.CursorRow >= 0 && w.CursorRow < len(w.Text) {
-					lineLen := len([]rune(w.Text[w.CursorRow]))
-					if w.CursorCol > lineLen {
-						w.CursorCol = lineLen
-					}
+	case *ride.ReplyFormatCode:
+		win := ev.Win
+		if w, exists := m.editors[win]; exists && ev.Text != nil {
+			w.Text = ev.Text
+			// Clamp cursor
+			if w.CursorRow >= len(w.Text) {
+				w.CursorRow = max(len(w.Text)-1, 0)
+			}
+			if w.CursorRow >= 0 && w.CursorRow < len(w.Text) {
+				lineLen := len([]rune(w.Text[w.CursorRow]))
+				if w.CursorCol > lineLen {
+					w.CursorCol = lineLen
 				}
-				m.log("  formatted: token=%d, lines=%d", win, len(text))
 			}
+			m.log("  formatted: token=%d, lines=%d", win, len(w.Text))
 		}
 
-	case "SetHighlightLine":
-		win := int(msg.Args["win"].(float64))
-		line := int(msg.Args["line"].(float64))
+	case *ride.SetHighlightLine:
+		win, line := ev.Win, ev.Line
 
 		// Store highlight in the window itself
 		if w, exists := m.editors[win]; exists {
@@ -3476,6 +4331,7 @@ func (m Model) handleRide(ev rideEvent) (tea.Model, tea.Cmd) {
 
 		// Update pane if this is the current tracer or a regular editor
 		if m.isInTracerStack(win) {
+			m.breakpoints.Arrive(win)
 			// If this is the current tracer, update the tracer pane
 			if win == m.tracerCurrent {
 				if pane := m.panes.Get("tracer"); pane != nil {
@@ -3503,45 +4359,37 @@ func (m Model) handleRide(ev rideEvent) (tea.Model, tea.Cmd) {
 				}
 			}
 		}
+		// After the variables, whose fetch doesn't wait its turn
+		if win == m.tracerCurrent {
+			m.retargetInlinePane()
+		}
+
+	case *ride.ReplyGetThreads:
+		if pane := m.panes.Get("threads"); pane != nil {
+			if tp, ok := pane.Content.(*ThreadsPane); ok {
+				tp.Infos = ev.Threads
+				m.updateThreadsPane(tp)
+			}
+		}
 
-	case "WindowTypeChanged":
-		win := int(msg.Args["win"].(float64))
-		tracer := int(msg.Args["tracer"].(float64))
+	case *ride.WindowTypeChanged:
+		win := ev.Win
 		if w, exists := m.editors[win]; exists {
-			w.Debugger = tracer != 0
+			w.Debugger = bool(ev.Tracer)
 			m.log("  window type changed: token=%d, tracer=%v", win, w.Debugger)
 		}
 
-	case "OptionsDialog":
-		token := 0
-		if t, ok := msg.Args["token"].(float64); ok {
-			token = int(t)
-		}
-		title := ""
-		if t, ok := msg.Args["title"].(string); ok {
-			title = t
-		}
-		m.log("  OptionsDialog: token=%d, title=%q", token, title)
+	case *ride.OptionsDialog:
+		token := ev.Token
+		m.log("  OptionsDialog: token=%d, title=%q", token, ev.Title)
 
 		// Auto-reply "No" (replace only the name being edited) for APLAN namespace saves
 		// TODO: Show actual dialog UI for user choice
 		m.log("→ ReplyOptionsDialog token=%d, index=1 (No)", token)
-		m.send("ReplyOptionsDialog", map[string]any{"token": token, "index": 1})
-
-	case "ReplyGetAutocomplete":
-		token := int(msg.Args["token"].(float64))
-		skip := 0
-		if s, ok := msg.Args["skip"].(float64); ok {
-			skip = int(s)
-		}
-		var options []string
-		if opts, ok := msg.Args["options"].([]any); ok {
-			for _, o := range opts {
-				if s, ok := o.(string); ok {
-					options = append(options, s)
-				}
-			}
-		}
+		m.send("ReplyOptionsDialog", ride.ReplyOptionsDialog{Token: token, Index: 1})
+
+	case *ride.ReplyGetAutocomplete:
+		token, skip, options := ev.Token, ev.Skip, ev.Options
 		m.log("  autocomplete: token=%d, skip=%d, options=%d", token, skip, len(options))
 
 		// Ignore if we're not waiting for autocomplete
@@ -3575,6 +4423,12 @@ func (m Model) handleRide(ev rideEvent) (tea.Model, tea.Cmd) {
 
 func (m Model) View() string {
 	if m.connecting {
+		if m.preplAddr != "" {
+			return splash + fmt.Sprintf("\n  gritt - Go RIDE Terminal\n  Connecting to prepl %s...\n", m.preplAddr)
+		}
+		if m.listener != nil {
+			return splash + fmt.Sprintf("\n  gritt - Go RIDE Terminal\n  Waiting for Dyalog on %s (RIDE_INIT=CONNECT:%s)...\n", m.addr, m.addr)
+		}
 		return splash + fmt.Sprintf("\n  gritt - Go RIDE Terminal\n  Connecting to %s...\n", m.addr)
 	}
 	if m.err != nil {
@@ -3711,6 +4565,9 @@ func (m Model) viewSession(w, h int) string {
 	if m.multilineMode {
 		title += " [ML]"
 	}
+	if m.continuation {
+		title += " [CONT]"
+	}
 
 	return m.renderBox(title, content, contentW, contentH, borderColor)
 }
@@ -3780,6 +4637,13 @@ func (m Model) renderSession(w, h int) string {
 			runes = runes[:maxLen]
 		}
 
+		// Highlight input: lines at the prompt indent or edited by the user.
+		// Output is left as the interpreter formatted it.
+		var kinds []syntax.Kind
+		if strings.HasPrefix(text, aplIndent) || lineData.Edited {
+			kinds = syntax.KindAt(text)
+		}
+
 		// Render with cursor if this is the current line
 		if srcIdx == m.cursorRow {
 			col := m.cursorCol
@@ -3789,7 +4653,10 @@ func (m Model) renderSession(w, h int) string {
 
 			var rendered string
 			var visualLen int
-			if col < len(runes) {
+			if kinds != nil {
+				rendered = highlightRunes(runes, kinds, col, cursorStyle)
+				visualLen = max(len(runes), col+1)
+			} else if col < len(runes) {
 				// Cursor on a character - visual length unchanged
 				rendered = string(runes[:col]) + cursorStyle.Render(string(runes[col])) + string(runes[col+1:])
 				visualLen = len(runes)
@@ -3806,6 +4673,9 @@ func (m Model) renderSession(w, h int) string {
 		} else {
 			// Pad to width
 			line := string(runes)
+			if kinds != nil {
+				line = highlightRunes(runes, kinds, -1, cursorStyle)
+			}
 			if len(runes) < w {
 				line += strings.Repeat(" ", w-len(runes))
 			}
@@ -1,14 +1,19 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
 	"net"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"reflect"
 	"testing"
 	"time"
 
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/cursork/gritt/ride"
+	"github.com/cursork/gritt/ride/ridetest"
 	"github.com/cursork/gritt/uitest"
 )
 
@@ -33,6 +38,110 @@ func pickPort(t *testing.T) int {
 	return port
 }
 
+// testModel is a Model driven the way the program loop drives it.
+type testModel struct {
+	Model
+	t *testing.T
+}
+
+// newTestModel returns an 80×24 Model with the default commands, connected
+// to client and ready for input unless client is nil.
+func newTestModel(t *testing.T, client *ride.Client) *testModel {
+	t.Helper()
+	var cfg Config
+	if err := json.Unmarshal(defaultConfigJSON, &cfg); err != nil {
+		t.Fatal(err)
+	}
+	return &testModel{t: t, Model: Model{
+		client:      client,
+		connected:   client != nil,
+		ready:       client != nil,
+		panes:       NewPaneManager(80, 24),
+		editors:     make(map[int]*EditorWindow),
+		breakpoints: NewBreakpoints(),
+		debugLog:    &LogBuffer{},
+		commands:    buildCommands(&cfg),
+		width:       80,
+		height:      24,
+	}}
+}
+
+// recv handles a message from the interpreter.
+func (m *testModel) recv(msg *ride.Message) {
+	m.t.Helper()
+	next, _ := m.handleRide(rideEvent{msg: msg})
+	m.Model = next.(Model)
+}
+
+// update handles any other message, such as a key press.
+func (m *testModel) update(msg tea.Msg) {
+	m.t.Helper()
+	next, _ := m.Update(msg)
+	m.Model = next.(Model)
+}
+
+// TestContinuation types a ∇ definition into the session while the
+// interpreter is in its line editor (SetPromptType type 3): lines after
+// the header are held back until the closing ∇, then sent one per prompt.
+func TestContinuation(t *testing.T) {
+	client, srv := fakeInterpreter(t, ridetest.LineEditor(ridetest.Eval(nil)))
+	m := Model{
+		client:    client,
+		connected: true,
+		ready:     true,
+		panes:     NewPaneManager(80, 24),
+		editors:   make(map[int]*EditorWindow),
+		debugLog:  &LogBuffer{},
+		lines:     []Line{{Text: aplIndent + "∇ r←Dbl y"}},
+	}
+	prompt := func(typ int) {
+		t.Helper()
+		next, _ := m.handleRide(rideEvent{msg: ridetest.Prompt(typ)})
+		m = next.(Model)
+	}
+	enter := func(text string) {
+		t.Helper()
+		m.setCurrentLine(aplIndent + text)
+		next, _ := m.execute()
+		m = next.(Model)
+	}
+
+	enter("∇ r←Dbl y")
+	prompt(3)
+	if !m.continuation || m.continuationStart != 0 || len(m.lines) != 2 {
+		t.Fatalf("after type 3: continuation=%v start=%d lines=%d", m.continuation, m.continuationStart, len(m.lines))
+	}
+	enter("  r←y×2")
+	if !m.continuation || len(m.lines) != 3 || m.cursorRow != 2 {
+		t.Fatalf("incomplete block was sent: continuation=%v lines=%d", m.continuation, len(m.lines))
+	}
+
+	// Back up and edit a held line; Enter there opens a line below it
+	m.cursorRow = 1
+	enter("  r←y+y")
+	if len(m.lines) != 4 || m.cursorRow != 2 {
+		t.Fatalf("Enter inside block: lines=%d row=%d", len(m.lines), m.cursorRow)
+	}
+	enter("∇")
+	if m.continuation || m.ready || !reflect.DeepEqual(m.pendingLines, []string{"[2]  ∇\n"}) {
+		t.Fatalf("closing ∇: continuation=%v ready=%v pending=%q", m.continuation, m.ready, m.pendingLines)
+	}
+	prompt(3) // drains the closing line
+	prompt(1)
+	if m.continuation || !m.ready || m.lines[len(m.lines)-1].Text != aplIndent {
+		t.Fatalf("after type 1: continuation=%v ready=%v", m.continuation, m.ready)
+	}
+
+	want := []string{"      ∇ r←Dbl y\n", "[1]    r←y+y\n", "[2]  ∇\n"}
+	deadline := time.Now().Add(2 * time.Second)
+	for !reflect.DeepEqual(executed(srv), want) && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got := executed(srv); !reflect.DeepEqual(got, want) {
+		t.Errorf("sent %q, want %q", got, want)
+	}
+}
+
 // TestTUI runs the full TUI test suite
 func TestTUI(t *testing.T) {
 	// Build gritt first
@@ -0,0 +1,351 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss/v2"
+)
+
+// watchesFile holds the watch expressions, per function, in the cache
+// directory.
+const watchesFile = "watches.json"
+
+// sessionWatches is the key for watches added outside the tracer.
+const sessionWatches = "#"
+
+// loadWatches reads the saved watch expressions: function name → watches.
+// A missing or unreadable file gives none.
+func loadWatches(path string) map[string][]string {
+	watches := make(map[string][]string)
+	if path == "" {
+		return watches
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return watches
+	}
+	json.Unmarshal(data, &watches)
+	return watches
+}
+
+// saveWatches writes the watch expressions back, dropping functions
+// without any.
+func saveWatches(path string, watches map[string][]string) error {
+	if path == "" {
+		return fmt.Errorf("cache directory unavailable")
+	}
+	for fn, exprs := range watches {
+		if len(exprs) == 0 {
+			delete(watches, fn)
+		}
+	}
+	data, err := json.MarshalIndent(watches, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// Watch is one watch expression and its last two values.
+type Watch struct {
+	Expr    string
+	Value   string // "" until evaluated
+	Prev    string // Value at the stop before
+	Changed bool   // Value differs from Prev
+}
+
+// WatchPane shows APL expressions re-evaluated each time the tracer stops
+// or moves to another frame. Each function has its own list, kept in the
+// cache directory; outside the tracer the session's list is shown and
+// re-evaluated after each input. Results that changed since the last stop
+// are highlighted.
+//
+// Like the workspace pane it talks to the model through Pending fields:
+// the model evaluates PendingEval and answers with SetValues.
+type WatchPane struct {
+	fn       string // Function whose watches are shown
+	watches  []Watch
+	saved    map[string][]string // All functions' watch expressions
+	seen     map[string]string   // fn + expr → last value, across frames
+	path     string              // Where saved is kept; "" to not persist
+	selected int
+	status   string
+
+	// Adding or editing a watch
+	editing bool
+	editIdx int // -1 for a new watch
+	buf     []rune
+	cursor  int
+
+	PendingEval []string // Expressions to evaluate
+
+	// Styles
+	selectedStyle lipgloss.Style
+	changedStyle  lipgloss.Style
+	noteStyle     lipgloss.Style
+	statusStyle   lipgloss.Style
+}
+
+// NewWatchPane creates a watch pane with the watches saved at path
+func NewWatchPane(path string) *WatchPane {
+	return &WatchPane{
+		saved:         loadWatches(path),
+		seen:          make(map[string]string),
+		path:          path,
+		fn:            "\x00", // so the first SetFunction loads
+		selectedStyle: lipgloss.NewStyle().Background(lipgloss.Color("240")),
+		changedStyle:  lipgloss.NewStyle().Foreground(AccentColor).Bold(true),
+		noteStyle:     lipgloss.NewStyle().Foreground(lipgloss.Color("243")),
+		statusStyle:   lipgloss.NewStyle().Foreground(lipgloss.Color("245")),
+	}
+}
+
+// SetFunction shows fn's watches ("" for the session's).
+func (p *WatchPane) SetFunction(fn string) {
+	if fn == "" {
+		fn = sessionWatches
+	}
+	if fn == p.fn {
+		return
+	}
+	p.fn = fn
+	p.watches = nil
+	for _, e := range p.saved[fn] {
+		p.watches = append(p.watches, Watch{Expr: e, Value: p.seen[fn+"\x00"+e]})
+	}
+	p.selected = 0
+}
+
+// Refresh asks for every watch to be evaluated again
+func (p *WatchPane) Refresh() {
+	p.PendingEval = nil
+	for _, w := range p.watches {
+		p.PendingEval = append(p.PendingEval, w.Expr)
+	}
+}
+
+// SetValues records new values; those that differ from the last ones are
+// marked changed.
+func (p *WatchPane) SetValues(values map[string]string) {
+	for i := range p.watches {
+		w := &p.watches[i]
+		v, ok := values[w.Expr]
+		if !ok {
+			continue
+		}
+		w.Prev = w.Value
+		w.Value = v
+		w.Changed = w.Prev != "" && w.Prev != v
+		p.seen[p.fn+"\x00"+w.Expr] = v
+	}
+}
+
+// exprs lists the shown watches' expressions
+func (p *WatchPane) exprs() []string {
+	var exprs []string
+	for _, w := range p.watches {
+		exprs = append(exprs, w.Expr)
+	}
+	return exprs
+}
+
+// save stores the shown list and writes all lists to the cache
+func (p *WatchPane) save() {
+	p.saved[p.fn] = p.exprs()
+	if p.path == "" {
+		return
+	}
+	if err := saveWatches(p.path, p.saved); err != nil {
+		p.status = "can't save watches: " + err.Error()
+	}
+}
+
+func (p *WatchPane) Title() string {
+	if p.fn == sessionWatches {
+		return fmt.Sprintf("watch (%d)", len(p.watches))
+	}
+	return fmt.Sprintf("watch %s (%d)", p.fn, len(p.watches))
+}
+
+func (p *WatchPane) Render(w, h int) string {
+	listH := h - 1 // Last line: input, status or key help
+	exprW := 0
+	for _, wt := range p.watches {
+		exprW = max(exprW, len([]rune(wt.Expr)))
+	}
+	exprW = min(exprW, w/3)
+
+	var lines []string
+	for i, wt := range p.watches {
+		if len(lines) == listH {
+			break
+		}
+		expr, _ := fitLine(wt.Expr, "", exprW)
+		expr += strings.Repeat(" ", exprW-len([]rune(expr)))
+		value := wt.Value
+		if nl := strings.Index(value, "\n"); nl != -1 {
+			value = value[:nl] + "..."
+		}
+		if value == "" {
+			value = "…"
+		}
+		marker := " "
+		if wt.Changed {
+			marker = "*"
+		}
+		text, _ := fitLine(marker+expr+" = "+value, "", w)
+		pad := strings.Repeat(" ", max(w-len([]rune(text)), 0))
+		switch {
+		case i == p.selected:
+			lines = append(lines, p.selectedStyle.Render(text+pad))
+		case wt.Changed:
+			lines = append(lines, p.changedStyle.Render(text)+pad)
+		default:
+			lines = append(lines, text+pad)
+		}
+	}
+	if len(p.watches) == 0 && listH > 0 {
+		lines = append(lines, p.noteStyle.Render("  (no watches: a to add)"))
+	}
+	for len(lines) < listH {
+		lines = append(lines, strings.Repeat(" ", w))
+	}
+
+	var footer string
+	footerStyle := p.statusStyle
+	switch {
+	case p.editing:
+		footer = "watch: " + string(p.buf[:p.cursor]) + "█" + string(p.buf[p.cursor:])
+		footerStyle = lipgloss.NewStyle()
+	case p.status != "":
+		footer = p.status
+	default:
+		footer = "a add  ⏎ edit  d delete  F5 refresh"
+	}
+	footer, _ = fitLine(footer, "", w)
+	lines = append(lines, footerStyle.Render(footer))
+	return strings.Join(lines, "\n")
+}
+
+func (p *WatchPane) HandleKey(msg tea.KeyMsg) bool {
+	if p.editing {
+		return p.handleEditKey(msg)
+	}
+	p.status = ""
+	switch msg.Type {
+	case tea.KeyUp:
+		if p.selected > 0 {
+			p.selected--
+		}
+		return true
+	case tea.KeyDown:
+		if p.selected < len(p.watches)-1 {
+			p.selected++
+		}
+		return true
+	case tea.KeyHome:
+		p.selected = 0
+		return true
+	case tea.KeyEnd:
+		p.selected = max(len(p.watches)-1, 0)
+		return true
+	case tea.KeyF5:
+		p.Refresh()
+		return true
+	case tea.KeyEnter:
+		if p.selected < len(p.watches) {
+			p.edit(p.selected, p.watches[p.selected].Expr)
+		}
+		return true
+	case tea.KeyDelete:
+		p.remove()
+		return true
+	case tea.KeyRunes:
+		switch string(msg.Runes) {
+		case "a":
+			p.edit(-1, "")
+		case "d":
+			p.remove()
+		}
+		return true
+	}
+	return false
+}
+
+func (p *WatchPane) edit(idx int, text string) {
+	p.editing = true
+	p.editIdx = idx
+	p.buf = []rune(text)
+	p.cursor = len(p.buf)
+}
+
+func (p *WatchPane) remove() {
+	if p.selected >= len(p.watches) {
+		return
+	}
+	p.watches = append(p.watches[:p.selected], p.watches[p.selected+1:]...)
+	if p.selected > 0 && p.selected >= len(p.watches) {
+		p.selected--
+	}
+	p.save()
+}
+
+func (p *WatchPane) handleEditKey(msg tea.KeyMsg) bool {
+	switch msg.Type {
+	case tea.KeyEnter:
+		p.editing = false
+		expr := strings.TrimSpace(string(p.buf))
+		switch {
+		case expr == "":
+		case p.editIdx >= 0 && p.editIdx < len(p.watches):
+			p.watches[p.editIdx] = Watch{Expr: expr}
+		default:
+			p.watches = append(p.watches, Watch{Expr: expr})
+			p.selected = len(p.watches) - 1
+		}
+		if expr != "" {
+			p.save()
+			p.PendingEval = append(p.PendingEval, expr)
+		}
+	case tea.KeyEscape:
+		p.editing = false
+	case tea.KeyBackspace:
+		if p.cursor > 0 {
+			p.buf = append(p.buf[:p.cursor-1], p.buf[p.cursor:]...)
+			p.cursor--
+		}
+	case tea.KeyLeft:
+		if p.cursor > 0 {
+			p.cursor--
+		}
+	case tea.KeyRight:
+		if p.cursor < len(p.buf) {
+			p.cursor++
+		}
+	case tea.KeyHome:
+		p.cursor = 0
+	case tea.KeyEnd:
+		p.cursor = len(p.buf)
+	case tea.KeySpace:
+		p.buf = append(p.buf[:p.cursor], append([]rune{' '}, p.buf[p.cursor:]...)...)
+		p.cursor++
+	case tea.KeyRunes:
+		p.buf = append(p.buf[:p.cursor], append(msg.Runes, p.buf[p.cursor:]...)...)
+		p.cursor += len(msg.Runes)
+	}
+	return true // consume all keys while editing
+}
+
+func (p *WatchPane) HandleMouse(x, y int, msg tea.MouseMsg) bool {
+	if msg.Button == tea.MouseButtonLeft && msg.Action == tea.MouseActionPress {
+		if y >= 0 && y < len(p.watches) {
+			p.selected = y
+		}
+		return true
+	}
+	return false
+}
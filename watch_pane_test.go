@@ -0,0 +1,126 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/cursork/gritt/ride"
+	"github.com/cursork/gritt/ride/ridetest"
+)
+
+func typeWatch(p *WatchPane, expr string) {
+	p.HandleKey(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'a'}})
+	p.HandleKey(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune(expr)})
+	p.HandleKey(tea.KeyMsg{Type: tea.KeyEnter})
+}
+
+func TestWatchPane(t *testing.T) {
+	path := filepath.Join(t.TempDir(), watchesFile)
+	p := NewWatchPane(path)
+	p.SetFunction("f")
+	typeWatch(p, "⍴data")
+	typeWatch(p, "+/totals")
+	if !reflect.DeepEqual(p.PendingEval, []string{"⍴data", "+/totals"}) {
+		t.Fatalf("PendingEval = %q", p.PendingEval)
+	}
+	p.SetValues(map[string]string{"⍴data": "3", "+/totals": "10"})
+	p.Refresh()
+	p.SetValues(map[string]string{"⍴data": "3", "+/totals": "12"})
+	if p.watches[0].Changed || !p.watches[1].Changed {
+		t.Errorf("changed: %+v", p.watches)
+	}
+	out := stripANSI(p.Render(40, 5))
+	for _, want := range []string{" ⍴data    = 3", "*+/totals = 12", "a add"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("render lacks %q:\n%s", want, out)
+		}
+	}
+
+	// Each function has its own list; values seen come back with it
+	p.SetFunction("g")
+	if len(p.watches) != 0 || p.Title() != "watch g (0)" {
+		t.Errorf("g: %d watches, title %q", len(p.watches), p.Title())
+	}
+	p.SetFunction("f")
+	if p.watches[1].Value != "12" {
+		t.Errorf("f's +/totals = %q", p.watches[1].Value)
+	}
+
+	// Delete, then edit the rest; both persist
+	p.HandleKey(tea.KeyMsg{Type: tea.KeyDown})
+	p.HandleKey(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'d'}})
+	p.HandleKey(tea.KeyMsg{Type: tea.KeyEnter})
+	p.HandleKey(tea.KeyMsg{Type: tea.KeyBackspace})
+	p.HandleKey(tea.KeyMsg{Type: tea.KeyBackspace})
+	p.HandleKey(tea.KeyMsg{Type: tea.KeyBackspace})
+	p.HandleKey(tea.KeyMsg{Type: tea.KeyBackspace})
+	p.HandleKey(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("ns.config.timeout")})
+	p.HandleKey(tea.KeyMsg{Type: tea.KeyHome})
+	p.HandleKey(tea.KeyMsg{Type: tea.KeyEnter})
+	if got := loadWatches(path); !reflect.DeepEqual(got, map[string][]string{"f": {"⍴ns.config.timeout"}}) {
+		t.Errorf("saved %v", got)
+	}
+
+	// Escape abandons an edit
+	p.HandleKey(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'a'}})
+	p.HandleKey(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("x")})
+	p.HandleKey(tea.KeyMsg{Type: tea.KeyEscape})
+	if len(p.watches) != 1 {
+		t.Errorf("after Esc: %+v", p.watches)
+	}
+}
+
+func TestWatchPaneModel(t *testing.T) {
+	client, srv := fakeInterpreter(t, func(*ride.Message) []*ride.Message { return nil })
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	m := newTestModel(t, client)
+
+	m.toggleWatchPane()
+	wp := m.panes.Get("watch").Content.(*WatchPane)
+	m.update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'a'}})
+	m.update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("⍴y")})
+	m.update(tea.KeyMsg{Type: tea.KeyEnter})
+	if !strings.Contains(m.internalQuery, "⎕EA'⍴y'") {
+		t.Fatalf("query = %q", m.internalQuery)
+	}
+	m.recv(ridetest.Prompt(0))
+	m.recv(ridetest.Output(2, "⍝GRITT 0\n0\n"))
+	m.recv(ridetest.Prompt(1))
+	if wp.watches[0].Value != "0" || wp.Title() != "watch (1)" {
+		t.Fatalf("session watch: %+v, %q", wp.watches, wp.Title())
+	}
+
+	// The tracer switches to the function's own list, and each stop
+	// re-evaluates it
+	wp.saved["f"] = []string{"y"}
+	m.recv(ridetest.Prompt(0))
+	m.recv(&ride.Message{Command: "OpenWindow", Args: map[string]any{
+		"token": 1, "name": "f", "debugger": 1, "text": []string{"r←f y", "r←1+y"}, "currentRow": 1,
+	}})
+	if wp.fn != "f" || !reflect.DeepEqual(wp.PendingEval, []string{"y"}) {
+		t.Fatalf("tracer: fn %q, pending %q", wp.fn, wp.PendingEval)
+	}
+	m.recv(ridetest.Prompt(1))
+	m.recv(ridetest.Prompt(0))
+	m.recv(ridetest.Output(2, "⍝GRITT 0\n1 2\n"))
+	m.recv(ridetest.Prompt(1))
+	if wp.watches[0].Value != "1 2" {
+		t.Errorf("f's y = %q", wp.watches[0].Value)
+	}
+
+	// Esc while adding cancels the add rather than closing the pane
+	m.panes.Focus("watch")
+	m.update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'a'}})
+	m.update(tea.KeyMsg{Type: tea.KeyEscape})
+	if m.panes.Get("watch") == nil || wp.editing {
+		t.Errorf("Esc while adding: pane %v, editing %v", m.panes.Get("watch"), wp.editing)
+	}
+	waitReceived(srv, 2)
+	if texts := executed(srv); len(texts) != 2 {
+		t.Errorf("executed %q", texts)
+	}
+}
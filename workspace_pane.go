@@ -0,0 +1,569 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss/v2"
+	"github.com/cursork/gritt/syntax"
+)
+
+// WorkspaceEntry is one name in a namespace, as reported by ⎕NL and ⎕NC
+type WorkspaceEntry struct {
+	Name  string
+	Class float64 // Extended name class: 2.1 variable, 3.1 tradfn, 9.1 namespace...
+}
+
+// parseWorkspaceEntries parses "name class" lines, one per name. Lines
+// starting with ⍝ are linked namespaces: "⍝ #.ns directory". Anything else
+// (blank lines, echoed results) is ignored.
+func parseWorkspaceEntries(outputs []string) (entries []WorkspaceEntry, links [][2]string, errs []string) {
+	for _, output := range outputs {
+		for _, line := range strings.Split(output, "\n") {
+			line = strings.TrimSpace(line)
+			if msg, ok := strings.CutPrefix(line, "⍝! "); ok {
+				errs = append(errs, msg)
+				continue
+			}
+			if rest, ok := strings.CutPrefix(line, "⍝"); ok {
+				ns, dir, _ := strings.Cut(strings.TrimSpace(rest), " ")
+				if ns != "" {
+					links = append(links, [2]string{ns, strings.TrimSpace(dir)})
+				}
+				continue
+			}
+			fields := strings.Fields(line)
+			if len(fields) != 2 {
+				continue
+			}
+			class, err := strconv.ParseFloat(fields[1], 64)
+			if err != nil {
+				continue
+			}
+			entries = append(entries, WorkspaceEntry{Name: fields[0], Class: class})
+		}
+	}
+	return entries, links, errs
+}
+
+// workspaceListExpr lists the names in namespace ns as "name class" lines.
+// The guard covers a namespace that has gone away since it was displayed.
+func workspaceListExpr(ns string) string {
+	return fmt.Sprintf("{0::⍬ ⋄ n←%s.⎕NL ¯2 ¯3 ¯4 ¯9 ⋄ 0=≢n:⍬ ⋄ _←{⎕←⍵}¨n,¨' ',¨⍕¨%s.⎕NC n}⍬", ns, ns)
+}
+
+// workspaceDeleteExpr expunges path, ahead of re-listing its namespace.
+// A failure shows as a "⍝! message" line rather than stopping the listing.
+func workspaceDeleteExpr(path string) string {
+	ns, name := parentPath(path), path[len(parentPath(path))+1:]
+	return fmt.Sprintf("{}{0::⎕←'⍝! ',⊃⎕DM ⋄ 0=%s.⎕EX'%s':⎕←'⍝! can''t expunge %s' ⋄ ⍬}⍬ ⋄ ", ns, name, name)
+}
+
+// workspaceRenameExpr renames path to newName, ahead of re-listing its
+// namespace, by assignment: only for arrays and the functions and
+// operators that are values (see isRenamable). It won't overwrite a name
+// that exists; failures show as for workspaceDeleteExpr.
+func workspaceRenameExpr(path, newName string) string {
+	ns, name := parentPath(path), path[len(parentPath(path))+1:]
+	return fmt.Sprintf("{}{0::⎕←'⍝! ',⊃⎕DM ⋄ 0≠%s.⎕NC⊂'%s':⎕←'⍝! %s already exists' ⋄ %s⍎'%s←%s' ⋄ %s.⎕EX'%s'}⍬ ⋄ ",
+		ns, newName, newName, ns, newName, name, ns, name)
+}
+
+// workspaceLinksExpr lists linked namespaces as "⍝ ns directory" lines,
+// printing nothing if Link isn't loaded.
+const workspaceLinksExpr = "{0::⍬ ⋄ _←{⎕←'⍝ ',(⍕⍵.ns),' ',⍕⍵.dir}¨⎕SE.Link.Links}⍬"
+
+// classGlyph returns the symbol shown beside a name of the given class
+func classGlyph(class float64) string {
+	switch {
+	case class >= 2 && class < 3:
+		return "⍴" // variable, field, property
+	case class >= 3 && class < 4:
+		return "∇" // function
+	case class >= 4 && class < 5:
+		return "∘" // operator
+	case class == 9.1:
+		return "#" // namespace
+	case class == 9.2:
+		return "●" // instance
+	case class == 9.5:
+		return "◇" // interface
+	case class >= 9 && class < 10:
+		return "○" // class
+	}
+	return "?"
+}
+
+// isRenamable reports whether names of this class can be renamed by
+// assignment without loss: arrays, dfns, derived functions and dops. A
+// tradfn or tradop would become a copy whose header names the old name.
+func isRenamable(class float64) bool {
+	return class >= 2 && class < 3 || class == 3.2 || class == 3.3 || class == 4.2
+}
+
+// isNamespaceClass reports whether names of this class can be expanded
+func isNamespaceClass(class float64) bool {
+	return class >= 9 && class < 10
+}
+
+// wsNode is one name in the workspace tree
+type wsNode struct {
+	path     string // Fully qualified: #.utils.Sort
+	name     string // Displayed name
+	class    float64
+	note     string // Extra detail, e.g. a linked directory
+	depth    int
+	expanded bool
+	loaded   bool
+	loading  bool
+	children []*wsNode
+}
+
+// WorkspacePane shows a tree of namespaces and the names in them. It
+// talks to the interpreter through the Pending fields, which the model
+// services when idle, answering listings with SetEntries.
+type WorkspacePane struct {
+	roots    []*wsNode
+	selected int
+	scroll   int
+	status   string
+
+	PendingList   []string  // Namespaces waiting to be listed
+	PendingOpen   string    // Name to open in an editor
+	PendingDelete string    // Name to expunge
+	PendingRename [2]string // Name and its new name
+
+	renaming      bool
+	renameBuf     []rune
+	renameCursor  int
+	confirmDelete bool
+
+	// Styles
+	selectedStyle lipgloss.Style
+	glyphStyle    lipgloss.Style
+	noteStyle     lipgloss.Style
+	statusStyle   lipgloss.Style
+}
+
+// NewWorkspacePane creates a workspace pane with # and ⎕SE as roots
+func NewWorkspacePane() *WorkspacePane {
+	return &WorkspacePane{
+		roots: []*wsNode{
+			{path: "#", name: "#", class: 9.1},
+			{path: "⎕SE", name: "⎕SE", class: 9.1},
+		},
+		selectedStyle: lipgloss.NewStyle().Background(lipgloss.Color("240")),
+		glyphStyle:    lipgloss.NewStyle().Foreground(AccentColor),
+		noteStyle:     lipgloss.NewStyle().Foreground(lipgloss.Color("245")),
+		statusStyle:   lipgloss.NewStyle().Foreground(lipgloss.Color("245")),
+	}
+}
+
+func (p *WorkspacePane) Title() string {
+	return "workspace"
+}
+
+// AddLink adds a linked namespace as an extra root, unless already a root
+func (p *WorkspacePane) AddLink(ns, dir string) {
+	for _, r := range p.roots {
+		if r.path == ns {
+			r.note = dir
+			return
+		}
+	}
+	p.roots = append(p.roots, &wsNode{path: ns, name: ns, class: 9.1, note: dir})
+}
+
+// Expand lists and expands the namespace at path, if it is displayed
+func (p *WorkspacePane) Expand(path string) {
+	if n := p.find(path); n != nil {
+		p.expand(n)
+	}
+}
+
+// SetEntries fills in the children of path, keeping the expansion state of
+// namespaces that are still there.
+func (p *WorkspacePane) SetEntries(path string, entries []WorkspaceEntry) {
+	for _, n := range p.findAll(path) {
+		p.setEntries(n, entries)
+	}
+	p.status = ""
+	p.clamp()
+}
+
+// SetError shows why a delete or rename failed.
+func (p *WorkspacePane) SetError(msg string) {
+	p.status = msg
+}
+
+func (p *WorkspacePane) setEntries(n *wsNode, entries []WorkspaceEntry) {
+	old := make(map[string]*wsNode, len(n.children))
+	for _, c := range n.children {
+		old[c.name] = c
+	}
+	n.children = nil
+	for _, e := range entries {
+		child := &wsNode{
+			path:  n.path + "." + e.Name,
+			name:  e.Name,
+			class: e.Class,
+			depth: n.depth + 1,
+		}
+		if prev, ok := old[e.Name]; ok && prev.class == e.Class {
+			child = prev
+		}
+		n.children = append(n.children, child)
+	}
+	n.loaded = true
+	n.loading = false
+}
+
+// Reload re-lists the namespace at path if it has been listed before
+func (p *WorkspacePane) Reload(path string) {
+	for _, n := range p.findAll(path) {
+		if n.loaded {
+			n.loaded = false
+			p.expand(n)
+		}
+	}
+}
+
+// ReloadExpanded re-lists every expanded namespace, e.g. after the user has
+// run code that may have defined or erased names.
+func (p *WorkspacePane) ReloadExpanded() {
+	for _, n := range p.visible() {
+		if n.expanded && n.loaded {
+			p.Reload(n.path)
+		}
+	}
+}
+
+func (p *WorkspacePane) expand(n *wsNode) {
+	n.expanded = true
+	if n.loaded || n.loading {
+		return
+	}
+	n.loading = true
+	if !slices.Contains(p.PendingList, n.path) {
+		p.PendingList = append(p.PendingList, n.path)
+	}
+}
+
+// find returns the first node with the given path
+func (p *WorkspacePane) find(path string) *wsNode {
+	if nodes := p.findAll(path); len(nodes) > 0 {
+		return nodes[0]
+	}
+	return nil
+}
+
+// findAll returns every node with the given path, searching loaded
+// namespaces. A linked namespace can appear both as a root and inside #.
+func (p *WorkspacePane) findAll(path string) []*wsNode {
+	var found []*wsNode
+	var walk func(nodes []*wsNode)
+	walk = func(nodes []*wsNode) {
+		for _, n := range nodes {
+			if n.path == path {
+				found = append(found, n)
+			} else if strings.HasPrefix(path, n.path+".") {
+				walk(n.children)
+			}
+		}
+	}
+	walk(p.roots)
+	return found
+}
+
+// visible returns the nodes currently shown, in display order
+func (p *WorkspacePane) visible() []*wsNode {
+	var out []*wsNode
+	var walk func(nodes []*wsNode)
+	walk = func(nodes []*wsNode) {
+		for _, n := range nodes {
+			out = append(out, n)
+			if n.expanded {
+				walk(n.children)
+			}
+		}
+	}
+	walk(p.roots)
+	return out
+}
+
+func (p *WorkspacePane) clamp() {
+	n := len(p.visible())
+	if p.selected >= n {
+		p.selected = n - 1
+	}
+	if p.selected < 0 {
+		p.selected = 0
+	}
+}
+
+// isValidName reports whether s is a plain APL name
+func isValidName(s string) bool {
+	for i, r := range []rune(s) {
+		if !syntax.IsNameRune(r) || i == 0 && r >= '0' && r <= '9' {
+			return false
+		}
+	}
+	return s != ""
+}
+
+// sameEntity reports whether an editor window's name is the workspace
+// path that was opened; the interpreter may give it unqualified.
+func sameEntity(path, name string) bool {
+	return name == path || strings.HasSuffix(path, "."+name)
+}
+
+// parentPath returns the namespace containing path
+func parentPath(path string) string {
+	if i := strings.LastIndex(path, "."); i > 0 {
+		return path[:i]
+	}
+	return ""
+}
+
+func (p *WorkspacePane) Render(w, h int) string {
+	nodes := p.visible()
+	listH := h - 1 // Last line: status, prompt or key help
+
+	if p.selected < p.scroll {
+		p.scroll = p.selected
+	}
+	if p.selected >= p.scroll+listH {
+		p.scroll = p.selected - listH + 1
+	}
+
+	var lines []string
+	for i := p.scroll; i < len(nodes) && len(lines) < listH; i++ {
+		n := nodes[i]
+		marker := " "
+		if isNamespaceClass(n.class) {
+			marker = "▸"
+			if n.expanded {
+				marker = "▾"
+			}
+		}
+		text := strings.Repeat("  ", n.depth) + marker + " " + n.name
+		if n.loading {
+			text += " …"
+		}
+		note := ""
+		if n.note != "" {
+			note = " → " + n.note
+		}
+		// 2 columns for the glyph and its space
+		text, note = fitLine(text, note, w-2)
+		pad := strings.Repeat(" ", max(w-2-len([]rune(text))-len([]rune(note)), 0))
+
+		line := p.glyphStyle.Render(classGlyph(n.class)) + " "
+		if i == p.selected {
+			line += p.selectedStyle.Render(text + note + pad)
+		} else {
+			line += text + p.noteStyle.Render(note) + pad
+		}
+		lines = append(lines, line)
+	}
+	for len(lines) < listH {
+		lines = append(lines, strings.Repeat(" ", w))
+	}
+
+	var footer string
+	footerStyle := p.statusStyle
+	switch {
+	case p.renaming:
+		footer = "rename to: " + string(p.renameBuf[:p.renameCursor]) + "█" + string(p.renameBuf[p.renameCursor:])
+		footerStyle = lipgloss.NewStyle()
+	case p.confirmDelete:
+		if n := p.selectedNode(); n != nil {
+			footer = "delete " + n.path + "? (y/n)"
+			footerStyle = lipgloss.NewStyle()
+		}
+	case p.status != "":
+		footer = p.status
+	default:
+		footer = "⏎ open  d delete  r rename  F5 refresh"
+	}
+	footer, _ = fitLine(footer, "", w)
+	lines = append(lines, footerStyle.Render(footer))
+	return strings.Join(lines, "\n")
+}
+
+// fitLine truncates text then note so that together they fit in w runes
+func fitLine(text, note string, w int) (string, string) {
+	tr, nr := []rune(text), []rune(note)
+	if len(tr) > w {
+		return string(tr[:max(w, 0)]), ""
+	}
+	if len(tr)+len(nr) > w {
+		nr = nr[:w-len(tr)]
+	}
+	return string(tr), string(nr)
+}
+
+func (p *WorkspacePane) selectedNode() *wsNode {
+	nodes := p.visible()
+	if p.selected >= 0 && p.selected < len(nodes) {
+		return nodes[p.selected]
+	}
+	return nil
+}
+
+func (p *WorkspacePane) HandleKey(msg tea.KeyMsg) bool {
+	if p.renaming {
+		return p.handleRenameKey(msg)
+	}
+	if p.confirmDelete {
+		p.confirmDelete = false
+		if n := p.selectedNode(); n != nil && msg.String() == "y" {
+			p.PendingDelete = n.path
+		}
+		return true
+	}
+
+	n := p.selectedNode()
+	if n == nil {
+		return false
+	}
+	p.status = ""
+
+	switch msg.Type {
+	case tea.KeyUp:
+		if p.selected > 0 {
+			p.selected--
+		}
+		return true
+	case tea.KeyDown:
+		if p.selected < len(p.visible())-1 {
+			p.selected++
+		}
+		return true
+	case tea.KeyHome:
+		p.selected = 0
+		return true
+	case tea.KeyEnd:
+		p.selected = len(p.visible()) - 1
+		return true
+	case tea.KeyRight:
+		if isNamespaceClass(n.class) {
+			p.expand(n)
+		}
+		return true
+	case tea.KeyLeft:
+		if n.expanded {
+			n.expanded = false
+		} else {
+			// Move to the enclosing namespace
+			nodes := p.visible()
+			for i := p.selected - 1; i >= 0; i-- {
+				if nodes[i].depth < n.depth {
+					p.selected = i
+					break
+				}
+			}
+		}
+		return true
+	case tea.KeyEnter:
+		if isNamespaceClass(n.class) {
+			if n.expanded {
+				n.expanded = false
+			} else {
+				p.expand(n)
+			}
+		} else {
+			p.PendingOpen = n.path
+		}
+		return true
+	case tea.KeyF5:
+		target := n
+		if !isNamespaceClass(n.class) || !n.expanded {
+			target = p.find(parentPath(n.path))
+		}
+		if target != nil {
+			p.Reload(target.path)
+		}
+		return true
+	case tea.KeyRunes:
+		if n.depth == 0 {
+			return true // roots can't be renamed or deleted here
+		}
+		switch string(msg.Runes) {
+		case "d":
+			p.confirmDelete = true
+		case "r":
+			if !isRenamable(n.class) {
+				p.status = "only arrays and dfns can be renamed here"
+				break
+			}
+			p.renaming = true
+			p.renameBuf = []rune(n.name)
+			p.renameCursor = len(p.renameBuf)
+		case "e":
+			p.PendingOpen = n.path
+		}
+		return true
+	}
+	return false
+}
+
+func (p *WorkspacePane) handleRenameKey(msg tea.KeyMsg) bool {
+	switch msg.Type {
+	case tea.KeyEnter:
+		p.renaming = false
+		newName := strings.TrimSpace(string(p.renameBuf))
+		n := p.selectedNode()
+		switch {
+		case n == nil || newName == "" || newName == n.name:
+		case !isValidName(newName):
+			p.status = "invalid name: " + newName
+		default:
+			p.PendingRename = [2]string{n.path, newName}
+		}
+	case tea.KeyEscape:
+		p.renaming = false
+	case tea.KeyBackspace:
+		if p.renameCursor > 0 {
+			p.renameBuf = append(p.renameBuf[:p.renameCursor-1], p.renameBuf[p.renameCursor:]...)
+			p.renameCursor--
+		}
+	case tea.KeyLeft:
+		if p.renameCursor > 0 {
+			p.renameCursor--
+		}
+	case tea.KeyRight:
+		if p.renameCursor < len(p.renameBuf) {
+			p.renameCursor++
+		}
+	case tea.KeyRunes:
+		p.renameBuf = append(p.renameBuf[:p.renameCursor], append(msg.Runes, p.renameBuf[p.renameCursor:]...)...)
+		p.renameCursor += len(msg.Runes)
+	}
+	return true // consume all keys while renaming
+}
+
+func (p *WorkspacePane) HandleMouse(x, y int, msg tea.MouseMsg) bool {
+	if msg.Button == tea.MouseButtonWheelUp {
+		if p.selected > 0 {
+			p.selected--
+		}
+		return true
+	}
+	if msg.Button == tea.MouseButtonWheelDown {
+		if p.selected < len(p.visible())-1 {
+			p.selected++
+		}
+		return true
+	}
+	if msg.Button == tea.MouseButtonLeft && msg.Action == tea.MouseActionPress {
+		if idx := p.scroll + y; idx >= 0 && idx < len(p.visible()) {
+			p.selected = idx
+		}
+		return true
+	}
+	return false
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+func TestParseWorkspaceEntries(t *testing.T) {
+	outputs := []string{
+		"⍝ #.app /home/me/app\n",
+		"foo 3.1\n",
+		"\n",
+		"ns 9.1\nx 2.1\n",
+		"not a listing line\n",
+		"⍝! fox already exists\n",
+	}
+	entries, links, errs := parseWorkspaceEntries(outputs)
+	want := []WorkspaceEntry{{"foo", 3.1}, {"ns", 9.1}, {"x", 2.1}}
+	if !reflect.DeepEqual(entries, want) {
+		t.Errorf("entries = %v, want %v", entries, want)
+	}
+	if len(links) != 1 || links[0] != [2]string{"#.app", "/home/me/app"} {
+		t.Errorf("links = %v", links)
+	}
+	if !reflect.DeepEqual(errs, []string{"fox already exists"}) {
+		t.Errorf("errs = %q", errs)
+	}
+}
+
+func TestWorkspaceEditExprs(t *testing.T) {
+	if got, want := workspaceDeleteExpr("#.ns.foo"), "{}{0::⎕←'⍝! ',⊃⎕DM ⋄ 0=#.ns.⎕EX'foo':⎕←'⍝! can''t expunge foo' ⋄ ⍬}⍬ ⋄ "; got != want {
+		t.Errorf("workspaceDeleteExpr = %s", got)
+	}
+	if got, want := workspaceRenameExpr("#.foo", "fox"), "{}{0::⎕←'⍝! ',⊃⎕DM ⋄ 0≠#.⎕NC⊂'fox':⎕←'⍝! fox already exists' ⋄ #⍎'fox←foo' ⋄ #.⎕EX'foo'}⍬ ⋄ "; got != want {
+		t.Errorf("workspaceRenameExpr = %s", got)
+	}
+	if !sameEntity("#.ns.bar", "bar") || !sameEntity("#.ns.bar", "#.ns.bar") || sameEntity("#.ns.bar", "ar") {
+		t.Error("sameEntity")
+	}
+}
+
+func TestWorkspacePaneTree(t *testing.T) {
+	p := NewWorkspacePane()
+	p.Expand("#")
+	if !reflect.DeepEqual(p.PendingList, []string{"#"}) {
+		t.Fatalf("PendingList = %v, want [#]", p.PendingList)
+	}
+	p.PendingList = nil
+	p.SetEntries("#", []WorkspaceEntry{{"foo", 3.1}, {"ns", 9.1}, {"x", 2.1}})
+
+	out := stripANSI(p.Render(30, 8))
+	for _, want := range []string{"▾ #", "∇     foo", "#   ▸ ns", "⍴     x", "▸ ⎕SE"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("render missing %q:\n%s", want, out)
+		}
+	}
+
+	// Select ns and expand it
+	p.HandleKey(tea.KeyMsg{Type: tea.KeyDown})
+	p.HandleKey(tea.KeyMsg{Type: tea.KeyDown})
+	p.HandleKey(tea.KeyMsg{Type: tea.KeyRight})
+	if !reflect.DeepEqual(p.PendingList, []string{"#.ns"}) {
+		t.Fatalf("PendingList = %v, want [#.ns]", p.PendingList)
+	}
+	p.PendingList = nil
+	p.SetEntries("#.ns", []WorkspaceEntry{{"bar", 2.1}})
+
+	// Open the array inside it
+	p.HandleKey(tea.KeyMsg{Type: tea.KeyDown})
+	p.HandleKey(tea.KeyMsg{Type: tea.KeyEnter})
+	if p.PendingOpen != "#.ns.bar" {
+		t.Errorf("PendingOpen = %q, want #.ns.bar", p.PendingOpen)
+	}
+
+	// Left from a leaf goes to its namespace; again collapses it
+	p.HandleKey(tea.KeyMsg{Type: tea.KeyLeft})
+	if n := p.selectedNode(); n == nil || n.path != "#.ns" {
+		t.Fatalf("selected = %v, want #.ns", n)
+	}
+	p.HandleKey(tea.KeyMsg{Type: tea.KeyLeft})
+	if strings.Contains(stripANSI(p.Render(30, 8)), "bar") {
+		t.Error("collapsed namespace still shows its children")
+	}
+
+	// Re-listing keeps the expansion state of surviving namespaces
+	p.HandleKey(tea.KeyMsg{Type: tea.KeyRight})
+	p.SetEntries("#", []WorkspaceEntry{{"ns", 9.1}})
+	if n := p.find("#.ns"); n == nil || !n.expanded || len(n.children) != 1 {
+		t.Errorf("#.ns lost its state on re-list: %+v", n)
+	}
+}
+
+func TestWorkspacePaneRenameDelete(t *testing.T) {
+	p := NewWorkspacePane()
+	p.Expand("#")
+	p.SetEntries("#", []WorkspaceEntry{{"foo", 3.2}, {"trad", 3.1}})
+	p.HandleKey(tea.KeyMsg{Type: tea.KeyDown})
+
+	// Delete needs confirmation
+	p.HandleKey(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("d")})
+	p.HandleKey(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("n")})
+	if p.PendingDelete != "" {
+		t.Errorf("delete without confirmation: %q", p.PendingDelete)
+	}
+	p.HandleKey(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("d")})
+	p.HandleKey(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("y")})
+	if p.PendingDelete != "#.foo" {
+		t.Errorf("PendingDelete = %q, want #.foo", p.PendingDelete)
+	}
+
+	p.HandleKey(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("r")})
+	p.HandleKey(tea.KeyMsg{Type: tea.KeyBackspace})
+	p.HandleKey(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("x")})
+	p.HandleKey(tea.KeyMsg{Type: tea.KeyEnter})
+	if p.PendingRename != [2]string{"#.foo", "fox"} {
+		t.Errorf("PendingRename = %v", p.PendingRename)
+	}
+
+	p.PendingRename = [2]string{}
+	p.HandleKey(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("r")})
+	p.HandleKey(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("+")})
+	p.HandleKey(tea.KeyMsg{Type: tea.KeyEnter})
+	if p.PendingRename != [2]string{} || !strings.Contains(p.status, "invalid") {
+		t.Errorf("invalid name accepted: %v, status %q", p.PendingRename, p.status)
+	}
+
+	// A tradfn would keep its old name in its header
+	p.HandleKey(tea.KeyMsg{Type: tea.KeyDown})
+	p.HandleKey(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("r")})
+	if p.renaming || !strings.Contains(p.status, "only arrays") {
+		t.Errorf("tradfn rename started: status %q", p.status)
+	}
+
+	// A failure reported by the interpreter outlasts the re-listing
+	p.SetEntries("#", []WorkspaceEntry{{"foo", 3.2}, {"trad", 3.1}})
+	p.SetError("fox already exists")
+	if !strings.Contains(stripANSI(p.Render(30, 8)), "fox already exists") {
+		t.Error("error not shown")
+	}
+}
+
+func TestWorkspacePaneLinks(t *testing.T) {
+	p := NewWorkspacePane()
+	p.Expand("#")
+	p.SetEntries("#", []WorkspaceEntry{{"app", 9.1}})
+	p.AddLink("#.app", "/src/app")
+
+	// Listing a linked namespace fills both its root and its place in #
+	p.find("#.app").expanded = true
+	p.SetEntries("#.app", []WorkspaceEntry{{"Main", 3.1}})
+	if got := len(p.findAll("#.app.Main")); got != 2 {
+		t.Errorf("found #.app.Main %d times, want 2", got)
+	}
+	if !strings.Contains(stripANSI(p.Render(40, 10)), "→ /src/app") {
+		t.Error("linked root should show its directory")
+	}
+}